@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+// accessionPrefix marks a --reference that is an accession to fetch, e.g.
+// accession:NC_045512.2
+const accessionPrefix = "accession:"
+
+// cacheDirEnv is the environment variable that can say where fetched references are
+// cached, instead of the user's cache directory
+const cacheDirEnv = "SNPS_CACHE_DIR"
+
+// accessionURLs are tried in turn to fetch an accession in fasta format, NCBI first and
+// then ENA. %s is the accession
+var accessionURLs = []string{
+	"https://eutils.ncbi.nlm.nih.gov/entrez/eutils/efetch.fcgi?db=nuccore&rettype=fasta&retmode=text&id=%s",
+	"https://www.ebi.ac.uk/ena/browser/api/fasta/%s",
+}
+
+var accessionRegex = regexp.MustCompile(`^[A-Za-z0-9_.]+$`)
+
+var accessionClient = &http.Client{Timeout: 2 * time.Minute}
+
+// openAccession opens the sequence of an accession in fasta format, from the cache if
+// it has been fetched before, or else by downloading it and caching it
+func openAccession(accession string) (io.ReadCloser, error) {
+	if !accessionRegex.MatchString(accession) {
+		return nil, usage("bad accession: " + accession)
+	}
+
+	dir, err := referenceCacheDir()
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, accession+".fasta")
+
+	f, err := os.Open(path)
+	if err == nil {
+		return f, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	errs := make([]error, 0, len(accessionURLs))
+	for _, url := range accessionURLs {
+		err = fetchAccession(fmt.Sprintf(url, accession), path)
+		if err == nil {
+			return os.Open(path)
+		}
+		errs = append(errs, err)
+	}
+	return nil, ioError{fmt.Errorf("couldn't fetch %s: %v", accession, errs)}
+}
+
+// referenceCacheDir returns the directory that fetched references are cached in
+func referenceCacheDir() (string, error) {
+	if dir := os.Getenv(cacheDirEnv); dir != "" {
+		return dir, nil
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("no cache directory for fetched references, set $%s: %w", cacheDirEnv, err)
+	}
+	return filepath.Join(dir, "snps", "references"), nil
+}
+
+// fetchAccession downloads url to path. It is written to a temporary file first and
+// then moved, so that a failed download never leaves a partial reference in the cache
+func fetchAccession(url string, path string) error {
+	resp, err := accessionClient.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.New(url + ": " + resp.Status)
+	}
+
+	// services answer unknown accessions with an empty body or an error page
+	body := bufio.NewReader(resp.Body)
+	first, err := body.Peek(1)
+	if err != nil || first[0] != '>' {
+		return errors.New(url + ": response isn't fasta")
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(tmp, body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
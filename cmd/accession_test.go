@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestOpenAccession(t *testing.T) {
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path == "/MN908947.3" {
+			fmt.Fprint(w, ">MN908947.3 Severe acute respiratory syndrome coronavirus 2\nATTAAAGG\n")
+		}
+	}))
+	defer ts.Close()
+
+	urls := accessionURLs
+	accessionURLs = []string{ts.URL + "/%s"}
+	defer func() { accessionURLs = urls }()
+
+	os.Setenv(cacheDirEnv, t.TempDir())
+	defer os.Unsetenv(cacheDirEnv)
+
+	// the second time, it comes from the cache
+	for i := 0; i < 2; i++ {
+		refIn, err := openReference(accessionPrefix+"MN908947.3", "", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := io.ReadAll(refIn)
+		refIn.Close()
+		if err != nil {
+			t.Error(err)
+		}
+		if string(b) != ">MN908947.3 Severe acute respiratory syndrome coronavirus 2\nATTAAAGG\n" {
+			t.Errorf("problem in TestOpenAccession(): got %q", string(b))
+		}
+	}
+	if requests != 1 {
+		t.Errorf("problem in TestOpenAccession(): expected 1 request, got %d", requests)
+	}
+
+	_, err := openReference(accessionPrefix+"XX000000.1", "", "")
+	if err == nil {
+		t.Errorf("problem in TestOpenAccession(): unknown accession was accepted")
+	}
+	_, err = openReference(accessionPrefix+"../x", "", "")
+	if err == nil {
+		t.Errorf("problem in TestOpenAccession(): bad accession was accepted")
+	}
+}
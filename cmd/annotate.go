@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"strings"
+
+	"github.com/benjamincjackson/snps/pkg/snps"
+	"github.com/spf13/cobra"
+)
+
+var annotateInfile string
+var annotateOutfile string
+var annotateReference string
+var annotateRefSeq string
+var annotateGFF string
+var annotatePreset string
+
+func init() {
+	rootCmd.AddCommand(annotateCmd)
+
+	annotateCmd.Flags().StringVarP(&annotateInfile, "infile", "i", "stdin", "Output of an earlier run, in csv format. Can also be given as an argument")
+	annotateCmd.Flags().StringVarP(&annotateOutfile, "outfile", "o", "stdout", "Annotated output to write")
+	annotateCmd.Flags().StringVarP(&annotateReference, "reference", "r", "", "Reference sequence that the earlier run compared with, in fasta or GenBank format")
+	annotateCmd.Flags().StringVarP(&annotateRefSeq, "ref-seq", "", "", "Reference sequence itself, instead of a file")
+	annotateCmd.Flags().StringVarP(&annotateGFF, "gff", "", "", "Annotation of the reference in GFF3 format")
+	annotateCmd.Flags().StringVarP(&annotatePreset, "preset", "", "", "Use a built-in reference and annotation, one of: "+strings.Join(presetNames(), ", ")+". --reference and --gff take precedence over the preset")
+
+	annotateCmd.Flags().SortFlags = false
+}
+
+var annotateCmd = &cobra.Command{
+	Use:   "annotate [results.csv]",
+	Short: "Annotate the output of an earlier run",
+	Long: `Add the amino acid consequence, codon position and effect (synonymous, missense,
+nonsense or stop_lost) of each snp to the per-query csv output of an earlier run,
+without comparing the alignment again. Each query's codons are rebuilt from the
+reference and its snps, so a codon with an ambiguity code or missing data that wasn't
+in the output is translated as if it had the reference's bases there.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+
+		if len(args) == 1 {
+			if cmd.Flags().Changed("infile") {
+				return usage("give the input as an argument or with --infile, not both")
+			}
+			annotateInfile = args[0]
+		}
+
+		refSeq, err := readReference(annotateReference, annotatePreset, annotateRefSeq, false, false, false)
+		if err != nil {
+			return err
+		}
+		regions, err := readAnnotation(annotateGFF, annotatePreset, annotateReference)
+		if err != nil {
+			return err
+		}
+		if regions == nil {
+			return usage("snps annotate needs --gff, --preset or a GenBank --reference")
+		}
+
+		in, err := openIn(annotateInfile)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+
+		cr, err := snps.NewCSVReader(in)
+		if err != nil {
+			return err
+		}
+		if cr.WriterOptions().Contigs {
+			return usage("can't annotate output from a reference made up of contigs")
+		}
+		cr.Annotator = snps.NewAnnotator(refSeq, regions)
+
+		out, err := openOut(annotateOutfile)
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+
+		ow, err := snps.NewOutputWriter("csv", out, cr.WriterOptions())
+		if err != nil {
+			return err
+		}
+
+		return snps.Convert(cr, ow)
+	},
+}
@@ -0,0 +1,280 @@
+package cmd
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// openQueries opens the alignments given to --query, after expanding any glob patterns
+// among them, e.g. batch_*.fasta, and reads them one after another as one alignment. If
+// there is more than one, or a pattern, or an archive, source returns the file that each
+// record was read from, by its index, otherwise it is nil. Records from an archive come
+// from archive:member
+func openQueries(queries []string) (r io.ReadCloser, source func(int) string, err error) {
+	paths := make([]string, 0, len(queries))
+	pattern := false
+	for _, query := range queries {
+		if query == "stdin" || isURL(query) || !strings.ContainsAny(query, "*?[") {
+			paths = append(paths, query)
+			continue
+		}
+		pattern = true
+		matches, err := filepath.Glob(query)
+		if err != nil {
+			return nil, nil, usage("bad --query pattern " + query + ": " + err.Error())
+		}
+		if len(matches) == 0 {
+			return nil, nil, usage("no files match --query " + query)
+		}
+		paths = append(paths, matches...)
+	}
+	if len(paths) == 1 && !pattern && !isArchive(paths[0]) {
+		r, err = openQuery(paths[0])
+		return r, nil, err
+	}
+
+	qs := &querySources{paths: paths, lineStart: true}
+	qs.ar = &archiveReader{next: qs.next, closer: qs}
+	return qs, qs.source, nil
+}
+
+// querySources reads several alignments one after another, and keeps the index of the
+// first record of each, and of each member of an archive, by counting the header lines
+// that have been read
+type querySources struct {
+	ar        *archiveReader
+	paths     []string
+	opened    int
+	current   io.ReadCloser
+	records   int
+	lineStart bool
+
+	mu     sync.Mutex
+	starts []int
+	names  []string
+}
+
+// next opens the next alignment, for ar
+func (qs *querySources) next() (io.Reader, string, error) {
+	if qs.current != nil {
+		qs.current.Close()
+		qs.current = nil
+	}
+	if qs.opened == len(qs.paths) {
+		return nil, "", io.EOF
+	}
+	path := qs.paths[qs.opened]
+	qs.opened++
+	in, err := openQuery(path)
+	if err != nil {
+		return nil, "", err
+	}
+	qs.current = in
+	if ar, ok := in.(*archiveReader); ok {
+		ar.opened = func(member string) {
+			qs.start(path + ":" + member)
+		}
+	} else {
+		qs.start(path)
+	}
+	return in, path, nil
+}
+
+// start notes that the records from here on are from source
+func (qs *querySources) start(source string) {
+	qs.mu.Lock()
+	qs.starts = append(qs.starts, qs.records)
+	qs.names = append(qs.names, source)
+	qs.mu.Unlock()
+}
+
+func (qs *querySources) Read(p []byte) (int, error) {
+	n, err := qs.ar.Read(p)
+	for _, b := range p[:n] {
+		if qs.lineStart && b == '>' {
+			qs.records++
+		}
+		qs.lineStart = b == '\n'
+	}
+	return n, err
+}
+
+func (qs *querySources) Close() error {
+	if qs.current != nil {
+		return qs.current.Close()
+	}
+	return nil
+}
+
+// source returns the file that the record at index was read from. Records are compared
+// after they are read, so the file has always been opened by then
+func (qs *querySources) source(index int) string {
+	qs.mu.Lock()
+	defer qs.mu.Unlock()
+	i := sort.Search(len(qs.starts), func(i int) bool {
+		return qs.starts[i] > index
+	}) - 1
+	if i < 0 {
+		return ""
+	}
+	return qs.names[i]
+}
+
+// openQuery opens the alignment. If it is a tar (optionally gzipped) or zip archive,
+// judging by its name, its members are read one after another as one alignment, so that
+// an archive of per-sample fasta files needn't be unpacked first. Directories, and
+// hidden files like the ones macOS adds to zip archives, are skipped. Tar archives can
+// be URLs, but zip archives can't, since they are read from their end
+func openQuery(query string) (io.ReadCloser, error) {
+	lower := queryName(query)
+	open := func() (io.ReadCloser, error) {
+		if isURL(query) {
+			return openURL(query)
+		}
+		return os.Open(query)
+	}
+	switch {
+	case strings.HasSuffix(lower, ".tar"):
+		f, err := open()
+		if err != nil {
+			return nil, err
+		}
+		return newTarReader(f, f), nil
+	case strings.HasSuffix(lower, ".tar.gz") || strings.HasSuffix(lower, ".tgz"):
+		f, err := open()
+		if err != nil {
+			return nil, err
+		}
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		return newTarReader(gz, f), nil
+	case strings.HasSuffix(lower, ".zip"):
+		if isURL(query) {
+			return nil, usage("zip archives can't be read from URLs: " + query)
+		}
+		zr, err := zip.OpenReader(query)
+		if err != nil {
+			return nil, err
+		}
+		return newZipReader(zr), nil
+	}
+	return openIn(query)
+}
+
+// queryName returns the lower-case name of a query, by which archives are recognised.
+// The query string of a URL isn't part of its name
+func queryName(query string) string {
+	lower := strings.ToLower(query)
+	if isURL(query) {
+		lower, _, _ = strings.Cut(lower, "?")
+	}
+	return lower
+}
+
+// isArchive returns whether a query is a tar, tar.gz or zip archive, judging by its name
+func isArchive(query string) bool {
+	lower := queryName(query)
+	for _, suffix := range []string{".tar", ".tar.gz", ".tgz", ".zip"} {
+		if strings.HasSuffix(lower, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// archiveReader concatenates the members of an archive, with a newline after each in
+// case its last line hasn't got one. next returns the next member and its name, or
+// io.EOF. opened, if not nil, is given the name of each member as it is opened
+type archiveReader struct {
+	next    func() (io.Reader, string, error)
+	closer  io.Closer
+	current io.Reader
+	opened  func(name string)
+}
+
+func (ar *archiveReader) Read(p []byte) (int, error) {
+	for {
+		if ar.current == nil {
+			member, name, err := ar.next()
+			if err != nil {
+				return 0, err
+			}
+			if ar.opened != nil {
+				ar.opened(name)
+			}
+			ar.current = io.MultiReader(member, strings.NewReader("\n"))
+		}
+		n, err := ar.current.Read(p)
+		if err == io.EOF {
+			ar.current = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+func (ar *archiveReader) Close() error {
+	return ar.closer.Close()
+}
+
+// skipMember returns whether an archive member with this name isn't an alignment
+func skipMember(name string) bool {
+	return strings.HasPrefix(path.Base(name), ".") || strings.HasPrefix(name, "__MACOSX/")
+}
+
+func newTarReader(r io.Reader, closer io.Closer) *archiveReader {
+	tr := tar.NewReader(r)
+	next := func() (io.Reader, string, error) {
+		for {
+			header, err := tr.Next()
+			if err != nil {
+				return nil, "", err
+			}
+			if header.Typeflag != tar.TypeReg || skipMember(header.Name) {
+				continue
+			}
+			return tr, header.Name, nil
+		}
+	}
+	return &archiveReader{next: next, closer: closer}
+}
+
+func newZipReader(zr *zip.ReadCloser) *archiveReader {
+	i := 0
+	var member io.ReadCloser
+	next := func() (io.Reader, string, error) {
+		if member != nil {
+			member.Close()
+			member = nil
+		}
+		for ; i < len(zr.File); i++ {
+			f := zr.File[i]
+			if f.FileInfo().IsDir() || skipMember(f.Name) {
+				continue
+			}
+			i++
+			var err error
+			member, err = f.Open()
+			if err != nil {
+				return nil, "", err
+			}
+			return member, f.Name, nil
+		}
+		return nil, "", io.EOF
+	}
+	return &archiveReader{next: next, closer: zr}
+}
@@ -0,0 +1,158 @@
+package cmd
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenQueryArchives(t *testing.T) {
+	dir := t.TempDir()
+
+	// the second member has no final newline, and the macOS metadata isn't fasta
+	members := [][2]string{
+		{"samples/", ""},
+		{"samples/a.fasta", ">a\nATGATG\n"},
+		{"samples/b.fasta", ">b\nATGATC"},
+		{"__MACOSX/samples/._a.fasta", "junk"},
+		{"samples/c.fasta", ">c\nATTATG\n"},
+	}
+	expected := ">a\nATGATG\n\n>b\nATGATC\n>c\nATTATG\n\n"
+
+	writeTar := func(w io.Writer) {
+		tw := tar.NewWriter(w)
+		for _, m := range members {
+			header := &tar.Header{Name: m[0], Mode: 0644, Size: int64(len(m[1])), Typeflag: tar.TypeReg}
+			if m[0][len(m[0])-1] == '/' {
+				header.Typeflag = tar.TypeDir
+				header.Mode = 0755
+			}
+			if err := tw.WriteHeader(header); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := tw.Write([]byte(m[1])); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := tw.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f, err := os.Create(filepath.Join(dir, "q.tar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTar(f)
+	f.Close()
+
+	f, err = os.Create(filepath.Join(dir, "q.tar.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(f)
+	writeTar(gz)
+	gz.Close()
+	f.Close()
+
+	f, err = os.Create(filepath.Join(dir, "q.zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	for _, m := range members {
+		w, err := zw.Create(m[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(m[1])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	zw.Close()
+	f.Close()
+
+	for _, name := range []string{"q.tar", "q.tar.gz", "q.zip"} {
+		r, err := openQuery(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Error(err)
+		}
+		if string(b) != expected {
+			t.Errorf("problem in TestOpenQueryArchives(): %s gave %q", name, string(b))
+		}
+	}
+
+	// each record's source is its member, e.g. so that --ref-first can tell them apart
+	r, source, err := openQueries([]string{filepath.Join(dir, "q.zip")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = io.ReadAll(r); err != nil {
+		t.Error(err)
+	}
+	r.Close()
+	for index, member := range []string{"samples/a.fasta", "samples/b.fasta", "samples/c.fasta"} {
+		if source == nil || source(index) != filepath.Join(dir, "q.zip")+":"+member {
+			t.Errorf("problem in TestOpenQueryArchives(): record %d has the wrong source", index)
+		}
+	}
+}
+
+func TestOpenQueries(t *testing.T) {
+	dir := t.TempDir()
+
+	// b_2 has no final newline, and b_3 no records
+	files := map[string]string{
+		"b_1.fasta": ">a\nATGATG\n>b\nATGATC\n",
+		"b_2.fasta": ">c\nATTATG",
+		"b_3.fasta": "",
+		"d.fasta":   ">d\nATGATG\n",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r, source, err := openQueries([]string{filepath.Join(dir, "b_*.fasta"), filepath.Join(dir, "d.fasta")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(r)
+	r.Close()
+	if err != nil {
+		t.Error(err)
+	}
+	if string(b) != ">a\nATGATG\n>b\nATGATC\n\n>c\nATTATG\n\n>d\nATGATG\n\n" {
+		t.Errorf("problem in TestOpenQueries(): read %q", string(b))
+	}
+	for index, expected := range []string{"b_1.fasta", "b_1.fasta", "b_2.fasta", "d.fasta"} {
+		if source(index) != filepath.Join(dir, expected) {
+			t.Errorf("problem in TestOpenQueries(): record %d came from %s", index, source(index))
+		}
+	}
+
+	// one file isn't tagged
+	r, source, err = openQueries([]string{filepath.Join(dir, "d.fasta")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	if source != nil {
+		t.Errorf("problem in TestOpenQueries(): one file had sources")
+	}
+
+	_, _, err = openQueries([]string{filepath.Join(dir, "c_*.fasta")})
+	if err == nil {
+		t.Errorf("problem in TestOpenQueries(): a pattern that matched nothing was accepted")
+	}
+}
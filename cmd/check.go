@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"encoding/json"
+
+	"github.com/benjamincjackson/snps/pkg/snps"
+	"github.com/spf13/cobra"
+)
+
+var checkReference string
+var checkRefSeq string
+var checkPreset string
+var checkQuery string
+var checkOutfile string
+
+func init() {
+	rootCmd.AddCommand(checkCmd)
+
+	checkCmd.Flags().StringVarP(&checkReference, "reference", "r", "", "Reference sequence, in fasta format")
+	checkCmd.Flags().StringVarP(&checkRefSeq, "ref-seq", "", "", "The reference sequence itself, instead of a file. Can also be given in $"+refSeqEnv)
+	checkCmd.Flags().StringVarP(&checkPreset, "preset", "", "", "Use a built-in reference")
+	checkCmd.Flags().StringVarP(&checkQuery, "query", "q", "stdin", "Alignment to check, in fasta format")
+	checkCmd.Flags().StringVarP(&checkOutfile, "outfile", "o", "stdout", "Report to write, in JSON")
+
+	checkCmd.Flags().SortFlags = false
+}
+
+var checkCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Check the reference and alignment without finding snps",
+	Long: `Check the reference and alignment without finding snps: that they are fasta, that
+the reference is one record, and that each query is as long as the reference, is made
+up of IUPAC codes, gaps and ?, and has a unique ID. A JSON report is written, whose
+"ok" field is true if no problems were found, and whose "problems" list each one with
+its file, record, kind and a message.`,
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+
+		refIn, err := openReference(checkReference, checkPreset, checkRefSeq)
+		if err != nil {
+			return err
+		}
+		defer refIn.Close()
+
+		queryIn, err := openQuery(checkQuery)
+		if err != nil {
+			return err
+		}
+		defer queryIn.Close()
+
+		report := snps.Check(queryIn, refIn)
+
+		out, err := openOut(checkOutfile)
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(report)
+		if err != nil {
+			return err
+		}
+		if !report.OK {
+			return errCheckFailed
+		}
+		return nil
+	},
+}
@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"strconv"
+
+	"github.com/benjamincjackson/snps/pkg/snps"
+	"github.com/spf13/cobra"
+)
+
+var compareRefsA string
+var compareRefsB string
+var compareRefsOutfile string
+var compareRefsLiftover string
+var compareRefsDifferences string
+
+func init() {
+	rootCmd.AddCommand(compareRefsCmd)
+
+	compareRefsCmd.Flags().StringVarP(&compareRefsA, "a", "a", "", "First reference, e.g. the one an earlier run compared with, in fasta format")
+	compareRefsCmd.Flags().StringVarP(&compareRefsB, "b", "b", "", "Second reference, e.g. an update of the first, in fasta format")
+	compareRefsCmd.Flags().StringVarP(&compareRefsOutfile, "outfile", "o", "stdout", "Differences to write, in csv format, or with --liftover the lifted output")
+	compareRefsCmd.Flags().StringVarP(&compareRefsLiftover, "liftover", "", "", "Output of an earlier run against -a, in csv format, to lift over into the coordinates and alleles of -b")
+	compareRefsCmd.Flags().StringVarP(&compareRefsDifferences, "differences", "", "", "with --liftover, also write the differences to this file")
+
+	compareRefsCmd.Flags().SortFlags = false
+}
+
+var compareRefsCmd = &cobra.Command{
+	Use:   "compare-refs",
+	Short: "Compare two references, and lift output over from one to the other",
+	Long: `Align two versions of a reference and write their differences (substitutions,
+insertions and deletions), with the positions and alleles in each. With --liftover,
+write the per-query csv output of an earlier run against -a as it would be against -b
+instead: snps are moved to their positions in -b, those that -b has the query's base at
+are dropped, and each query gets a snp where -a and -b differ and it had -a's base.
+Snps at sites that were deleted from -b are dropped, with a warning. Columns that
+depend on the reference, e.g. annotations, are dropped too, but can be added back with
+snps annotate. The references should be mostly similar, since the alignment is anchored
+on the stretches that they share.`,
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+
+		if compareRefsA == "" || compareRefsB == "" {
+			return usage("-a and -b are both required")
+		}
+		if compareRefsDifferences != "" && compareRefsLiftover == "" {
+			return usage("--differences needs --liftover")
+		}
+
+		refA, err := readReference(compareRefsA, "", "", false, false, false)
+		if err != nil {
+			return err
+		}
+		refB, err := readReference(compareRefsB, "", "", false, false, false)
+		if err != nil {
+			return err
+		}
+		lo := snps.NewLiftover(refA, refB)
+
+		differences := compareRefsOutfile
+		if compareRefsLiftover != "" {
+			differences = compareRefsDifferences
+		}
+		if differences != "" {
+			out, err := openOut(differences)
+			if err != nil {
+				return err
+			}
+			defer out.Close()
+			err = snps.WriteRefDifferences(out, lo.Differences())
+			if err != nil {
+				return err
+			}
+		}
+		if compareRefsLiftover == "" {
+			return nil
+		}
+
+		in, err := openIn(compareRefsLiftover)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+
+		cr, err := snps.NewCSVReader(in)
+		if err != nil {
+			return err
+		}
+		if cr.WriterOptions().Contigs {
+			return usage("can't lift over output from a reference made up of contigs")
+		}
+		cr.Liftover = lo
+
+		out, err := openOut(compareRefsOutfile)
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+
+		ow, err := snps.NewOutputWriter("csv", out, cr.WriterOptions())
+		if err != nil {
+			return err
+		}
+		err = snps.Convert(cr, ow)
+		if err != nil {
+			return err
+		}
+		if n := lo.Unlifted(); n > 0 {
+			cmd.PrintErrln("Warning: " + strconv.Itoa(n) + " snps at sites deleted from -b were dropped")
+		}
+		return nil
+	},
+}
@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// applyConfig sets flags from a YAML config file whose keys are flag names, e.g.:
+//
+//	reference: reference.fasta
+//	hard-gaps: true
+//	threshold: 0.05
+//
+// Flags that were given on the command line take precedence over the config file.
+// Flags that can be repeated may be given a list
+func applyConfig(flags *pflag.FlagSet, r io.Reader) error {
+
+	config := make(map[string]interface{})
+
+	err := yaml.NewDecoder(r).Decode(&config)
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	keys := make([]string, 0, len(config))
+	for key := range config {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		flag := flags.Lookup(key)
+		if flag == nil || key == "config" {
+			return usage("unknown option in config file: " + key)
+		}
+		if flag.Changed {
+			continue
+		}
+
+		var values []interface{}
+		switch v := config[key].(type) {
+		case nil:
+			return usage("no value for option in config file: " + key)
+		case []interface{}:
+			values = v
+		default:
+			values = []interface{}{v}
+		}
+
+		for _, value := range values {
+			err = flags.Set(key, fmt.Sprint(value))
+			if err != nil {
+				return usageError{fmt.Errorf("bad value for option %s in config file: %w", key, err)}
+			}
+		}
+	}
+
+	return nil
+}
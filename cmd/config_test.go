@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/pflag"
+)
+
+func TestApplyConfig(t *testing.T) {
+	var reference string
+	var hardGaps bool
+	var threshold float64
+
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	flags.StringVarP(&reference, "reference", "r", "", "")
+	flags.BoolVarP(&hardGaps, "hard-gaps", "", false, "")
+	flags.Float64VarP(&threshold, "threshold", "", 0.0, "")
+
+	err := flags.Parse([]string{"--threshold", "0.5"})
+	if err != nil {
+		t.Error(err)
+	}
+
+	config := strings.NewReader(`reference: ref.fasta
+hard-gaps: true
+threshold: 0.1
+`)
+
+	err = applyConfig(flags, config)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if reference != "ref.fasta" || !hardGaps || threshold != 0.5 {
+		t.Errorf("problem in TestApplyConfig(): %s %t %f", reference, hardGaps, threshold)
+	}
+
+	err = applyConfig(flags, strings.NewReader("not-a-flag: 1\n"))
+	if err == nil {
+		t.Errorf("problem in TestApplyConfig(): unknown option was accepted")
+	}
+}
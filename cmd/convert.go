@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"io"
+	"strings"
+
+	"github.com/benjamincjackson/snps/pkg/snps"
+	"github.com/spf13/cobra"
+)
+
+var convertInfile string
+var convertOutfile string
+var convertFormat string
+var convertReference string
+var convertThresh float64
+var convertMinCount int
+
+func init() {
+	rootCmd.AddCommand(convertCmd)
+
+	convertCmd.Flags().StringVarP(&convertInfile, "infile", "i", "stdin", "Output of an earlier run, in csv format")
+	convertCmd.Flags().StringVarP(&convertOutfile, "outfile", "o", "stdout", "Output to write")
+	convertCmd.Flags().StringVarP(&convertFormat, "format", "f", "csv", "Output format to write, one of: "+strings.Join(snps.OutputFormats(), ", "))
+	convertCmd.Flags().StringVarP(&convertReference, "reference", "r", "", "Reference sequence of the earlier run, for output formats that need one, e.g. vcf")
+	convertCmd.Flags().Float64VarP(&convertThresh, "threshold", "", 0.0, "for aggregate formats, only report snps with a freq above this value")
+	convertCmd.Flags().IntVarP(&convertMinCount, "min-count", "", 0, "for aggregate formats, only report snps found in at least this many queries")
+
+	convertCmd.Flags().SortFlags = false
+}
+
+var convertCmd = &cobra.Command{
+	Use:   "convert",
+	Short: "Write the output of an earlier run in another format",
+	Long: `Write the output of an earlier run in another format, without reading and comparing
+the alignment again. The input is the per-query csv output, with any of its optional
+columns, which are kept if the output format has them. The long and JSON outputs can't
+be converted. Output formats that need the reference, e.g. vcf, need --reference.`,
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+
+		in, err := openIn(convertInfile)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+
+		cr, err := snps.NewCSVReader(in)
+		if err != nil {
+			return err
+		}
+
+		wopts := cr.WriterOptions()
+		wopts.Threshold = convertThresh
+		wopts.MinCount = convertMinCount
+
+		var refSeq []byte
+		if convertReference != "" {
+			refSeq, wopts.ReferenceName, err = readNamedReference(convertReference, "", "", false, false, false)
+			if err != nil {
+				return err
+			}
+		}
+
+		out, err := openOut(convertOutfile)
+		if err != nil {
+			return err
+		}
+
+		ow, err := snps.NewOutputWriter(convertFormat, out, wopts)
+		if err == nil {
+			if rw, ok := ow.(snps.ReferenceWriter); ok && refSeq != nil {
+				rw.SetReference(refSeq)
+			}
+			err = snps.Convert(cr, ow)
+		}
+		if err != nil {
+			out.Close()
+			return err
+		}
+		// closing the outfile finishes it if it is compressed
+		return closeOuts([]io.Closer{out})
+	},
+}
@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConvertVCF(t *testing.T) {
+	dir := t.TempDir()
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	err := os.WriteFile(path("ref.fasta"), []byte(">ref\nATGATG\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(path("snps.csv"), []byte("query,SNPs\nQuery1,G6C\nQuery2,G3T\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		convertInfile, convertOutfile, convertFormat, convertReference = "stdin", "stdout", "csv", ""
+		rootCmd.SetArgs(nil)
+	}()
+
+	// vcf output needs the reference, which is given with --reference
+	rootCmd.SetArgs([]string{"convert", "-i", path("snps.csv"), "-f", "vcf", "-r", path("ref.fasta"), "-o", path("snps.vcf")})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	out, err := os.ReadFile(path("snps.vcf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), "ref\t3\t.\tG\tT\t") || !strings.Contains(string(out), "ref\t6\t.\tG\tC\t") {
+		t.Errorf("problem in TestConvertVCF()")
+		t.Log(string(out))
+	}
+}
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"github.com/benjamincjackson/snps/pkg/snps"
+	"github.com/spf13/cobra"
+)
+
+var disagreementsA string
+var disagreementsB string
+var disagreementsOutfile string
+var disagreementsHardGaps bool
+var disagreementsIgnoreMissing bool
+
+func init() {
+	rootCmd.AddCommand(disagreementsCmd)
+
+	disagreementsCmd.Flags().StringVarP(&disagreementsA, "a", "a", "", "First alignment, in fasta format")
+	disagreementsCmd.Flags().StringVarP(&disagreementsB, "b", "b", "", "Second alignment of the same samples, in fasta format")
+	disagreementsCmd.Flags().StringVarP(&disagreementsOutfile, "outfile", "o", "stdout", "Disagreements to write, in csv format")
+	disagreementsCmd.Flags().BoolVarP(&disagreementsHardGaps, "hard-gaps", "", false, "don't treat alignment gaps as missing data")
+	disagreementsCmd.Flags().BoolVarP(&disagreementsIgnoreMissing, "ignore-missing", "", false, "ignore positions where either alignment has N, ? or a gap")
+
+	disagreementsCmd.Flags().Lookup("hard-gaps").NoOptDefVal = "true"
+	disagreementsCmd.Flags().Lookup("ignore-missing").NoOptDefVal = "true"
+
+	disagreementsCmd.Flags().SortFlags = false
+}
+
+var disagreementsCmd = &cobra.Command{
+	Use:   "disagreements",
+	Short: "Find where two alignments of the same samples disagree",
+	Long: `Compare two alignments of the same samples, e.g. from two mapping pipelines, and
+write the positions where each sample's base calls differ between them, written as the
+call in -a, the position and the call in -b, e.g. A100G. Samples are matched by ID, and
+those that are only in one alignment are listed too. The first alignment is held in
+memory.`,
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+
+		if disagreementsA == "" || disagreementsB == "" {
+			return usage("-a and -b are both required")
+		}
+
+		inA, err := openQuery(disagreementsA)
+		if err != nil {
+			return err
+		}
+		defer inA.Close()
+
+		inB, err := openQuery(disagreementsB)
+		if err != nil {
+			return err
+		}
+		defer inB.Close()
+
+		disagreements, err := snps.CompareAlignments(inA, inB, disagreementsHardGaps, disagreementsIgnoreMissing)
+		if err != nil {
+			return err
+		}
+
+		out, err := openOut(disagreementsOutfile)
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+
+		return snps.WriteDisagreements(out, disagreements)
+	},
+}
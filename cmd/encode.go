@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"context"
+
+	"github.com/benjamincjackson/snps/pkg/fastaio"
+	"github.com/spf13/cobra"
+)
+
+var encodeQuery string
+var encodeOutfile string
+var encodeHardGaps bool
+
+func init() {
+	rootCmd.AddCommand(encodeCmd)
+
+	encodeCmd.Flags().StringVarP(&encodeQuery, "query", "q", "stdin", "Alignment (or reference) to encode, in fasta format")
+	encodeCmd.Flags().StringVarP(&encodeOutfile, "outfile", "o", "stdout", "Encoded alignment to write, conventionally with a .sep extension")
+	encodeCmd.Flags().BoolVarP(&encodeHardGaps, "hard-gaps", "", false, "encode gaps as a fifth character state. Either way, the encoding can be used with or without --hard-gaps")
+
+	encodeCmd.Flags().Lookup("hard-gaps").NoOptDefVal = "true"
+
+	encodeCmd.Flags().SortFlags = false
+}
+
+var encodeCmd = &cobra.Command{
+	Use:   "encode",
+	Short: "Encode an alignment once, to skip parsing it in later runs",
+	Long: `Encode an alignment once, to skip parsing it in later runs. The output can be given to
+-q or -r (or the other commands) in place of the fasta file it was made from, and is
+recognised by its contents, so repeated runs against the same large alignment don't
+parse and encode it every time.`,
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+
+		queryIn, err := openQuery(encodeQuery)
+		if err != nil {
+			return err
+		}
+		defer queryIn.Close()
+
+		out, err := openOut(encodeOutfile)
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+
+		ew, err := fastaio.NewEncodedWriter(out, encodeHardGaps)
+		if err != nil {
+			return err
+		}
+
+		// the reader is stopped if writing fails
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		cErr := make(chan error)
+		cFR := make(chan fastaio.EncodedFastaRecord)
+		cDone := make(chan bool)
+
+		go fastaio.ReadEncodeAlignmentContext(ctx, queryIn, encodeHardGaps, cFR, cErr, cDone)
+
+		for {
+			select {
+			case err := <-cErr:
+				return err
+			case FR := <-cFR:
+				// the reader gives an empty file one record with no ID
+				if FR.ID == "" && len(FR.Seq) == 0 {
+					continue
+				}
+				err = ew.Write(FR)
+				if err != nil {
+					return err
+				}
+			case <-cDone:
+				return ew.Flush()
+			}
+		}
+	},
+}
@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"io/fs"
+	"net"
+	"strings"
+	"syscall"
+
+	"github.com/benjamincjackson/snps/pkg/annotation"
+	"github.com/benjamincjackson/snps/pkg/snps"
+	"github.com/spf13/cobra"
+)
+
+// The exit codes, so that pipelines can tell failures that are worth retrying (I/O) from
+// ones that aren't
+const (
+	exitOK         = 0
+	exitError      = 1 // anything not covered below
+	exitUsage      = 2 // bad flags, arguments or config
+	exitParse      = 3 // input that can't be read as what it should be
+	exitValidation = 4 // input that can be read, but is wrong, e.g. a sequence longer than the reference
+	exitIO         = 5 // failing to open, read or write files, or to fetch references
+)
+
+// usageError is an error in how snps was called, rather than in what it was given
+type usageError struct{ error }
+
+// usage returns a usageError with msg
+func usage(msg string) error {
+	return usageError{errors.New(msg)}
+}
+
+// usageArgs makes the errors of an argument validator usageErrors
+func usageArgs(args cobra.PositionalArgs) cobra.PositionalArgs {
+	return func(cmd *cobra.Command, a []string) error {
+		if err := args(cmd, a); err != nil {
+			return usageError{err}
+		}
+		return nil
+	}
+}
+
+// ioError is an I/O error whose cause doesn't say so, e.g. failing to fetch a reference
+type ioError struct{ error }
+
+// errCheckFailed is returned by check when it finds problems, after writing its report
+var errCheckFailed = errors.New("check found problems")
+
+// exitCode returns the exit code for err
+func exitCode(err error) int {
+	var ue usageError
+	var ie ioError
+	var pathError *fs.PathError
+	var netError net.Error
+	var csvError *csv.ParseError
+
+	switch {
+	case err == nil:
+		return exitOK
+
+	// cobra's errors for unknown commands aren't typed
+	case errors.As(err, &ue), strings.HasPrefix(err.Error(), "unknown command"),
+		errors.Is(err, snps.ErrUnknownFormat), errors.Is(err, snps.ErrUnknownPolicy), errors.Is(err, snps.ErrBadPattern),
+		errors.Is(err, snps.ErrBadExpression), errors.Is(err, snps.ErrExpressionType):
+		return exitUsage
+
+	case errors.Is(err, snps.ErrBadFasta), errors.Is(err, snps.ErrEmptyHeader),
+		errors.Is(err, snps.ErrBadTwoBit), errors.Is(err, snps.ErrBadEncoded),
+		errors.Is(err, snps.ErrBadPhylip), errors.Is(err, snps.ErrBadNexus), errors.Is(err, snps.ErrBadMAF),
+		errors.Is(err, snps.ErrBadGenBank), errors.Is(err, annotation.ErrBadGenBank),
+		errors.Is(err, snps.ErrBadFaidx), errors.Is(err, snps.ErrBadRegion),
+		errors.Is(err, snps.ErrBadCSV), errors.Is(err, snps.ErrBadIndex), errors.Is(err, snps.ErrBadBED), errors.Is(err, snps.ErrBadProfile), errors.Is(err, snps.ErrBadWeights), errors.Is(err, snps.ErrBadTrack), errors.Is(err, annotation.ErrBadGFF),
+		errors.As(err, &csvError):
+		return exitParse
+
+	case errors.Is(err, snps.ErrLengthMismatch), errors.Is(err, snps.ErrInvalidChar),
+		errors.Is(err, snps.ErrQuestionMark), errors.Is(err, snps.ErrBadReference), errors.Is(err, snps.ErrNotInAlignment), errors.Is(err, snps.ErrNoContig),
+		errors.Is(err, errCheckFailed):
+		return exitValidation
+
+	case errors.As(err, &ie), errors.As(err, &pathError), errors.As(err, &netError),
+		errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, syscall.EPIPE):
+		return exitIO
+	}
+
+	return exitError
+}
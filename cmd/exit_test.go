@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/benjamincjackson/snps/pkg/annotation"
+	"github.com/benjamincjackson/snps/pkg/fastaio"
+	"github.com/benjamincjackson/snps/pkg/snps"
+)
+
+func TestExitCode(t *testing.T) {
+	_, openErr := os.Open("/does/not/exist")
+	_, fastaErr := snps.ReadReference(bytes.NewReader([]byte("ATG\n")), false)
+	_, refErr := snps.ReadValidReference(bytes.NewReader([]byte(">ref\nATGNTG\n")), false, false)
+	_, sizeErr := parseSize("lots")
+
+	// each format that can be read has its own cause, which should be a parse error too
+	parseErrs := make(map[string]error)
+	for name, data := range map[string]string{
+		"phylip":  " 2 6\na ATGATG\n",
+		"nexus":   "#NEXUS\nbegin data;\nmatrix\na ATG\n",
+		"maf":     "##maf version=1\na\ns hg38.chr1 0 x + 10 ATGA\n",
+		"genbank": "LOCUS       x 6 bp\nORIGIN\n   1 atgxtg\n",
+	} {
+		_, parseErrs[name] = snps.ReadReference(strings.NewReader(data), false)
+	}
+	_, parseErrs["genbank features"] = annotation.ReadGenBank(strings.NewReader("LOCUS       x 6 bp\nORIGIN\n   1 atgatg\n//\n"))
+	_, parseErrs["faidx"] = fastaio.ReadFaidx(strings.NewReader("r\tx\t3\t6\t7\n"))
+	_, parseErrs["region"] = snps.ReadReferenceRegion(strings.NewReader(">r\nATGATG\n"), snps.Region{Contig: "r", Start: 5, End: 10}, false)
+
+	for i, c := range []struct {
+		err  error
+		code int
+	}{
+		{nil, exitOK},
+		{fmt.Errorf("something else"), exitError},
+		{sizeErr, exitUsage},
+		{fmt.Errorf("unknown command \"x\" for \"snps\""), exitUsage},
+		{fastaErr, exitParse},
+		{refErr, exitValidation},
+		{errCheckFailed, exitValidation},
+		{openErr, exitIO},
+		{fmt.Errorf("reading the reference: %w", openErr), exitIO},
+	} {
+		if code := exitCode(c.err); code != c.code {
+			t.Errorf("problem in TestExitCode(): case %d (%v) gave %d", i, c.err, code)
+		}
+	}
+	for name, err := range parseErrs {
+		if err == nil || exitCode(err) != exitParse {
+			t.Errorf("problem in TestExitCode(): bad %s input (%v) gave %d", name, err, exitCode(err))
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"github.com/benjamincjackson/snps/pkg/snps"
+	"github.com/spf13/cobra"
+)
+
+var filterInfile string
+var filterOutfile string
+var filterKeep string
+var filterDrop string
+var filterMask string
+var filterIncludeSNPs string
+var filterExcludeSNPs string
+var filterMinSNPs int
+var filterMaxSNPs int
+
+func init() {
+	rootCmd.AddCommand(filterCmd)
+
+	filterCmd.Flags().StringVarP(&filterInfile, "infile", "i", "stdin", "Output of an earlier run, in csv format")
+	filterCmd.Flags().StringVarP(&filterOutfile, "outfile", "o", "stdout", "Filtered output to write, in the same format")
+	filterCmd.Flags().StringVarP(&filterKeep, "names", "", "", "file of query names, one per line, to keep")
+	filterCmd.Flags().StringVarP(&filterDrop, "exclude-names", "", "", "file of query names, one per line, to drop")
+	filterCmd.Flags().StringVarP(&filterMask, "mask", "", "", "positions and ranges of positions to drop snps at, e.g. 1-55,29804-29903")
+	filterCmd.Flags().StringVarP(&filterIncludeSNPs, "include-snps", "", "", "file of snps, e.g. A23403G, one per line, to keep (and drop all others)")
+	filterCmd.Flags().StringVarP(&filterExcludeSNPs, "exclude-snps", "", "", "file of snps, one per line, to drop")
+	filterCmd.Flags().IntVarP(&filterMinSNPs, "min-snps", "", 0, "drop queries with fewer than this many snps, after the other filters")
+	filterCmd.Flags().IntVarP(&filterMaxSNPs, "max-snps", "", -1, "drop queries with more than this many snps, after the other filters")
+
+	filterCmd.Flags().SortFlags = false
+}
+
+var filterCmd = &cobra.Command{
+	Use:   "filter",
+	Short: "Filter the output of an earlier run",
+	Long: `Filter the per-query csv output of an earlier run by query name, position, snp and
+number of snps, for iterative analysis of frozen results without comparing the
+alignment again. The output has the same columns as the input.`,
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+
+		filter := &snps.Filter{MinSNPs: filterMinSNPs, MaxSNPs: filterMaxSNPs}
+		for _, list := range []struct {
+			file string
+			set  *map[string]bool
+		}{
+			{filterKeep, &filter.Keep},
+			{filterDrop, &filter.Drop},
+			{filterIncludeSNPs, &filter.IncludeSNPs},
+			{filterExcludeSNPs, &filter.ExcludeSNPs},
+		} {
+			if list.file == "" {
+				continue
+			}
+			*list.set, err = readList(list.file)
+			if err != nil {
+				return err
+			}
+		}
+		if filterMask != "" {
+			filter.Mask, err = snps.ParseRanges(filterMask)
+			if err != nil {
+				return err
+			}
+		}
+
+		in, err := openIn(filterInfile)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+
+		cr, err := snps.NewCSVReader(in)
+		if err != nil {
+			return err
+		}
+		cr.Filter = filter
+
+		out, err := openOut(filterOutfile)
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+
+		ow, err := snps.NewOutputWriter("csv", out, cr.WriterOptions())
+		if err != nil {
+			return err
+		}
+
+		return snps.Convert(cr, ow)
+	},
+}
+
+// readList reads a file of names, one per line
+func readList(file string) (map[string]bool, error) {
+	f, err := openIn(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return snps.ReadList(f)
+}
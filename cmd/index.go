@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"github.com/benjamincjackson/snps/pkg/snps"
+	"github.com/spf13/cobra"
+)
+
+var indexReference string
+var indexRefSeq string
+var indexPreset string
+var indexQuery string
+var indexOutfile string
+var indexHardGaps bool
+
+func init() {
+	rootCmd.AddCommand(indexCmd)
+
+	indexCmd.Flags().StringVarP(&indexReference, "reference", "r", "", "Reference sequence, in fasta format")
+	indexCmd.Flags().StringVarP(&indexRefSeq, "ref-seq", "", "", "The reference sequence itself, instead of a file. Can also be given in $"+refSeqEnv)
+	indexCmd.Flags().StringVarP(&indexPreset, "preset", "", "", "Use a built-in reference")
+	indexCmd.Flags().StringVarP(&indexQuery, "query", "q", "stdin", "Alignment to index, in fasta format")
+	indexCmd.Flags().StringVarP(&indexOutfile, "outfile", "o", "stdout", "Index to write")
+	indexCmd.Flags().BoolVarP(&indexHardGaps, "hard-gaps", "", false, "don't treat alignment gaps as missing data")
+
+	indexCmd.Flags().Lookup("hard-gaps").NoOptDefVal = "true"
+
+	indexCmd.Flags().SortFlags = false
+}
+
+var indexCmd = &cobra.Command{
+	Use:   "index",
+	Short: "Index the snps in an alignment, to search it quickly with snps search",
+	Long: `Compare an alignment with the reference once, and write a compact index of which
+samples have which snps: a bitset of samples for each snp. The index can then be
+searched repeatedly with snps search, without reading the alignment again. The index
+format is the same as -o index:<file> in a run.`,
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+
+		queryIn, err := openQuery(indexQuery)
+		if err != nil {
+			return err
+		}
+		defer queryIn.Close()
+
+		refSeq, err := readReference(indexReference, indexPreset, indexRefSeq, indexHardGaps, false, false)
+		if err != nil {
+			return err
+		}
+
+		out, err := openOut(indexOutfile)
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+
+		ow, err := snps.NewOutputWriter("index", out, snps.WriterOptions{})
+		if err != nil {
+			return err
+		}
+
+		return snps.RunReference(queryIn, refSeq, snps.Options{HardGaps: indexHardGaps}, ow)
+	},
+}
@@ -0,0 +1,456 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/benjamincjackson/snps/pkg/annotation"
+	"github.com/benjamincjackson/snps/pkg/bgzf"
+	"github.com/benjamincjackson/snps/pkg/fastaio"
+	"github.com/benjamincjackson/snps/pkg/snps"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// The compression formats that inputs are read in and outputs can be written in
+const (
+	compressionGzip  = "gzip"
+	compressionBgzip = "bgzip"
+	compressionZstd  = "zstd"
+	compressionXz    = "xz"
+	compressionNone  = "none"
+)
+
+// compressionMagic are the bytes that files in each compression format start with
+var compressionMagic = map[string][]byte{
+	compressionGzip: {0x1f, 0x8b},
+	compressionZstd: {0x28, 0xb5, 0x2f, 0xfd},
+	compressionXz:   {0xfd, '7', 'z', 'X', 'Z', 0x00},
+}
+
+// compressionExtensions are the file extensions that choose the compression of outputs
+var compressionExtensions = map[string]string{
+	".gz":  compressionGzip,
+	".bgz": compressionBgzip,
+	".zst": compressionZstd,
+	".xz":  compressionXz,
+}
+
+// openIn opens a file, stdin or a URL (see openURL). If it is compressed with gzip, zstd
+// or xz, judging by its first bytes rather than its name, so that compressed stdin works
+// too, it is decompressed as it is read
+func openIn(inFile string) (io.ReadCloser, error) {
+	var err error
+	var f io.ReadCloser
+
+	switch {
+	case inFile == "stdin":
+		f = os.Stdin
+	case isURL(inFile):
+		f, err = openURL(inFile)
+	default:
+		f, err = os.Open(inFile)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	in := &inputFile{f: f}
+	br := bufio.NewReader(f)
+	in.r = br
+	magic, _ := br.Peek(6)
+	switch {
+	case bytes.HasPrefix(magic, compressionMagic[compressionGzip]):
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		in.r, in.closer = gz, gz
+	case bytes.HasPrefix(magic, compressionMagic[compressionZstd]):
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		in.r, in.closer = zr, zr.IOReadCloser()
+	case bytes.HasPrefix(magic, compressionMagic[compressionXz]):
+		xr, err := xz.NewReader(br)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		in.r = xr
+	}
+
+	return in, nil
+}
+
+// inputFile is a file (or URL) opened by openIn, which is read through r. closer, if it
+// isn't nil, releases r's decompressor
+type inputFile struct {
+	r      io.Reader
+	f      io.ReadCloser
+	closer io.Closer
+}
+
+func (in *inputFile) Read(p []byte) (int, error) {
+	return in.r.Read(p)
+}
+
+func (in *inputFile) Close() error {
+	if in.closer != nil {
+		in.closer.Close()
+	}
+	return in.f.Close()
+}
+
+// openOut creates a file, or opens stdout. It is compressed if its extension is .gz, .zst
+// or .xz
+func openOut(outFile string) (io.WriteCloser, error) {
+	return openCompressedOut(outFile, "")
+}
+
+// openCompressedOut opens an output like openOut, but compresses it in compression
+// (gzip, bgzip, zstd, xz or none), unless that is "", when it is chosen by its extension
+func openCompressedOut(outFile string, compression string) (io.WriteCloser, error) {
+	var err error
+	var f *os.File
+
+	if compression == "" && outFile != "stdout" {
+		compression = compressionExtensions[strings.ToLower(filepath.Ext(outFile))]
+	}
+
+	if outFile != "stdout" {
+		f, err = os.Create(outFile)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		f = os.Stdout
+	}
+
+	out := &outputFile{w: f, f: f}
+	switch compression {
+	case compressionGzip:
+		gz := gzip.NewWriter(f)
+		out.w, out.closer = gz, gz
+	case compressionBgzip:
+		bw := bgzf.NewWriter(f)
+		out.w, out.closer = bw, bw
+	case compressionZstd:
+		zw, err := zstd.NewWriter(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		out.w, out.closer = zw, zw
+	case compressionXz:
+		xw, err := xz.NewWriter(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		out.w, out.closer = xw, xw
+	}
+
+	return out, nil
+}
+
+// openIndexedOut creates a bgzip-compressed VCF file, and a tabix index of it alongside
+// it, with .tbi added to its name, once it is closed
+func openIndexedOut(outFile string) (io.WriteCloser, error) {
+	f, err := os.Create(outFile)
+	if err != nil {
+		return nil, err
+	}
+	bw := bgzf.NewWriter(f)
+	ix := bgzf.NewIndexer(bw)
+	index := func() error {
+		tbi, err := os.Create(outFile + ".tbi")
+		if err != nil {
+			return err
+		}
+		defer tbi.Close()
+		return ix.WriteIndex(tbi)
+	}
+	return &outputFile{w: ix, f: f, closer: bw, index: index}, nil
+}
+
+// outputFile is a file opened by openOut, which is written through w. closer, if it
+// isn't nil, is w's compressor, which is closed to finish the file before the file is,
+// and index, if it isn't nil, writes an index of the file once it is finished
+type outputFile struct {
+	w      io.Writer
+	f      *os.File
+	closer io.Closer
+	index  func() error
+}
+
+func (out *outputFile) Write(p []byte) (int, error) {
+	return out.w.Write(p)
+}
+
+func (out *outputFile) Close() error {
+	var err error
+	if out.closer != nil {
+		err = out.closer.Close()
+	}
+	if ferr := out.f.Close(); err == nil {
+		err = ferr
+	}
+	if err == nil && out.index != nil {
+		err = out.index()
+	}
+	return err
+}
+
+// refSeqEnv is the environment variable that can hold the reference sequence itself, if
+// no reference is given any other way
+const refSeqEnv = "SNPS_REF_SEQ"
+
+// openReference opens the reference sequence file, or fetches it if it is of the form
+// accession:NC_045512.2. If no file is given, the reference is refSeq, the sequence
+// itself (from --ref-seq), or else the reference from a preset, or else the sequence in
+// $SNPS_REF_SEQ
+func openReference(reference string, presetName string, refSeq string) (io.ReadCloser, error) {
+	if strings.HasPrefix(reference, accessionPrefix) {
+		return openAccession(strings.TrimPrefix(reference, accessionPrefix))
+	}
+	if reference == "" && refSeq == "" && presetName == "" {
+		refSeq = os.Getenv(refSeqEnv)
+	}
+	if reference == "" && refSeq != "" {
+		// the sequence can be wrapped, but can't be fasta itself
+		if strings.Contains(refSeq, ">") {
+			return nil, usage("--ref-seq should be a sequence, not fasta")
+		}
+		return io.NopCloser(strings.NewReader(">ref\n" + strings.Join(strings.Fields(refSeq), "") + "\n")), nil
+	}
+	if reference == "" && presetName != "" {
+		p, err := getPreset(presetName)
+		if err != nil {
+			return nil, err
+		}
+		return p.reference()
+	}
+	return openReferenceIn(reference)
+}
+
+// fetchedGenBank holds the GenBank references that have been fetched from URLs, by URL,
+// since they are read twice, for their sequence and for their features
+var fetchedGenBank = struct {
+	sync.Mutex
+	files map[string][]byte
+}{files: make(map[string][]byte)}
+
+// openReferenceIn opens a reference as openIn does, except that a GenBank reference
+// given as a URL is only fetched once, and kept in memory to be opened again
+func openReferenceIn(reference string) (io.ReadCloser, error) {
+	if !isURL(reference) {
+		return openIn(reference)
+	}
+	fetchedGenBank.Lock()
+	defer fetchedGenBank.Unlock()
+	if b, ok := fetchedGenBank.files[reference]; ok {
+		return io.NopCloser(bytes.NewReader(b)), nil
+	}
+
+	in, err := openIn(reference)
+	if err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(in)
+	if start, _ := br.Peek(5); !fastaio.IsGenBank(start) {
+		return &inputFile{r: br, f: in}, nil
+	}
+	defer in.Close()
+	b, err := io.ReadAll(br)
+	if err != nil {
+		return nil, ioError{err}
+	}
+	fetchedGenBank.files[reference] = b
+	return io.NopCloser(bytes.NewReader(b)), nil
+}
+
+// readReference opens and reads the reference as openReference does. If validate is
+// true, the reference has to be one record of A, C, G and T (and N, if allowN)
+func readReference(reference string, presetName string, refSeq string, hardGaps bool, validate bool, allowN bool) ([]byte, error) {
+	seq, _, err := readNamedReference(reference, presetName, refSeq, hardGaps, validate, allowN)
+	return seq, err
+}
+
+// readNamedReference is readReference, but also returns the reference's ID
+func readNamedReference(reference string, presetName string, refSeq string, hardGaps bool, validate bool, allowN bool) ([]byte, string, error) {
+	refIn, err := openReference(reference, presetName, refSeq)
+	if err != nil {
+		return nil, "", err
+	}
+	defer refIn.Close()
+
+	ref, err := snps.ReadReferenceRecord(refIn, hardGaps, validate, allowN)
+	if err != nil {
+		return nil, "", err
+	}
+	return ref.Seq, ref.ID, nil
+}
+
+// readReferenceRegion reads the region of the reference, opened as openReference does.
+// If the reference is an uncompressed fasta file with a samtools faidx index next to it
+// (its name with .fai added), only the region itself is read from it
+func readReferenceRegion(reference string, presetName string, refSeq string, hardGaps bool, region snps.Region) ([]byte, error) {
+	if reference != "" && reference != "stdin" && !strings.HasPrefix(reference, accessionPrefix) && !isURL(reference) {
+		if faiIn, err := os.Open(reference + ".fai"); err == nil {
+			defer faiIn.Close()
+			f, err := os.Open(reference)
+			if err != nil {
+				return nil, err
+			}
+			defer f.Close()
+			// a compressed reference would need a .gzi index as well, so is read through
+			start := make([]byte, 6)
+			n, _ := f.ReadAt(start, 0)
+			compressed := false
+			for _, magic := range compressionMagic {
+				compressed = compressed || bytes.HasPrefix(start[:n], magic)
+			}
+			if !compressed {
+				return snps.ReadIndexedReferenceRegion(f, faiIn, region, hardGaps)
+			}
+		}
+	}
+
+	refIn, err := openReference(reference, presetName, refSeq)
+	if err != nil {
+		return nil, err
+	}
+	defer refIn.Close()
+
+	return snps.ReadReferenceRegion(refIn, region, hardGaps)
+}
+
+// readContigs opens the reference as openReference does, and reads each of its records
+// as a contig. If contigMap isn't empty, it is a file of query IDs and contigs
+func readContigs(reference string, presetName string, refSeq string, hardGaps bool, contigMap string) (*snps.Contigs, error) {
+	refIn, err := openReference(reference, presetName, refSeq)
+	if err != nil {
+		return nil, err
+	}
+	defer refIn.Close()
+
+	c, err := snps.ReadContigs(refIn, hardGaps)
+	if err != nil {
+		return nil, err
+	}
+	if contigMap != "" {
+		mapIn, err := openIn(contigMap)
+		if err != nil {
+			return nil, err
+		}
+		defer mapIn.Close()
+		c.Map, err = snps.ReadRenameMap(mapIn)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// readAnnotation reads the CDSs from a GFF3 file, or from a preset if no file is given,
+// or else from the reference's feature table, if it is a GenBank file. It returns nil if
+// there is none of them
+func readAnnotation(gff string, presetName string, reference string) ([]annotation.CDS, error) {
+	var gffIn io.ReadCloser
+	var err error
+
+	switch {
+	case gff != "":
+		gffIn, err = openIn(gff)
+	case presetName != "":
+		var p preset
+		p, err = getPreset(presetName)
+		if err != nil {
+			return nil, err
+		}
+		gffIn, err = p.annotation()
+	case reference != "" && reference != "stdin" && !strings.HasPrefix(reference, accessionPrefix):
+		return readGenBankAnnotation(reference)
+	default:
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer gffIn.Close()
+
+	return annotation.ReadGFF(gffIn)
+}
+
+// readGenBankAnnotation reads the CDSs from the feature table of a reference, if it is a
+// GenBank file, judging by its contents, and returns nil if it isn't
+func readGenBankAnnotation(reference string) ([]annotation.CDS, error) {
+	refIn, err := openReferenceIn(reference)
+	if err != nil {
+		return nil, err
+	}
+	defer refIn.Close()
+
+	br := bufio.NewReader(refIn)
+	if start, _ := br.Peek(5); !fastaio.IsGenBank(start) {
+		return nil, nil
+	}
+	return annotation.ReadGenBank(br)
+}
+
+// parseSize parses a number of bytes with an optional K, M, G or T suffix (powers of
+// 1024, which can be followed by B or iB), e.g. 512M or 2GiB
+func parseSize(size string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(size))
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "B"), "I")
+
+	multiplier := int64(1)
+	if s != "" {
+		switch s[len(s)-1] {
+		case 'K':
+			multiplier = 1 << 10
+		case 'M':
+			multiplier = 1 << 20
+		case 'G':
+			multiplier = 1 << 30
+		case 'T':
+			multiplier = 1 << 40
+		}
+		if multiplier > 1 {
+			s = s[:len(s)-1]
+		}
+	}
+
+	n, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || n < 0 {
+		return 0, usage("bad size: " + size)
+	}
+
+	return int64(n * float64(multiplier)), nil
+}
+
+// parseOutfile splits an --outfile of the form format:path, where format is a registered
+// output format, into the two. Any other outfile is a path to write defaultFormat to
+func parseOutfile(outfile string, defaultFormat string) (string, string) {
+	i := strings.Index(outfile, ":")
+	if i < 0 {
+		return defaultFormat, outfile
+	}
+	for _, name := range snps.OutputFormats() {
+		if outfile[:i] == name {
+			return name, outfile[i+1:]
+		}
+	}
+	return defaultFormat, outfile
+}
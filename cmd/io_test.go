@@ -0,0 +1,170 @@
+package cmd
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/benjamincjackson/snps/pkg/snps"
+)
+
+func TestParseSize(t *testing.T) {
+	sizes := map[string]int64{
+		"100":    100,
+		"512M":   512 << 20,
+		"2GiB":   2 << 30,
+		"1.5k":   1536,
+		"3 GB":   3 << 30,
+		"1T":     1 << 40,
+		"1024 b": 1024,
+	}
+	for s, expected := range sizes {
+		size, err := parseSize(s)
+		if err != nil {
+			t.Error(err)
+		}
+		if size != expected {
+			t.Errorf("problem in TestParseSize(): %s gave %d", s, size)
+		}
+	}
+
+	for _, s := range []string{"", "G", "lots", "-1M"} {
+		_, err := parseSize(s)
+		if err == nil {
+			t.Errorf("problem in TestParseSize(): expected an error for %q", s)
+		}
+	}
+}
+
+func TestParseOutfile(t *testing.T) {
+	outfiles := map[string][2]string{
+		"snps.csv":            {"csv", "snps.csv"},
+		"aggregate:freqs.csv": {"aggregate", "freqs.csv"},
+		"csv:stdout":          {"csv", "stdout"},
+		"C:\\out\\snps.csv":   {"csv", "C:\\out\\snps.csv"},
+	}
+	for outfile, expected := range outfiles {
+		format, path := parseOutfile(outfile, "csv")
+		if format != expected[0] || path != expected[1] {
+			t.Errorf("problem in TestParseOutfile(): %s gave %s and %s", outfile, format, path)
+		}
+	}
+}
+
+func TestOpenReferenceInline(t *testing.T) {
+	os.Setenv(refSeqEnv, "CCCC")
+	defer os.Unsetenv(refSeqEnv)
+
+	for refSeq, expected := range map[string]string{"ATG ATG\nATG": "ATGATGATG", "": "CCCC"} {
+		refIn, err := openReference("", "", refSeq)
+		if err != nil {
+			t.Fatal(err)
+		}
+		seq, err := snps.ReadReference(refIn, false)
+		refIn.Close()
+		if err != nil {
+			t.Error(err)
+		}
+		if len(seq) != len(expected) {
+			t.Errorf("problem in TestOpenReferenceInline(): %q gave a reference of length %d", refSeq, len(seq))
+		}
+	}
+
+	_, err := openReference("", "", ">ref\nATG")
+	if err == nil {
+		t.Errorf("problem in TestOpenReferenceInline(): fasta was accepted")
+	}
+}
+
+func TestCompression(t *testing.T) {
+	dir := t.TempDir()
+	fasta := ">ref\nATGATG\n"
+
+	// outputs are compressed by their extension or as asked, and inputs are recognised by
+	// their contents, whatever they are called
+	outputs := map[string]string{
+		"plain.fasta":    "",
+		"gzipped.gz":     "",
+		"zstd.fasta.zst": "",
+		"xz.fasta.xz":    "",
+		"gzipped.fasta":  compressionGzip,
+		"zstd.fasta":     compressionZstd,
+		"plain.fasta.gz": compressionNone,
+	}
+	for name, compression := range outputs {
+		path := filepath.Join(dir, name)
+		out, err := openCompressedOut(path, compression)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = io.WriteString(out, fasta); err != nil {
+			t.Error(err)
+		}
+		if err = out.Close(); err != nil {
+			t.Error(err)
+		}
+
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		compressed := !strings.HasPrefix(name, "plain")
+		if (string(raw) != fasta) != compressed {
+			t.Errorf("problem in TestCompression(): %s was compressed: %v", name, !compressed)
+		}
+
+		in, err := openIn(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(in)
+		in.Close()
+		if err != nil {
+			t.Error(err)
+		}
+		if string(data) != fasta {
+			t.Errorf("problem in TestCompression(): %s gave %q", name, data)
+		}
+	}
+}
+
+// failingCloser fails to close, as a compressed file does if its last block can't be
+// written
+type failingCloser struct{ closed *int }
+
+func (fc failingCloser) Close() error {
+	*fc.closed++
+	return errors.New("no space left on device")
+}
+
+func TestCloseOuts(t *testing.T) {
+	closed := 0
+	dir := t.TempDir()
+	out, err := openCompressedOut(filepath.Join(dir, "snps.csv.zst"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out.Write([]byte("query,SNPs\n"))
+
+	// every outfile is closed, and the error is the run's
+	err = closeOuts([]io.Closer{failingCloser{&closed}, out, failingCloser{&closed}})
+	if err == nil || exitCode(err) != exitIO || closed != 2 {
+		t.Errorf("problem in TestCloseOuts(): %v", err)
+	}
+	in, err := openIn(filepath.Join(dir, "snps.csv.zst"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(in)
+	in.Close()
+	if err != nil || string(b) != "query,SNPs\n" {
+		t.Errorf("problem in TestCloseOuts(): the file wasn't finished: %q, %v", string(b), err)
+	}
+
+	if err = closeOuts(nil); err != nil {
+		t.Errorf("problem in TestCloseOuts(): %v", err)
+	}
+}
@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/benjamincjackson/snps/pkg/snps"
+)
+
+// liveRows is the number of changes in the live table
+const liveRows = 10
+
+// liveInterval is how often the live table is redrawn
+const liveInterval = 500 * time.Millisecond
+
+// liveWriter is an OutputWriter that shows, while a run is going, a table of the most
+// frequent changes so far and the number of queries processed per second, redrawn in
+// place in the terminal, for triaging data before a run has finished
+type liveWriter struct {
+	w io.Writer
+
+	mu      sync.Mutex
+	records int
+	counts  map[string]int
+	start   time.Time
+	last    time.Time // when the table was last drawn
+	lastN   int       // and how many queries had been processed then
+	lines   int       // and how many lines it had, to draw over
+	stop    chan bool
+	stopped chan bool
+}
+
+func newLiveWriter(w io.Writer) *liveWriter {
+	return &liveWriter{w: w, counts: make(map[string]int), stop: make(chan bool), stopped: make(chan bool)}
+}
+
+// WriteHeader starts redrawing the table
+func (lw *liveWriter) WriteHeader() error {
+	lw.start = time.Now()
+	lw.last = lw.start
+	go func() {
+		ticker := time.NewTicker(liveInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				lw.draw(now)
+			case <-lw.stop:
+				close(lw.stopped)
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func (lw *liveWriter) WriteRecord(record snps.Record) error {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	lw.records++
+	for _, snp := range record.SNPs {
+		lw.counts[snp.String()]++
+	}
+	return nil
+}
+
+func (lw *liveWriter) WriteAggregate(snps.Aggregate) error {
+	return nil
+}
+
+// Close stops redrawing the table, and draws it for the last time
+func (lw *liveWriter) Close() error {
+	close(lw.stop)
+	<-lw.stopped
+	lw.draw(time.Now())
+	return nil
+}
+
+func (lw *liveWriter) draw(now time.Time) {
+	lw.mu.Lock()
+	lines := lw.table(now)
+	lw.mu.Unlock()
+
+	s := ""
+	if lw.lines > 0 {
+		// move up to the start of the last table and clear it
+		s = "\x1b[" + strconv.Itoa(lw.lines) + "A\x1b[J"
+	}
+	for _, line := range lines {
+		s += line + "\n"
+	}
+	lw.lines = len(lines)
+	io.WriteString(lw.w, s)
+}
+
+// table returns the lines of the table at now, and starts the next interval's rate
+func (lw *liveWriter) table(now time.Time) []string {
+	rate := 0.0
+	if interval := now.Sub(lw.last).Seconds(); interval > 0 {
+		rate = float64(lw.records-lw.lastN) / interval
+	}
+	lw.last, lw.lastN = now, lw.records
+
+	changes := make([]string, 0, len(lw.counts))
+	for change := range lw.counts {
+		changes = append(changes, change)
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		if lw.counts[changes[i]] != lw.counts[changes[j]] {
+			return lw.counts[changes[i]] > lw.counts[changes[j]]
+		}
+		return changes[i] < changes[j]
+	})
+	if len(changes) > liveRows {
+		changes = changes[:liveRows]
+	}
+
+	lines := []string{
+		fmt.Sprintf("%d queries in %s, %.0f/s", lw.records, now.Sub(lw.start).Round(time.Second), rate),
+		fmt.Sprintf("%-12s %10s %10s", "change", "count", "proportion"),
+	}
+	for _, change := range changes {
+		lines = append(lines, fmt.Sprintf("%-12s %10d %10.4f", change, lw.counts[change], float64(lw.counts[change])/float64(lw.records)))
+	}
+	return lines
+}
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benjamincjackson/snps/pkg/snps"
+)
+
+func TestLiveWriter(t *testing.T) {
+	out := new(bytes.Buffer)
+	lw := newLiveWriter(out)
+	err := lw.WriteHeader()
+	if err != nil {
+		t.Error(err)
+	}
+	for _, SNPs := range [][]snps.SNP{
+		{{Position: 6, Ref: "G", Alt: "C"}},
+		{{Position: 3, Ref: "G", Alt: "T"}, {Position: 6, Ref: "G", Alt: "C"}},
+		{},
+		{{Position: 6, Ref: "G", Alt: "C"}},
+	} {
+		err = lw.WriteRecord(snps.Record{SNPs: SNPs})
+		if err != nil {
+			t.Error(err)
+		}
+	}
+
+	lw.mu.Lock()
+	lines := lw.table(lw.start.Add(2 * time.Second))
+	lw.mu.Unlock()
+	expected := []string{
+		"4 queries in 2s, 2/s",
+		"change            count proportion",
+		"G6C                   3     0.7500",
+		"G3T                   1     0.2500",
+	}
+	if strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("problem in TestLiveWriter()")
+		fmt.Println(strings.Join(lines, "\n"))
+	}
+
+	err = lw.Close()
+	if err != nil {
+		t.Error(err)
+	}
+	if !strings.Contains(out.String(), "G6C") {
+		t.Errorf("problem in TestLiveWriter(): nothing was drawn")
+	}
+}
@@ -0,0 +1,163 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/benjamincjackson/snps/pkg/annotation"
+	"github.com/benjamincjackson/snps/pkg/snps"
+)
+
+// manifestJob is one row of a manifest: find the SNPs in query against reference,
+// and write them to outfile
+type manifestJob struct {
+	reference string
+	query     string
+	outfile   string
+	gff       string
+}
+
+// readManifest reads a CSV file with a header and reference, query and outfile
+// columns (and optionally a gff column), in any order. Relative paths in it are relative
+// to dir, the manifest's directory, so that it behaves the same wherever it is run from,
+// unless dir is "", e.g. for a manifest read from stdin
+func readManifest(r io.Reader, dir string) ([]manifestJob, error) {
+
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	columns := map[string]int{"reference": -1, "query": -1, "outfile": -1, "gff": -1}
+	for i, name := range header {
+		if _, ok := columns[name]; ok {
+			columns[name] = i
+		}
+	}
+	for _, name := range []string{"reference", "query", "outfile"} {
+		if columns[name] == -1 {
+			return nil, fmt.Errorf("%w: manifest has no %s column", snps.ErrBadCSV, name)
+		}
+	}
+
+	field := func(row []string, name string) string {
+		if columns[name] == -1 || columns[name] >= len(row) {
+			return ""
+		}
+		return manifestPath(dir, row[columns[name]])
+	}
+
+	jobs := make([]manifestJob, 0)
+
+	for {
+		row, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, manifestJob{
+			reference: field(row, "reference"),
+			query:     field(row, "query"),
+			outfile:   field(row, "outfile"),
+			gff:       field(row, "gff"),
+		})
+	}
+
+	return jobs, nil
+}
+
+// manifestPath returns path relative to dir, unless it is absolute, or isn't a file:
+// stdin, stdout, a URL or an accession
+func manifestPath(dir string, path string) string {
+	if dir == "" || path == "" || path == "stdin" || path == "stdout" || filepath.IsAbs(path) || isURL(path) || strings.HasPrefix(path, accessionPrefix) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+// runManifest runs each job in turn. References and annotations that are used by
+// more than one job are only read once. Jobs without a reference or gff use the
+// --reference, --gff and --preset given on the command line. opts.Regions is set
+// for each job from its gff, or from its reference if that is a GenBank file, and
+// wopts.Genes and wopts.ReferenceName from those, as they are for a single run
+func runManifest(jobs []manifestJob, format string, opts snps.Options, wopts snps.WriterOptions) error {
+
+	refSeqs := make(map[string][]byte)
+	refNames := make(map[string]string)
+	annotations := make(map[[2]string][]annotation.CDS)
+
+	for i, job := range jobs {
+		if job.reference == "" {
+			job.reference = snpsReference
+		}
+		if job.gff == "" {
+			job.gff = snpsGFF
+		}
+
+		refSeq, ok := refSeqs[job.reference]
+		if !ok {
+			var err error
+			refSeq, refNames[job.reference], err = readNamedReference(job.reference, snpsPreset, snpsRefSeq, opts.HardGaps, validateReference, allowN)
+			if err != nil {
+				return fmt.Errorf("manifest row %d: %w", i+1, err)
+			}
+			refSeqs[job.reference] = refSeq
+		}
+
+		annotationKey := [2]string{job.gff, job.reference}
+		regions, ok := annotations[annotationKey]
+		if !ok {
+			var err error
+			regions, err = readAnnotation(job.gff, snpsPreset, job.reference)
+			if err != nil {
+				return fmt.Errorf("manifest row %d: %w", i+1, err)
+			}
+			annotations[annotationKey] = regions
+		}
+
+		opts.Regions = regions
+		wopts.Genes = snps.GeneNames(regions)
+		wopts.ReferenceName = refNames[job.reference]
+
+		err := runJob(job, refSeq, format, opts, wopts)
+		if err != nil {
+			return fmt.Errorf("manifest row %d: %w", i+1, err)
+		}
+	}
+
+	return nil
+}
+
+func runJob(job manifestJob, refSeq []byte, format string, opts snps.Options, wopts snps.WriterOptions) error {
+	queryIn, err := openQuery(job.query)
+	if err != nil {
+		return err
+	}
+	defer queryIn.Close()
+
+	out, err := openCompressedOut(job.outfile, compress)
+	if err != nil {
+		return err
+	}
+
+	wopts.Annotated = opts.Regions != nil
+
+	ow, err := snps.NewOutputWriter(format, out, wopts)
+	if err == nil {
+		err = snps.RunReference(queryIn, refSeq, opts, ow)
+	}
+	if err != nil {
+		out.Close()
+		return err
+	}
+	// closing the outfile finishes it if it is compressed
+	return closeOuts([]io.Closer{out})
+}
@@ -0,0 +1,193 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/benjamincjackson/snps/pkg/snps"
+)
+
+func TestManifest(t *testing.T) {
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"ref1.fasta": ">ref1\nATGATG\n",
+		"ref2.fasta": ">ref2\nCCCC\n",
+		"q1.fasta":   ">Query1\nATGATC\n",
+		"q2.fasta":   ">Query2\nATTTTG\n",
+		"q3.fasta":   ">Query3\nCCGC\n",
+	}
+	for name, content := range files {
+		err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	manifest := "query,reference,outfile\n"
+	for _, job := range [][3]string{{"q1", "ref1", "out1"}, {"q2", "ref1", "out2"}, {"q3", "ref2", "out3"}} {
+		manifest += filepath.Join(dir, job[0]+".fasta") + "," + filepath.Join(dir, job[1]+".fasta") + "," + filepath.Join(dir, job[2]+".csv") + "\n"
+	}
+
+	jobs, err := readManifest(strings.NewReader(manifest), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 3 {
+		t.Fatalf("problem in TestManifest(): expected 3 jobs, got %d", len(jobs))
+	}
+
+	err = runManifest(jobs, "csv", snps.Options{}, snps.WriterOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"out1.csv": "query,SNPs\nQuery1,G6C\n",
+		"out2.csv": "query,SNPs\nQuery2,G3T|A4T\n",
+		"out3.csv": "query,SNPs\nQuery3,C3G\n",
+	}
+	for name, content := range expected {
+		out, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(out) != content {
+			t.Errorf("problem in TestManifest(): %s: %s", name, out)
+		}
+	}
+
+	_, err = readManifest(strings.NewReader("query,outfile\nq.fasta,out.csv\n"), "")
+	if err == nil {
+		t.Errorf("problem in TestManifest(): a manifest without a reference column was accepted")
+	}
+
+	// a compressed outfile is only written when it is closed, which can fail too
+	if _, err := os.Stat("/dev/full"); err == nil {
+		compress = compressionZstd
+		defer func() { compress = "" }()
+		job := manifestJob{query: filepath.Join(dir, "q1.fasta"), reference: filepath.Join(dir, "ref1.fasta"), outfile: "/dev/full"}
+		err = runManifest([]manifestJob{job}, "csv", snps.Options{}, snps.WriterOptions{})
+		if err == nil || exitCode(err) != exitIO {
+			t.Errorf("problem in TestManifest(): writing to a full disk gave %v", err)
+		}
+	}
+}
+
+func TestManifestMatchesRun(t *testing.T) {
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"ref.fasta": ">MN908947.3\nATGATGCCATGAATGTAA\n",
+		"q.fasta":   ">Query1\nATGATCCCATGAATGTAA\n>Query2\nATTATGCCCTGAATGTAA\n",
+		"ref.gff":   "##gff-version 3\nMN908947.3\t.\tCDS\t1\t12\t.\t+\t0\tID=cds-1;Name=g1\nMN908947.3\t.\tCDS\t13\t18\t.\t+\t0\tID=cds-2;Name=g2\n",
+	}
+	for name, content := range files {
+		err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	savedManifest, savedReference, savedGFF, savedFormat := snpsManifest, snpsReference, snpsGFF, outputFormat
+	savedQuery, savedOutfiles := snpsQuery, snpsOutfiles
+	defer func() {
+		snpsManifest, snpsReference, snpsGFF, outputFormat = savedManifest, savedReference, savedGFF, savedFormat
+		snpsQuery, snpsOutfiles = savedQuery, savedOutfiles
+		rootCmd.SetArgs(nil)
+	}()
+
+	// VCF output names the reference, and genes output lists every gene in the annotation,
+	// including g2, which has no changes
+	for _, format := range []string{"vcf", "genes"} {
+		manifest := "query,reference,gff,outfile\n" + path("q.fasta") + "," + path("ref.fasta") + "," + path("ref.gff") + "," + path("manifest."+format) + "\n"
+		err := os.WriteFile(path("manifest.csv"), []byte(manifest), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rootCmd.SetArgs([]string{"--manifest", path("manifest.csv"), "--format", format})
+		if err := rootCmd.Execute(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// --query and --outfile add to the values of the last run, so both outputs are
+	// written by one
+	snpsManifest, outputFormat = "", ""
+	rootCmd.SetArgs([]string{"-r", path("ref.fasta"), "--gff", path("ref.gff"), "-q", path("q.fasta"), "-o", "vcf:" + path("run.vcf"), "-o", "genes:" + path("run.genes")})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, format := range []string{"vcf", "genes"} {
+		manifestOut, err := os.ReadFile(path("manifest." + format))
+		if err != nil {
+			t.Fatal(err)
+		}
+		runOut, err := os.ReadFile(path("run." + format))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(runOut) == 0 || string(manifestOut) != string(runOut) {
+			t.Errorf("problem in TestManifestMatchesRun(): %s output from a manifest differs from a run", format)
+			fmt.Println(string(manifestOut))
+			fmt.Println(string(runOut))
+		}
+	}
+}
+
+func TestManifestRelativePaths(t *testing.T) {
+	dir := t.TempDir()
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	files := map[string]string{
+		"ref.fasta":    ">ref\nATGATG\n",
+		"q.fasta":      ">Query1\nATGATC\n",
+		"manifest.csv": "query,reference,outfile\nq.fasta,ref.fasta,out.csv\n",
+	}
+	for name, content := range files {
+		err := os.WriteFile(path(name), []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// run from somewhere else: the manifest's paths are relative to its directory
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	savedManifest := snpsManifest
+	defer func() {
+		os.Chdir(wd)
+		snpsManifest = savedManifest
+		rootCmd.SetArgs(nil)
+	}()
+
+	rootCmd.SetArgs([]string{"--manifest", path("manifest.csv")})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	out, err := os.ReadFile(path("out.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "query,SNPs\nQuery1,G6C\n" {
+		t.Errorf("problem in TestManifestRelativePaths(): %s", out)
+	}
+
+	// paths that aren't files are left alone
+	for _, p := range []string{"stdout", "/abs/ref.fasta", "https://example.com/ref.fasta", "accession:NC_045512.2"} {
+		if manifestPath(dir, p) != p {
+			t.Errorf("problem in TestManifestRelativePaths(): %s became %s", p, manifestPath(dir, p))
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"strings"
+
+	"github.com/benjamincjackson/snps/pkg/snps"
+	"github.com/spf13/cobra"
+)
+
+var matrixInfile string
+var matrixOutfile string
+var matrixPresence bool
+var matrixLayout string
+
+func init() {
+	rootCmd.AddCommand(matrixCmd)
+
+	matrixCmd.Flags().StringVarP(&matrixInfile, "infile", "i", "stdin", "Output of an earlier run, in csv format")
+	matrixCmd.Flags().StringVarP(&matrixOutfile, "outfile", "o", "stdout", "Matrix to write, in csv format")
+	matrixCmd.Flags().BoolVarP(&matrixPresence, "presence", "", false, "write a presence/absence matrix of snps instead of distances")
+	matrixCmd.Flags().StringVarP(&matrixLayout, "layout", "", snps.LayoutSquare, "layout of the distance matrix, one of: "+strings.Join(snps.MatrixLayouts, ", "))
+
+	matrixCmd.Flags().Lookup("presence").NoOptDefVal = "true"
+
+	matrixCmd.Flags().SortFlags = false
+}
+
+var matrixCmd = &cobra.Command{
+	Use:   "matrix",
+	Short: "Make a distance or presence/absence matrix from the output of an earlier run",
+	Long: `Make the matrix of pairwise snp distances between queries (the number of snps that
+one of each pair has and the other hasn't), or with --presence a matrix of which
+queries have which snps, from the per-query csv output of an earlier run. This is much
+cheaper than comparing the sequences again, but ignores missing data. --layout chooses
+between a square csv, its lower triangle, PHYLIP's format and a long csv of pairs.`,
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+
+		known := false
+		for _, layout := range snps.MatrixLayouts {
+			known = known || layout == matrixLayout
+		}
+		if !known {
+			return usage("--layout must be one of: " + strings.Join(snps.MatrixLayouts, ", "))
+		}
+
+		in, err := openIn(matrixInfile)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+
+		cr, err := snps.NewCSVReader(in)
+		if err != nil {
+			return err
+		}
+
+		out, err := openOut(matrixOutfile)
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+
+		format := "distance"
+		if matrixPresence {
+			format = "presence"
+		}
+		wopts := cr.WriterOptions()
+		wopts.MatrixLayout = matrixLayout
+		ow, err := snps.NewOutputWriter(format, out, wopts)
+		if err != nil {
+			return err
+		}
+
+		return snps.Convert(cr, ow)
+	},
+}
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"github.com/benjamincjackson/snps/pkg/snps"
+	"github.com/spf13/cobra"
+)
+
+var pairsQuery string
+var pairsFile string
+var pairsOutfile string
+var pairsHardGaps bool
+var pairsOnlyACGT bool
+
+func init() {
+	rootCmd.AddCommand(pairsCmd)
+
+	pairsCmd.Flags().StringVarP(&pairsQuery, "query", "q", "stdin", "Alignment of the sequences to compare, in fasta format")
+	pairsCmd.Flags().StringVarP(&pairsFile, "pairs", "p", "", "CSV file of the pairs of sequences to compare, with name_a and name_b columns (or the first two columns)")
+	pairsCmd.Flags().StringVarP(&pairsOutfile, "outfile", "o", "stdout", "SNPs between each pair to write, in csv format")
+	pairsCmd.Flags().BoolVarP(&pairsHardGaps, "hard-gaps", "", false, "don't treat alignment gaps as missing data")
+	pairsCmd.Flags().BoolVarP(&pairsOnlyACGT, "only-acgt", "", false, "treat ambiguity codes as missing data, so that they are never reported as snps")
+
+	pairsCmd.Flags().Lookup("hard-gaps").NoOptDefVal = "true"
+	pairsCmd.Flags().Lookup("only-acgt").NoOptDefVal = "true"
+
+	pairsCmd.Flags().SortFlags = false
+}
+
+var pairsCmd = &cobra.Command{
+	Use:   "pairs",
+	Short: "Find the snps between listed pairs of sequences in an alignment",
+	Long: `Find the snps between each listed pair of sequences in an alignment, e.g. putative
+transmission pairs, without comparing every sequence with every other. The first
+sequence of each pair is used as the reference, and only the sequences that are in a
+pair are kept in memory.`,
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+
+		if pairsFile == "" {
+			return usage("--pairs is required")
+		}
+		pairsIn, err := openIn(pairsFile)
+		if err != nil {
+			return err
+		}
+		pairs, err := snps.ReadPairs(pairsIn)
+		pairsIn.Close()
+		if err != nil {
+			return err
+		}
+
+		queryIn, err := openQuery(pairsQuery)
+		if err != nil {
+			return err
+		}
+		defer queryIn.Close()
+
+		results, err := snps.ComparePairs(queryIn, pairs, snps.Options{HardGaps: pairsHardGaps, OnlyACGT: pairsOnlyACGT})
+		if err != nil {
+			return err
+		}
+
+		out, err := openOut(pairsOutfile)
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+
+		return snps.WritePairSNPs(out, results)
+	},
+}
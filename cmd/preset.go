@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"sort"
+)
+
+// Each preset is a directory under presets/ holding a reference sequence
+// (reference.fasta) and an annotation of it (annotation.gff3). To add an organism,
+// add a directory and an entry to the presets map. The SARS-CoV-2 reference is fetched
+// from NCBI by go generate
+//
+//go:generate sh -c "curl -fsS 'https://eutils.ncbi.nlm.nih.gov/entrez/eutils/efetch.fcgi?db=nuccore&rettype=fasta&retmode=text&id=NC_045512.2' -o presets/sars-cov-2/reference.fasta"
+//go:embed presets
+var presetFS embed.FS
+
+type preset struct {
+	dir         string
+	description string
+}
+
+var presets = map[string]preset{
+	"sars-cov-2": {dir: "presets/sars-cov-2", description: "SARS-CoV-2, Wuhan-Hu-1 (NC_045512.2)"},
+}
+
+// presetNames returns the names of the available presets, sorted
+func presetNames() []string {
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func getPreset(name string) (preset, error) {
+	p, ok := presets[name]
+	if !ok {
+		return p, usage("unknown preset: " + name)
+	}
+	return p, nil
+}
+
+// openPresetFile opens one of the files embedded for a preset. It returns
+// fs.ErrNotExist if the preset doesn't include that file
+func openPresetFile(p preset, file string) (io.ReadCloser, error) {
+	f, err := presetFS.Open(p.dir + "/" + file)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (p preset) reference() (io.ReadCloser, error) {
+	f, err := openPresetFile(p, "reference.fasta")
+	// every preset should have a reference, so this is a broken build, not a bad flag
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("snps was built without the reference sequence of preset %s (run go generate ./cmd before building)", p.description)
+	}
+	return f, err
+}
+
+func (p preset) annotation() (io.ReadCloser, error) {
+	return openPresetFile(p, "annotation.gff3")
+}
@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+	"testing"
+
+	"github.com/benjamincjackson/snps/pkg/annotation"
+	"github.com/benjamincjackson/snps/pkg/encoding"
+	"github.com/benjamincjackson/snps/pkg/snps"
+)
+
+func TestPresetAnnotations(t *testing.T) {
+	for _, name := range presetNames() {
+		p, err := getPreset(name)
+		if err != nil {
+			t.Error(err)
+		}
+
+		f, err := p.annotation()
+		if err != nil {
+			t.Errorf("problem in TestPresetAnnotations(): %s: %s", name, err)
+			continue
+		}
+
+		regions, err := annotation.ReadGFF(f)
+		f.Close()
+		if err != nil || len(regions) == 0 {
+			t.Errorf("problem in TestPresetAnnotations(): couldn't read annotation for %s", name)
+		}
+	}
+}
+
+func TestPresetSARSCoV2(t *testing.T) {
+	p, err := getPreset("sars-cov-2")
+	if err != nil {
+		t.Error(err)
+	}
+
+	f, err := p.annotation()
+	if err != nil {
+		t.Error(err)
+	}
+	defer f.Close()
+
+	regions, err := annotation.ReadGFF(f)
+	if err != nil {
+		t.Error(err)
+	}
+
+	for _, region := range regions {
+		offsets := region.Offsets(23403)
+		if region.Name == "S" && (len(offsets) != 1 || offsets[0]/3+1 != 614) {
+			t.Errorf("problem in TestPresetSARSCoV2(): A23403G should be in codon 614 of S")
+		}
+		if region.Name != "S" && len(offsets) != 0 {
+			t.Errorf("problem in TestPresetSARSCoV2(): 23403 should only be in S")
+		}
+	}
+}
+
+func TestPresetRun(t *testing.T) {
+	if _, err := presetFS.Open("presets/sars-cov-2/reference.fasta"); errors.Is(err, fs.ErrNotExist) {
+		t.Skip("the SARS-CoV-2 reference hasn't been fetched, run go generate ./cmd")
+	}
+
+	refSeq, err := readReference("", "sars-cov-2", "", false, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(refSeq) != 29903 {
+		t.Fatalf("problem in TestPresetRun(): the reference is %d long", len(refSeq))
+	}
+	regions, err := readAnnotation("", "sars-cov-2", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the query is the reference with D614G
+	DA := encoding.MakeDecodingArray()
+	query := make([]string, len(refSeq))
+	for i, b := range refSeq {
+		query[i] = DA[b]
+	}
+	query[23402] = "G"
+
+	out := new(bytes.Buffer)
+	ow, err := snps.NewOutputWriter("csv", out, snps.WriterOptions{Annotated: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = snps.RunReference(strings.NewReader(">D614G\n"+strings.Join(query, "")+"\n"), refSeq, snps.Options{Regions: regions}, ow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out.String(), "query,SNPs,") || !strings.Contains(out.String(), "A23403G (S:D614G)") {
+		t.Errorf("problem in TestPresetRun()")
+		fmt.Println(out.String())
+	}
+}
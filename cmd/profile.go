@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"github.com/benjamincjackson/snps/pkg/snps"
+	"github.com/spf13/cobra"
+)
+
+var profileReference string
+var profileRefSeq string
+var profilePreset string
+var profileQuery string
+var profileFile string
+var profileOutfile string
+var profileHardGaps bool
+
+func init() {
+	rootCmd.AddCommand(profileCmd)
+
+	profileCmd.Flags().StringVarP(&profileReference, "reference", "r", "", "Reference sequence, in fasta format")
+	profileCmd.Flags().StringVarP(&profileRefSeq, "ref-seq", "", "", "The reference sequence itself, instead of a file. Can also be given in $"+refSeqEnv)
+	profileCmd.Flags().StringVarP(&profilePreset, "preset", "", "", "Use a built-in reference")
+	profileCmd.Flags().StringVarP(&profileQuery, "query", "q", "stdin", "Alignment of sequences to rank, in fasta format")
+	profileCmd.Flags().StringVarP(&profileFile, "profile", "p", "", "The changes to match, e.g. A23403G, separated by new lines, commas, | or spaces")
+	profileCmd.Flags().StringVarP(&profileOutfile, "outfile", "o", "stdout", "Ranked queries to write, in csv format")
+	profileCmd.Flags().BoolVarP(&profileHardGaps, "hard-gaps", "", false, "don't treat alignment gaps as missing data")
+
+	profileCmd.Flags().Lookup("hard-gaps").NoOptDefVal = "true"
+
+	profileCmd.Flags().SortFlags = false
+}
+
+var profileCmd = &cobra.Command{
+	Use:   "profile",
+	Short: "Rank the sequences in an alignment by how well they match a profile of snps",
+	Long: `Rank the sequences in an alignment by how completely they match a target profile of
+snps, e.g. to hunt for genomes that fit a hypothesised variant. At each site in the
+profile, a sequence either has the profile's change (matched), is N, ? or a gap there,
+or an ambiguity code that includes the change (missing), or has something else
+(mismatched). Sequences are ranked by the number of sites matched, then the number
+mismatched.`,
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+
+		if profileFile == "" {
+			return usage("--profile is required")
+		}
+		profileIn, err := openIn(profileFile)
+		if err != nil {
+			return err
+		}
+		profile, err := snps.ReadProfile(profileIn)
+		profileIn.Close()
+		if err != nil {
+			return err
+		}
+
+		refSeq, err := readReference(profileReference, profilePreset, profileRefSeq, profileHardGaps, false, false)
+		if err != nil {
+			return err
+		}
+
+		queryIn, err := openQuery(profileQuery)
+		if err != nil {
+			return err
+		}
+		defer queryIn.Close()
+
+		matches, err := snps.RankProfile(queryIn, refSeq, profile, snps.Options{HardGaps: profileHardGaps})
+		if err != nil {
+			return err
+		}
+
+		out, err := openOut(profileOutfile)
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+
+		return snps.WriteProfileMatches(out, matches)
+	},
+}
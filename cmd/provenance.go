@@ -0,0 +1,150 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// version is the version of snps, which can be set when it is built, e.g. with
+// -ldflags "-X github.com/benjamincjackson/snps/cmd.version=v1.2.0". If it isn't, the
+// module version from the build info is used
+var version string
+
+// toolVersion returns the version of snps, or "(devel)" if it isn't known
+func toolVersion() string {
+	if version != "" {
+		return version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	return "(devel)"
+}
+
+// provenance records how a run was done, so that its results can be reproduced and
+// audited: the version of snps, the command line, the value of every option, the inputs
+// and outputs with their checksums, when it started and finished, and its error, if it
+// failed
+type provenance struct {
+	Tool        string                 `json:"tool"`
+	Version     string                 `json:"version"`
+	GoVersion   string                 `json:"go_version"`
+	CommandLine []string               `json:"command_line"`
+	Started     time.Time              `json:"started"`
+	Finished    time.Time              `json:"finished"`
+	Seconds     float64                `json:"duration_seconds"`
+	Parameters  map[string]interface{} `json:"parameters"`
+	Inputs      []checksummedFile      `json:"inputs"`
+	Outputs     []checksummedFile      `json:"outputs"`
+	Error       string                 `json:"error,omitempty"`
+}
+
+// checksummedFile is one input or output of a run, and the option it was given to. Files
+// that can't be read, e.g. stdin, an accession or a file that wasn't written, have no
+// checksum
+type checksummedFile struct {
+	Option string `json:"option"`
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256,omitempty"`
+	Bytes  int64  `json:"bytes,omitempty"`
+}
+
+// newProvenance records a run with flags, which started at started and failed with
+// runErr, if it isn't nil. inputs and outputs are the names of the flags that give the
+// run's input and output files. Flags that are empty aren't listed as files
+func newProvenance(flags *pflag.FlagSet, inputs []string, outputs []string, started time.Time, runErr error) provenance {
+	finished := time.Now()
+	p := provenance{
+		Tool:        "snps",
+		Version:     toolVersion(),
+		GoVersion:   runtime.Version(),
+		CommandLine: os.Args,
+		Started:     started.UTC(),
+		Finished:    finished.UTC(),
+		Seconds:     finished.Sub(started).Seconds(),
+		Parameters:  make(map[string]interface{}),
+		Inputs:      provenanceFiles(flags, inputs),
+		Outputs:     provenanceFiles(flags, outputs),
+	}
+	flags.VisitAll(func(flag *pflag.Flag) {
+		if flag.Name == "help" {
+			return
+		}
+		if sv, ok := flag.Value.(pflag.SliceValue); ok {
+			p.Parameters[flag.Name] = sv.GetSlice()
+		} else {
+			p.Parameters[flag.Name] = flag.Value.String()
+		}
+	})
+	if runErr != nil {
+		p.Error = runErr.Error()
+	}
+	return p
+}
+
+// provenanceFiles returns the files given to the flags named in names
+func provenanceFiles(flags *pflag.FlagSet, names []string) []checksummedFile {
+	files := make([]checksummedFile, 0)
+	for _, name := range names {
+		flag := flags.Lookup(name)
+		if flag == nil {
+			continue
+		}
+		paths := []string{flag.Value.String()}
+		if sv, ok := flag.Value.(pflag.SliceValue); ok {
+			paths = sv.GetSlice()
+		}
+		for _, path := range paths {
+			if path == "" {
+				continue
+			}
+			if name == "outfile" {
+				_, path = parseOutfile(path, "")
+			}
+			file := checksummedFile{Option: name, Path: path}
+			file.SHA256, file.Bytes = checksum(path)
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// checksum returns the SHA-256 checksum and size of the regular file at path, or "" and
+// 0 if there isn't one there that can be read
+func checksum(path string) (string, int64) {
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return "", 0
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0
+	}
+	return hex.EncodeToString(h.Sum(nil)), n
+}
+
+// writeProvenance writes p as indented JSON to the file at path
+func writeProvenance(path string, p provenance) error {
+	out, err := openOut(path)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(p)
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+func TestNewProvenance(t *testing.T) {
+	dir := t.TempDir()
+	reference := filepath.Join(dir, "ref.fasta")
+	err := os.WriteFile(reference, []byte(">ref\nACGT\n"), 0644)
+	if err != nil {
+		t.Error(err)
+	}
+
+	var ref, query, gff string
+	var outfiles []string
+	var threshold float64
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	flags.StringVarP(&ref, "reference", "r", "", "")
+	flags.StringVarP(&query, "query", "q", "stdin", "")
+	flags.StringVarP(&gff, "gff", "", "", "")
+	flags.StringArrayVarP(&outfiles, "outfile", "o", []string{"stdout"}, "")
+	flags.Float64VarP(&threshold, "threshold", "", 0.0, "")
+
+	err = flags.Parse([]string{"-r", reference, "-o", "aggregate:" + filepath.Join(dir, "missing.csv"), "--threshold", "0.5"})
+	if err != nil {
+		t.Error(err)
+	}
+
+	started := time.Now()
+	p := newProvenance(flags, []string{"reference", "query", "gff"}, []string{"outfile"}, started, errors.New("failed"))
+
+	wantInputs := []checksummedFile{
+		{Option: "reference", Path: reference, SHA256: "c14c26c1c137190f5394cceef6e1abba1a88dd6dc65835177edd4caddfb5b2f2", Bytes: 10},
+		{Option: "query", Path: "stdin"},
+	}
+	if !reflect.DeepEqual(p.Inputs, wantInputs) {
+		t.Errorf("problem in TestNewProvenance(): %+v", p.Inputs)
+	}
+	if !reflect.DeepEqual(p.Outputs, []checksummedFile{{Option: "outfile", Path: filepath.Join(dir, "missing.csv")}}) {
+		t.Errorf("problem in TestNewProvenance(): %+v", p.Outputs)
+	}
+	if p.Parameters["threshold"] != "0.5" || !reflect.DeepEqual(p.Parameters["outfile"], []string{"aggregate:" + filepath.Join(dir, "missing.csv")}) {
+		t.Errorf("problem in TestNewProvenance(): %+v", p.Parameters)
+	}
+	if p.Error != "failed" || p.Started.After(p.Finished) || p.Version == "" {
+		t.Errorf("problem in TestNewProvenance(): %+v", p)
+	}
+}
@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// remoteClient fetches inputs given as URLs. It has no overall timeout, since an
+// alignment can take a long time to stream, but gives up on servers that don't answer
+var remoteClient = &http.Client{Transport: &http.Transport{
+	Proxy:                 http.ProxyFromEnvironment,
+	ResponseHeaderTimeout: time.Minute,
+}}
+
+// emptyHash is the SHA-256 hash of an empty request body, for signing S3 requests
+const emptyHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// isURL returns whether an input is a URL to fetch rather than a file
+func isURL(path string) bool {
+	for _, scheme := range []string{"http://", "https://", "s3://"} {
+		if strings.HasPrefix(path, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// openURL opens an input given as an http://, https:// or s3:// URL, whose body is
+// streamed as it is read, rather than downloaded first. s3:// URLs are fetched from
+// $AWS_ENDPOINT_URL, if it is set, e.g. for other S3-compatible stores, or else from
+// AWS in $AWS_REGION (or $AWS_DEFAULT_REGION, or us-east-1). Requests are signed with
+// $AWS_ACCESS_KEY_ID, $AWS_SECRET_ACCESS_KEY and $AWS_SESSION_TOKEN if they are set, or
+// else sent unsigned, for public buckets
+func openURL(url string) (io.ReadCloser, error) {
+	var req *http.Request
+	var err error
+	if strings.HasPrefix(url, "s3://") {
+		req, err = newS3Request(url, time.Now())
+	} else {
+		req, err = http.NewRequest(http.MethodGet, url, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := remoteClient.Do(req)
+	if err != nil {
+		return nil, ioError{err}
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, ioError{fmt.Errorf("couldn't fetch %s: %s", url, resp.Status)}
+	}
+	return resp.Body, nil
+}
+
+// newS3Request returns the GET request for an s3://bucket/key URL, signed at now if
+// there are credentials
+func newS3Request(url string, now time.Time) (*http.Request, error) {
+	bucket, key, ok := strings.Cut(strings.TrimPrefix(url, "s3://"), "/")
+	if !ok || bucket == "" || key == "" {
+		return nil, usage("bad S3 URL, which should be s3://bucket/key: " + url)
+	}
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	path := "/" + awsEscape(key)
+	endpoint := "https://" + bucket + ".s3." + region + ".amazonaws.com"
+	if e := os.Getenv("AWS_ENDPOINT_URL"); e != "" {
+		endpoint = strings.TrimSuffix(e, "/")
+		path = "/" + awsEscape(bucket) + path
+	}
+	req, err := http.NewRequest(http.MethodGet, endpoint+path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	accessKey, secretKey := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if accessKey != "" && secretKey != "" {
+		if token := os.Getenv("AWS_SESSION_TOKEN"); token != "" {
+			req.Header.Set("X-Amz-Security-Token", token)
+		}
+		signS3(req, accessKey, secretKey, region, now)
+	}
+	return req, nil
+}
+
+// signS3 signs a request with no body with AWS Signature Version 4, covering its host
+// and every header it has
+func signS3(req *http.Request, accessKey string, secretKey string, region string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", emptyHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.Join(values, ",")
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{req.Method, req.URL.EscapedPath(), req.URL.RawQuery, canonicalHeaders.String(), signedHeaders, emptyHash}, "\n")
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	scope := date + "/" + region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	mac := func(key []byte, data string) []byte {
+		h := hmac.New(sha256.New, key)
+		h.Write([]byte(data))
+		return h.Sum(nil)
+	}
+	signingKey := mac(mac(mac(mac([]byte("AWS4"+secretKey), date), region), "s3"), "aws4_request")
+	signature := hex.EncodeToString(mac(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+accessKey+"/"+scope+", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+// awsEscape escapes an S3 key as AWS does to sign it: every byte other than letters,
+// digits, -._~ and / is percent-encoded
+func awsEscape(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		b := s[i]
+		if b >= 'A' && b <= 'Z' || b >= 'a' && b <= 'z' || b >= '0' && b <= '9' || strings.IndexByte("-._~/", b) >= 0 {
+			sb.WriteByte(b)
+		} else {
+			fmt.Fprintf(&sb, "%%%02X", b)
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,861 @@
+package cmd
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/benjamincjackson/snps/pkg/snps"
+	"github.com/spf13/cobra"
+)
+
+var snpsReference string
+var snpsRefSeq string
+var snpsQuery []string
+var snpsOutfiles []string
+var outputFormat string
+var compress string
+var tabix bool
+var snpsGFF string
+var snpsPreset string
+var snpsConfig string
+var snpsManifest string
+var refFirst bool
+var contigs bool
+var contigMap string
+var snpsRegion string
+var includeRegex string
+var excludeRegex string
+var recordFilter string
+var snpFilter string
+var truncateIDs string
+var renameIDs string
+var sanitizeIDs bool
+var description bool
+var dateRegex string
+var dateField int
+var dateDelimiter string
+var snpsBarcodes string
+var snpsCatalogue string
+var snpsParents string
+var parentWindow int
+var snpsAmplicons string
+var dropoutFraction float64
+var maskPrimers string
+var siteWeights string
+var siteTrack string
+var homopolymerLength int
+var lowComplexityLength int
+var coreProportion float64
+var snpsMetadata string
+var metadataID string
+var metadataColumns []string
+var groupColumn string
+var association bool
+var discriminate string
+var trend bool
+var hardGaps bool
+var aggregate bool
+var thresh float64
+var minCount int
+var unambiguousAlts bool
+var onlyACGT bool
+var skipAmbiguousRef bool
+var validateReference bool
+var allowN bool
+var maxMemory string
+var limit int
+var ambiguities bool
+var resolutions bool
+var codonPositions bool
+var clusterCount int
+var clusterWindow int
+var withSamples bool
+var includeMissing bool
+var questionMarks string
+var lengthMismatch string
+var reorient bool
+var circular bool
+var rotationOffset int
+var live bool
+var debugPerf bool
+var maxSamples int
+var distanceOnly bool
+var clock bool
+var spectrum bool
+var trinucleotide bool
+var snapshotFile string
+var reportFile string
+var provenanceFile string
+var signaturePositions string
+var snapshotEvery int
+var snapshotInterval time.Duration
+var clockFilter float64
+
+func init() {
+	rootCmd.PersistentFlags().StringVarP(&snpsConfig, "config", "", "", "YAML file of options, keyed by flag name. Options given on the command line take precedence")
+	rootCmd.Flags().StringVarP(&snpsReference, "reference", "r", "", "Reference sequence, in fasta format, or GenBank format, whose CDSs annotate snps unless --gff is given, or accession:<accession> to fetch it from NCBI or ENA. Can be an http(s):// or s3:// URL")
+	rootCmd.Flags().StringVarP(&snpsRefSeq, "ref-seq", "", "", "The reference sequence itself, instead of a file, e.g. for short amplicons. Can also be given in $"+refSeqEnv)
+	rootCmd.Flags().BoolVarP(&validateReference, "validate-reference", "", false, "check that the reference is one record of A, C, G and T, and stop if it isn't")
+	rootCmd.Flags().BoolVarP(&allowN, "allow-n", "", false, "with --validate-reference, allow N in the reference")
+	rootCmd.Flags().StringArrayVarP(&snpsQuery, "query", "q", []string{"stdin"}, "Alignment of sequences to find snps in, in fasta format, or a .tar, .tar.gz or .zip archive of fasta files. Can be given more than once, or as a quoted glob pattern, e.g. 'batch_*.fasta', to read several files as one alignment, with a source column of the file each query came from. Can be an http(s):// or s3:// URL, which is streamed rather than downloaded first")
+	rootCmd.Flags().StringArrayVarP(&snpsOutfiles, "outfile", "o", []string{"stdout"}, "Output to write. Can be given more than once, and prefixed with an output format to write other formats from the same run, e.g. -o snps.csv -o aggregate:freqs.csv")
+	rootCmd.Flags().StringVarP(&outputFormat, "format", "", "", "the output format of --outfile, e.g. vcf for a multi-sample VCF with each query's genotype, for outfiles that aren't prefixed with one (default csv, or the format that other options choose, e.g. aggregate with --aggregate)")
+	rootCmd.Flags().StringVarP(&compress, "compress", "", "", "compress --outfile (and the outfiles of --manifest) with gzip, bgzip, zstd or xz, or none. By default outfiles ending .gz, .bgz, .zst or .xz are compressed with the matching format, and VCF outfiles ending .gz with bgzip")
+	rootCmd.Flags().BoolVarP(&tabix, "tabix", "", false, "write a tabix index of each VCF outfile alongside it, with .tbi added to its name, so that tools like bcftools and IGV can read it by position. The VCF has to be bgzip-compressed, e.g. -o gvcf:alignment.g.vcf.gz")
+	rootCmd.Flags().StringVarP(&signaturePositions, "signature-positions", "", "", "with signature output, also write the sites that the signatures are made of to this file, one per base")
+	rootCmd.Flags().BoolVarP(&refFirst, "ref-first", "", false, "use the first record in the query as the reference, and don't report it")
+	rootCmd.Flags().BoolVarP(&contigs, "contigs", "", false, "the reference is made up of several records, e.g. influenza segments or a chromosome and plasmids, and each query is compared with the one whose name is in its ID. Adds a contig column, and prefixes snps with their contig, e.g. HA:A100G")
+	rootCmd.Flags().StringVarP(&contigMap, "contig-map", "", "", "with --contigs, file of query IDs and the contigs they are to be compared with, one pair per line, separated by a tab or a comma")
+	rootCmd.Flags().StringVarP(&snpsRegion, "region", "", "", "only compare this region of the reference, as chrom:start-end (1-based and inclusive) or chrom, e.g. a locus of a bacterial genome. Queries are aligned to the whole of chrom, and positions are chrom's. With a samtools faidx index of the reference (its name with .fai added), only the region is read from it")
+	rootCmd.Flags().StringVarP(&includeRegex, "include-regex", "", "", "only process query records whose header line matches this regular expression")
+	rootCmd.Flags().StringVarP(&excludeRegex, "exclude-regex", "", "", "don't process query records whose header line matches this regular expression")
+	rootCmd.Flags().StringVarP(&recordFilter, "filter", "", "", "only output query records for which this expression is true, e.g. 'snp_count < 40 && completeness > 0.9'")
+	rootCmd.Flags().StringVarP(&snpFilter, "snp-filter", "", "", "only report SNPs for which this expression is true, e.g. 'alt != \"-\" && position > 100'")
+	rootCmd.Flags().StringVarP(&truncateIDs, "truncate-ids", "", "", "cut each query ID at the first occurrence of this string, e.g. '|'")
+	rootCmd.Flags().StringVarP(&renameIDs, "rename-ids", "", "", "file of old and new query IDs, one pair per line, separated by a tab or a comma")
+	rootCmd.Flags().BoolVarP(&sanitizeIDs, "sanitize-ids", "", false, "replace characters in query IDs other than letters, digits and ._-/| with _")
+	rootCmd.Flags().BoolVarP(&description, "description", "", false, "add a column with each query's whole header line")
+	rootCmd.Flags().StringVarP(&dateRegex, "date-regex", "", "", "regular expression matching each query's collection date (YYYY-MM-DD) in its header line, or whose first group does. Adds date, ISO week and epi week columns")
+	rootCmd.Flags().IntVarP(&dateField, "date-field", "", 0, "alternatively, the field of the header line that holds the collection date, counting from 1")
+	rootCmd.Flags().StringVarP(&dateDelimiter, "date-delimiter", "", "|", "with --date-field, the string that separates fields in the header line")
+	rootCmd.Flags().BoolVarP(&ambiguities, "ambiguities", "", false, "add a column of sites where the query resolves an ambiguity code in the reference, or vice versa, e.g. R5A")
+	rootCmd.Flags().BoolVarP(&resolutions, "resolutions", "", false, "add a column of sites where the reference is an ambiguity code, N or ? and the query is A, C, G or T, e.g. R5A, to improve a draft reference")
+	rootCmd.Flags().BoolVarP(&includeMissing, "include-missing", "", false, "also report sites where the reference is A, C, G or T and the query is N or ?, e.g. A100N: in their own column, or counted with the snps with --aggregate")
+	rootCmd.Flags().IntVarP(&clusterCount, "cluster-snps", "", 0, "add a column flagging clusters of at least this many snps within --cluster-window bases, e.g. possible recombinants or contamination")
+	rootCmd.Flags().IntVarP(&clusterWindow, "cluster-window", "", 100, "with --cluster-snps, the window that a cluster's snps must be within")
+	rootCmd.Flags().StringVarP(&snpsCatalogue, "catalogue", "", "", "CSV file of changes and labels for them (change and label columns), e.g. drug resistance or antigenic sites. Adds a column of the labels of the listed changes found, to per-query and --aggregate output")
+	rootCmd.Flags().StringVarP(&snpsBarcodes, "barcodes", "", "", "lineage barcodes in Freyja's CSV format. If provided, each query is assigned the lineage it matches best")
+	rootCmd.Flags().StringVarP(&snpsParents, "parents", "", "", "two or more candidate parent sequences, in fasta format and aligned to the reference. Adds columns of the segments of each query closest to each parent, and the breakpoints between them, to screen for recombinants")
+	rootCmd.Flags().IntVarP(&parentWindow, "parent-window", "", 1000, "with --parents, the size of the windows that are each assigned to a parent")
+	rootCmd.Flags().StringVarP(&snpsAmplicons, "amplicons", "", "", "amplicon scheme in BED format, either the primers (named like SARS-CoV-2_1_LEFT and SARS-CoV-2_1_RIGHT) or the amplicons themselves. Adds a column of the amplicons that have dropped out of each query")
+	rootCmd.Flags().Float64VarP(&dropoutFraction, "dropout-fraction", "", 0.5, "with --amplicons, the proportion of an amplicon that has to be N or gaps for it to have dropped out")
+	rootCmd.Flags().StringVarP(&snpsMetadata, "metadata", "", "", "CSV or TSV file of metadata about the queries, with a header")
+	rootCmd.Flags().StringVarP(&metadataID, "metadata-id", "", "", "the column of --metadata holding query IDs (default the first column)")
+	rootCmd.Flags().StringSliceVarP(&metadataColumns, "metadata-columns", "", nil, "the columns of --metadata to add to auspice and microreact output, separated by commas (default all of them)")
+	rootCmd.Flags().StringVarP(&groupColumn, "group", "", "", "the column of --metadata to group queries by, or without --metadata one of lineage (with --barcodes), month, iso_week or epi_week (with --date-field or --date-regex). With --aggregate, report the proportions of each change in each group")
+	rootCmd.Flags().StringVarP(&snpsManifest, "manifest", "", "", "CSV file with reference, query and outfile columns (and optionally gff), to process many jobs in one go")
+	rootCmd.Flags().StringVarP(&snpsGFF, "gff", "", "", "Annotation of the reference in GFF3 format. If provided, SNPs are also reported with their amino acid consequences")
+	rootCmd.Flags().BoolVarP(&codonPositions, "codon-positions", "", false, "with --gff or --preset, add a column pairing each snp with its codon number and position in the codon, e.g. A23403G (S:614:2)")
+	rootCmd.Flags().StringVarP(&snpsPreset, "preset", "", "", "Use a built-in reference and annotation, one of: "+strings.Join(presetNames(), ", ")+". --reference and --gff take precedence over the preset")
+	rootCmd.Flags().BoolVarP(&hardGaps, "hard-gaps", "", false, "don't treat alignment gaps as missing data")
+	rootCmd.Flags().StringVarP(&questionMarks, "question-mark", "", "", "what ? means in the reference and query: n (read it as N), gap (read it as a gap) or error (stop if there is one). By default it is kept as ?, missing data like N")
+	rootCmd.Flags().StringVarP(&lengthMismatch, "on-length-mismatch", "", "", "what to do with queries whose length differs from the reference's: error, skip (with a warning), pad (shorter queries with N) or truncate (longer queries). By default longer queries are an error and shorter ones are compared as far as they go")
+	rootCmd.Flags().BoolVarP(&reorient, "reorient", "", false, "reverse-complement queries that look like the reverse complement of the reference, with a warning, instead of reporting hundreds of spurious snps")
+	rootCmd.Flags().BoolVarP(&circular, "circular", "", false, "the reference is circular, e.g. a plasmid or a mitochondrion: rotate each query into its coordinates, finding where the query starts in the reference, so that queries that start at a different origin are compared correctly")
+	rootCmd.Flags().IntVarP(&rotationOffset, "rotation-offset", "", 0, "with --circular, rotate every query by this many bases instead: the first base of each query is at this 0-based position in the reference")
+	rootCmd.Flags().BoolVarP(&onlyACGT, "only-acgt", "", false, "treat ambiguity codes in the query as missing data, so that they are never reported as snps")
+	rootCmd.Flags().BoolVarP(&skipAmbiguousRef, "skip-ambiguous-ref", "", false, "ignore alignment columns where the reference is N, a gap or another ambiguity code")
+	rootCmd.Flags().StringVarP(&maskPrimers, "mask-primers", "", "", "BED file of regions to ignore when calling snps, e.g. the primer-binding sites of an ARTIC-style primer BED, whose sequence comes from the primers rather than the sample")
+	rootCmd.Flags().StringVarP(&siteWeights, "weights", "", "", "file of reference positions and weights, e.g. the probability that a call there is right, one pair per line, separated by a tab or a comma. Each snp is given the weight of its site (1 if it isn't listed), which is written with it and used to weight aggregate proportions, so that error-prone sites can be down-weighted rather than masked")
+	rootCmd.Flags().StringVarP(&siteTrack, "track", "", "", "bedGraph or wiggle file of a numeric track of the reference, e.g. conservation scores. Each snp is given the score of its site (NA if the track has none there), which is written with it and, with --aggregate, in a column of its own")
+	rootCmd.Flags().IntVarP(&homopolymerLength, "homopolymer-length", "", 0, "flag snps (and gaps, with --hard-gaps) in reference homopolymers of at least this many bases, or that make one, the main source of errors in nanopore consensus genomes. Adds a column pairing flagged snps with their context, e.g. A100G (homopolymer:6)")
+	rootCmd.Flags().IntVarP(&lowComplexityLength, "low-complexity-length", "", 0, "flag snps in reference tandem repeats of a 2- or 3-base unit (e.g. ATATAT) at least this long, like --homopolymer-length")
+	rootCmd.Flags().Float64VarP(&coreProportion, "core", "", 0, "only report snps at core sites, which are called as A, C, G or T in at least this proportion of the queries, e.g. 0.95, as in core-genome snp workflows. Output is held back until every query has been compared")
+	rootCmd.Flags().IntVarP(&limit, "limit", "", 0, "only process the first this many query records, for a quick preview")
+	rootCmd.Flags().BoolVarP(&live, "live", "", false, "while processing, show a table of the most frequent snps so far and the number of queries processed per second, redrawn in the terminal")
+	rootCmd.Flags().BoolVarP(&debugPerf, "debug-perf", "", false, "at the end of the run, report the records per second of reading, comparing and writing, how long the comparing workers spent busy and waiting for each other stage, and which stage looks like the bottleneck, to stderr")
+	rootCmd.Flags().StringVarP(&maxMemory, "max-memory", "", "", "limit the total size of the query sequences held in memory at once, e.g. 2G. Reading is held up until there is room")
+	rootCmd.Flags().BoolVarP(&distanceOnly, "distance-only", "", false, "only write each query's number of snps, which are counted without being listed, for a large speedup when only divergence is needed")
+	rootCmd.Flags().BoolVarP(&aggregate, "aggregate", "", false, "report the proportions of each change")
+	rootCmd.Flags().Float64VarP(&thresh, "threshold", "", 0.0, "if --aggregate, only report snps with a freq above this value")
+	rootCmd.Flags().IntVarP(&minCount, "min-count", "", 0, "if --aggregate, only report snps found in at least this many queries")
+	rootCmd.Flags().StringVarP(&snapshotFile, "snapshot", "", "", "if --aggregate, also write snapshots of the proportions so far to this file while the run is going, e.g. for a dashboard")
+	rootCmd.Flags().IntVarP(&snapshotEvery, "snapshot-every", "", 0, "with --snapshot, write a snapshot after every this many queries")
+	rootCmd.Flags().DurationVarP(&snapshotInterval, "snapshot-interval", "", time.Minute, "with --snapshot, write a snapshot at least this often while queries are arriving, e.g. 30s. 0 turns it off")
+	rootCmd.Flags().StringVarP(&reportFile, "report", "", "", "also write a standalone HTML report of the run to this file, with the most common changes, a histogram of snps per query and an overview of missing data, e.g. for colleagues who don't use the command line")
+	rootCmd.Flags().StringVarP(&provenanceFile, "provenance", "", "", "also write a JSON record of the run to this file: the inputs and outputs with their checksums, every option, the version of snps and when it ran, so that its results can be reproduced")
+	rootCmd.Flags().BoolVarP(&unambiguousAlts, "unambiguous-alts", "", false, "if --aggregate, only report snps whose alternative allele is A, C, G or T")
+	rootCmd.Flags().BoolVarP(&withSamples, "with-samples", "", false, "if --aggregate, add a column of the queries each snp is found in")
+	rootCmd.Flags().IntVarP(&maxSamples, "max-samples", "", 0, "with --with-samples, list at most this many queries per snp, followed by ... if there are more")
+	rootCmd.Flags().BoolVarP(&trend, "trend", "", false, "fit a logistic growth rate over time to each snp with a freq above --threshold, using dates from --date-field or --date-regex")
+	rootCmd.Flags().BoolVarP(&clock, "clock", "", false, "regress each query's snp distance from the reference on its date from --date-field or --date-regex, and report the substitution rate per year, the root date and outliers")
+	rootCmd.Flags().Float64VarP(&clockFilter, "clock-filter", "", 3, "with --clock, the number of interquartile ranges from the median residual that makes a query an outlier")
+	rootCmd.Flags().BoolVarP(&spectrum, "spectrum", "", false, "count the changes of each of the 12 substitution types (A>C, A>G, ...), e.g. to detect APOBEC-style editing or batch artefacts")
+	rootCmd.Flags().BoolVarP(&trinucleotide, "trinucleotide", "", false, "with --spectrum, split the substitutions by the reference's bases either side of them into the 96 categories of mutational signatures, e.g. T[C>T]A")
+	rootCmd.Flags().BoolVarP(&association, "association", "", false, "test each snp for an association with --group, which must have two values, and report odds ratios and p-values")
+	rootCmd.Flags().StringVarP(&discriminate, "discriminate", "", "", "two values of --group separated by a comma, e.g. B.1.1.7,B.1.351: report a small set of snps that tells their queries apart, chosen greedily, e.g. for designing a typing assay")
+
+	rootCmd.Flags().Lookup("hard-gaps").NoOptDefVal = "true"
+	rootCmd.Flags().Lookup("only-acgt").NoOptDefVal = "true"
+	rootCmd.Flags().Lookup("skip-ambiguous-ref").NoOptDefVal = "true"
+	rootCmd.Flags().Lookup("aggregate").NoOptDefVal = "true"
+	rootCmd.Flags().Lookup("association").NoOptDefVal = "true"
+	rootCmd.Flags().Lookup("trend").NoOptDefVal = "true"
+	rootCmd.Flags().Lookup("unambiguous-alts").NoOptDefVal = "true"
+	rootCmd.Flags().Lookup("ref-first").NoOptDefVal = "true"
+	rootCmd.Flags().Lookup("contigs").NoOptDefVal = "true"
+	rootCmd.Flags().Lookup("validate-reference").NoOptDefVal = "true"
+	rootCmd.Flags().Lookup("allow-n").NoOptDefVal = "true"
+	rootCmd.Flags().Lookup("sanitize-ids").NoOptDefVal = "true"
+	rootCmd.Flags().Lookup("description").NoOptDefVal = "true"
+	rootCmd.Flags().Lookup("ambiguities").NoOptDefVal = "true"
+	rootCmd.Flags().Lookup("resolutions").NoOptDefVal = "true"
+	rootCmd.Flags().Lookup("codon-positions").NoOptDefVal = "true"
+	rootCmd.Flags().Lookup("with-samples").NoOptDefVal = "true"
+	rootCmd.Flags().Lookup("include-missing").NoOptDefVal = "true"
+	rootCmd.Flags().Lookup("live").NoOptDefVal = "true"
+	rootCmd.Flags().Lookup("debug-perf").NoOptDefVal = "true"
+	rootCmd.Flags().Lookup("tabix").NoOptDefVal = "true"
+	rootCmd.Flags().Lookup("distance-only").NoOptDefVal = "true"
+	rootCmd.Flags().Lookup("clock").NoOptDefVal = "true"
+	rootCmd.Flags().Lookup("spectrum").NoOptDefVal = "true"
+	rootCmd.Flags().Lookup("trinucleotide").NoOptDefVal = "true"
+	rootCmd.Flags().Lookup("reorient").NoOptDefVal = "true"
+	rootCmd.Flags().Lookup("circular").NoOptDefVal = "true"
+
+	rootCmd.Flags().SortFlags = false
+}
+
+var rootCmd = &cobra.Command{
+	Use:   "snps",
+	Short: "snps...",
+	Long:  `snps...`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+
+		if snpsConfig != "" {
+			configIn, err := openIn(snpsConfig)
+			if err != nil {
+				return err
+			}
+			err = applyConfig(cmd.Flags(), configIn)
+			configIn.Close()
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+
+		if provenanceFile != "" {
+			started := time.Now()
+			// written last, once the outputs are closed, and even if the run fails
+			defer func() {
+				p := newProvenance(cmd.Flags(), provenanceInputs, provenanceOutputs, started, err)
+				if perr := writeProvenance(provenanceFile, p); perr != nil && err == nil {
+					err = perr
+				}
+			}()
+		}
+
+		format := "csv"
+		if aggregate {
+			format = "aggregate"
+			if groupColumn != "" {
+				format = "stratified"
+			}
+		}
+		if association {
+			if aggregate {
+				return usage("can't use --aggregate with --association")
+			}
+			if groupColumn == "" {
+				return usage("--association needs --group")
+			}
+			format = "association"
+		}
+		var discriminateGroups []string
+		if discriminate != "" {
+			if aggregate || association {
+				return usage("can't use --discriminate with --aggregate or --association")
+			}
+			if groupColumn == "" {
+				return usage("--discriminate needs --group")
+			}
+			discriminateGroups = strings.Split(discriminate, ",")
+			if len(discriminateGroups) != 2 || discriminateGroups[0] == "" || discriminateGroups[1] == "" || discriminateGroups[0] == discriminateGroups[1] {
+				return usage("--discriminate should be two different groups separated by a comma, e.g. A,B")
+			}
+			format = "discriminate"
+		}
+		if trend {
+			if aggregate || association || discriminate != "" {
+				return usage("can't use --trend with --aggregate, --association or --discriminate")
+			}
+			if dateRegex == "" && dateField == 0 {
+				return usage("--trend needs --date-field or --date-regex")
+			}
+			format = "trend"
+		}
+		if clock {
+			if aggregate || association || discriminate != "" || trend {
+				return usage("can't use --clock with --aggregate, --association, --discriminate or --trend")
+			}
+			if dateRegex == "" && dateField == 0 {
+				return usage("--clock needs --date-field or --date-regex")
+			}
+			if clockFilter <= 0 {
+				return usage("--clock-filter must be greater than 0")
+			}
+			format = "clock"
+		}
+		if spectrum {
+			if aggregate || association || discriminate != "" || trend || clock {
+				return usage("can't use --spectrum with --aggregate, --association, --discriminate, --trend or --clock")
+			}
+			format = "spectrum"
+		}
+		if trinucleotide && contigs {
+			return usage("can't use --trinucleotide with --contigs")
+		}
+		if distanceOnly && (aggregate || association || discriminate != "" || trend || spectrum) {
+			return usage("can't use --distance-only with --aggregate, --association, --discriminate, --trend or --spectrum")
+		}
+		if distanceOnly && !clock {
+			format = "distance-only"
+		}
+		if outputFormat != "" {
+			if format != "csv" {
+				return usage("can't use --format with an option that chooses the output format, e.g. --aggregate; prefix --outfile with the format instead, e.g. -o vcf:snps.vcf")
+			}
+			if _, err := snps.NewOutputWriter(outputFormat, io.Discard, snps.WriterOptions{}); err != nil {
+				return usage("unknown --format " + outputFormat + ", which should be one of: " + strings.Join(snps.OutputFormats(), ", "))
+			}
+			format = outputFormat
+		}
+
+		opts := snps.Options{HardGaps: hardGaps, OnlyACGT: onlyACGT, SkipAmbiguousRef: skipAmbiguousRef, Limit: limit, Ambiguities: ambiguities, Resolutions: resolutions, IncludeMissing: includeMissing, QuestionMarks: questionMarks, LengthMismatch: lengthMismatch, Reorient: reorient, Circular: circular, RotationOffset: rotationOffset, CountOnly: distanceOnly}
+		if contigs && (refFirst || validateReference) {
+			return usage("can't use --contigs with --ref-first or --validate-reference")
+		}
+		var region *snps.Region
+		if snpsRegion != "" {
+			if contigs || refFirst || validateReference {
+				return usage("can't use --region with --contigs, --ref-first or --validate-reference")
+			}
+			r, err := snps.ParseRegion(snpsRegion)
+			if err != nil {
+				return usage(err.Error())
+			}
+			region = &r
+		}
+		if contigMap != "" && !contigs {
+			return usage("--contig-map needs --contigs")
+		}
+		if rotationOffset != 0 && !circular {
+			return usage("--rotation-offset needs --circular")
+		}
+		if rotationOffset < 0 {
+			return usage("--rotation-offset can't be negative")
+		}
+
+		opts.Warn = func(message string) {
+			cmd.PrintErrln("Warning:", message)
+		}
+
+		if clusterCount > 0 {
+			if clusterWindow < 1 {
+				return usage("--cluster-window must be at least 1")
+			}
+			opts.Clusters = snps.ClusterOptions{Count: clusterCount, Window: clusterWindow}
+		}
+
+		if maxMemory != "" {
+			opts.MaxMemory, err = parseSize(maxMemory)
+			if err != nil {
+				return err
+			}
+		}
+		opts.Include, opts.Exclude, err = compileFilters(includeRegex, excludeRegex)
+		if err != nil {
+			return err
+		}
+		if recordFilter != "" {
+			opts.Filter, err = snps.CompileFilter(recordFilter)
+			if err != nil {
+				return usage("bad --filter: " + err.Error())
+			}
+		}
+		if snpFilter != "" {
+			if distanceOnly {
+				return usage("can't use --snp-filter with --distance-only")
+			}
+			opts.SNPFilter, err = snps.CompileSNPFilter(snpFilter)
+			if err != nil {
+				return usage("bad --snp-filter: " + err.Error())
+			}
+		}
+
+		opts.IDs, err = readIDOptions(truncateIDs, renameIDs, sanitizeIDs)
+		if err != nil {
+			return err
+		}
+
+		opts.Dates, err = dateOptions(dateRegex, dateField, dateDelimiter)
+		if err != nil {
+			return err
+		}
+		if snpsBarcodes != "" {
+			barcodesIn, err := openIn(snpsBarcodes)
+			if err != nil {
+				return err
+			}
+			opts.Barcodes, err = snps.ReadBarcodes(barcodesIn)
+			barcodesIn.Close()
+			if err != nil {
+				return err
+			}
+		}
+
+		if snpsParents != "" {
+			if parentWindow < 1 {
+				return usage("--parent-window must be at least 1")
+			}
+			parentsIn, err := openIn(snpsParents)
+			if err != nil {
+				return err
+			}
+			opts.Parents, err = snps.ReadParents(parentsIn, parentWindow)
+			parentsIn.Close()
+			if err != nil {
+				return err
+			}
+		}
+
+		if maskPrimers != "" {
+			maskIn, err := openIn(maskPrimers)
+			if err != nil {
+				return err
+			}
+			opts.Mask, err = snps.ReadMask(maskIn)
+			maskIn.Close()
+			if err != nil {
+				return err
+			}
+		}
+
+		if siteWeights != "" {
+			if contigs || distanceOnly {
+				return usage("can't use --weights with --contigs or --distance-only")
+			}
+			weightsIn, err := openIn(siteWeights)
+			if err != nil {
+				return err
+			}
+			opts.Weights, err = snps.ReadWeights(weightsIn)
+			weightsIn.Close()
+			if err != nil {
+				return err
+			}
+		}
+
+		if siteTrack != "" {
+			if distanceOnly {
+				return usage("can't use --track with --distance-only")
+			}
+			trackIn, err := openIn(siteTrack)
+			if err != nil {
+				return err
+			}
+			opts.Track, err = snps.ReadTrack(trackIn)
+			trackIn.Close()
+			if err != nil {
+				return err
+			}
+		}
+
+		if homopolymerLength < 0 || lowComplexityLength < 0 {
+			return usage("--homopolymer-length and --low-complexity-length can't be negative")
+		}
+		if coreProportion < 0 || coreProportion > 1 {
+			return usage("--core must be between 0 and 1")
+		}
+		if coreProportion > 0 && (contigs || distanceOnly) {
+			return usage("can't use --core with --contigs or --distance-only")
+		}
+		opts.Core = coreProportion
+		opts.Context = snps.ContextOptions{Homopolymer: homopolymerLength, LowComplexity: lowComplexityLength}
+		if distanceOnly && (homopolymerLength > 0 || lowComplexityLength > 0) {
+			return usage("can't use --homopolymer-length or --low-complexity-length with --distance-only")
+		}
+
+		if snpsAmplicons != "" {
+			if dropoutFraction <= 0 || dropoutFraction > 1 {
+				return usage("--dropout-fraction must be greater than 0 and at most 1")
+			}
+			ampliconsIn, err := openIn(snpsAmplicons)
+			if err != nil {
+				return err
+			}
+			opts.Amplicons, err = snps.ReadAmplicons(ampliconsIn, dropoutFraction)
+			ampliconsIn.Close()
+			if err != nil {
+				return err
+			}
+		}
+
+		switch {
+		case groupColumn == "":
+		case snpsMetadata != "":
+			metadataIn, err := openIn(snpsMetadata)
+			if err != nil {
+				return err
+			}
+			opts.Groups, err = snps.ReadGroups(metadataIn, metadataID, groupColumn)
+			metadataIn.Close()
+			if err != nil {
+				return err
+			}
+		case groupColumn == snps.GroupLineage:
+			if opts.Barcodes == nil {
+				return usage("--group lineage needs --barcodes")
+			}
+			opts.GroupBy = groupColumn
+		case groupColumn == snps.GroupMonth || groupColumn == snps.GroupISOWeek || groupColumn == snps.GroupEpiWeek:
+			if dateRegex == "" && dateField == 0 {
+				return usage("--group " + groupColumn + " needs --date-field or --date-regex")
+			}
+			opts.GroupBy = groupColumn
+		default:
+			return usage("--group " + groupColumn + " needs --metadata")
+		}
+
+		wopts := snps.WriterOptions{Threshold: thresh, MinCount: minCount, UnambiguousAlts: unambiguousAlts, Description: description, Dates: dateRegex != "" || dateField > 0, Lineages: opts.Barcodes != nil, Ambiguities: ambiguities, Resolutions: resolutions, CodonPositions: codonPositions, Clusters: clusterCount > 0, Parents: snpsParents != "", Dropouts: snpsAmplicons != "", Contigs: contigs, WithSamples: withSamples, MaxSamples: maxSamples, Missing: includeMissing, ClockFilter: clockFilter, Weights: siteWeights != "", Scores: siteTrack != "", Contexts: homopolymerLength > 0 || lowComplexityLength > 0, Trinucleotide: trinucleotide, Discriminate: discriminateGroups}
+
+		if snpsCatalogue != "" {
+			catalogueIn, err := openIn(snpsCatalogue)
+			if err != nil {
+				return err
+			}
+			wopts.Catalogue, err = snps.ReadCatalogue(catalogueIn)
+			catalogueIn.Close()
+			if err != nil {
+				return err
+			}
+		}
+
+		switch compress {
+		case "", compressionGzip, compressionBgzip, compressionZstd, compressionXz, compressionNone:
+		default:
+			return usage("--compress should be gzip, bgzip, zstd, xz or none")
+		}
+
+		if snpsManifest != "" {
+			if debugPerf {
+				return usage("can't use --debug-perf with --manifest")
+			}
+			if tabix {
+				return usage("can't use --tabix with --manifest")
+			}
+			manifestIn, err := openIn(snpsManifest)
+			if err != nil {
+				return err
+			}
+			// the manifest's relative paths are relative to its directory, if it is a file
+			dir := ""
+			if snpsManifest != "stdin" && !isURL(snpsManifest) {
+				dir = filepath.Dir(snpsManifest)
+			}
+			jobs, err := readManifest(manifestIn, dir)
+			manifestIn.Close()
+			if err != nil {
+				return err
+			}
+			return runManifest(jobs, format, opts, wopts)
+		}
+
+		queryIn, source, err := openQueries(snpsQuery)
+		if err != nil {
+			return err
+		}
+		defer queryIn.Close()
+		opts.Source = source
+		wopts.Source = source != nil
+
+		// a GenBank reference made up of contigs isn't annotated from its features, since contigs
+		// can't be annotated (--gff and --preset are rejected with them below)
+		annotationReference := snpsReference
+		if contigs {
+			annotationReference = ""
+		}
+		opts.Regions, err = readAnnotation(snpsGFF, snpsPreset, annotationReference)
+		if err != nil {
+			return err
+		}
+
+		wopts.Annotated = opts.Regions != nil
+		wopts.Genes = snps.GeneNames(opts.Regions)
+		if contigs && wopts.Annotated {
+			return usage("can't annotate a reference made up of contigs with --gff or --preset")
+		}
+
+		// the reference is read before the outputs are opened, so that they can be given its
+		// name, e.g. for the contig of VCF output
+		var refSeq []byte
+		switch {
+		case refFirst:
+			if snpsReference != "" || snpsRefSeq != "" {
+				return usage("can't use --reference or --ref-seq with --ref-first")
+			}
+		case contigs:
+		case region != nil:
+			refSeq, err = readReferenceRegion(snpsReference, snpsPreset, snpsRefSeq, hardGaps, *region)
+			if err != nil {
+				return err
+			}
+			opts.Mask = region.Mask(len(refSeq), opts.Mask)
+			wopts.ReferenceName = region.Contig
+		default:
+			refSeq, wopts.ReferenceName, err = readNamedReference(snpsReference, snpsPreset, snpsRefSeq, hardGaps, validateReference, allowN)
+			if err != nil {
+				return err
+			}
+		}
+
+		// the outfiles are closed once the run has finished, by closeOuts, since closing
+		// them finishes compressed files and writes their indexes. If the run fails they
+		// are closed here
+		var outs []io.Closer
+		defer func() {
+			for _, out := range outs {
+				out.Close()
+			}
+		}()
+
+		if signaturePositions != "" {
+			positionsOut, err := openOut(signaturePositions)
+			if err != nil {
+				return err
+			}
+			outs = append(outs, positionsOut)
+			wopts.SignaturePositions = positionsOut
+		}
+
+		writers := make([]snps.OutputWriter, 0, len(snpsOutfiles))
+		signature := false
+		spectrumOut := false
+		indexed := false
+		for _, outfile := range snpsOutfiles {
+			outFormat, path := parseOutfile(outfile, format)
+			spectrumOut = spectrumOut || outFormat == "spectrum"
+			if outFormat == "vcf" || outFormat == "gvcf" || outFormat == "population-vcf" {
+				opts.MissingRanges = true
+			}
+			if (outFormat == "auspice" || outFormat == "microreact") && snpsMetadata != "" && wopts.Metadata.Values == nil {
+				metadataIn, err := openIn(snpsMetadata)
+				if err != nil {
+					return err
+				}
+				wopts.Metadata, err = snps.ReadMetadata(metadataIn, metadataID, metadataColumns)
+				metadataIn.Close()
+				if err != nil {
+					return err
+				}
+			}
+			if outFormat == "genes" && !wopts.Annotated {
+				return usage("genes output needs --gff or --preset")
+			}
+			if outFormat == "signature" {
+				if signature {
+					return usage("can't write signature output more than once")
+				}
+				signature = true
+			}
+			if distanceOnly && outFormat != "distance-only" && outFormat != "clock" {
+				return usage("can't write " + outFormat + " output with --distance-only, since the snps are only counted")
+			}
+			// bcftools and the like need VCF to be compressed with bgzip, which can be read as
+			// gzip, to index it
+			compression := compress
+			if compression == "" && path != "stdout" {
+				compression = compressionExtensions[strings.ToLower(filepath.Ext(path))]
+			}
+			schema, _ := snps.OutputSchema(outFormat)
+			vcf := schema.Kind == snps.KindVCF
+			if vcf && compress == "" && compression == compressionGzip {
+				compression = compressionBgzip
+			}
+			var snpsOut io.WriteCloser
+			if tabix && vcf {
+				if path == "stdout" || compression != compressionBgzip {
+					return usage("--tabix needs VCF outfiles to be files compressed with bgzip, e.g. -o gvcf:alignment.g.vcf.gz")
+				}
+				indexed = true
+				snpsOut, err = openIndexedOut(path)
+			} else {
+				snpsOut, err = openCompressedOut(path, compression)
+			}
+			if err != nil {
+				return err
+			}
+			outs = append(outs, snpsOut)
+			ow, err := snps.NewOutputWriter(outFormat, snpsOut, wopts)
+			if err != nil {
+				return err
+			}
+			writers = append(writers, ow)
+		}
+		if tabix && !indexed {
+			return usage("--tabix needs VCF output, e.g. -o gvcf:alignment.g.vcf.gz")
+		}
+		if trinucleotide && !spectrumOut {
+			return usage("--trinucleotide needs spectrum output, e.g. --spectrum")
+		}
+		if signaturePositions != "" && !signature {
+			return usage("--signature-positions needs signature output, e.g. -o signature:signatures.fasta")
+		}
+		if snapshotFile != "" {
+			if !aggregate {
+				return usage("--snapshot needs --aggregate")
+			}
+			snapshotOut, err := openOut(snapshotFile)
+			if err != nil {
+				return err
+			}
+			outs = append(outs, snapshotOut)
+			writers = append(writers, snps.NewSnapshotWriter(snapshotOut, snps.SnapshotOptions{Every: snapshotEvery, Interval: snapshotInterval}, wopts))
+		}
+		if reportFile != "" {
+			if distanceOnly {
+				return usage("can't use --report with --distance-only, since the snps are only counted")
+			}
+			reportOut, err := openOut(reportFile)
+			if err != nil {
+				return err
+			}
+			outs = append(outs, reportOut)
+			opts.CountMissing = true
+			reportOpts := wopts
+			reportOpts.MissingSites = true
+			ow, err := snps.NewOutputWriter("report", reportOut, reportOpts)
+			if err != nil {
+				return err
+			}
+			writers = append(writers, ow)
+		}
+		if live {
+			writers = append(writers, newLiveWriter(os.Stderr))
+		}
+		if debugPerf {
+			perf := new(snps.Perf)
+			opts.Perf = perf
+			// reported once the run has finished, if it finishes
+			defer func() {
+				if err == nil {
+					err = perf.Report(cmd.ErrOrStderr())
+				}
+			}()
+		}
+		ow := writers[0]
+		if len(writers) > 1 {
+			ow = snps.MultiWriter(writers...)
+		}
+
+		switch {
+		case contigs:
+			var c *snps.Contigs
+			c, err = readContigs(snpsReference, snpsPreset, snpsRefSeq, hardGaps, contigMap)
+			if err != nil {
+				return err
+			}
+			err = snps.RunContigs(queryIn, c, opts, ow)
+		case refFirst:
+			err = snps.RunRefFirst(queryIn, opts, ow)
+		default:
+			err = snps.RunReference(queryIn, refSeq, opts, ow)
+		}
+		if err != nil {
+			return err
+		}
+
+		err = closeOuts(outs)
+		outs = nil
+		return err
+	},
+}
+
+// closeOuts closes the outfiles of a run that has finished. Closing them finishes
+// compressed files and writes their indexes, so if that fails, so has the run
+func closeOuts(outs []io.Closer) error {
+	var err error
+	for _, out := range outs {
+		if cerr := out.Close(); cerr != nil && err == nil {
+			err = ioError{cerr}
+		}
+	}
+	return err
+}
+
+// provenanceInputs and provenanceOutputs are the flags that give a run's input and
+// output files, for --provenance
+var provenanceInputs = []string{"config", "reference", "query", "gff", "manifest", "metadata", "barcodes", "parents", "amplicons", "mask-primers", "weights", "track", "catalogue", "rename-ids", "contig-map"}
+var provenanceOutputs = []string{"outfile", "snapshot", "report", "signature-positions"}
+
+// readIDOptions returns the IDOptions for --truncate-ids, --rename-ids and --sanitize-ids
+func readIDOptions(truncate string, rename string, sanitize bool) (snps.IDOptions, error) {
+	idOpts := snps.IDOptions{Truncate: truncate, Sanitize: sanitize}
+	if rename != "" {
+		renameIn, err := openIn(rename)
+		if err != nil {
+			return idOpts, err
+		}
+		defer renameIn.Close()
+		idOpts.Rename, err = snps.ReadRenameMap(renameIn)
+		if err != nil {
+			return idOpts, err
+		}
+	}
+	return idOpts, nil
+}
+
+// dateOptions returns the DateOptions for --date-regex, --date-field and --date-delimiter
+func dateOptions(regex string, field int, delimiter string) (snps.DateOptions, error) {
+	dopts := snps.DateOptions{Field: field, Delimiter: delimiter}
+	if regex != "" {
+		re, err := regexp.Compile(regex)
+		if err != nil {
+			return dopts, usage("bad --date-regex: " + err.Error())
+		}
+		dopts.Regex = re
+	}
+	if field > 0 && delimiter == "" {
+		return dopts, usage("--date-delimiter can't be empty")
+	}
+	return dopts, nil
+}
+
+// compileFilters compiles the regular expressions given to --include-regex and
+// --exclude-regex. Empty expressions compile to nil
+func compileFilters(include string, exclude string) (*regexp.Regexp, *regexp.Regexp, error) {
+	var includeRE, excludeRE *regexp.Regexp
+	var err error
+	if include != "" {
+		includeRE, err = regexp.Compile(include)
+		if err != nil {
+			return nil, nil, usage("bad --include-regex: " + err.Error())
+		}
+	}
+	if exclude != "" {
+		excludeRE, err = regexp.Compile(exclude)
+		if err != nil {
+			return nil, nil, usage("bad --exclude-regex: " + err.Error())
+		}
+	}
+	return includeRE, excludeRE, nil
+}
+
+// Execute runs the root command, and exits with the exit code for its error, if it has
+// one. Usage is only printed for usage errors
+func Execute() {
+	rootCmd.SilenceErrors = true
+	rootCmd.SilenceUsage = true
+	rootCmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		return usageError{err}
+	})
+
+	cmd, err := rootCmd.ExecuteC()
+	if err == nil {
+		return
+	}
+	code := exitCode(err)
+	cmd.PrintErrln("Error:", err.Error())
+	if code == exitUsage {
+		cmd.PrintErrln(cmd.UsageString())
+	}
+	os.Exit(code)
+}
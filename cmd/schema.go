@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/benjamincjackson/snps/pkg/snps"
+	"github.com/spf13/cobra"
+)
+
+var schemaFormat string
+var schemaOutfile string
+
+func init() {
+	rootCmd.AddCommand(schemaCmd)
+
+	schemaCmd.Flags().StringVarP(&schemaFormat, "format", "f", "json", "how to write the schemas: json, or arrow for Apache Arrow's JSON schema representation (of the csv and tsv output formats only)")
+	schemaCmd.Flags().StringVarP(&schemaOutfile, "outfile", "o", "stdout", "File to write the schemas to")
+
+	schemaCmd.Flags().SortFlags = false
+}
+
+var schemaCmd = &cobra.Command{
+	Use:   "schema [output format...]",
+	Short: "Describe the columns of each output format",
+	Long: `Write a machine-readable schema of each output format (or of the ones given), with
+the version of snps and of the schemas, so that downstream loaders can check the files
+they are given and keep up with changes to them. For csv, tsv and parquet formats, the
+schema lists the columns in the order they are written, with their types and the
+options that add them. Columns named in braces, e.g. {group}, are named after the data.`,
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+
+		if schemaFormat != "json" && schemaFormat != "arrow" {
+			return usage("--format should be json or arrow")
+		}
+
+		schemas := snps.OutputSchemas()
+		if len(args) > 0 {
+			schemas = schemas[:0:0]
+			for _, format := range args {
+				schema, ok := snps.OutputSchema(format)
+				if !ok {
+					return fmt.Errorf("%w: %s", snps.ErrUnknownFormat, format)
+				}
+				schemas = append(schemas, schema)
+			}
+		}
+
+		out, err := openOut(schemaOutfile)
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		if schemaFormat == "json" {
+			return enc.Encode(schemaDocument{ToolVersion: toolVersion(), SchemaVersion: snps.SchemaVersion, Formats: schemas})
+		}
+
+		arrow := make(map[string]arrowSchema)
+		for _, schema := range schemas {
+			if schema.Kind == snps.KindCSV || schema.Kind == snps.KindTSV {
+				arrow[schema.Format] = toArrow(schema)
+			}
+		}
+		return enc.Encode(arrowDocument{ToolVersion: toolVersion(), SchemaVersion: snps.SchemaVersion, Schemas: arrow})
+	},
+}
+
+// schemaDocument is what snps schema writes with --format json
+type schemaDocument struct {
+	ToolVersion   string        `json:"tool_version"`
+	SchemaVersion int           `json:"schema_version"`
+	Formats       []snps.Schema `json:"formats"`
+}
+
+// arrowDocument is what snps schema writes with --format arrow: an Arrow schema for each
+// csv and tsv output format, in the JSON representation of Arrow's integration tests
+type arrowDocument struct {
+	ToolVersion   string                 `json:"tool_version"`
+	SchemaVersion int                    `json:"schema_version"`
+	Schemas       map[string]arrowSchema `json:"schemas"`
+}
+
+type arrowSchema struct {
+	Fields   []arrowField    `json:"fields"`
+	Metadata []arrowMetadata `json:"metadata"`
+}
+
+type arrowField struct {
+	Name     string                 `json:"name"`
+	Nullable bool                   `json:"nullable"`
+	Type     map[string]interface{} `json:"type"`
+	Children []arrowField           `json:"children"`
+	Metadata []arrowMetadata        `json:"metadata,omitempty"`
+}
+
+type arrowMetadata struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// toArrow returns the Arrow schema of a csv or tsv output format. Lists are lists of
+// strings, which are split on | when the file is read
+func toArrow(schema snps.Schema) arrowSchema {
+	types := map[string]map[string]interface{}{
+		snps.TypeString:  {"name": "utf8"},
+		snps.TypeInteger: {"name": "int", "bitWidth": 64, "isSigned": true},
+		snps.TypeNumber:  {"name": "floatingpoint", "precision": "DOUBLE"},
+		snps.TypeBoolean: {"name": "bool"},
+		snps.TypeDate:    {"name": "date", "unit": "DAY"},
+		snps.TypeList:    {"name": "list"},
+	}
+	as := arrowSchema{
+		Fields: make([]arrowField, len(schema.Columns)),
+		Metadata: []arrowMetadata{
+			{Key: "snps.format", Value: schema.Format},
+			{Key: "snps.schema_version", Value: strconv.Itoa(schema.Version)},
+		},
+	}
+	for i, column := range schema.Columns {
+		field := arrowField{Name: column.Name, Nullable: column.Nullable, Type: types[column.Type], Children: []arrowField{}}
+		if column.Type == snps.TypeList {
+			field.Children = []arrowField{{Name: "item", Type: types[snps.TypeString], Children: []arrowField{}}}
+		}
+		field.Metadata = append(field.Metadata, arrowMetadata{Key: "description", Value: column.Description})
+		if column.Option != "" {
+			field.Metadata = append(field.Metadata, arrowMetadata{Key: "snps.option", Value: column.Option})
+		}
+		if column.Repeated {
+			field.Metadata = append(field.Metadata, arrowMetadata{Key: "snps.repeated", Value: "true"})
+		}
+		as.Fields[i] = field
+	}
+	return as
+}
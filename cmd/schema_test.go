@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/benjamincjackson/snps/pkg/snps"
+)
+
+func TestToArrow(t *testing.T) {
+	schema, ok := snps.OutputSchema("csv")
+	if !ok {
+		t.Fatal("problem in TestToArrow(): no schema for csv")
+	}
+	as := toArrow(schema)
+	if len(as.Fields) != len(schema.Columns) {
+		t.Fatalf("problem in TestToArrow(): %d fields", len(as.Fields))
+	}
+
+	for i, field := range as.Fields {
+		column := schema.Columns[i]
+		if field.Name != column.Name || field.Nullable != column.Nullable || field.Type["name"] == nil {
+			t.Errorf("problem in TestToArrow(): %+v", field)
+		}
+		switch column.Name {
+		case "SNPs":
+			if field.Type["name"] != "list" || len(field.Children) != 1 || field.Children[0].Type["name"] != "utf8" {
+				t.Errorf("problem in TestToArrow(): %+v", field)
+			}
+		case "date":
+			if field.Type["name"] != "date" || field.Metadata[1] != (arrowMetadata{Key: "snps.option", Value: "Dates"}) {
+				t.Errorf("problem in TestToArrow(): %+v", field)
+			}
+		}
+	}
+	if as.Metadata[0] != (arrowMetadata{Key: "snps.format", Value: "csv"}) {
+		t.Errorf("problem in TestToArrow(): %+v", as.Metadata)
+	}
+}
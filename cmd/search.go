@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+
+	"github.com/benjamincjackson/snps/pkg/snps"
+	"github.com/spf13/cobra"
+)
+
+var searchIndex string
+var searchPattern string
+var searchOutfile string
+var searchCount bool
+
+func init() {
+	rootCmd.AddCommand(searchCmd)
+
+	searchCmd.Flags().StringVarP(&searchIndex, "index", "i", "", "Index made by snps index")
+	searchCmd.Flags().StringVarP(&searchPattern, "pattern", "p", "", "snps to search for, combined with AND (or a comma), OR, NOT and parentheses, e.g. 'C23604A,A23403G' or 'G23012A OR (A23403G AND NOT C23604A)'")
+	searchCmd.Flags().StringVarP(&searchOutfile, "outfile", "o", "stdout", "Names of the matching samples to write, one per line")
+	searchCmd.Flags().BoolVarP(&searchCount, "count", "", false, "only write the number of matching samples")
+
+	searchCmd.Flags().Lookup("count").NoOptDefVal = "true"
+
+	searchCmd.Flags().SortFlags = false
+}
+
+var searchCmd = &cobra.Command{
+	Use:   "search",
+	Short: "Find the samples in an index that match a pattern of snps",
+	Long: `Find the samples in an index made by snps index that match a pattern of snps, without
+reading the alignment again. A pattern is made of snps, which match the samples that
+have them, combined with NOT, AND and OR (in that order of precedence) and
+parentheses. A comma is the same as AND.`,
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+
+		if searchIndex == "" || searchPattern == "" {
+			return usage("search needs --index and --pattern")
+		}
+
+		in, err := openIn(searchIndex)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+
+		idx, err := snps.ReadIndex(in)
+		if err != nil {
+			return err
+		}
+
+		matches, err := idx.Search(searchPattern)
+		if err != nil {
+			return err
+		}
+
+		out, err := openOut(searchOutfile)
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+
+		w := bufio.NewWriter(out)
+		if searchCount {
+			_, err = fmt.Fprintln(w, len(matches))
+		} else {
+			for _, match := range matches {
+				if _, err = w.WriteString(match + "\n"); err != nil {
+					break
+				}
+			}
+		}
+		if err != nil {
+			return err
+		}
+		return w.Flush()
+	},
+}
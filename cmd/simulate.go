@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"bufio"
+	"strconv"
+	"strings"
+
+	"github.com/benjamincjackson/snps/pkg/encoding"
+	"github.com/benjamincjackson/snps/pkg/simulate"
+	"github.com/benjamincjackson/snps/pkg/snps"
+	"github.com/spf13/cobra"
+)
+
+var simReference string
+var simPreset string
+var simOutfile string
+var simTruth string
+var simOpts simulate.Options
+
+func init() {
+	rootCmd.AddCommand(simulateCmd)
+
+	simulateCmd.Flags().StringVarP(&simReference, "reference", "r", "", "Reference sequence, in fasta format")
+	simulateCmd.Flags().StringVarP(&simPreset, "preset", "", "", "Use a built-in reference")
+	simulateCmd.Flags().StringVarP(&simOutfile, "outfile", "o", "stdout", "Alignment to write, in fasta format")
+	simulateCmd.Flags().StringVarP(&simTruth, "truth", "t", "", "CSV file to write the SNPs, deletions and runs of Ns in each record to")
+	simulateCmd.Flags().IntVarP(&simOpts.Records, "records", "n", 100, "number of records to make")
+	simulateCmd.Flags().IntVarP(&simOpts.Substitutions, "substitutions", "", 10, "number of substitutions per record")
+	simulateCmd.Flags().IntVarP(&simOpts.Deletions, "deletions", "", 0, "number of deletions per record")
+	simulateCmd.Flags().IntVarP(&simOpts.MaxDeletionLength, "deletion-length", "", 10, "maximum length of a deletion")
+	simulateCmd.Flags().IntVarP(&simOpts.NRuns, "n-runs", "", 0, "number of runs of Ns per record")
+	simulateCmd.Flags().IntVarP(&simOpts.NRunLength, "n-run-length", "", 200, "length of a run of Ns")
+	simulateCmd.Flags().Int64VarP(&simOpts.Seed, "seed", "", 1, "random seed")
+
+	simulateCmd.Flags().SortFlags = false
+}
+
+var simulateCmd = &cobra.Command{
+	Use:   "simulate",
+	Short: "Make a synthetic alignment with known changes",
+	Long: `Make a synthetic alignment from a reference, with a number of random substitutions,
+deletions (runs of gaps) and runs of Ns in each record, and optionally a truth table
+of the SNPs that snps should find in each record, and where the deletions and runs
+of Ns are. Later changes can overwrite earlier ones. Insertions can't be represented
+in an alignment to the reference, so there aren't any.`,
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+
+		if simOpts.Records < 0 || simOpts.Substitutions < 0 || simOpts.Deletions < 0 || simOpts.NRuns < 0 {
+			return usage("numbers of records and changes can't be negative")
+		}
+
+		refSeq, err := readReference(simReference, simPreset, "", false, false, false)
+		if err != nil {
+			return err
+		}
+
+		DA := encoding.MakeDecodingArray()
+		ref := make([]byte, len(refSeq))
+		for i, nuc := range refSeq {
+			// characters that aren't IUPAC codes have no decoding
+			ref[i] = 'N'
+			if DA[nuc] != "" {
+				ref[i] = DA[nuc][0]
+			}
+		}
+
+		out, err := openOut(simOutfile)
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+		w := bufio.NewWriter(out)
+
+		var tw *bufio.Writer
+		if simTruth != "" {
+			truthOut, err := openOut(simTruth)
+			if err != nil {
+				return err
+			}
+			defer truthOut.Close()
+			tw = bufio.NewWriter(truthOut)
+			_, err = tw.WriteString("query,SNPs,deletions,N_runs\n")
+			if err != nil {
+				return err
+			}
+		}
+
+		s := simulate.NewSimulator(ref, simOpts)
+		for {
+			record, ok := s.Next()
+			if !ok {
+				break
+			}
+
+			_, err = w.WriteString(">" + record.ID + "\n" + string(record.Seq) + "\n")
+			if err != nil {
+				return err
+			}
+
+			if tw != nil {
+				_, err = tw.WriteString(record.ID + "," + joinSNPs(record.SNPs) + "," + joinRanges(record.Deletions) + "," + joinRanges(record.NRuns) + "\n")
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		if tw != nil {
+			err = tw.Flush()
+			if err != nil {
+				return err
+			}
+		}
+
+		return w.Flush()
+	},
+}
+
+func joinSNPs(SNPs []snps.SNP) string {
+	s := make([]string, len(SNPs))
+	for i, snp := range SNPs {
+		s[i] = snp.String()
+	}
+	return strings.Join(s, "|")
+}
+
+func joinRanges(ranges [][2]int) string {
+	s := make([]string, len(ranges))
+	for i, r := range ranges {
+		s[i] = strconv.Itoa(r[0]) + "-" + strconv.Itoa(r[1])
+	}
+	return strings.Join(s, "|")
+}
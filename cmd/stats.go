@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"github.com/benjamincjackson/snps/pkg/snps"
+	"github.com/spf13/cobra"
+)
+
+var statsOutfile string
+var statsPerSample string
+var statsFrequencies string
+var statsThresh float64
+
+func init() {
+	rootCmd.AddCommand(statsCmd)
+
+	statsCmd.Flags().StringVarP(&statsOutfile, "outfile", "o", "stdout", "Summary statistics to write")
+	statsCmd.Flags().StringVarP(&statsPerSample, "per-sample", "", "", "Also write the number of snps, ambiguities and missing sites in each query to this file")
+	statsCmd.Flags().StringVarP(&statsFrequencies, "frequencies", "", "", "Also write the proportion of queries that each snp is found in to this file")
+	statsCmd.Flags().Float64VarP(&statsThresh, "threshold", "", 0.0, "with --frequencies, only report snps with a freq above this value")
+
+	statsCmd.Flags().SortFlags = false
+}
+
+var statsCmd = &cobra.Command{
+	Use:   "stats [results.csv]",
+	Short: "Summarise the output of an earlier run",
+	Long: `Summarise the per-query csv output of an earlier run, without reading and comparing the
+alignment again: the number of queries and of distinct and singleton snps, and the
+mean, median, minimum and maximum number of snps per query. Per-query counts and the
+frequency of each snp can be written at the same time. The output is read from
+stdin if no file is given.`,
+	Args: usageArgs(cobra.MaximumNArgs(1)),
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+
+		infile := "stdin"
+		if len(args) > 0 {
+			infile = args[0]
+		}
+		in, err := openIn(infile)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+
+		cr, err := snps.NewCSVReader(in)
+		if err != nil {
+			return err
+		}
+
+		wopts := cr.WriterOptions()
+		wopts.Threshold = statsThresh
+
+		writers := make([]snps.OutputWriter, 0, 3)
+		for _, output := range [][2]string{{"summary", statsOutfile}, {"counts", statsPerSample}, {"aggregate", statsFrequencies}} {
+			if output[1] == "" {
+				continue
+			}
+			out, err := openOut(output[1])
+			if err != nil {
+				return err
+			}
+			defer out.Close()
+			ow, err := snps.NewOutputWriter(output[0], out, wopts)
+			if err != nil {
+				return err
+			}
+			writers = append(writers, ow)
+		}
+
+		return snps.Convert(cr, snps.MultiWriter(writers...))
+	},
+}
@@ -1,5 +1,14 @@
 module github.com/benjamincjackson/snps
 
-go 1.16
+// go 1.22 is the oldest Go that github.com/klauspost/compress, for zstd, builds with
+go 1.22
 
-require github.com/spf13/cobra v1.2.1
+require (
+	github.com/klauspost/compress v1.18.0
+	github.com/spf13/cobra v1.2.1
+	github.com/spf13/pflag v1.0.5
+	github.com/ulikunitz/xz v0.5.12
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require github.com/inconshreveable/mousetrap v1.0.0 // indirect
@@ -0,0 +1,7 @@
+package main
+
+import "github.com/benjamincjackson/snps/cmd"
+
+func main() {
+	cmd.Execute()
+}
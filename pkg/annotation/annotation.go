@@ -0,0 +1,214 @@
+// Package annotation reads the coding regions of a reference sequence and translates
+// the changes found in them
+package annotation
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// CDS is one coding region from a GFF3 annotation. A CDS can be made of several
+// segments (e.g. either side of a ribosomal slippage site), which are stored in the order
+// they are translated
+type CDS struct {
+	Name     string
+	Strand   byte
+	Segments [][2]int
+}
+
+// ErrBadGFF is the cause of the errors ReadGFF returns for files it can't read
+var ErrBadGFF = errors.New("badly formatted gff file")
+
+// ReadGFF reads the CDS features from a GFF3 file. Rows that share an ID are joined
+// into one CDS. The name of a CDS is taken from its gene, Name or ID attribute, in that
+// order of preference
+func ReadGFF(r io.Reader) ([]CDS, error) {
+
+	regions := make([]CDS, 0)
+	lookup := make(map[string]int)
+
+	s := bufio.NewScanner(r)
+	lineNumber := 0
+
+	bad := func(problem string) error {
+		return fmt.Errorf("%w: line %d: %s", ErrBadGFF, lineNumber, problem)
+	}
+
+	for s.Scan() {
+		line := s.Text()
+		lineNumber++
+
+		if strings.HasPrefix(line, "##FASTA") {
+			break
+		}
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) != 9 {
+			return regions, bad("should have 9 columns")
+		}
+		if fields[2] != "CDS" {
+			continue
+		}
+
+		start, err := strconv.Atoi(fields[3])
+		if err != nil {
+			return regions, bad("bad start: " + fields[3])
+		}
+		end, err := strconv.Atoi(fields[4])
+		if err != nil {
+			return regions, bad("bad end: " + fields[4])
+		}
+		if fields[6] != "+" && fields[6] != "-" {
+			return regions, bad("CDS without a strand")
+		}
+
+		attributes := make(map[string]string)
+		for _, attribute := range strings.Split(fields[8], ";") {
+			kv := strings.SplitN(attribute, "=", 2)
+			if len(kv) == 2 {
+				attributes[kv[0]] = kv[1]
+			}
+		}
+
+		var name string
+		for _, key := range []string{"gene", "Name", "ID"} {
+			if v, ok := attributes[key]; ok {
+				name = v
+				break
+			}
+		}
+
+		if i, ok := lookup[attributes["ID"]]; ok && attributes["ID"] != "" {
+			regions[i].Segments = append(regions[i].Segments, [2]int{start, end})
+			continue
+		}
+
+		lookup[attributes["ID"]] = len(regions)
+		regions = append(regions, CDS{Name: name, Strand: fields[6][0], Segments: [][2]int{{start, end}}})
+	}
+
+	if s.Err() != nil {
+		return regions, s.Err()
+	}
+
+	for _, region := range regions {
+		if region.Strand == '-' {
+			for i, j := 0, len(region.Segments)-1; i < j; i, j = i+1, j-1 {
+				region.Segments[i], region.Segments[j] = region.Segments[j], region.Segments[i]
+			}
+		}
+	}
+
+	return regions, nil
+}
+
+// Offsets returns the 0-based offset(s) of a 1-based genomic position within the
+// coding sequence of the CDS. There is more than one offset if the segments overlap
+func (c CDS) Offsets(pos int) []int {
+	offsets := make([]int, 0)
+	length := 0
+	for _, seg := range c.Segments {
+		if pos >= seg[0] && pos <= seg[1] {
+			switch c.Strand {
+			case '+':
+				offsets = append(offsets, length+pos-seg[0])
+			case '-':
+				offsets = append(offsets, length+seg[1]-pos)
+			}
+		}
+		length += seg[1] - seg[0] + 1
+	}
+	return offsets
+}
+
+// Position returns the 1-based genomic position of a 0-based offset within the
+// coding sequence of the CDS
+func (c CDS) Position(offset int) int {
+	for _, seg := range c.Segments {
+		length := seg[1] - seg[0] + 1
+		if offset < length {
+			if c.Strand == '-' {
+				return seg[1] - offset
+			}
+			return seg[0] + offset
+		}
+		offset -= length
+	}
+	return -1
+}
+
+var complement = map[byte]byte{'A': 'T', 'C': 'G', 'G': 'C', 'T': 'A'}
+
+// MakeCodonTable returns the standard genetic code as a map from codon to amino acid
+func MakeCodonTable() map[string]byte {
+	bases := "TCAG"
+	aas := "FFLLSSSSYY**CC*WLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG"
+
+	codonTable := make(map[string]byte)
+	for i := 0; i < 64; i++ {
+		codon := string([]byte{bases[i/16], bases[(i/4)%4], bases[i%4]})
+		codonTable[codon] = aas[i]
+	}
+
+	return codonTable
+}
+
+// TranslateCodon returns the amino acid encoded by the codon at a 0-based offset in the
+// CDS, reading bases from an encoded sequence. Codons containing anything other than
+// A, C, G or T are translated as X
+func TranslateCodon(c CDS, codonStart int, seq []byte, DA []string, codonTable map[string]byte) byte {
+	codon := make([]byte, 3)
+	for k := 0; k < 3; k++ {
+		pos := c.Position(codonStart + k)
+		if pos < 1 || pos > len(seq) {
+			return 'X'
+		}
+		b := DA[seq[pos-1]]
+		if len(b) != 1 {
+			return 'X'
+		}
+		codon[k] = b[0]
+		if c.Strand == '-' {
+			codon[k] = complement[codon[k]]
+		}
+	}
+	if aa, ok := codonTable[string(codon)]; ok {
+		return aa
+	}
+	return 'X'
+}
+
+// AnnotateSNP returns a description of the protein-level consequence(s) of the SNP at
+// a 1-based position, e.g. "S:D614G", or an empty string if it is not in a CDS
+func AnnotateSNP(pos int, refSeq []byte, querySeq []byte, regions []CDS, DA []string, codonTable map[string]byte) string {
+	changes := make([]string, 0)
+	for _, region := range regions {
+		for _, offset := range region.Offsets(pos) {
+			codonStart := offset - offset%3
+			refAA := TranslateCodon(region, codonStart, refSeq, DA, codonTable)
+			queryAA := TranslateCodon(region, codonStart, querySeq, DA, codonTable)
+			changes = append(changes, region.Name+":"+string(refAA)+strconv.Itoa(offset/3+1)+string(queryAA))
+		}
+	}
+	return strings.Join(changes, ";")
+}
+
+// CodonPosition returns the codon number and the position within the codon (1, 2 or 3)
+// of a genomic position in each CDS it is in, e.g. "S:614:2", joined by ";" if there is
+// more than one
+func CodonPosition(pos int, regions []CDS) string {
+	positions := make([]string, 0)
+	for _, region := range regions {
+		for _, offset := range region.Offsets(pos) {
+			positions = append(positions, region.Name+":"+strconv.Itoa(offset/3+1)+":"+strconv.Itoa(offset%3+1))
+		}
+	}
+	return strings.Join(positions, ";")
+}
@@ -0,0 +1,94 @@
+package annotation
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestReadGFF(t *testing.T) {
+	gffData := []byte(`##gff-version 3
+ref	.	gene	1	9	.	+	.	ID=gene-1;Name=g1
+ref	.	CDS	1	6	.	+	0	ID=cds-1;gene=g1
+ref	.	CDS	6	9	.	+	0	ID=cds-1;gene=g1
+ref	.	CDS	10	15	.	-	0	ID=cds-2;Name=g2
+`)
+
+	regions, err := ReadGFF(bytes.NewReader(gffData))
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(regions) != 2 {
+		t.Errorf("problem in TestReadGFF(): expected 2 CDSs, got %d", len(regions))
+		return
+	}
+
+	if regions[0].Name != "g1" || len(regions[0].Segments) != 2 {
+		t.Errorf("problem in TestReadGFF(): bad first CDS")
+	}
+
+	offsets := regions[0].Offsets(6)
+	if len(offsets) != 2 || offsets[0] != 5 || offsets[1] != 6 {
+		t.Errorf("problem in TestReadGFF(): bad offsets for a slippage site")
+	}
+
+	if regions[1].Name != "g2" || regions[1].Strand != '-' || regions[1].Position(0) != 15 {
+		t.Errorf("problem in TestReadGFF(): bad second CDS")
+	}
+}
+
+func TestReadGenBank(t *testing.T) {
+	gbData := []byte(`LOCUS       TEST01                    18 bp    RNA     linear   VRL 01-JAN-2020
+DEFINITION  Test virus, complete genome.
+VERSION     TEST01.1
+FEATURES             Location/Qualifiers
+     source          1..18
+                     /organism="Test virus"
+     gene            1..9
+                     /gene="g1"
+     CDS             join(1..6,
+                     6..8)
+                     /gene="g1"
+                     /product="protein
+                     one"
+     CDS             complement(join(10..12,13..18))
+                     /locus_tag="T_2"
+     CDS             <1..>8
+                     /protein_id="P_3"
+                     /codon_start=2
+     CDS             OTHER01.1:1..9
+                     /gene="elsewhere"
+ORIGIN
+        1 atgatgcca tggcatcat
+//
+`)
+
+	regions, err := ReadGenBank(bytes.NewReader(gbData))
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(regions) != 3 {
+		t.Errorf("problem in TestReadGenBank(): expected 3 CDSs, got %d", len(regions))
+		return
+	}
+
+	offsets := regions[0].Offsets(6)
+	if regions[0].Name != "g1" || regions[0].Strand != '+' || len(offsets) != 2 || offsets[0] != 5 || offsets[1] != 6 {
+		t.Errorf("problem in TestReadGenBank(): bad first CDS")
+	}
+
+	if regions[1].Name != "T_2" || regions[1].Strand != '-' || regions[1].Position(0) != 18 || regions[1].Position(8) != 10 {
+		t.Errorf("problem in TestReadGenBank(): bad second CDS")
+	}
+
+	if regions[2].Name != "P_3" || regions[2].Position(0) != 2 {
+		t.Errorf("problem in TestReadGenBank(): bad third CDS")
+	}
+
+	_, err = ReadGenBank(bytes.NewReader([]byte("FEATURES             Location/Qualifiers\n     CDS             1..x\n")))
+	if !errors.Is(err, ErrBadGenBank) {
+		t.Errorf("problem in TestReadGenBank(): a bad location was accepted")
+	}
+}
@@ -0,0 +1,194 @@
+package annotation
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ErrBadGenBank is the cause of the errors ReadGenBank returns for files it can't read
+var ErrBadGenBank = errors.New("badly formatted genbank file")
+
+// featureIndent is the column that feature locations and qualifiers start at
+const featureIndent = 21
+
+// ReadGenBank reads the CDS features from the feature table of a GenBank flat file, e.g.
+// a RefSeq record, or of its first record if it has more than one. The name of a CDS is
+// taken from its gene, locus_tag or protein_id qualifier, in that order of preference.
+// Locations can be joined and complemented, and partial ones are read as if they were
+// complete, after skipping codon_start - 1 bases. Features on other records, or between
+// two bases, are skipped
+func ReadGenBank(r io.Reader) ([]CDS, error) {
+	regions := make([]CDS, 0)
+
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, 64*1024), 1<<24)
+	lineNumber := 0
+
+	bad := func(problem string) error {
+		return fmt.Errorf("%w: line %d: %s", ErrBadGenBank, lineNumber, problem)
+	}
+
+	var key, location, qualifier string
+	var qualifiers map[string]string
+	inFeatures, inLocation := false, false
+	indent := strings.Repeat(" ", featureIndent)
+
+	// add adds the feature that has just been read, if it is a CDS
+	add := func() error {
+		if key != "CDS" {
+			return nil
+		}
+		segments, strand, ok := parseLocation(location)
+		if !ok {
+			if strings.ContainsAny(location, ":^") {
+				return nil
+			}
+			return bad("bad location: " + location)
+		}
+		if codonStart, err := strconv.Atoi(qualifiers["codon_start"]); err == nil && codonStart > 1 {
+			if strand == '+' {
+				segments[0][0] += codonStart - 1
+			} else {
+				segments[0][1] -= codonStart - 1
+			}
+		}
+		var name string
+		for _, q := range []string{"gene", "locus_tag", "protein_id"} {
+			if v, ok := qualifiers[q]; ok {
+				name = v
+				break
+			}
+		}
+		regions = append(regions, CDS{Name: name, Strand: strand, Segments: segments})
+		return nil
+	}
+
+	for s.Scan() {
+		line := strings.TrimRight(s.Text(), " \r")
+		lineNumber++
+
+		if !inFeatures {
+			if strings.HasPrefix(line, "FEATURES") {
+				inFeatures = true
+			}
+			continue
+		}
+		// the feature table ends at the next section, e.g. ORIGIN
+		if len(line) > 0 && line[0] != ' ' {
+			break
+		}
+
+		switch {
+		case strings.HasPrefix(line, indent):
+			text := strings.TrimSpace(line)
+			switch {
+			case strings.HasPrefix(text, "/"):
+				inLocation = false
+				kv := strings.SplitN(text[1:], "=", 2)
+				qualifier = kv[0]
+				qualifiers[qualifier] = ""
+				if len(kv) == 2 {
+					qualifiers[qualifier] = strings.Trim(kv[1], `"`)
+				}
+			case inLocation:
+				location += text
+			case qualifier != "":
+				qualifiers[qualifier] = strings.TrimSpace(qualifiers[qualifier] + " " + strings.Trim(text, `"`))
+			}
+		case len(line) > 5 && line[5] != ' ':
+			if err := add(); err != nil {
+				return regions, err
+			}
+			fields := strings.Fields(line)
+			if len(fields) != 2 {
+				return regions, bad("feature without a location")
+			}
+			key, location, qualifier = fields[0], fields[1], ""
+			qualifiers = make(map[string]string)
+			inLocation = true
+		}
+	}
+	if s.Err() != nil {
+		return regions, s.Err()
+	}
+	if !inFeatures {
+		return regions, fmt.Errorf("%w: no feature table", ErrBadGenBank)
+	}
+	if err := add(); err != nil {
+		return regions, err
+	}
+
+	return regions, nil
+}
+
+// parseLocation reads a feature's location, e.g. join(266..13468,13468..21555) or
+// complement(28274..29533), into its segments in the order they are translated and
+// their strand. It returns false if it can't, or if the segments are on both strands
+func parseLocation(location string) ([][2]int, byte, bool) {
+	segments, strands, ok := parseSpans(strings.NewReplacer("<", "", ">", "").Replace(location))
+	if !ok || len(segments) == 0 {
+		return nil, 0, false
+	}
+	for _, strand := range strands {
+		if strand != strands[0] {
+			return nil, 0, false
+		}
+	}
+	return segments, strands[0], true
+}
+
+// parseSpans reads a location into its spans and the strand of each, in order
+func parseSpans(location string) ([][2]int, []byte, bool) {
+	switch {
+	case strings.HasPrefix(location, "complement(") && strings.HasSuffix(location, ")"):
+		segments, strands, ok := parseSpans(location[len("complement(") : len(location)-1])
+		for i, j := 0, len(segments)-1; i < j; i, j = i+1, j-1 {
+			segments[i], segments[j] = segments[j], segments[i]
+		}
+		for i := range strands {
+			if strands[i] == '+' {
+				strands[i] = '-'
+			} else {
+				strands[i] = '+'
+			}
+		}
+		return segments, strands, ok
+	case (strings.HasPrefix(location, "join(") || strings.HasPrefix(location, "order(")) && strings.HasSuffix(location, ")"):
+		inner := location[strings.IndexByte(location, '(')+1 : len(location)-1]
+		segments := make([][2]int, 0)
+		strands := make([]byte, 0)
+		// split at the commas that aren't inside brackets
+		depth, start := 0, 0
+		for i := 0; i <= len(inner); i++ {
+			if i < len(inner) && inner[i] == '(' {
+				depth++
+			} else if i < len(inner) && inner[i] == ')' {
+				depth--
+			} else if i == len(inner) || (inner[i] == ',' && depth == 0) {
+				s, st, ok := parseSpans(inner[start:i])
+				if !ok {
+					return nil, nil, false
+				}
+				segments = append(segments, s...)
+				strands = append(strands, st...)
+				start = i + 1
+			}
+		}
+		return segments, strands, true
+	}
+
+	ends := strings.SplitN(location, "..", 2)
+	if len(ends) == 1 {
+		ends = append(ends, ends[0])
+	}
+	start, err1 := strconv.Atoi(ends[0])
+	end, err2 := strconv.Atoi(ends[1])
+	if err1 != nil || err2 != nil || start < 1 || end < start {
+		return nil, nil, false
+	}
+	return [][2]int{{start, end}}, []byte{'+'}, true
+}
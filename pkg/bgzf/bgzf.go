@@ -0,0 +1,108 @@
+// Package bgzf writes BGZF, the blocked gzip format of bgzip, which any gzip reader can
+// read but which can also be read from the start of any block, and tabix indexes of the
+// VCF written in it, so that tools like bcftools and IGV can read it by position
+package bgzf
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+)
+
+// maxBlockSize is the most data that goes in a block, as bgzip writes them, which leaves
+// room for data that doesn't compress in a block of at most 64 KiB
+const maxBlockSize = 0xff00
+
+// eofBlock is the empty block that ends a BGZF file
+var eofBlock = []byte{0x1f, 0x8b, 0x08, 0x04, 0x00, 0x00, 0x00, 0x00, 0x00, 0xff, 0x06, 0x00, 0x42, 0x43, 0x02, 0x00, 0x1b, 0x00, 0x03, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
+
+// Writer compresses what is written to it into BGZF blocks. Close writes the last block
+// and the end-of-file marker, but doesn't close the underlying io.Writer
+type Writer struct {
+	w      io.Writer
+	buf    []byte
+	offset uint64 // the offset in w of the block being filled
+	cbuf   bytes.Buffer
+	fw     *flate.Writer
+	err    error
+}
+
+// NewWriter returns a Writer that writes BGZF to w
+func NewWriter(w io.Writer) *Writer {
+	bw := &Writer{w: w, buf: make([]byte, 0, maxBlockSize)}
+	bw.fw, _ = flate.NewWriter(&bw.cbuf, flate.DefaultCompression)
+	return bw
+}
+
+func (bw *Writer) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 && bw.err == nil {
+		n := copy(bw.buf[len(bw.buf):maxBlockSize], p)
+		bw.buf = bw.buf[:len(bw.buf)+n]
+		p = p[n:]
+		written += n
+		if len(bw.buf) == maxBlockSize {
+			bw.flushBlock()
+		}
+	}
+	return written, bw.err
+}
+
+// Offset returns the virtual offset of the next byte to be written: the offset of its
+// block in the file, shifted left 16 bits, plus its offset in the uncompressed block
+func (bw *Writer) Offset() uint64 {
+	return bw.offset<<16 | uint64(len(bw.buf))
+}
+
+// Flush writes what has been written so far as a block, so that the next byte written
+// starts a new one
+func (bw *Writer) Flush() error {
+	if len(bw.buf) > 0 {
+		bw.flushBlock()
+	}
+	return bw.err
+}
+
+// Close writes the last block and the end-of-file marker
+func (bw *Writer) Close() error {
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	_, bw.err = bw.w.Write(eofBlock)
+	return bw.err
+}
+
+// flushBlock compresses the buffered data into one block, or stores it if it doesn't
+// compress
+func (bw *Writer) flushBlock() {
+	if bw.err != nil {
+		return
+	}
+	bw.cbuf.Reset()
+	bw.fw.Reset(&bw.cbuf)
+	bw.fw.Write(bw.buf)
+	bw.fw.Close()
+	if bw.cbuf.Len()+26 > 1<<16 {
+		bw.cbuf.Reset()
+		fw, _ := flate.NewWriter(&bw.cbuf, flate.NoCompression)
+		fw.Write(bw.buf)
+		fw.Close()
+	}
+
+	size := bw.cbuf.Len() + 26
+	header := []byte{0x1f, 0x8b, 0x08, 0x04, 0x00, 0x00, 0x00, 0x00, 0x00, 0xff, 0x06, 0x00, 'B', 'C', 0x02, 0x00, 0x00, 0x00}
+	binary.LittleEndian.PutUint16(header[16:], uint16(size-1))
+	footer := make([]byte, 8)
+	binary.LittleEndian.PutUint32(footer, crc32.ChecksumIEEE(bw.buf))
+	binary.LittleEndian.PutUint32(footer[4:], uint32(len(bw.buf)))
+
+	for _, b := range [][]byte{header, bw.cbuf.Bytes(), footer} {
+		if _, bw.err = bw.w.Write(b); bw.err != nil {
+			return
+		}
+	}
+	bw.offset += uint64(size)
+	bw.buf = bw.buf[:0]
+}
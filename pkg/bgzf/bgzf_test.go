@@ -0,0 +1,165 @@
+package bgzf
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// readBlock decompresses the block that starts at offset in file
+func readBlock(t *testing.T, file []byte, offset uint64) []byte {
+	header := file[offset:]
+	if header[0] != 0x1f || header[1] != 0x8b || header[12] != 'B' || header[13] != 'C' {
+		t.Fatalf("problem in readBlock(): no block at offset %d", offset)
+	}
+	size := int(binary.LittleEndian.Uint16(header[16:])) + 1
+	data, err := io.ReadAll(flate.NewReader(bytes.NewReader(header[18 : size-8])))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestWriter(t *testing.T) {
+	var sb strings.Builder
+	for i := 0; sb.Len() < 3*maxBlockSize; i++ {
+		sb.WriteString("line " + strconv.Itoa(i) + "\n")
+	}
+	text := sb.String()
+
+	var out bytes.Buffer
+	bw := NewWriter(&out)
+	_, err := bw.Write([]byte(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = bw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := out.Bytes()
+
+	// any gzip reader can read it
+	gz, err := gzip.NewReader(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != text {
+		t.Errorf("problem in TestWriter(): the data didn't survive a round trip through gzip")
+	}
+
+	// and it can be read block by block, ending with the empty block
+	var blocks bytes.Buffer
+	n := 0
+	offset := uint64(0)
+	for offset < uint64(len(file)-len(eofBlock)) {
+		blocks.Write(readBlock(t, file, offset))
+		offset += uint64(binary.LittleEndian.Uint16(file[offset+16:])) + 1
+		n++
+	}
+	if blocks.String() != text || n != 4 {
+		t.Errorf("problem in TestWriter(): read %d blocks", n)
+	}
+	if !bytes.Equal(file[offset:], eofBlock) {
+		t.Errorf("problem in TestWriter(): no end-of-file block")
+	}
+}
+
+func TestIndexer(t *testing.T) {
+	var out bytes.Buffer
+	bw := NewWriter(&out)
+	ix := NewIndexer(bw)
+
+	lines := []string{
+		"##fileformat=VCFv4.2",
+		"#CHROM\tPOS\tID\tREF\tALT\tQUAL\tFILTER\tINFO",
+		"HA\t10\t.\tA\tG\t.\t.\t.",
+		"HA\t20000\t.\tC\tT\t.\t.\t.",
+		"NA\t5\t.\tG\t<*>\t.\t.\tEND=40000",
+	}
+	for _, line := range lines {
+		// lines can be written in pieces
+		ix.Write([]byte(line[:3]))
+		_, err := ix.Write([]byte(line[3:] + "\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := bw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var index bytes.Buffer
+	err = ix.WriteIndex(&index)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gz, err := gzip.NewReader(&index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tbi, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(tbi[:4]) != "TBI\x01" || string(tbi[36:42]) != "HA\x00NA\x00" {
+		t.Fatalf("problem in TestIndexer(): bad header")
+	}
+	r := bytes.NewReader(tbi[42:])
+	read := func() int64 {
+		var v int32
+		binary.Read(r, binary.LittleEndian, &v)
+		return int64(v)
+	}
+
+	// each chromosome's records are found from its bins' chunks, and the linear index
+	// has a window for each 16 kb it covers
+	file := out.Bytes()
+	expected := [][]string{{"HA\t10\t", "HA\t20000\t"}, {"NA\t5\t"}}
+	windows := []int64{2, 3}
+	for i := range expected {
+		found := make([]string, 0)
+		nBins := read()
+		for b := int64(0); b < nBins; b++ {
+			read()
+			nChunks := read()
+			for c := int64(0); c < nChunks; c++ {
+				var chunk [2]uint64
+				binary.Read(r, binary.LittleEndian, &chunk)
+				data := readBlock(t, file, chunk[0]>>16)[chunk[0]&0xffff : chunk[1]&0xffff]
+				found = append(found, strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")...)
+			}
+		}
+		if len(found) != len(expected[i]) {
+			t.Errorf("problem in TestIndexer(): found %d records of %s", len(found), expected[i][0][:2])
+		} else {
+			for j := range found {
+				if !strings.HasPrefix(found[j], expected[i][j]) {
+					t.Errorf("problem in TestIndexer(): found %q", found[j])
+				}
+			}
+		}
+		nIntervals := read()
+		if nIntervals != windows[i] {
+			t.Errorf("problem in TestIndexer(): %d windows in the linear index", nIntervals)
+		}
+		r.Seek(nIntervals*8, io.SeekCurrent)
+	}
+
+	// unsorted records can't be indexed
+	ix = NewIndexer(NewWriter(io.Discard))
+	ix.Write([]byte("HA\t20\t.\tA\tG\t.\t.\t.\nHA\t10\t.\tA\tG\t.\t.\t.\n"))
+	if ix.WriteIndex(io.Discard) == nil {
+		t.Errorf("problem in TestIndexer(): unsorted records were indexed")
+	}
+}
@@ -0,0 +1,213 @@
+package bgzf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strconv"
+)
+
+// linearShift is the log2 of the size of the windows of tabix's linear index
+const linearShift = 14
+
+// Indexer builds a tabix index of the VCF written through it to a Writer, as tabix -p
+// vcf would. Records have to be sorted by position within each chromosome, and each
+// chromosome's records have to be together
+type Indexer struct {
+	bw        *Writer
+	line      []byte
+	lineStart uint64
+	names     []string
+	refs      map[string]*tabixRef
+	last      *tabixRef
+	lastBegin int
+	err       error
+}
+
+type tabixRef struct {
+	bins   map[uint32][]chunk
+	order  []uint32
+	linear []uint64
+}
+
+// chunk is a run of the file, from one virtual offset to another
+type chunk [2]uint64
+
+// NewIndexer returns an Indexer that writes to bw
+func NewIndexer(bw *Writer) *Indexer {
+	return &Indexer{bw: bw, refs: make(map[string]*tabixRef)}
+}
+
+func (ix *Indexer) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		if len(ix.line) == 0 {
+			ix.lineStart = ix.bw.Offset()
+		}
+		end := bytes.IndexByte(p, '\n') + 1
+		if end == 0 {
+			end = len(p)
+		}
+		n, err := ix.bw.Write(p[:end])
+		written += n
+		if err != nil {
+			return written, err
+		}
+		ix.line = append(ix.line, p[:end]...)
+		p = p[end:]
+		if ix.line[len(ix.line)-1] == '\n' {
+			ix.add(ix.line[:len(ix.line)-1], ix.lineStart, ix.bw.Offset())
+			ix.line = ix.line[:0]
+		}
+	}
+	return written, ix.err
+}
+
+// add indexes one line, which runs from virtual offset start to end
+func (ix *Indexer) add(line []byte, start uint64, end uint64) {
+	if ix.err != nil || len(line) == 0 || line[0] == '#' {
+		return
+	}
+	fields := bytes.Split(line, []byte{'\t'})
+	if len(fields) < 4 {
+		ix.err = errors.New("can't index a VCF line with fewer than 4 fields")
+		return
+	}
+	name := string(fields[0])
+	pos, err := strconv.Atoi(string(fields[1]))
+	if err != nil || pos < 1 {
+		ix.err = errors.New("can't index a VCF line with a bad position: " + string(fields[1]))
+		return
+	}
+	// tabix's intervals are 0-based and half-open, and a record spans its REF allele, or
+	// up to its END if it has one, e.g. a gVCF reference block
+	begin := pos - 1
+	stop := begin + len(fields[3])
+	if len(fields) > 7 {
+		for _, info := range bytes.Split(fields[7], []byte{';'}) {
+			if bytes.HasPrefix(info, []byte("END=")) {
+				if e, err := strconv.Atoi(string(info[4:])); err == nil && e > begin {
+					stop = e
+				}
+			}
+		}
+	}
+	if stop <= begin {
+		stop = begin + 1
+	}
+
+	ref, ok := ix.refs[name]
+	if !ok {
+		ref = &tabixRef{bins: make(map[uint32][]chunk)}
+		ix.refs[name] = ref
+		ix.names = append(ix.names, name)
+	} else if ref != ix.last {
+		ix.err = errors.New("can't index a VCF whose chromosomes aren't together: " + name)
+		return
+	}
+	if ref == ix.last && begin < ix.lastBegin {
+		ix.err = errors.New("can't index a VCF that isn't sorted by position")
+		return
+	}
+	ix.last, ix.lastBegin = ref, begin
+
+	bin := reg2bin(begin, stop)
+	chunks, ok := ref.bins[bin]
+	if !ok {
+		ref.order = append(ref.order, bin)
+	}
+	if len(chunks) > 0 && chunks[len(chunks)-1][1] == start {
+		chunks[len(chunks)-1][1] = end
+	} else {
+		chunks = append(chunks, chunk{start, end})
+	}
+	ref.bins[bin] = chunks
+
+	// each window of the linear index has the offset of the first record that overlaps it
+	for w := begin >> linearShift; w <= (stop-1)>>linearShift; w++ {
+		for len(ref.linear) <= w {
+			ref.linear = append(ref.linear, ^uint64(0))
+		}
+		if ref.linear[w] == ^uint64(0) {
+			ref.linear[w] = start
+		}
+	}
+}
+
+// reg2bin returns the smallest bin of the binning index that holds the 0-based,
+// half-open interval from begin to end, as in the SAM specification
+func reg2bin(begin int, end int) uint32 {
+	end--
+	switch {
+	case begin>>14 == end>>14:
+		return uint32(((1<<15)-1)/7 + (begin >> 14))
+	case begin>>17 == end>>17:
+		return uint32(((1<<12)-1)/7 + (begin >> 17))
+	case begin>>20 == end>>20:
+		return uint32(((1<<9)-1)/7 + (begin >> 20))
+	case begin>>23 == end>>23:
+		return uint32(((1<<6)-1)/7 + (begin >> 23))
+	case begin>>26 == end>>26:
+		return uint32(((1<<3)-1)/7 + (begin >> 26))
+	}
+	return 0
+}
+
+// WriteIndex writes the index, BGZF-compressed as a .tbi file is, once everything has
+// been written and the Writer has been closed
+func (ix *Indexer) WriteIndex(w io.Writer) error {
+	if ix.err != nil {
+		return ix.err
+	}
+	if len(ix.line) > 0 {
+		return errors.New("can't index a VCF whose last line is unfinished")
+	}
+
+	var buf bytes.Buffer
+	put := func(v interface{}) {
+		binary.Write(&buf, binary.LittleEndian, v)
+	}
+	var names bytes.Buffer
+	for _, name := range ix.names {
+		names.WriteString(name)
+		names.WriteByte(0)
+	}
+
+	buf.WriteString("TBI\x01")
+	// the number of chromosomes, then the VCF preset: the format, the columns of the
+	// chromosome, start and end, the character that starts header lines and the number of
+	// lines to skip
+	put(int32(len(ix.names)))
+	put([]int32{2, 1, 2, 0, '#', 0})
+	put(int32(names.Len()))
+	buf.Write(names.Bytes())
+	for _, name := range ix.names {
+		ref := ix.refs[name]
+		put(int32(len(ref.order)))
+		for _, bin := range ref.order {
+			put(bin)
+			put(int32(len(ref.bins[bin])))
+			for _, c := range ref.bins[bin] {
+				put(c[0])
+				put(c[1])
+			}
+		}
+		// windows that no record overlaps take the offset of the one before
+		previous := uint64(0)
+		for i, offset := range ref.linear {
+			if offset == ^uint64(0) {
+				ref.linear[i] = previous
+			}
+			previous = ref.linear[i]
+		}
+		put(int32(len(ref.linear)))
+		put(ref.linear)
+	}
+
+	bw := NewWriter(w)
+	if _, err := bw.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	return bw.Close()
+}
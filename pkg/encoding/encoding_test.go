@@ -1,8 +1,6 @@
-package main
+package encoding
 
 import (
-	"bytes"
-	"fmt"
 	"strings"
 	"testing"
 )
@@ -60,7 +58,7 @@ func TestEncoding(t *testing.T) {
 	lookupChar['?'] = []string{"A", "C", "G", "T"}
 	lookupChar['-'] = []string{"A", "C", "G", "T"}
 
-	lookupByte := makeEncodingArray()
+	lookupByte := MakeEncodingArray()
 
 	for i := 0; i < len(nucs); i++ {
 		for j := 0; j < len(nucs); j++ {
@@ -92,8 +90,8 @@ func TestDecoding(t *testing.T) {
 	nucs := []byte{'A', 'G', 'C', 'T', 'R', 'M', 'W', 'S', 'K', 'Y', 'V', 'H', 'D', 'B', 'N', '-', '?',
 		'a', 'g', 'c', 't', 'r', 'm', 'w', 's', 'k', 'y', 'v', 'h', 'd', 'b', 'n'}
 
-	EA := makeEncodingArray()
-	DA := makeDecodingArray()
+	EA := MakeEncodingArray()
+	DA := MakeDecodingArray()
 
 	for _, nuc := range nucs {
 		a := EA[nuc]
@@ -104,142 +102,19 @@ func TestDecoding(t *testing.T) {
 	}
 }
 
-func TestSNPs(t *testing.T) {
-	refData := []byte(`>ref
-ATGATG
-`)
-	queryData := []byte(
-		`>Query1
-ATGATG
->Query2
-ATGATC
->Query3
-ATTTTW
-`)
-
-	ref := bytes.NewReader(refData)
-	query := bytes.NewReader(queryData)
-
-	out := new(bytes.Buffer)
-
-	err := snps(query, ref, false, false, 0.0, out)
-	if err != nil {
-		t.Error(err)
-	}
+func TestComplement(t *testing.T) {
+	complement := map[byte]byte{'A': 'T', 'G': 'C', 'C': 'G', 'T': 'A', 'R': 'Y', 'Y': 'R', 'M': 'K', 'K': 'M',
+		'W': 'W', 'S': 'S', 'B': 'V', 'V': 'B', 'D': 'H', 'H': 'D', 'N': 'N', '-': '-', '?': '?'}
 
-	if string(out.Bytes()) != `query,SNPs
-Query1,
-Query2,G6C
-Query3,G3T|A4T|G6W
-` {
-		t.Errorf("problem in TestSNPs()")
-		fmt.Println(string(out.Bytes()))
-	}
-}
-
-func TestSNPsHardGaps(t *testing.T) {
-	refData := []byte(`>ref
-ATGATG
-`)
-	queryData := []byte(
-		`>Query1
---GATG
->Query2
-ATGATC
->Query3
-ATTTTW
-`)
-
-	ref := bytes.NewReader(refData)
-	query := bytes.NewReader(queryData)
-
-	out := new(bytes.Buffer)
-
-	err := snps(query, ref, true, false, 0.0, out)
-	if err != nil {
-		t.Error(err)
-	}
+	EA := MakeEncodingArray()
+	CA := MakeComplementArray()
 
-	if string(out.Bytes()) != `query,SNPs
-Query1,A1-|T2-
-Query2,G6C
-Query3,G3T|A4T|G6W
-` {
-		t.Errorf("problem in TestSNPsHardGaps()")
-		fmt.Println(string(out.Bytes()))
-	}
-}
-
-func TestSNPsAggregate(t *testing.T) {
-	refData := []byte(`>ref
-ATGATG
-`)
-	queryData := []byte(
-		`>Query1
-ATGATG
->Query2
-ATGATC
->Query3
-ATTTTW
->Query4
-ATTTTG
-`)
-
-	ref := bytes.NewReader(refData)
-	query := bytes.NewReader(queryData)
-
-	out := new(bytes.Buffer)
-
-	err := snps(query, ref, false, true, 0.0, out)
-	if err != nil {
-		t.Error(err)
-	}
-
-	// strconv.FormatFloat(propMap[snp]/counter, 'f', 4, 64) + "\n")
-
-	if string(out.Bytes()) != `change,proportion
-G3T,0.500000000
-A4T,0.500000000
-G6C,0.250000000
-G6W,0.250000000
-` {
-		t.Errorf("problem in TestSNPsAggregate()")
-		fmt.Println(string(out.Bytes()))
-	}
-}
-
-func TestSNPsAggregateThresh(t *testing.T) {
-	refData := []byte(`>ref
-ATGATG
-`)
-	queryData := []byte(
-		`>Query1
-ATGATG
->Query2
-ATGATC
->Query3
-ATTTTW
->Query4
-ATTTTG
-`)
-
-	ref := bytes.NewReader(refData)
-	query := bytes.NewReader(queryData)
-
-	out := new(bytes.Buffer)
-
-	err := snps(query, ref, false, true, 0.26, out)
-	if err != nil {
-		t.Error(err)
+	for nuc, comp := range complement {
+		if CA[EA[nuc]] != EA[comp] {
+			t.Errorf("problem in complement test: %s", string(nuc))
+		}
 	}
-
-	// strconv.FormatFloat(propMap[snp]/counter, 'f', 4, 64) + "\n")
-
-	if string(out.Bytes()) != `change,proportion
-G3T,0.500000000
-A4T,0.500000000
-` {
-		t.Errorf("problem in TestSNPsAggregateThresh()")
-		fmt.Println(string(out.Bytes()))
+	if CA[MakeEncodingArrayHardGaps()['-']] != 4 {
+		t.Errorf("problem in complement test: hard gap")
 	}
 }
@@ -0,0 +1,457 @@
+// Package expr is a small expression language for filters, e.g.
+// snp_count < 40 && completeness > 0.9. Values are numbers, strings and booleans.
+// Expressions can use the variables they are compiled with, number and string literals
+// ('...' or "..."), true and false, parentheses, the arithmetic operators + - * /, the
+// comparisons == != < <= > >=, =~ and !~ (which match a string against a regular
+// expression literal), and the logical operators ! && ||, in increasing order of
+// precedence from || to unary ! and -
+package expr
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ErrSyntax is the cause of the errors that Compile returns
+var ErrSyntax = errors.New("bad expression")
+
+// ErrType is the cause of the errors that evaluating an expression returns, when an
+// operator is given the wrong type of value
+var ErrType = errors.New("type error in expression")
+
+// Env holds the values of an expression's variables, which are float64, string or bool
+type Env map[string]interface{}
+
+// Expr is a compiled expression
+type Expr struct {
+	src  string
+	eval func(Env) (interface{}, error)
+}
+
+// String returns the expression's source
+func (e *Expr) String() string {
+	return e.src
+}
+
+// Compile parses src, which can only use the variables named in vars
+func Compile(src string, vars []string) (*Expr, error) {
+	tokens, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+	known := make(map[string]bool, len(vars))
+	for _, v := range vars {
+		known[v] = true
+	}
+	p := &parser{tokens: tokens, vars: known}
+	eval, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("%w: unexpected %s", ErrSyntax, p.tokens[p.pos].text)
+	}
+	return &Expr{src: src, eval: eval}, nil
+}
+
+// Eval evaluates the expression with the variables in env
+func (e *Expr) Eval(env Env) (interface{}, error) {
+	return e.eval(env)
+}
+
+// Bool evaluates the expression, which has to be true or false
+func (e *Expr) Bool(env Env) (bool, error) {
+	v, err := e.eval(env)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("%w: %s isn't true or false", ErrType, e.src)
+	}
+	return b, nil
+}
+
+type tokenKind int
+
+const (
+	tNumber tokenKind = iota
+	tString
+	tIdent
+	tOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+// operators are matched longest first
+var operators = []string{"&&", "||", "==", "!=", "<=", ">=", "=~", "!~", "<", ">", "!", "+", "-", "*", "/", "(", ")"}
+
+func tokenize(src string) ([]token, error) {
+	tokens := make([]token, 0)
+	for i := 0; i < len(src); {
+		c := rune(src[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c >= '0' && c <= '9' || c == '.':
+			j := i
+			for j < len(src) && (src[j] >= '0' && src[j] <= '9' || src[j] == '.' || src[j] == 'e' || src[j] == 'E') {
+				j++
+			}
+			tokens = append(tokens, token{tNumber, src[i:j]})
+			i = j
+		case c == '_' || unicode.IsLetter(c):
+			j := i
+			for j < len(src) && (src[j] == '_' || unicode.IsLetter(rune(src[j])) || unicode.IsDigit(rune(src[j]))) {
+				j++
+			}
+			tokens = append(tokens, token{tIdent, src[i:j]})
+			i = j
+		case c == '\'' || c == '"':
+			j := strings.IndexByte(src[i+1:], src[i])
+			if j < 0 {
+				return nil, fmt.Errorf("%w: unterminated string", ErrSyntax)
+			}
+			tokens = append(tokens, token{tString, src[i+1 : i+1+j]})
+			i += j + 2
+		default:
+			found := false
+			for _, op := range operators {
+				if strings.HasPrefix(src[i:], op) {
+					tokens = append(tokens, token{tOp, op})
+					i += len(op)
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("%w: unexpected %c", ErrSyntax, c)
+			}
+		}
+	}
+	return tokens, nil
+}
+
+type evalFunc func(Env) (interface{}, error)
+
+// parser parses an expression by recursive descent, into a tree of closures
+type parser struct {
+	tokens []token
+	pos    int
+	vars   map[string]bool
+}
+
+// accept moves past the next token and returns true if it is one of ops
+func (p *parser) accept(ops ...string) (string, bool) {
+	if p.pos == len(p.tokens) || p.tokens[p.pos].kind != tOp {
+		return "", false
+	}
+	for _, op := range ops {
+		if p.tokens[p.pos].text == op {
+			p.pos++
+			return op, true
+		}
+	}
+	return "", false
+}
+
+func (p *parser) or() (evalFunc, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.accept("||"); !ok {
+			return left, nil
+		}
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		left = logical(left, right, true)
+	}
+}
+
+func (p *parser) and() (evalFunc, error) {
+	left, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.accept("&&"); !ok {
+			return left, nil
+		}
+		right, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		left = logical(left, right, false)
+	}
+}
+
+// logical returns left || right if or is true, and left && right if not, without
+// evaluating right if left decides it
+func logical(left evalFunc, right evalFunc, or bool) evalFunc {
+	return func(env Env) (interface{}, error) {
+		for _, f := range []evalFunc{left, right} {
+			v, err := f(env)
+			if err != nil {
+				return nil, err
+			}
+			b, ok := v.(bool)
+			if !ok {
+				return nil, fmt.Errorf("%w: && and || need true or false, not %v", ErrType, v)
+			}
+			if b == or {
+				return or, nil
+			}
+		}
+		return !or, nil
+	}
+}
+
+func (p *parser) not() (evalFunc, error) {
+	if _, ok := p.accept("!"); ok {
+		operand, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return func(env Env) (interface{}, error) {
+			v, err := operand(env)
+			if err != nil {
+				return nil, err
+			}
+			b, ok := v.(bool)
+			if !ok {
+				return nil, fmt.Errorf("%w: ! needs true or false, not %v", ErrType, v)
+			}
+			return !b, nil
+		}, nil
+	}
+	return p.comparison()
+}
+
+func (p *parser) comparison() (evalFunc, error) {
+	left, err := p.sum()
+	if err != nil {
+		return nil, err
+	}
+	if op, ok := p.accept("=~", "!~"); ok {
+		if p.pos == len(p.tokens) || p.tokens[p.pos].kind != tString {
+			return nil, fmt.Errorf("%w: %s needs a string literal on its right", ErrSyntax, op)
+		}
+		re, err := regexp.Compile(p.tokens[p.pos].text)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrSyntax, err)
+		}
+		p.pos++
+		return func(env Env) (interface{}, error) {
+			v, err := left(env)
+			if err != nil {
+				return nil, err
+			}
+			s, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("%w: %s needs a string, not %v", ErrType, op, v)
+			}
+			return re.MatchString(s) == (op == "=~"), nil
+		}, nil
+	}
+	op, ok := p.accept("==", "!=", "<=", ">=", "<", ">")
+	if !ok {
+		return left, nil
+	}
+	right, err := p.sum()
+	if err != nil {
+		return nil, err
+	}
+	return func(env Env) (interface{}, error) {
+		a, err := left(env)
+		if err != nil {
+			return nil, err
+		}
+		b, err := right(env)
+		if err != nil {
+			return nil, err
+		}
+		return compare(op, a, b)
+	}, nil
+}
+
+// compare returns a op b, for two numbers, two strings or (for == and !=) two booleans
+func compare(op string, a interface{}, b interface{}) (interface{}, error) {
+	var c int
+	switch x := a.(type) {
+	case float64:
+		y, ok := b.(float64)
+		if !ok {
+			return nil, fmt.Errorf("%w: can't compare %v with %v", ErrType, a, b)
+		}
+		switch {
+		case x < y:
+			c = -1
+		case x > y:
+			c = 1
+		}
+	case string:
+		y, ok := b.(string)
+		if !ok {
+			return nil, fmt.Errorf("%w: can't compare %q with %v", ErrType, x, b)
+		}
+		c = strings.Compare(x, y)
+	case bool:
+		y, ok := b.(bool)
+		if !ok || (op != "==" && op != "!=") {
+			return nil, fmt.Errorf("%w: can't compare %v with %v using %s", ErrType, a, b, op)
+		}
+		if x != y {
+			c = 1
+		}
+	default:
+		return nil, fmt.Errorf("%w: can't compare %v", ErrType, a)
+	}
+	switch op {
+	case "==":
+		return c == 0, nil
+	case "!=":
+		return c != 0, nil
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	}
+	return c >= 0, nil
+}
+
+func (p *parser) sum() (evalFunc, error) {
+	left, err := p.product()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.accept("+", "-")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.product()
+		if err != nil {
+			return nil, err
+		}
+		left = arithmetic(op, left, right)
+	}
+}
+
+func (p *parser) product() (evalFunc, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.accept("*", "/")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		left = arithmetic(op, left, right)
+	}
+}
+
+// arithmetic returns left op right, for two numbers
+func arithmetic(op string, left evalFunc, right evalFunc) evalFunc {
+	return func(env Env) (interface{}, error) {
+		a, err := left(env)
+		if err != nil {
+			return nil, err
+		}
+		b, err := right(env)
+		if err != nil {
+			return nil, err
+		}
+		x, okA := a.(float64)
+		y, okB := b.(float64)
+		if !okA || !okB {
+			return nil, fmt.Errorf("%w: %s needs numbers, not %v and %v", ErrType, op, a, b)
+		}
+		switch op {
+		case "+":
+			return x + y, nil
+		case "-":
+			return x - y, nil
+		case "*":
+			return x * y, nil
+		}
+		return x / y, nil
+	}
+}
+
+func (p *parser) unary() (evalFunc, error) {
+	if _, ok := p.accept("-"); ok {
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return arithmetic("-", func(Env) (interface{}, error) { return 0.0, nil }, operand), nil
+	}
+	return p.primary()
+}
+
+func (p *parser) primary() (evalFunc, error) {
+	if p.pos == len(p.tokens) {
+		return nil, fmt.Errorf("%w: unexpected end", ErrSyntax)
+	}
+	t := p.tokens[p.pos]
+	p.pos++
+	switch t.kind {
+	case tNumber:
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: bad number %s", ErrSyntax, t.text)
+		}
+		return constant(f), nil
+	case tString:
+		return constant(t.text), nil
+	case tIdent:
+		switch t.text {
+		case "true":
+			return constant(true), nil
+		case "false":
+			return constant(false), nil
+		}
+		if !p.vars[t.text] {
+			return nil, fmt.Errorf("%w: unknown variable %s", ErrSyntax, t.text)
+		}
+		name := t.text
+		return func(env Env) (interface{}, error) {
+			return env[name], nil
+		}, nil
+	}
+	if t.text == "(" {
+		inner, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := p.accept(")"); !ok {
+			return nil, fmt.Errorf("%w: missing )", ErrSyntax)
+		}
+		return inner, nil
+	}
+	return nil, fmt.Errorf("%w: unexpected %s", ErrSyntax, t.text)
+}
+
+func constant(v interface{}) evalFunc {
+	return func(Env) (interface{}, error) {
+		return v, nil
+	}
+}
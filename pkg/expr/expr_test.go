@@ -0,0 +1,52 @@
+package expr
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestEval(t *testing.T) {
+	vars := []string{"n", "s"}
+	env := Env{"n": 3.0, "s": "England/1"}
+	tests := []struct {
+		src  string
+		want interface{}
+	}{
+		{"1 + 2 * 3", 7.0},
+		{"(1 + 2) * 3", 9.0},
+		{"-n / 2", -1.5},
+		{"n < 40 && s =~ '^England/'", true},
+		{"n >= 4 || s == \"England/1\"", true},
+		{"!(n != 3)", true},
+		{"s !~ 'Wales' && s > 'A'", true},
+		{"true == (n > 1)", true},
+	}
+	for _, test := range tests {
+		e, err := Compile(test.src, vars)
+		if err != nil {
+			t.Errorf("problem in TestEval(): %s: %v", test.src, err)
+			continue
+		}
+		got, err := e.Eval(env)
+		if err != nil || got != test.want {
+			t.Errorf("problem in TestEval(): %s is %v, %v", test.src, got, err)
+		}
+	}
+
+	for _, src := range []string{"", "n <", "(n", "m > 1", "s =~ n", "'s", "n # 1", "s =~ '('"} {
+		if _, err := Compile(src, vars); !errors.Is(err, ErrSyntax) {
+			t.Errorf("problem in TestEval(): %q compiled: %v", src, err)
+		}
+	}
+
+	for _, src := range []string{"s > 1", "n && true", "s + 1", "n", "n =~ 'x'"} {
+		e, err := Compile(src, vars)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if _, err := e.Bool(env); !errors.Is(err, ErrType) {
+			t.Errorf("problem in TestEval(): %q evaluated: %v", src, err)
+		}
+	}
+}
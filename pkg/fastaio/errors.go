@@ -0,0 +1,60 @@
+package fastaio
+
+import (
+	"errors"
+	"strconv"
+)
+
+// The causes of errors reading alignments, which callers can check for with errors.Is
+var (
+	ErrBadFasta    = errors.New("badly formatted fasta file")
+	ErrEmptyHeader = errors.New("empty header line")
+	ErrBadTwoBit   = errors.New("badly formatted .2bit file")
+	ErrBadEncoded  = errors.New("badly formatted encoded alignment")
+	ErrBadPhylip   = errors.New("badly formatted phylip file")
+	ErrBadNexus    = errors.New("badly formatted nexus file")
+	ErrBadMAF      = errors.New("badly formatted MAF file")
+	ErrBadGenBank  = errors.New("badly formatted genbank file")
+	ErrBadFaidx    = errors.New("bad fasta index")
+)
+
+// RecordError is an error in one record of an alignment. Record is the record's ID, if
+// it is known, Index is its number in the alignment (from 1), Line is the line of the
+// file the error is on and Position is the position in the sequence. Any of them may be
+// 0 (or "") if they don't apply. Err is the cause
+type RecordError struct {
+	Record   string
+	Index    int
+	Line     int
+	Position int
+	Err      error
+}
+
+func (e *RecordError) Error() string {
+	where := ""
+	add := func(s string) {
+		if where != "" {
+			where += ", "
+		}
+		where += s
+	}
+	if e.Line > 0 {
+		add("line " + strconv.Itoa(e.Line))
+	}
+	if e.Record != "" {
+		add("sequence " + e.Record)
+	} else if e.Index > 0 {
+		add("record " + strconv.Itoa(e.Index))
+	}
+	if e.Position > 0 {
+		add("position " + strconv.Itoa(e.Position))
+	}
+	if where == "" {
+		return e.Err.Error()
+	}
+	return where + ": " + e.Err.Error()
+}
+
+func (e *RecordError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,99 @@
+package fastaio
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/benjamincjackson/snps/pkg/encoding"
+)
+
+// FaidxRecord is one line of a samtools faidx (.fai) index: a record of a fasta file,
+// its length, the offset of its first base in the file, and the number of bases and
+// bytes in each of its lines
+type FaidxRecord struct {
+	Name      string
+	Length    int64
+	Offset    int64
+	LineBases int64
+	LineWidth int64
+}
+
+// ReadFaidx reads a .fai index
+func ReadFaidx(r io.Reader) ([]FaidxRecord, error) {
+	records := make([]FaidxRecord, 0)
+	s := bufio.NewScanner(r)
+	lineNumber := 0
+	for s.Scan() {
+		lineNumber++
+		line := strings.TrimRight(s.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) < 5 {
+			return nil, &RecordError{Line: lineNumber, Err: fmt.Errorf("%w: a line should have 5 fields", ErrBadFaidx)}
+		}
+		var numbers [4]int64
+		for i := range numbers {
+			n, err := strconv.ParseInt(fields[i+1], 10, 64)
+			if err != nil || n < 0 {
+				return nil, &RecordError{Record: fields[0], Line: lineNumber, Err: fmt.Errorf("%w: bad number %q", ErrBadFaidx, fields[i+1])}
+			}
+			numbers[i] = n
+		}
+		rec := FaidxRecord{Name: fields[0], Length: numbers[0], Offset: numbers[1], LineBases: numbers[2], LineWidth: numbers[3]}
+		if rec.Length > 0 && (rec.LineBases == 0 || rec.LineWidth < rec.LineBases) {
+			return nil, &RecordError{Record: rec.Name, Line: lineNumber, Err: fmt.Errorf("%w: bad line lengths", ErrBadFaidx)}
+		}
+		records = append(records, rec)
+	}
+	if s.Err() != nil {
+		return nil, s.Err()
+	}
+	return records, nil
+}
+
+// ReadFaidxRange reads the bases of rec from the 0-based start up to but not including
+// end out of the fasta file it indexes, without reading the rest of the file, and
+// encodes them
+func ReadFaidxRange(r io.ReaderAt, rec FaidxRecord, start int64, end int64, hardGaps bool) ([]byte, error) {
+	if start < 0 || end > rec.Length || start > end {
+		return nil, fmt.Errorf("%w: %d-%d is outside %s, which is %d long", ErrBadFaidx, start+1, end, rec.Name, rec.Length)
+	}
+	EA := encoding.MakeEncodingArray()
+	if hardGaps {
+		EA = encoding.MakeEncodingArrayHardGaps()
+	}
+
+	// the bytes of the range include the ends of the lines it spans
+	offset := func(i int64) int64 {
+		return rec.Offset + i/rec.LineBases*rec.LineWidth + i%rec.LineBases
+	}
+	seq := make([]byte, 0, end-start)
+	if start == end {
+		return seq, nil
+	}
+	buf := make([]byte, offset(end-1)+1-offset(start))
+	if _, err := r.ReadAt(buf, offset(start)); err != nil {
+		if err == io.EOF {
+			err = fmt.Errorf("%w: %s runs off the end of the fasta file", ErrBadFaidx, rec.Name)
+		}
+		return nil, err
+	}
+	for _, nuc := range buf {
+		if nuc == '\n' || nuc == '\r' {
+			continue
+		}
+		if EA[nuc] == 0 {
+			return nil, &RecordError{Record: rec.Name, Position: int(start) + len(seq) + 1, Err: fmt.Errorf("%w: %q, which may mean the index is out of date", ErrBadFaidx, nuc)}
+		}
+		seq = append(seq, EA[nuc])
+	}
+	if int64(len(seq)) != end-start {
+		return nil, fmt.Errorf("%w: %s isn't where the index says it is", ErrBadFaidx, rec.Name)
+	}
+	return seq, nil
+}
@@ -0,0 +1,200 @@
+// Package fastaio reads alignments in fasta format
+package fastaio
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"strings"
+
+	"github.com/benjamincjackson/snps/pkg/encoding"
+)
+
+// EncodedFastaRecord is a struct for one Fasta record
+type EncodedFastaRecord struct {
+	ID          string
+	Description string
+	Seq         []byte
+	Idx         int
+}
+
+// maxLineLength is the length of the longest line that can be read
+const maxLineLength = 1<<31 - 1
+
+// ReadEncodeAlignment reads an alignment in fasta format to a channel
+// of EncodedFastaRecord structs - converting sequence to EP's bitwise coding scheme.
+// An alignment that has already been encoded (see EncodedWriter) is read as it is, and
+// so are sequences in UCSC's .2bit format, PHYLIP alignments, NEXUS files, MAF
+// alignments and GenBank flat files
+func ReadEncodeAlignment(r io.Reader, hardGaps bool, chnl chan EncodedFastaRecord, chnlerr chan error, cdone chan bool) {
+	ReadEncodeAlignmentContext(context.Background(), r, hardGaps, chnl, chnlerr, cdone)
+}
+
+// ReadEncodeAlignmentContext is ReadEncodeAlignment, but stops reading once ctx is done,
+// without sending anything more, so that it can be abandoned
+func ReadEncodeAlignmentContext(ctx context.Context, r io.Reader, hardGaps bool, chnl chan EncodedFastaRecord, chnlerr chan error, cdone chan bool) {
+
+	c := channels{ctx: ctx, records: chnl, errs: chnlerr, done: cdone}
+
+	br := bufio.NewReader(&contextReader{ctx: ctx, r: r})
+	if start, err := br.Peek(len(sepMagic)); err == nil && IsEncoded(start) {
+		readEncoded(br, hardGaps, c)
+		return
+	}
+	if start, err := br.Peek(4); err == nil && IsTwoBit(start) {
+		readTwoBit(br, c)
+		return
+	}
+	if start, _ := br.Peek(phylipPeek); IsNexus(start) {
+		readNexus(br, hardGaps, c)
+		return
+	} else if IsMAF(start) {
+		readMAF(br, hardGaps, c)
+		return
+	} else if IsGenBank(start) {
+		readGenBank(br, hardGaps, c)
+		return
+	} else if IsPhylip(start) {
+		readPhylip(br, hardGaps, c)
+		return
+	}
+
+	var EA []byte
+	switch hardGaps {
+	case true:
+		EA = encoding.MakeEncodingArrayHardGaps()
+	case false:
+		EA = encoding.MakeEncodingArray()
+	}
+
+	s := bufio.NewScanner(br)
+	// whole chromosomes can be on one line
+	s.Buffer(make([]byte, 0, 64*1024), maxLineLength)
+
+	first := true
+
+	var id string
+	var description string
+	var seqBuffer []byte
+	var line []byte
+
+	counter := 0
+	lineNumber := 0
+
+	for s.Scan() {
+		line = s.Bytes()
+		lineNumber++
+
+		if len(line) == 0 {
+			continue
+		}
+
+		if first {
+
+			if line[0] != '>' {
+				c.error(&RecordError{Index: counter + 1, Line: lineNumber, Err: ErrBadFasta})
+				return
+			}
+
+			description = string(line[1:])
+			id = firstField(description)
+			if id == "" {
+				c.error(&RecordError{Index: counter + 1, Line: lineNumber, Err: ErrEmptyHeader})
+				return
+			}
+
+			first = false
+
+		} else if line[0] == '>' {
+
+			fr := EncodedFastaRecord{ID: id, Description: description, Seq: seqBuffer, Idx: counter}
+			if !c.record(fr) {
+				return
+			}
+			counter++
+
+			description = string(line[1:])
+			id = firstField(description)
+			if id == "" {
+				c.error(&RecordError{Index: counter + 1, Line: lineNumber, Err: ErrEmptyHeader})
+				return
+			}
+			seqBuffer = make([]byte, 0)
+
+		} else {
+			encodedLine := make([]byte, len(line))
+			for i := range line {
+				encodedLine[i] = EA[line[i]]
+			}
+			seqBuffer = append(seqBuffer, encodedLine...)
+		}
+	}
+
+	if s.Err() != nil {
+		c.error(s.Err())
+		return
+	}
+
+	fr := EncodedFastaRecord{ID: id, Description: description, Seq: seqBuffer, Idx: counter}
+	if !c.record(fr) {
+		return
+	}
+
+	c.finish()
+}
+
+// channels are where a reader sends its records, the error that stops it, and then the
+// signal that it has finished. Sends give up once ctx is done, so that a reader that no
+// one is listening to any more returns
+type channels struct {
+	ctx     context.Context
+	records chan EncodedFastaRecord
+	errs    chan error
+	done    chan bool
+}
+
+// record sends a record, and returns false if ctx is done instead
+func (c channels) record(FR EncodedFastaRecord) bool {
+	select {
+	case c.records <- FR:
+		return true
+	case <-c.ctx.Done():
+		return false
+	}
+}
+
+func (c channels) error(err error) {
+	select {
+	case c.errs <- err:
+	case <-c.ctx.Done():
+	}
+}
+
+func (c channels) finish() {
+	select {
+	case c.done <- true:
+	case <-c.ctx.Done():
+	}
+}
+
+// contextReader is an io.Reader that stops with ctx's error once ctx is done
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr *contextReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}
+
+// firstField returns the first whitespace-separated field of s, or "" if it hasn't got one
+func firstField(s string) string {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
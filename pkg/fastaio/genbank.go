@@ -0,0 +1,107 @@
+package fastaio
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/benjamincjackson/snps/pkg/encoding"
+)
+
+// IsGenBank returns whether the start of a file says it is a GenBank flat file
+func IsGenBank(start []byte) bool {
+	return bytes.HasPrefix(start, []byte("LOCUS"))
+}
+
+// readGenBank is ReadEncodeAlignment for GenBank flat files, e.g. a RefSeq record. Each
+// record's sequence is read from its ORIGIN section, with its ID taken from its VERSION
+// (or LOCUS, if it hasn't got one) and its description from its DEFINITION, as in the
+// fasta that NCBI would give for it. The rest, e.g. the feature table, is skipped
+func readGenBank(r *bufio.Reader, hardGaps bool, c channels) {
+	EA := encoding.MakeEncodingArray()
+	if hardGaps {
+		EA = encoding.MakeEncodingArrayHardGaps()
+	}
+
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, 64*1024), maxLineLength)
+
+	var id, definition, section string
+	var seq []byte
+	inRecord, hasOrigin := false, false
+	counter, lineNumber := 0, 0
+
+	for s.Scan() {
+		line := strings.TrimRight(s.Text(), " \r")
+		lineNumber++
+		if len(line) == 0 {
+			continue
+		}
+
+		// a keyword starts a section, and lines that start with spaces go on with it
+		if line[0] != ' ' {
+			fields := strings.Fields(line)
+			section = fields[0]
+			switch section {
+			case "LOCUS":
+				if inRecord {
+					c.error(&RecordError{Record: id, Index: counter + 1, Line: lineNumber, Err: fmt.Errorf("%w: a record without // at its end", ErrBadGenBank)})
+					return
+				}
+				if len(fields) < 2 {
+					c.error(&RecordError{Index: counter + 1, Line: lineNumber, Err: fmt.Errorf("%w: LOCUS without a name", ErrBadGenBank)})
+					return
+				}
+				id, definition, seq = fields[1], "", make([]byte, 0)
+				inRecord, hasOrigin = true, false
+			case "VERSION":
+				if len(fields) > 1 {
+					id = fields[1]
+				}
+			case "DEFINITION":
+				definition = strings.TrimSpace(strings.TrimPrefix(line, "DEFINITION"))
+			case "ORIGIN":
+				hasOrigin = true
+			case "//":
+				if !inRecord || !hasOrigin {
+					c.error(&RecordError{Record: id, Index: counter + 1, Line: lineNumber, Err: fmt.Errorf("%w: a record without a sequence", ErrBadGenBank)})
+					return
+				}
+				description := id
+				if definition != "" {
+					description += " " + definition
+				}
+				if !c.record(EncodedFastaRecord{ID: id, Description: description, Seq: seq, Idx: counter}) {
+					return
+				}
+				counter++
+				inRecord = false
+			}
+			continue
+		}
+
+		switch section {
+		case "DEFINITION":
+			definition += " " + strings.TrimSpace(line)
+		case "ORIGIN":
+			// sequence lines start with the position of their first base
+			for i := 0; i < len(line); i++ {
+				if nuc := line[i]; nuc != ' ' && (nuc < '0' || nuc > '9') {
+					seq = append(seq, EA[nuc])
+				}
+			}
+		}
+	}
+
+	if s.Err() != nil {
+		c.error(s.Err())
+		return
+	}
+	if inRecord {
+		c.error(&RecordError{Record: id, Index: counter + 1, Line: lineNumber, Err: fmt.Errorf("%w: a record without // at its end", ErrBadGenBank)})
+		return
+	}
+
+	c.finish()
+}
@@ -0,0 +1,194 @@
+package fastaio
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/benjamincjackson/snps/pkg/encoding"
+)
+
+// IsMAF returns whether the start of a file says it is a UCSC multiple alignment (MAF)
+func IsMAF(start []byte) bool {
+	return bytes.HasPrefix(start, []byte("##maf"))
+}
+
+// mafRow is one s line of a MAF block: part of the sequence src, from the 0-based start
+// on strand, of which text is the aligned bases
+type mafRow struct {
+	src     string
+	start   int
+	size    int
+	strand  string
+	srcSize int
+	text    []byte
+}
+
+// species returns the species of a row, which is the part of its source before the
+// first ., e.g. hg38 for hg38.chr1
+func (row mafRow) species() string {
+	if i := strings.IndexByte(row.src, '.'); i >= 0 {
+		return row.src[:i]
+	}
+	return row.src
+}
+
+// mafComplement complements bases in MAF blocks on the reverse strand
+var mafComplement = func() [256]byte {
+	var complement [256]byte
+	for i := range complement {
+		complement[i] = byte(i)
+	}
+	for _, pair := range []string{"AT", "CG", "RY", "KM", "BV", "DH", "at", "cg", "ry", "km", "bv", "dh"} {
+		complement[pair[0]], complement[pair[1]] = pair[1], pair[0]
+	}
+	return complement
+}()
+
+// readMAF is ReadEncodeAlignment for MAF files, e.g. whole-genome alignments of several
+// species. The reference is the species of the first row of the first block, and each
+// species' rows are stitched together along the reference's, so that each species is
+// one record in the reference's coordinates: its bases where it was aligned with a base
+// of the reference, N where it wasn't aligned with the reference and gaps where it was
+// aligned with a gap. Its insertions relative to the reference are left out, and so are
+// its other rows in a block after the first. The reference is the first record, so that
+// it can be used with --ref-first. Its rows all have to be on the same sequence, e.g.
+// one chromosome
+func readMAF(r *bufio.Reader, hardGaps bool, c channels) {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, 64*1024), maxLineLength)
+
+	names := make([]string, 0)
+	seqs := make(map[string][]byte)
+	var ref mafRow
+	block := make([]mafRow, 0)
+	lineNumber := 0
+
+	// stitch adds a block to the sequences
+	stitch := func() error {
+		defer func() {
+			block = block[:0]
+		}()
+		if len(block) == 0 {
+			return nil
+		}
+		if ref.src == "" {
+			ref = block[0]
+		}
+		refSpecies := ref.species()
+		refRow := -1
+		for i, row := range block {
+			if row.species() == refSpecies {
+				refRow = i
+				break
+			}
+		}
+		if refRow < 0 {
+			return nil
+		}
+		if block[refRow].src != ref.src || block[refRow].srcSize != ref.srcSize {
+			return fmt.Errorf("%w: the reference, %s, is aligned on more than one sequence: %s and %s", ErrBadMAF, refSpecies, ref.src, block[refRow].src)
+		}
+
+		start := block[refRow].start
+		if block[refRow].strand == "-" {
+			start = ref.srcSize - start - block[refRow].size
+			for _, row := range block {
+				for i, j := 0, len(row.text)-1; i <= j; i, j = i+1, j-1 {
+					row.text[i], row.text[j] = mafComplement[row.text[j]], mafComplement[row.text[i]]
+				}
+			}
+		}
+
+		seen := make(map[string]bool)
+		rows := make([]mafRow, 0, len(block))
+		for _, row := range block {
+			species := row.species()
+			if seen[species] {
+				continue
+			}
+			seen[species] = true
+			if len(row.text) != len(block[refRow].text) {
+				return fmt.Errorf("%w: the rows of a block are different lengths", ErrBadMAF)
+			}
+			if _, ok := seqs[species]; !ok {
+				seq := bytes.Repeat([]byte{'N'}, ref.srcSize)
+				seqs[species] = seq
+				names = append(names, species)
+			}
+			rows = append(rows, row)
+		}
+		pos := start
+		for col, nuc := range block[refRow].text {
+			if nuc == '-' {
+				continue
+			}
+			if pos >= ref.srcSize {
+				return fmt.Errorf("%w: the reference's row runs off the end of %s", ErrBadMAF, ref.src)
+			}
+			for _, row := range rows {
+				seqs[row.species()][pos] = row.text[col]
+			}
+			pos++
+		}
+		return nil
+	}
+
+	for s.Scan() {
+		line := s.Bytes()
+		lineNumber++
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		var err error
+		switch line[0] {
+		case 'a':
+			err = stitch()
+		case 's':
+			fields := strings.Fields(string(line))
+			if len(fields) != 7 {
+				err = fmt.Errorf("%w: an s line should have 7 fields", ErrBadMAF)
+				break
+			}
+			row := mafRow{src: fields[1], strand: fields[4], text: []byte(fields[6])}
+			var err1, err2, err3 error
+			row.start, err1 = strconv.Atoi(fields[2])
+			row.size, err2 = strconv.Atoi(fields[3])
+			row.srcSize, err3 = strconv.Atoi(fields[5])
+			if err1 != nil || err2 != nil || err3 != nil || row.start < 0 || row.start+row.size > row.srcSize {
+				err = fmt.Errorf("%w: bad coordinates", ErrBadMAF)
+				break
+			}
+			block = append(block, row)
+		}
+		if err != nil {
+			c.error(&RecordError{Line: lineNumber, Err: err})
+			return
+		}
+	}
+	if s.Err() != nil {
+		c.error(s.Err())
+		return
+	}
+	if err := stitch(); err != nil {
+		c.error(&RecordError{Line: lineNumber, Err: err})
+		return
+	}
+
+	EA := encoding.MakeEncodingArray()
+	if hardGaps {
+		EA = encoding.MakeEncodingArrayHardGaps()
+	}
+	for idx, name := range names {
+		seq := seqs[name]
+		for i := range seq {
+			seq[i] = EA[seq[i]]
+		}
+		if !c.record(EncodedFastaRecord{ID: name, Description: name, Seq: seq, Idx: idx}) {
+			return
+		}
+	}
+	c.finish()
+}
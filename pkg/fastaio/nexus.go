@@ -0,0 +1,261 @@
+package fastaio
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/benjamincjackson/snps/pkg/encoding"
+)
+
+// IsNexus returns whether the start of a file says it is in NEXUS format
+func IsNexus(start []byte) bool {
+	start = bytes.TrimLeft(start, " \t\r\n")
+	return len(start) >= 6 && strings.EqualFold(string(start[:6]), "#NEXUS")
+}
+
+// nexusToken is a word or punctuation of a NEXUS file. lineStart is true if it is the
+// first on its line
+type nexusToken struct {
+	text      string
+	lineStart bool
+}
+
+// readNexus is ReadEncodeAlignment for NEXUS files, e.g. the input of BEAST or MrBayes.
+// The matrix of the first DATA or CHARACTERS block is read, interleaved or not, with
+// the block's MISSING, GAP and MATCHCHAR symbols, and everything else is skipped. Every
+// row has to have NCHAR sites, and there have to be NTAX rows, from the block or else
+// the TAXA block, if it is given. The whole file is held in memory, since an interleaved
+// matrix's sequences aren't finished until its last block
+func readNexus(r *bufio.Reader, hardGaps bool, c channels) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		c.error(err)
+		return
+	}
+	tokens, err := tokenizeNexus(data)
+	if err != nil {
+		c.error(err)
+		return
+	}
+
+	// command returns the tokens of the command that starts at tokens[i], up to its ;,
+	// the index of the token after the ;, and false if there isn't a ;
+	command := func(i int) ([]nexusToken, int, bool) {
+		for j := i; j < len(tokens); j++ {
+			if tokens[j].text == ";" {
+				return tokens[i:j], j + 1, true
+			}
+		}
+		return tokens[i:], len(tokens), false
+	}
+	// setting returns the value of key=value in a command, or "" if it isn't there
+	setting := func(cmd []nexusToken, key string) string {
+		for j := 0; j+2 < len(cmd); j++ {
+			if strings.EqualFold(cmd[j].text, key) && cmd[j+1].text == "=" {
+				return cmd[j+2].text
+			}
+		}
+		return ""
+	}
+
+	nchar, ntax := 0, 0
+	interleaved := false
+	missing, gap, match := byte('?'), byte('-'), byte(0)
+	var matrix []nexusToken
+	inBlock, inTaxa := false, false
+	for i := 1; i < len(tokens) && matrix == nil; {
+		cmd, next, ended := command(i)
+		i = next
+		if len(cmd) == 0 {
+			continue
+		}
+		name := strings.ToUpper(cmd[0].text)
+		if name == "DIMENSIONS" && (inBlock || inTaxa) && setting(cmd, "NTAX") != "" {
+			ntax, err = strconv.Atoi(setting(cmd, "NTAX"))
+			if err != nil || ntax < 1 {
+				c.error(fmt.Errorf("%w: bad NTAX", ErrBadNexus))
+				return
+			}
+		}
+		switch {
+		case name == "BEGIN" && len(cmd) > 1:
+			block := strings.ToUpper(cmd[1].text)
+			inBlock = block == "DATA" || block == "CHARACTERS"
+			inTaxa = block == "TAXA"
+		case !inBlock:
+			if name == "END" || name == "ENDBLOCK" {
+				inTaxa = false
+			}
+		case name == "END" || name == "ENDBLOCK":
+			inBlock = false
+		case name == "DIMENSIONS":
+			nchar, err = strconv.Atoi(setting(cmd, "NCHAR"))
+			if err != nil || nchar < 1 {
+				c.error(fmt.Errorf("%w: bad NCHAR", ErrBadNexus))
+				return
+			}
+		case name == "FORMAT":
+			switch strings.ToUpper(setting(cmd, "DATATYPE")) {
+			case "", "DNA", "RNA", "NUCLEOTIDE":
+			default:
+				c.error(fmt.Errorf("%w: only DNA, RNA or nucleotide data can be read, not %s", ErrBadNexus, setting(cmd, "DATATYPE")))
+				return
+			}
+			for _, symbol := range []struct {
+				key string
+				to  *byte
+			}{{"MISSING", &missing}, {"GAP", &gap}, {"MATCHCHAR", &match}} {
+				if value := setting(cmd, symbol.key); len(value) == 1 {
+					*symbol.to = value[0]
+				}
+			}
+			for j, token := range cmd {
+				if strings.EqualFold(token.text, "INTERLEAVE") {
+					interleaved = j+2 >= len(cmd) || cmd[j+1].text != "=" || !strings.EqualFold(cmd[j+2].text, "NO")
+				}
+			}
+		case name == "MATRIX":
+			if !ended {
+				c.error(fmt.Errorf("%w: the MATRIX has no ; at its end", ErrBadNexus))
+				return
+			}
+			matrix = cmd[1:]
+		}
+	}
+	if matrix == nil {
+		c.error(fmt.Errorf("%w: no DATA or CHARACTERS block with a MATRIX", ErrBadNexus))
+		return
+	}
+	if nchar == 0 {
+		c.error(fmt.Errorf("%w: no NCHAR", ErrBadNexus))
+		return
+	}
+
+	// each row of an interleaved matrix is a name and part of its sequence, and each
+	// sequence of one that isn't goes on until it has nchar sites
+	names := make([]string, 0)
+	seqs := make(map[string][]byte)
+	current := ""
+	for _, token := range matrix {
+		if (interleaved && token.lineStart) || (!interleaved && (current == "" || len(seqs[current]) >= nchar)) {
+			current = token.text
+			if _, ok := seqs[current]; !ok {
+				names = append(names, current)
+				seqs[current] = make([]byte, 0, nchar)
+			}
+			continue
+		}
+		seqs[current] = append(seqs[current], token.text...)
+	}
+
+	if ntax > 0 && len(names) != ntax {
+		c.error(fmt.Errorf("%w: %d taxa in the MATRIX, not NTAX=%d", ErrBadNexus, len(names), ntax))
+		return
+	}
+
+	EA := encoding.MakeEncodingArray()
+	if hardGaps {
+		EA = encoding.MakeEncodingArrayHardGaps()
+	}
+	var first []byte
+	for idx, name := range names {
+		seq := seqs[name]
+		if len(seq) != nchar {
+			c.error(&RecordError{Record: name, Index: idx + 1, Err: fmt.Errorf("%w: %d sites, not NCHAR=%d", ErrBadNexus, len(seq), nchar)})
+			return
+		}
+		for j, nuc := range seq {
+			switch {
+			case nuc == match && first != nil:
+				nuc = first[j]
+			case nuc == missing:
+				nuc = '?'
+			case nuc == gap:
+				nuc = '-'
+			case nuc == 'U' || nuc == 'u':
+				nuc = 'T'
+			}
+			seq[j] = nuc
+		}
+		if first == nil {
+			first = append([]byte(nil), seq...)
+		}
+		for j := range seq {
+			seq[j] = EA[seq[j]]
+		}
+		if !c.record(EncodedFastaRecord{ID: name, Description: name, Seq: seq, Idx: idx}) {
+			return
+		}
+	}
+	c.finish()
+}
+
+// tokenizeNexus splits a NEXUS file into words, 'quoted words', in which a quote is
+// doubled, ; and =, leaving out [comments], which can be nested
+func tokenizeNexus(data []byte) ([]nexusToken, error) {
+	tokens := make([]nexusToken, 0)
+	lineStart := true
+	var word []byte
+	end := func() {
+		if word != nil {
+			tokens = append(tokens, nexusToken{text: string(word), lineStart: lineStart})
+			word = nil
+			lineStart = false
+		}
+	}
+	for i := 0; i < len(data); i++ {
+		switch b := data[i]; b {
+		case '\n':
+			end()
+			lineStart = true
+		case ' ', '\t', '\r':
+			end()
+		case ';', '=':
+			end()
+			tokens = append(tokens, nexusToken{text: string(b), lineStart: lineStart})
+			lineStart = false
+		case '[':
+			end()
+			depth := 0
+			for ; i < len(data); i++ {
+				if data[i] == '[' {
+					depth++
+				} else if data[i] == ']' {
+					depth--
+					if depth == 0 {
+						break
+					}
+				}
+			}
+			if depth > 0 {
+				return nil, fmt.Errorf("%w: unclosed comment", ErrBadNexus)
+			}
+		case '\'':
+			end()
+			quoted := make([]byte, 0)
+			for i++; ; i++ {
+				if i == len(data) {
+					return nil, fmt.Errorf("%w: unclosed quote", ErrBadNexus)
+				}
+				if data[i] == '\'' {
+					if i+1 < len(data) && data[i+1] == '\'' {
+						i++
+					} else {
+						break
+					}
+				}
+				quoted = append(quoted, data[i])
+			}
+			word = quoted
+			end()
+		default:
+			word = append(word, b)
+		}
+	}
+	end()
+	return tokens, nil
+}
@@ -0,0 +1,186 @@
+package fastaio
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+
+	"github.com/benjamincjackson/snps/pkg/encoding"
+)
+
+// phylipPeek is how much of the start of a file IsPhylip should be given, to be sure of
+// having its first line
+const phylipPeek = 256
+
+// strictNameLength is the length of names in strict PHYLIP, which are padded with spaces
+const strictNameLength = 10
+
+// IsPhylip returns whether the start of a file says it is a PHYLIP alignment: its first
+// line is the number of sequences then the number of sites
+func IsPhylip(start []byte) bool {
+	i := bytes.IndexByte(start, '\n')
+	if i < 0 {
+		return false
+	}
+	fields := bytes.Fields(start[:i])
+	if len(fields) < 2 {
+		return false
+	}
+	for _, field := range fields[:2] {
+		if n, err := strconv.Atoi(string(field)); err != nil || n < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// readPhylip is ReadEncodeAlignment for PHYLIP alignments, which can be sequential or
+// interleaved, with strict (10 characters, padded with spaces) or relaxed (up to the
+// first space) names. Which it is isn't written down, so it is whichever way of reading
+// it gives the right number of sequences of the right length, trying relaxed names
+// before strict ones and interleaved before sequential. Interleaved alignments can't be
+// sent until the last block has been read, so the whole alignment is held in memory
+func readPhylip(r *bufio.Reader, hardGaps bool, c channels) {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, 64*1024), maxLineLength)
+
+	s.Scan()
+	fields := bytes.Fields(s.Bytes())
+	ntax, _ := strconv.Atoi(string(fields[0]))
+	nchar, _ := strconv.Atoi(string(fields[1]))
+	if ntax == 0 {
+		c.error(fmt.Errorf("%w: it has no sequences", ErrBadPhylip))
+		return
+	}
+
+	lines := make([][]byte, 0, ntax)
+	for s.Scan() {
+		line := bytes.TrimRight(s.Bytes(), " \t\r")
+		if len(line) > 0 {
+			lines = append(lines, append([]byte(nil), line...))
+		}
+	}
+	if s.Err() != nil {
+		c.error(s.Err())
+		return
+	}
+
+	var names []string
+	var seqs [][]byte
+	ok := false
+	for _, strict := range []bool{false, true} {
+		for _, interleaved := range []bool{true, false} {
+			names, seqs, ok = parsePhylip(lines, ntax, nchar, interleaved, strict)
+			if ok {
+				break
+			}
+		}
+		if ok {
+			break
+		}
+	}
+	if !ok {
+		c.error(fmt.Errorf("%w: can't read %d sequences of %d sites from it", ErrBadPhylip, ntax, nchar))
+		return
+	}
+
+	EA := encoding.MakeEncodingArray()
+	if hardGaps {
+		EA = encoding.MakeEncodingArrayHardGaps()
+	}
+	for i, seq := range seqs {
+		for j := range seq {
+			seq[j] = EA[seq[j]]
+		}
+		if !c.record(EncodedFastaRecord{ID: names[i], Description: names[i], Seq: seq, Idx: i}) {
+			return
+		}
+	}
+	c.finish()
+}
+
+// parsePhylip reads the lines after the first of a PHYLIP alignment one way, and returns
+// the names and sequences, and whether they are ntax sequences of nchar sites
+func parsePhylip(lines [][]byte, ntax int, nchar int, interleaved bool, strict bool) ([]string, [][]byte, bool) {
+	names := make([]string, 0, ntax)
+	seqs := make([][]byte, 0, ntax)
+
+	// appendSites adds the sites in a line to a sequence, ignoring spaces, and returns
+	// false if any of it isn't sequence
+	appendSites := func(seq []byte, line []byte) ([]byte, bool) {
+		for _, b := range line {
+			switch {
+			case b == ' ' || b == '\t':
+			case b >= 'A' && b <= 'Z', b >= 'a' && b <= 'z', b == '-', b == '?':
+				seq = append(seq, b)
+			default:
+				return seq, false
+			}
+		}
+		return seq, true
+	}
+	// named reads a line that starts with a name
+	named := func(line []byte) bool {
+		var name, rest []byte
+		if strict {
+			name = line
+			if len(line) > strictNameLength {
+				name, rest = line[:strictNameLength], line[strictNameLength:]
+			}
+			name = bytes.TrimSpace(name)
+		} else {
+			name = line
+			if i := bytes.IndexAny(line, " \t"); i >= 0 {
+				name, rest = line[:i], line[i:]
+			}
+		}
+		seq, ok := appendSites(nil, rest)
+		names = append(names, string(name))
+		seqs = append(seqs, seq)
+		return ok && len(name) > 0
+	}
+
+	if interleaved {
+		if len(lines) < ntax || len(lines)%ntax != 0 {
+			return nil, nil, false
+		}
+		for i, line := range lines {
+			if i < ntax {
+				if !named(line) {
+					return nil, nil, false
+				}
+				continue
+			}
+			var ok bool
+			seqs[i%ntax], ok = appendSites(seqs[i%ntax], line)
+			if !ok {
+				return nil, nil, false
+			}
+		}
+	} else {
+		i := 0
+		for t := 0; t < ntax; t++ {
+			if i == len(lines) || !named(lines[i]) {
+				return nil, nil, false
+			}
+			for i++; len(seqs[t]) < nchar && i < len(lines); i++ {
+				var ok bool
+				seqs[t], ok = appendSites(seqs[t], lines[i])
+				if !ok {
+					return nil, nil, false
+				}
+			}
+		}
+		if i != len(lines) {
+			return nil, nil, false
+		}
+	}
+
+	for _, seq := range seqs {
+		if len(seq) != nchar {
+			return nil, nil, false
+		}
+	}
+	return names, seqs, len(seqs) == ntax
+}
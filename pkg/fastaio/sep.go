@@ -0,0 +1,143 @@
+package fastaio
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// sepMagic starts every encoded alignment (.sep) file. The byte after it is 1 if gaps
+// were encoded as hard gaps, else 0. Then each record is its header line (without the
+// >) and its encoded sequence, each preceded by its length as a uvarint
+var sepMagic = []byte("SNPSSEP\x01")
+
+// sepMaxField is the longest field (a header line or a sequence) that is read from an
+// encoded alignment, which is longer than any chromosome, so that a corrupt length is an
+// error rather than an allocation of that size
+const sepMaxField = 1 << 32
+
+// IsEncoded returns whether the start of a file, of at least 8 bytes, says it is an
+// encoded alignment
+func IsEncoded(start []byte) bool {
+	return bytes.HasPrefix(start, sepMagic)
+}
+
+// EncodedWriter writes records to an encoded alignment, which can be read again much
+// faster than fasta, since there is nothing to parse or encode
+type EncodedWriter struct {
+	w   *bufio.Writer
+	buf []byte
+}
+
+// NewEncodedWriter writes the header of an encoded alignment to w, whose records were
+// encoded with hard gaps or not
+func NewEncodedWriter(w io.Writer, hardGaps bool) (*EncodedWriter, error) {
+	ew := &EncodedWriter{w: bufio.NewWriter(w), buf: make([]byte, binary.MaxVarintLen64)}
+	_, err := ew.w.Write(sepMagic)
+	if err != nil {
+		return nil, err
+	}
+	flag := byte(0)
+	if hardGaps {
+		flag = 1
+	}
+	return ew, ew.w.WriteByte(flag)
+}
+
+// Write writes one record
+func (ew *EncodedWriter) Write(FR EncodedFastaRecord) error {
+	for _, b := range [][]byte{[]byte(FR.Description), FR.Seq} {
+		n := binary.PutUvarint(ew.buf, uint64(len(b)))
+		if _, err := ew.w.Write(ew.buf[:n]); err != nil {
+			return err
+		}
+		if _, err := ew.w.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flush writes any buffered records
+func (ew *EncodedWriter) Flush() error {
+	return ew.w.Flush()
+}
+
+// readEncoded is ReadEncodeAlignment for encoded alignments. If the alignment was
+// encoded with the other kind of gaps, they are converted
+func readEncoded(r *bufio.Reader, hardGaps bool, c channels) {
+
+	header := make([]byte, len(sepMagic)+1)
+	_, err := io.ReadFull(r, header)
+	if err != nil {
+		c.error(err)
+		return
+	}
+	var from, to byte = 244, 4
+	if header[len(sepMagic)] == 1 {
+		from, to = 4, 244
+	}
+	convert := (header[len(sepMagic)] == 1) != hardGaps
+
+	counter := 0
+	for {
+		description, err := readField(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			c.error(err)
+			return
+		}
+		seq, err := readField(r)
+		if err != nil {
+			if err == io.EOF {
+				err = fmt.Errorf("%w: it is truncated", ErrBadEncoded)
+			}
+			c.error(err)
+			return
+		}
+		id := firstField(string(description))
+		if id == "" {
+			c.error(&RecordError{Index: counter + 1, Err: ErrBadEncoded})
+			return
+		}
+		if convert {
+			for i := range seq {
+				if seq[i] == from {
+					seq[i] = to
+				}
+			}
+		}
+		if !c.record(EncodedFastaRecord{ID: id, Description: string(description), Seq: seq, Idx: counter}) {
+			return
+		}
+		counter++
+	}
+
+	c.finish()
+}
+
+// readField reads a uvarint length and that many bytes. It returns io.EOF only if there
+// was nothing left to read. The bytes are read as they come, rather than into a buffer
+// of the length first, so that a corrupt length in a truncated file isn't allocated
+func readField(r *bufio.Reader) ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err == io.EOF {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: bad field length: %v", ErrBadEncoded, err)
+	}
+	if n > sepMaxField {
+		return nil, fmt.Errorf("%w: a field of %d bytes is longer than any sequence", ErrBadEncoded, n)
+	}
+	var b bytes.Buffer
+	read, err := io.CopyN(&b, r, int64(n))
+	if err == io.EOF {
+		err = fmt.Errorf("%w: it is truncated: a field of %d bytes has only %d", ErrBadEncoded, n, read)
+	}
+	return b.Bytes(), err
+}
@@ -0,0 +1,167 @@
+package fastaio
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// twoBitSignature starts every UCSC .2bit file, in the byte order of the rest of it
+const twoBitSignature = 0x1A412743
+
+// IsTwoBit returns whether the start of a file, of at least 4 bytes, says it is in UCSC's
+// .2bit format
+func IsTwoBit(start []byte) bool {
+	return len(start) >= 4 && (binary.LittleEndian.Uint32(start) == twoBitSignature || binary.BigEndian.Uint32(start) == twoBitSignature)
+}
+
+// twoBitCodes are the encodings of T, C, A and G, which are 0 to 3 in .2bit files
+var twoBitCodes = [4]byte{24, 40, 136, 72}
+
+// readTwoBit is ReadEncodeAlignment for .2bit files. The sequences are read in the order
+// they are stored in, which is usually the order of the index, without seeking, so a
+// .2bit file can be piped in. Runs of N are read as N, and soft-masking is ignored
+func readTwoBit(r *bufio.Reader, c channels) {
+
+	tr := &twoBitReader{r: r, order: binary.LittleEndian}
+
+	signature := make([]byte, 4)
+	tr.read(signature)
+	if binary.LittleEndian.Uint32(signature) != twoBitSignature {
+		tr.order = binary.BigEndian
+	}
+	version := tr.uint32()
+	count := tr.uint32()
+	tr.uint32() // reserved
+	if tr.err == nil && version > 1 {
+		tr.err = fmt.Errorf("%w: unknown version %d", ErrBadTwoBit, version)
+	}
+
+	type entry struct {
+		name   string
+		offset uint64
+	}
+	// count isn't trusted: the index is read one entry at a time, so a corrupt count is
+	// an error when the file runs out, not an allocation of that many entries
+	index := make([]entry, 0, min(count, 1<<16))
+	for i := uint32(0); i < count && tr.err == nil; i++ {
+		var e entry
+		name := make([]byte, tr.byte())
+		tr.read(name)
+		e.name = string(name)
+		if version == 1 {
+			e.offset = tr.uint64()
+		} else {
+			e.offset = uint64(tr.uint32())
+		}
+		index = append(index, e)
+	}
+	if tr.err != nil {
+		c.error(tr.err)
+		return
+	}
+
+	sort.SliceStable(index, func(i, j int) bool { return index[i].offset < index[j].offset })
+
+	for i, e := range index {
+		if e.offset < tr.pos {
+			c.error(&RecordError{Record: e.name, Index: i + 1, Err: ErrBadTwoBit})
+			return
+		}
+		tr.skip(e.offset - tr.pos)
+
+		size := tr.uint32()
+		nBlocks := tr.blocks()
+		tr.blocks() // soft-masked blocks
+		tr.uint32() // reserved
+		packed := make([]byte, (uint64(size)+3)/4)
+		tr.read(packed)
+		if tr.err != nil {
+			c.error(tr.err)
+			return
+		}
+
+		seq := make([]byte, size)
+		for j := range seq {
+			seq[j] = twoBitCodes[(packed[j/4]>>(6-2*uint(j%4)))&3]
+		}
+		for _, block := range nBlocks {
+			for j := block[0]; j < block[0]+block[1] && j < uint32(size); j++ {
+				seq[j] = 240
+			}
+		}
+
+		if !c.record(EncodedFastaRecord{ID: e.name, Description: e.name, Seq: seq, Idx: i}) {
+			return
+		}
+	}
+
+	c.finish()
+}
+
+// twoBitReader reads the fields of a .2bit file in order, keeping track of its position
+// and of the first error, after which every read returns zero
+type twoBitReader struct {
+	r     *bufio.Reader
+	order binary.ByteOrder
+	pos   uint64
+	err   error
+}
+
+func (tr *twoBitReader) read(b []byte) {
+	if tr.err != nil {
+		return
+	}
+	n, err := io.ReadFull(tr.r, b)
+	tr.pos += uint64(n)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = fmt.Errorf("%w: it is truncated", ErrBadTwoBit)
+	}
+	tr.err = err
+}
+
+func (tr *twoBitReader) skip(n uint64) {
+	if tr.err != nil {
+		return
+	}
+	m, err := io.CopyN(io.Discard, tr.r, int64(n))
+	tr.pos += uint64(m)
+	if err == io.EOF {
+		err = fmt.Errorf("%w: it is truncated", ErrBadTwoBit)
+	}
+	tr.err = err
+}
+
+func (tr *twoBitReader) byte() byte {
+	b := make([]byte, 1)
+	tr.read(b)
+	return b[0]
+}
+
+func (tr *twoBitReader) uint32() uint32 {
+	b := make([]byte, 4)
+	tr.read(b)
+	return tr.order.Uint32(b)
+}
+
+func (tr *twoBitReader) uint64() uint64 {
+	b := make([]byte, 8)
+	tr.read(b)
+	return tr.order.Uint64(b)
+}
+
+// blocks reads a count of blocks, and then their starts and their sizes. Like the
+// index, they are read one at a time, so that a corrupt count isn't allocated
+func (tr *twoBitReader) blocks() [][2]uint32 {
+	n := tr.uint32()
+	blocks := make([][2]uint32, 0, min(n, 1<<16))
+	for i := uint32(0); i < n && tr.err == nil; i++ {
+		blocks = append(blocks, [2]uint32{tr.uint32(), 0})
+	}
+	for i := range blocks {
+		blocks[i][1] = tr.uint32()
+	}
+	return blocks
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// durationBuckets are the upper bounds, in seconds, of the request latency histogram
+var durationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// Metrics counts the requests a Server answers. It is an http.Handler that serves them
+// in the Prometheus text format
+type Metrics struct {
+	mu              sync.Mutex
+	requests        int64
+	errors          int64
+	sequences       int64
+	durationBuckets []int64
+	durationSum     float64
+}
+
+// NewMetrics returns an empty set of metrics
+func NewMetrics() *Metrics {
+	return &Metrics{durationBuckets: make([]int64, len(durationBuckets))}
+}
+
+// observe records one request
+func (m *Metrics) observe(duration time.Duration, sequences int, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requests++
+	if err != nil {
+		m.errors++
+	}
+	m.sequences += int64(sequences)
+
+	seconds := duration.Seconds()
+	m.durationSum += seconds
+	for i, le := range durationBuckets {
+		if seconds <= le {
+			m.durationBuckets[i]++
+		}
+	}
+}
+
+// ServeHTTP writes the metrics in the Prometheus text format
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	fmt.Fprintln(w, "# HELP snps_requests_total Requests answered.")
+	fmt.Fprintln(w, "# TYPE snps_requests_total counter")
+	fmt.Fprintf(w, "snps_requests_total %d\n", m.requests)
+
+	fmt.Fprintln(w, "# HELP snps_request_errors_total Requests answered with an error.")
+	fmt.Fprintln(w, "# TYPE snps_request_errors_total counter")
+	fmt.Fprintf(w, "snps_request_errors_total %d\n", m.errors)
+
+	fmt.Fprintln(w, "# HELP snps_sequences_processed_total Query sequences processed.")
+	fmt.Fprintln(w, "# TYPE snps_sequences_processed_total counter")
+	fmt.Fprintf(w, "snps_sequences_processed_total %d\n", m.sequences)
+
+	fmt.Fprintln(w, "# HELP snps_request_duration_seconds Time taken to answer requests.")
+	fmt.Fprintln(w, "# TYPE snps_request_duration_seconds histogram")
+	for i, le := range durationBuckets {
+		fmt.Fprintf(w, "snps_request_duration_seconds_bucket{le=\"%g\"} %d\n", le, m.durationBuckets[i])
+	}
+	fmt.Fprintf(w, "snps_request_duration_seconds_bucket{le=\"+Inf\"} %d\n", m.requests)
+	fmt.Fprintf(w, "snps_request_duration_seconds_sum %g\n", m.durationSum)
+	fmt.Fprintf(w, "snps_request_duration_seconds_count %d\n", m.requests)
+}
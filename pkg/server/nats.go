@@ -0,0 +1,234 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// NATSOptions configure ServeNATS. Alignments are read from messages published to
+// Subject, and the output for each is published to OutSubject. If ErrorSubject is set,
+// the error message for a failed alignment is published to it. If a message has a reply
+// subject, a response in the same form as over the socket (a status byte followed by the
+// output or error message) is also published to that
+type NATSOptions struct {
+	Subject      string
+	Queue        string
+	OutSubject   string
+	ErrorSubject string
+	User         string
+	Password     string
+}
+
+// ServeNATS answers alignments published on a NATS server, using the connection conn.
+// It returns when the connection is closed
+func (s *Server) ServeNATS(conn net.Conn, opts NATSOptions) error {
+	nc, err := connectNATS(conn, opts.User, opts.Password)
+	if err != nil {
+		return err
+	}
+
+	err = nc.subscribe(opts.Subject, opts.Queue)
+	if err != nil {
+		return err
+	}
+
+	for {
+		msg, err := nc.next()
+		if err != nil {
+			return err
+		}
+
+		output, processErr := s.Process(msg.data)
+
+		if msg.reply != "" {
+			err = nc.publish(msg.reply, response(output, processErr))
+			if err != nil {
+				return err
+			}
+		}
+
+		if processErr != nil && opts.ErrorSubject != "" {
+			err = nc.publish(opts.ErrorSubject, []byte(processErr.Error()))
+		} else if processErr == nil && opts.OutSubject != "" {
+			err = nc.publish(opts.OutSubject, output)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// natsMaxPayload is the largest message that is read from a NATS server, which is the
+// largest max_payload that NATS servers can be configured with. A server that says its
+// max_payload is smaller limits messages to that
+const natsMaxPayload = 64 << 20
+
+// natsConn is a minimal client for the NATS core protocol: enough to subscribe to one
+// subject and publish to others. It doesn't support TLS
+type natsConn struct {
+	r          *bufio.Reader
+	w          *bufio.Writer
+	maxPayload int
+}
+
+type natsMsg struct {
+	subject string
+	reply   string
+	data    []byte
+}
+
+func connectNATS(conn net.Conn, user string, password string) (*natsConn, error) {
+	nc := &natsConn{r: bufio.NewReader(conn), w: bufio.NewWriter(conn)}
+
+	line, err := nc.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		return nil, errors.New("unexpected greeting from NATS server: " + line)
+	}
+
+	var info struct {
+		MaxPayload  int  `json:"max_payload"`
+		TLSRequired bool `json:"tls_required"`
+	}
+	err = json.Unmarshal([]byte(line[5:]), &info)
+	if err != nil {
+		return nil, err
+	}
+	if info.TLSRequired {
+		return nil, errors.New("NATS server requires TLS, which isn't supported")
+	}
+	nc.maxPayload = info.MaxPayload
+
+	options := map[string]interface{}{"verbose": false, "pedantic": false, "lang": "go", "name": "snps", "protocol": 1}
+	if user != "" {
+		options["user"] = user
+		options["pass"] = password
+	}
+	connect, err := json.Marshal(options)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = nc.w.WriteString("CONNECT " + string(connect) + "\r\nPING\r\n")
+	if err != nil {
+		return nil, err
+	}
+	err = nc.w.Flush()
+	if err != nil {
+		return nil, err
+	}
+
+	// the server answers the PING once it has accepted the connection
+	for {
+		line, err := nc.readLine()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case line == "PONG":
+			return nc, nil
+		case strings.HasPrefix(line, "-ERR"):
+			return nil, errors.New("NATS server error: " + line)
+		}
+	}
+}
+
+func (nc *natsConn) readLine() (string, error) {
+	line, err := nc.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func (nc *natsConn) subscribe(subject string, queue string) error {
+	sub := "SUB " + subject
+	if queue != "" {
+		sub += " " + queue
+	}
+	_, err := nc.w.WriteString(sub + " 1\r\n")
+	if err != nil {
+		return err
+	}
+	return nc.w.Flush()
+}
+
+func (nc *natsConn) publish(subject string, data []byte) error {
+	if nc.maxPayload > 0 && len(data) > nc.maxPayload {
+		return errors.New("message is larger than the NATS server's maximum payload")
+	}
+	_, err := nc.w.WriteString("PUB " + subject + " " + strconv.Itoa(len(data)) + "\r\n")
+	if err != nil {
+		return err
+	}
+	_, err = nc.w.Write(data)
+	if err != nil {
+		return err
+	}
+	_, err = nc.w.WriteString("\r\n")
+	if err != nil {
+		return err
+	}
+	return nc.w.Flush()
+}
+
+// maxMessage returns the size of the largest message that is read from the server
+func (nc *natsConn) maxMessage() int {
+	if nc.maxPayload > 0 && nc.maxPayload < natsMaxPayload {
+		return nc.maxPayload
+	}
+	return natsMaxPayload
+}
+
+// next returns the next message, answering any PINGs from the server along the way
+func (nc *natsConn) next() (natsMsg, error) {
+	for {
+		line, err := nc.readLine()
+		if err != nil {
+			return natsMsg{}, err
+		}
+
+		switch {
+		case line == "PING":
+			_, err = nc.w.WriteString("PONG\r\n")
+			if err == nil {
+				err = nc.w.Flush()
+			}
+			if err != nil {
+				return natsMsg{}, err
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return natsMsg{}, errors.New("NATS server error: " + line)
+		case strings.HasPrefix(line, "MSG "):
+			// MSG <subject> <sid> [reply-to] <#bytes>
+			fields := strings.Fields(line)
+			if len(fields) != 4 && len(fields) != 5 {
+				return natsMsg{}, errors.New("badly formatted message from NATS server: " + line)
+			}
+			size, err := strconv.Atoi(fields[len(fields)-1])
+			if err != nil {
+				return natsMsg{}, err
+			}
+			if size < 0 || size > nc.maxMessage() {
+				return natsMsg{}, errors.New("bad message size from NATS server: " + line)
+			}
+			msg := natsMsg{subject: fields[1], data: make([]byte, size+2)}
+			if len(fields) == 5 {
+				msg.reply = fields[3]
+			}
+			_, err = io.ReadFull(nc.r, msg.data)
+			if err != nil {
+				return natsMsg{}, err
+			}
+			msg.data = msg.data[:size]
+			return msg, nil
+		}
+	}
+}
@@ -0,0 +1,175 @@
+// Package server runs SNP calling as a long-lived process, so that sequences can be
+// submitted to it without the reference being read each time.
+//
+// Requests and responses are frames: a 4-byte big-endian length followed by that many
+// bytes. A request is an alignment in fasta format. The first byte of a response is
+// StatusOK, in which case the rest of the frame is the output, or StatusError, in which
+// case the rest of the frame is an error message. A connection can carry any number of
+// requests, one after another
+package server
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"time"
+
+	"github.com/benjamincjackson/snps/pkg/snps"
+)
+
+const (
+	StatusOK    byte = 0
+	StatusError byte = 1
+)
+
+// MaxFrameSize is the largest frame that will be read
+const MaxFrameSize = 1 << 30
+
+// ReadFrame reads one length-prefixed frame
+func ReadFrame(r io.Reader) ([]byte, error) {
+	var length uint32
+	err := binary.Read(r, binary.BigEndian, &length)
+	if err != nil {
+		return nil, err
+	}
+	if length > MaxFrameSize {
+		return nil, errors.New("frame is too large")
+	}
+
+	frame := make([]byte, length)
+	_, err = io.ReadFull(r, frame)
+	if err != nil {
+		return nil, err
+	}
+
+	return frame, nil
+}
+
+// WriteFrame writes one length-prefixed frame
+func WriteFrame(w io.Writer, frame []byte) error {
+	if len(frame) > MaxFrameSize {
+		return errors.New("frame is too large")
+	}
+	err := binary.Write(w, binary.BigEndian, uint32(len(frame)))
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(frame)
+	return err
+}
+
+// Request sends an alignment to a server and returns its output
+func Request(conn io.ReadWriter, alignment []byte) ([]byte, error) {
+	err := WriteFrame(conn, alignment)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := ReadFrame(conn)
+	if err != nil {
+		return nil, err
+	}
+	if len(response) == 0 {
+		return nil, errors.New("empty response from server")
+	}
+	if response[0] != StatusOK {
+		return nil, errors.New(string(response[1:]))
+	}
+
+	return response[1:], nil
+}
+
+// Server answers requests against one reference sequence, which has been read with
+// snps.ReadReference. If Metrics is not nil, requests are counted in it
+type Server struct {
+	RefSeq        []byte
+	Options       snps.Options
+	Format        string
+	WriterOptions snps.WriterOptions
+	Metrics       *Metrics
+}
+
+// Serve accepts connections on l and handles each one in its own goroutine. It returns
+// when l is closed
+func (s *Server) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+
+	for {
+		request, err := ReadFrame(conn)
+		if err != nil {
+			return
+		}
+
+		err = WriteFrame(conn, response(s.Process(request)))
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Process finds the SNPs in one alignment and returns the output
+func (s *Server) Process(alignment []byte) ([]byte, error) {
+	start := time.Now()
+
+	output, sequences, err := s.process(alignment)
+
+	if s.Metrics != nil {
+		s.Metrics.observe(time.Since(start), sequences, err)
+	}
+
+	return output, err
+}
+
+func (s *Server) process(alignment []byte) ([]byte, int, error) {
+	out := new(bytes.Buffer)
+
+	ow, err := snps.NewOutputWriter(s.Format, out, s.WriterOptions)
+	if err != nil {
+		return nil, 0, err
+	}
+	cow := &countingWriter{OutputWriter: ow}
+
+	err = snps.RunReference(bytes.NewReader(alignment), s.RefSeq, s.Options, cow)
+	if err != nil {
+		return nil, cow.records, err
+	}
+
+	return out.Bytes(), cow.records, nil
+}
+
+// countingWriter counts the records that pass through it to an OutputWriter
+type countingWriter struct {
+	snps.OutputWriter
+	records int
+}
+
+func (cw *countingWriter) WriteRecord(record snps.Record) error {
+	cw.records++
+	return cw.OutputWriter.WriteRecord(record)
+}
+
+// NeedsAggregate passes on whether the writer it counts for reads the aggregate
+func (cw *countingWriter) NeedsAggregate() bool {
+	ac, ok := cw.OutputWriter.(interface{ NeedsAggregate() bool })
+	return ok && ac.NeedsAggregate()
+}
+
+// response returns the body of a response frame
+func response(output []byte, err error) []byte {
+	if err != nil {
+		return append([]byte{StatusError}, err.Error()...)
+	}
+	return append([]byte{StatusOK}, output...)
+}
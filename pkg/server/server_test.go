@@ -0,0 +1,164 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/benjamincjackson/snps/pkg/snps"
+)
+
+func TestServer(t *testing.T) {
+	refSeq, err := snps.ReadReference(strings.NewReader(">ref\nATGATG\n"), false)
+	if err != nil {
+		t.Error(err)
+	}
+
+	s := &Server{RefSeq: refSeq, Format: "csv"}
+
+	client, conn := net.Pipe()
+	defer client.Close()
+	go s.handle(conn)
+
+	out, err := Request(client, []byte(">Query1\nATGATC\n"))
+	if err != nil {
+		t.Error(err)
+	}
+	if string(out) != "query,SNPs\nQuery1,G6C\n" {
+		t.Errorf("problem in TestServer(): %s", out)
+	}
+
+	// the connection can be reused
+	out, err = Request(client, []byte(">Query2\nATTTTW\n"))
+	if err != nil {
+		t.Error(err)
+	}
+	if string(out) != "query,SNPs\nQuery2,G3T|A4T|G6W\n" {
+		t.Errorf("problem in TestServer(): %s", out)
+	}
+
+	_, err = Request(client, []byte(">Query3\nATGATGATG\n"))
+	if err == nil {
+		t.Errorf("problem in TestServer(): expected an error for a sequence longer than the reference")
+	}
+}
+
+func TestFrames(t *testing.T) {
+	buf := new(bytes.Buffer)
+
+	err := WriteFrame(buf, []byte("hello"))
+	if err != nil {
+		t.Error(err)
+	}
+	if !bytes.Equal(buf.Bytes(), []byte{0, 0, 0, 5, 'h', 'e', 'l', 'l', 'o'}) {
+		t.Errorf("problem in TestFrames(): %v", buf.Bytes())
+	}
+
+	frame, err := ReadFrame(buf)
+	if err != nil || string(frame) != "hello" {
+		t.Errorf("problem in TestFrames(): %s %v", frame, err)
+	}
+}
+
+func TestServeNATS(t *testing.T) {
+	refSeq, err := snps.ReadReference(strings.NewReader(">ref\nATGATG\n"), false)
+	if err != nil {
+		t.Error(err)
+	}
+
+	s := &Server{RefSeq: refSeq, Format: "csv"}
+
+	natsServer, conn := net.Pipe()
+	defer natsServer.Close()
+
+	cErr := make(chan error, 1)
+	go func() {
+		cErr <- s.ServeNATS(conn, NATSOptions{Subject: "in", Queue: "workers", OutSubject: "out", ErrorSubject: "errors"})
+	}()
+
+	r := bufio.NewReader(natsServer)
+	expect := func(want string) {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(line, want) {
+			t.Fatalf("problem in TestServeNATS(): expected %q, got %q", want, line)
+		}
+	}
+
+	natsServer.Write([]byte("INFO {\"max_payload\":1048576}\r\n"))
+	expect("CONNECT {")
+	expect("PING")
+	natsServer.Write([]byte("PONG\r\n"))
+	expect("SUB in workers 1")
+
+	natsServer.Write([]byte("MSG in 1 15\r\n>Query1\nATGATC\n\r\n"))
+	expect("PUB out 22")
+	expect("query,SNPs")
+	expect("Query1,G6C")
+	expect("\r\n")
+
+	natsServer.Write([]byte("MSG in 1 _INBOX.1 18\r\n>Query2\nATGATGATG\n\r\n"))
+	expect("PUB _INBOX.1 ")
+	expect("\x01sequence Query2: length differs from the reference's: 9 bases, not 6\r\n")
+	expect("PUB errors ")
+	expect("sequence Query2: length differs from the reference's: 9 bases, not 6\r\n")
+
+	natsServer.Close()
+	if err := <-cErr; err == nil {
+		t.Errorf("problem in TestServeNATS(): expected an error when the connection closed")
+	}
+
+	// message sizes that are negative or larger than the server's max_payload are errors,
+	// not allocations
+	for _, size := range []string{"-5", "1048577"} {
+		natsServer, conn := net.Pipe()
+		go func() {
+			cErr <- s.ServeNATS(conn, NATSOptions{Subject: "in"})
+		}()
+		r = bufio.NewReader(natsServer)
+		natsServer.Write([]byte("INFO {\"max_payload\":1048576}\r\n"))
+		expect("CONNECT {")
+		expect("PING")
+		natsServer.Write([]byte("PONG\r\n"))
+		expect("SUB in 1")
+		natsServer.Write([]byte("MSG in 1 " + size + "\r\n"))
+		if err := <-cErr; err == nil || !strings.Contains(err.Error(), "bad message size") {
+			t.Errorf("problem in TestServeNATS(): a message of %s bytes gave %v", size, err)
+		}
+		natsServer.Close()
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	refSeq, err := snps.ReadReference(strings.NewReader(">ref\nATGATG\n"), false)
+	if err != nil {
+		t.Error(err)
+	}
+
+	s := &Server{RefSeq: refSeq, Format: "csv", Metrics: NewMetrics()}
+
+	s.Process([]byte(">Query1\nATGATC\n>Query2\nATGATG\n"))
+	s.Process([]byte(">Query3\nATGATGATG\n"))
+
+	rec := httptest.NewRecorder()
+	s.Metrics.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	body := rec.Body.String()
+	for _, line := range []string{
+		"snps_requests_total 2\n",
+		"snps_request_errors_total 1\n",
+		"snps_sequences_processed_total 2\n",
+		"snps_request_duration_seconds_bucket{le=\"60\"} 2\n",
+		"snps_request_duration_seconds_bucket{le=\"+Inf\"} 2\n",
+		"snps_request_duration_seconds_count 2\n",
+	} {
+		if !strings.Contains(body, line) {
+			t.Errorf("problem in TestMetrics(): no %q in\n%s", line, body)
+		}
+	}
+}
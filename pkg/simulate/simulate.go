@@ -0,0 +1,124 @@
+// Package simulate makes synthetic alignments from a reference sequence, with known
+// changes, for testing and benchmarking
+package simulate
+
+import (
+	"math/rand"
+	"strconv"
+
+	"github.com/benjamincjackson/snps/pkg/snps"
+)
+
+// Options say how many changes to make in each record. Each record has Substitutions
+// substitutions at sites where the reference is A, C, G or T, then Deletions runs of up to
+// MaxDeletionLength gaps, then NRuns runs of NRunLength Ns. Later changes can overwrite
+// earlier ones. Insertions can't be represented in an alignment to the reference, so
+// there aren't any
+type Options struct {
+	Records           int
+	Substitutions     int
+	Deletions         int
+	MaxDeletionLength int
+	NRuns             int
+	NRunLength        int
+	Seed              int64
+}
+
+// Record is one synthetic sequence, and the truth about it: the SNPs that should be
+// found in it, and the (1-based, inclusive) ranges of its deletions and runs of Ns
+type Record struct {
+	ID        string
+	Seq       []byte
+	SNPs      []snps.SNP
+	Deletions [][2]int
+	NRuns     [][2]int
+}
+
+// Simulator makes mutated copies of a reference sequence
+type Simulator struct {
+	ref   []byte
+	sites []int // the positions where the reference is A, C, G or T
+	opts  Options
+	rng   *rand.Rand
+	n     int
+}
+
+// NewSimulator returns a Simulator for ref, which is a sequence of upper case nucleotides
+func NewSimulator(ref []byte, opts Options) *Simulator {
+	sites := make([]int, 0, len(ref))
+	for i, nuc := range ref {
+		if isACGT(nuc) {
+			sites = append(sites, i)
+		}
+	}
+	return &Simulator{ref: ref, sites: sites, opts: opts, rng: rand.New(rand.NewSource(opts.Seed))}
+}
+
+func isACGT(nuc byte) bool {
+	return nuc == 'A' || nuc == 'C' || nuc == 'G' || nuc == 'T'
+}
+
+// Next returns the next record, or false once opts.Records records have been made
+func (s *Simulator) Next() (Record, bool) {
+	if s.n >= s.opts.Records {
+		return Record{}, false
+	}
+	s.n++
+
+	seq := make([]byte, len(s.ref))
+	copy(seq, s.ref)
+
+	record := Record{ID: "sim" + strconv.Itoa(s.n), Seq: seq}
+
+	substitutions := s.opts.Substitutions
+	if substitutions > len(s.sites) {
+		substitutions = len(s.sites)
+	}
+	for _, j := range s.rng.Perm(len(s.sites))[:substitutions] {
+		i := s.sites[j]
+		alts := make([]byte, 0, 3)
+		for _, nuc := range []byte("ACGT") {
+			if nuc != s.ref[i] {
+				alts = append(alts, nuc)
+			}
+		}
+		seq[i] = alts[s.rng.Intn(3)]
+	}
+
+	record.Deletions = s.runs(seq, s.opts.Deletions, s.opts.MaxDeletionLength, true, '-')
+	record.NRuns = s.runs(seq, s.opts.NRuns, s.opts.NRunLength, false, 'N')
+
+	record.SNPs = make([]snps.SNP, 0)
+	for i, nuc := range seq {
+		if isACGT(nuc) && isACGT(s.ref[i]) && nuc != s.ref[i] {
+			record.SNPs = append(record.SNPs, snps.SNP{Position: i + 1, Ref: string(s.ref[i]), Alt: string(nuc)})
+		}
+	}
+
+	return record, true
+}
+
+// runs writes n runs of c into seq, each of length maxLength or, if random is true, a
+// random length up to maxLength, and returns their ranges
+func (s *Simulator) runs(seq []byte, n int, maxLength int, random bool, c byte) [][2]int {
+	ranges := make([][2]int, 0, n)
+	if len(seq) == 0 || maxLength < 1 {
+		return ranges
+	}
+	for k := 0; k < n; k++ {
+		length := maxLength
+		if random {
+			length = 1 + s.rng.Intn(maxLength)
+		}
+		start := s.rng.Intn(len(seq))
+		end := start + length
+		if end > len(seq) {
+			end = len(seq)
+		}
+		for i := start; i < end; i++ {
+			seq[i] = c
+		}
+		ranges = append(ranges, [2]int{start + 1, end})
+	}
+	return ranges
+}
@@ -0,0 +1,66 @@
+package simulate
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/benjamincjackson/snps/pkg/snps"
+)
+
+func TestSimulate(t *testing.T) {
+	ref := []byte(strings.Repeat("ATGCCGTTAG", 100))
+
+	opts := Options{Records: 20, Substitutions: 10, Deletions: 2, MaxDeletionLength: 5, NRuns: 1, NRunLength: 30, Seed: 7}
+
+	// every record should be found to have exactly its true SNPs
+	alignment := new(bytes.Buffer)
+	truth := new(bytes.Buffer)
+	truth.WriteString("query,SNPs\n")
+
+	s := NewSimulator(ref, opts)
+	n := 0
+	for {
+		record, ok := s.Next()
+		if !ok {
+			break
+		}
+		n++
+		if len(record.Seq) != len(ref) || len(record.Deletions) != 2 || len(record.NRuns) != 1 {
+			t.Errorf("problem in TestSimulate(): bad record %s", record.ID)
+		}
+		alignment.WriteString(">" + record.ID + "\n" + string(record.Seq) + "\n")
+		truth.WriteString(record.ID + ",")
+		for i, snp := range record.SNPs {
+			if i > 0 {
+				truth.WriteString("|")
+			}
+			truth.WriteString(snp.String())
+		}
+		truth.WriteString("\n")
+	}
+	if n != 20 {
+		t.Errorf("problem in TestSimulate(): expected 20 records, got %d", n)
+	}
+
+	out := new(bytes.Buffer)
+	ow, err := snps.NewOutputWriter("csv", out, snps.WriterOptions{})
+	if err != nil {
+		t.Error(err)
+	}
+	err = snps.Run(alignment, bytes.NewReader(append([]byte(">ref\n"), ref...)), snps.Options{}, ow)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if out.String() != truth.String() {
+		t.Errorf("problem in TestSimulate(): found SNPs differ from the truth")
+	}
+
+	// the same seed gives the same records
+	a, _ := NewSimulator(ref, opts).Next()
+	b, _ := NewSimulator(ref, opts).Next()
+	if !bytes.Equal(a.Seq, b.Seq) {
+		t.Errorf("problem in TestSimulate(): same seed, different records")
+	}
+}
@@ -0,0 +1,179 @@
+package snps
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Amplicon is one amplicon of a tiled amplicon scheme. Start and End are the (1-based,
+// inclusive) first and last positions that it covers
+type Amplicon struct {
+	Name  string
+	Start int
+	End   int
+}
+
+// Amplicons are the amplicons of a scheme, which queries are checked for dropouts: when
+// an amplicon fails, its region is N or gaps in the consensus, and the SNPs that are
+// expected in it look absent. An amplicon has dropped out if at least MinMissing of its
+// positions are missing data
+type Amplicons struct {
+	Amplicons  []Amplicon
+	MinMissing float64
+}
+
+// bedInterval is one line of a BED file, with its 0-based, half-open start and end
+type bedInterval struct {
+	chrom string
+	start int
+	end   int
+	name  string
+}
+
+// readBED reads the first four columns of a BED file. Blank lines, comments, and track
+// and browser lines are skipped. An interval without a name is named chrom:start-end,
+// with 1-based positions
+func readBED(r io.Reader) ([]bedInterval, error) {
+	intervals := make([]bedInterval, 0)
+	s := bufio.NewScanner(r)
+	for line := 1; s.Scan(); line++ {
+		text := strings.TrimSpace(s.Text())
+		if text == "" || strings.HasPrefix(text, "#") || strings.HasPrefix(text, "track") || strings.HasPrefix(text, "browser") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("%w: line %d has fewer than 3 columns", ErrBadBED, line)
+		}
+		start, err1 := strconv.Atoi(fields[1])
+		end, err2 := strconv.Atoi(fields[2])
+		if err1 != nil || err2 != nil || start < 0 || end < start {
+			return nil, fmt.Errorf("%w: line %d has a bad start or end", ErrBadBED, line)
+		}
+		interval := bedInterval{chrom: fields[0], start: start, end: end}
+		if len(fields) > 3 {
+			interval.name = fields[3]
+		} else {
+			interval.name = fields[0] + ":" + strconv.Itoa(start+1) + "-" + strconv.Itoa(end)
+		}
+		intervals = append(intervals, interval)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return intervals, nil
+}
+
+// primerSide splits a primer name of the form SARS-CoV-2_1_LEFT or SARS-CoV-2_1_LEFT_alt1
+// into the name of its amplicon (SARS-CoV-2_1) and LEFT or RIGHT, or returns "", "" if it
+// isn't one
+func primerSide(name string) (string, string) {
+	parts := strings.Split(name, "_")
+	for i := len(parts) - 1; i > 0; i-- {
+		if side := strings.ToUpper(parts[i]); side == "LEFT" || side == "RIGHT" {
+			return strings.Join(parts[:i], "_"), side
+		}
+	}
+	return "", ""
+}
+
+// ReadAmplicons reads an amplicon scheme in BED format. This can be either a primer BED,
+// with primers named like SARS-CoV-2_1_LEFT and SARS-CoV-2_1_RIGHT (and alternative
+// primers like SARS-CoV-2_1_LEFT_alt1), in which case each amplicon is the insert between
+// its innermost left and right primers, or a BED of the amplicons themselves
+func ReadAmplicons(r io.Reader, minMissing float64) (*Amplicons, error) {
+	if minMissing <= 0 || minMissing > 1 {
+		return nil, fmt.Errorf("the proportion of an amplicon that is missing for it to have dropped out must be greater than 0 and at most 1, but is %v", minMissing)
+	}
+	intervals, err := readBED(r)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &Amplicons{MinMissing: minMissing}
+	// the index in a.Amplicons of the insert between each pair of primers, whose start
+	// and end are 0 until its left and right primers are found
+	inserts := make(map[string]int)
+	for _, interval := range intervals {
+		name, side := primerSide(interval.name)
+		if side == "" {
+			a.Amplicons = append(a.Amplicons, Amplicon{Name: interval.name, Start: interval.start + 1, End: interval.end})
+			continue
+		}
+		i, ok := inserts[name]
+		if !ok {
+			i = len(a.Amplicons)
+			inserts[name] = i
+			a.Amplicons = append(a.Amplicons, Amplicon{Name: name})
+		}
+		insert := &a.Amplicons[i]
+		if side == "LEFT" && interval.end+1 > insert.Start {
+			insert.Start = interval.end + 1
+		}
+		if side == "RIGHT" && (insert.End == 0 || interval.start < insert.End) {
+			insert.End = interval.start
+		}
+	}
+	for _, amplicon := range a.Amplicons {
+		if _, ok := inserts[amplicon.Name]; ok && (amplicon.Start == 0 || amplicon.End == 0) {
+			return nil, fmt.Errorf("%w: amplicon %s hasn't got both a left and a right primer", ErrBadBED, amplicon.Name)
+		}
+	}
+	return a, nil
+}
+
+// Dropouts returns the names of the amplicons that have dropped out of seq, in the order
+// they were read. N, ? and gaps are missing data
+func (a *Amplicons) Dropouts(seq []byte) []string {
+	dropouts := make([]string, 0)
+	for _, amplicon := range a.Amplicons {
+		start, end := amplicon.Start-1, amplicon.End
+		if end > len(seq) {
+			end = len(seq)
+		}
+		if start >= end {
+			continue
+		}
+		missing := 0
+		for _, nuc := range seq[start:end] {
+			if nuc == 240 || nuc == 242 || nuc == 244 || nuc == 4 {
+				missing++
+			}
+		}
+		if float64(missing) >= a.MinMissing*float64(amplicon.End-amplicon.Start+1) {
+			dropouts = append(dropouts, amplicon.Name)
+		}
+	}
+	return dropouts
+}
+
+// Mask is a set of sites that are ignored when calling SNPs, by 0-based position
+type Mask []bool
+
+// ReadMask reads the regions to mask from a BED file, e.g. the primer-binding sites of
+// an ARTIC-style primer BED, where the reads carry the primers' sequences rather than the
+// sample's, which can hide real SNPs there or make up false ones
+func ReadMask(r io.Reader) (Mask, error) {
+	intervals, err := readBED(r)
+	if err != nil {
+		return nil, err
+	}
+	m := make(Mask, 0)
+	for _, interval := range intervals {
+		for len(m) < interval.end {
+			m = append(m, false)
+		}
+		for i := interval.start; i < interval.end; i++ {
+			m[i] = true
+		}
+	}
+	return m, nil
+}
+
+// masked returns whether the site at 0-based position i is masked
+func (m Mask) masked(i int) bool {
+	return i < len(m) && m[i]
+}
@@ -0,0 +1,86 @@
+package snps
+
+import (
+	"strings"
+
+	"github.com/benjamincjackson/snps/pkg/annotation"
+	"github.com/benjamincjackson/snps/pkg/encoding"
+)
+
+// Annotator annotates the SNPs of records that have already been found, e.g. read back
+// from csv output, with their amino acid consequences and codon positions, without the
+// alignment. Each query's codons are rebuilt from the reference and the changes in its
+// record (its SNPs, and its ambiguities, resolutions and missing sites if they were
+// recorded), so a codon with an ambiguity or missing data that wasn't recorded is
+// translated as if it had the reference's bases there
+type Annotator struct {
+	refSeq     []byte
+	regions    []annotation.CDS
+	EA         []byte
+	DA         []string
+	codonTable map[string]byte
+}
+
+// NewAnnotator returns an Annotator for regions of refSeq, which was read by ReadReference
+func NewAnnotator(refSeq []byte, regions []annotation.CDS) *Annotator {
+	return &Annotator{refSeq: refSeq, regions: regions, EA: encoding.MakeEncodingArray(), DA: encoding.MakeDecodingArray(), codonTable: annotation.MakeCodonTable()}
+}
+
+// annotate sets the annotation and codon position of each of record's SNPs
+func (a *Annotator) annotate(record Record) Record {
+	seq := make([]byte, len(a.refSeq))
+	copy(seq, a.refSeq)
+	for _, SNPs := range [][]SNP{record.SNPs, record.Ambiguities, record.Resolutions, record.Missing} {
+		for _, snp := range SNPs {
+			if snp.Position > len(seq) || len(snp.Alt) != 1 || a.EA[snp.Alt[0]] == 0 {
+				continue
+			}
+			seq[snp.Position-1] = a.EA[snp.Alt[0]]
+		}
+	}
+	SNPs := make([]SNP, len(record.SNPs))
+	for i, snp := range record.SNPs {
+		snp.Annotation, snp.CodonPosition = "", ""
+		if snp.Position <= len(seq) {
+			snp.Annotation = annotation.AnnotateSNP(snp.Position, a.refSeq, seq, a.regions, a.DA, a.codonTable)
+			snp.CodonPosition = annotation.CodonPosition(snp.Position, a.regions)
+		}
+		SNPs[i] = snp
+	}
+	record.SNPs = SNPs
+	return record
+}
+
+// effect returns the kind of change that annotation, e.g. S:D614G, describes in each
+// coding region it is in, joined by ";": synonymous, missense, nonsense (a change to a
+// stop codon), stop_lost, or unknown if either codon couldn't be translated. A SNP
+// outside coding regions is non-coding
+func effect(annotation string) string {
+	if annotation == "" {
+		return "non-coding"
+	}
+	changes := strings.Split(annotation, ";")
+	effects := make([]string, len(changes))
+	for i, change := range changes {
+		// the change is the region's name, then e.g. D614G
+		change = change[strings.LastIndex(change, ":")+1:]
+		if len(change) < 3 {
+			effects[i] = "unknown"
+			continue
+		}
+		ref, alt := change[0], change[len(change)-1]
+		switch {
+		case ref == 'X' || alt == 'X':
+			effects[i] = "unknown"
+		case ref == alt:
+			effects[i] = "synonymous"
+		case alt == '*':
+			effects[i] = "nonsense"
+		case ref == '*':
+			effects[i] = "stop_lost"
+		default:
+			effects[i] = "missense"
+		}
+	}
+	return strings.Join(effects, ";")
+}
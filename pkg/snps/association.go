@@ -0,0 +1,112 @@
+package snps
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/benjamincjackson/snps/pkg/stats"
+)
+
+// associationWriter tests each SNP for an association with a two-way grouping of the
+// queries, with Fisher's exact test. For each SNP it writes the number and proportion of
+// queries in each group that have it, the odds ratio of having it in the first group
+// compared to the second (groups are in alphabetical order), the p-value, and the p-value
+// adjusted for the false discovery rate across all SNPs by the Benjamini-Hochberg method.
+// Queries without a group are left out
+type associationWriter struct {
+	w      *bufio.Writer
+	groups map[string]*aggregator
+}
+
+func newAssociationWriter(w io.Writer, opts WriterOptions) OutputWriter {
+	return &associationWriter{w: bufio.NewWriter(w), groups: make(map[string]*aggregator)}
+}
+
+// the header depends on the groups, so it is written with the aggregate
+func (aw *associationWriter) WriteHeader() error {
+	return nil
+}
+
+func (aw *associationWriter) WriteRecord(record Record) error {
+	if record.Group == "" {
+		return nil
+	}
+	agg, ok := aw.groups[record.Group]
+	if !ok {
+		agg = newAggregator()
+		aw.groups[record.Group] = agg
+	}
+	agg.add(record)
+	return nil
+}
+
+func (aw *associationWriter) WriteAggregate(Aggregate) error {
+	names := make([]string, 0, len(aw.groups))
+	for name := range aw.groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if len(names) != 2 {
+		return errors.New("association tests need exactly two groups, found " + strconv.Itoa(len(names)) + ": " + strings.Join(names, ", "))
+	}
+
+	a, b := aw.groups[names[0]], aw.groups[names[1]]
+
+	changes := make([]Change, 0)
+	for _, change := range a.counts {
+		changes = append(changes, Change{SNP: change.SNP})
+	}
+	for key, change := range b.counts {
+		if _, ok := a.counts[key]; !ok {
+			changes = append(changes, Change{SNP: change.SNP})
+		}
+	}
+	sortChanges(changes)
+
+	count := func(agg *aggregator, snp SNP) int {
+		if change, ok := agg.counts[snp.String()]; ok {
+			return change.Count
+		}
+		return 0
+	}
+
+	ps := make([]float64, len(changes))
+	ors := make([]float64, len(changes))
+	for i, change := range changes {
+		inA, inB := count(a, change.SNP), count(b, change.SNP)
+		ps[i] = stats.FisherExact(inA, a.queries-inA, inB, b.queries-inB)
+		ors[i] = stats.OddsRatio(inA, a.queries-inA, inB, b.queries-inB)
+	}
+	adjusted := stats.BenjaminiHochberg(ps)
+
+	_, err := aw.w.WriteString("change," +
+		csvField(names[0]+"_count") + "," + csvField(names[0]+"_proportion") + "," +
+		csvField(names[1]+"_count") + "," + csvField(names[1]+"_proportion") + "," +
+		"odds_ratio,p_value,adjusted_p_value\n")
+	if err != nil {
+		return err
+	}
+
+	for i, change := range changes {
+		inA, inB := count(a, change.SNP), count(b, change.SNP)
+		_, err = aw.w.WriteString(change.SNP.String() + "," +
+			strconv.Itoa(inA) + "," + strconv.FormatFloat(float64(inA)/float64(a.queries), 'f', 9, 64) + "," +
+			strconv.Itoa(inB) + "," + strconv.FormatFloat(float64(inB)/float64(b.queries), 'f', 9, 64) + "," +
+			strconv.FormatFloat(ors[i], 'g', 6, 64) + "," +
+			strconv.FormatFloat(ps[i], 'g', 6, 64) + "," +
+			strconv.FormatFloat(adjusted[i], 'g', 6, 64) + "\n")
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (aw *associationWriter) Close() error {
+	return aw.w.Flush()
+}
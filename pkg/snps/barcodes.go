@@ -0,0 +1,116 @@
+package snps
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Barcodes are the defining SNPs of a set of lineages, used to assign each query to the
+// lineage it matches best
+type Barcodes struct {
+	lineages  []string
+	positions []int          // the position of each barcode SNP
+	index     map[string]int // barcode SNPs (e.g. C241T) to their index in positions
+	sets      [][]int        // the indices of each lineage's SNPs
+}
+
+// ReadBarcodes reads barcodes in the wide CSV format used by Freyja: a header of SNPs
+// (e.g. C241T) after an unnamed first column, then one row per lineage with its name
+// followed by 1 for each SNP that it has and 0 for each that it hasn't
+func ReadBarcodes(r io.Reader) (*Barcodes, error) {
+	cr := csv.NewReader(r)
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	b := &Barcodes{index: make(map[string]int)}
+
+	for _, mutation := range header[1:] {
+		if len(mutation) < 3 {
+			return nil, errors.New("badly formatted SNP in barcodes: " + mutation)
+		}
+		pos, err := strconv.Atoi(mutation[1 : len(mutation)-1])
+		if err != nil || pos < 1 {
+			return nil, errors.New("badly formatted SNP in barcodes: " + mutation)
+		}
+		b.index[mutation] = len(b.positions)
+		b.positions = append(b.positions, pos)
+	}
+
+	for {
+		row, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		set := make([]int, 0)
+		for i, value := range row[1:] {
+			has, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil {
+				return nil, errors.New("badly formatted value in barcodes for lineage " + row[0] + ": " + value)
+			}
+			if has > 0 {
+				set = append(set, i)
+			}
+		}
+
+		b.lineages = append(b.lineages, row[0])
+		b.sets = append(b.sets, set)
+	}
+
+	if len(b.lineages) == 0 {
+		return nil, errors.New("no lineages in barcodes")
+	}
+
+	return b, nil
+}
+
+// Assign returns the lineage whose barcode best matches a query, given its encoded
+// sequence and its SNPs, and the Jaccard similarity between the two. Barcode SNPs at
+// positions where the query has missing data are left out of the comparison, so that
+// incomplete sequences aren't penalised. Ties go to the lineage that comes first
+func (b *Barcodes) Assign(seq []byte, snps []SNP) (string, float64) {
+
+	query := make(map[int]bool)
+	for _, snp := range snps {
+		if i, ok := b.index[snp.String()]; ok {
+			query[i] = true
+		}
+	}
+
+	best := -1
+	var bestScore float64
+
+	for l, set := range b.sets {
+		intersection := 0
+		union := len(query)
+		for _, i := range set {
+			pos := b.positions[i]
+			if query[i] {
+				intersection++
+			} else if pos <= len(seq) && seq[pos-1]&8 == 8 {
+				union++
+			}
+		}
+
+		score := 1.0
+		if union > 0 {
+			score = float64(intersection) / float64(union)
+		}
+
+		if best == -1 || score > bestScore {
+			best = l
+			bestScore = score
+		}
+	}
+
+	return b.lineages[best], bestScore
+}
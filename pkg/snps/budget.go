@@ -0,0 +1,62 @@
+package snps
+
+import "sync"
+
+// budget limits the total size of the sequences in flight between the reader and the
+// writer. Sequences are charged for when they are read, and refunded when their SNPs
+// have been written, so a full budget holds the reader up until the writer catches up.
+// A sequence bigger than the whole budget is charged the whole budget, so that it can
+// still go through on its own
+type budget struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	limit   int64
+	used    int64
+	stopped bool
+}
+
+func newBudget(limit int64) *budget {
+	b := &budget{limit: limit}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+func (b *budget) cost(size int64) int64 {
+	if size > b.limit {
+		return b.limit
+	}
+	return size
+}
+
+// acquire waits until there is room in the budget for size bytes, then takes them. It
+// returns false, without waiting any longer, if the budget has been stopped
+func (b *budget) acquire(size int64) bool {
+	size = b.cost(size)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for b.used+size > b.limit && !b.stopped {
+		b.cond.Wait()
+	}
+	if b.stopped {
+		return false
+	}
+	b.used += size
+	return true
+}
+
+// stop wakes anything waiting in acquire, for good
+func (b *budget) stop() {
+	b.mu.Lock()
+	b.stopped = true
+	b.mu.Unlock()
+	b.cond.Broadcast()
+}
+
+// release gives back size bytes
+func (b *budget) release(size int64) {
+	size = b.cost(size)
+	b.mu.Lock()
+	b.used -= size
+	b.mu.Unlock()
+	b.cond.Broadcast()
+}
@@ -0,0 +1,75 @@
+package snps
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Catalogue maps changes (e.g. A23403G) to labels for them, e.g. drug resistance or
+// antigenic site annotations, which are added to the output wherever a listed change is
+// found
+type Catalogue map[string]string
+
+// ReadCatalogue reads a catalogue in CSV format, with a header. The changes are taken
+// from its change column and the labels from its label column, or if it hasn't got them,
+// from its first two columns. A change that is listed more than once gets all its
+// labels, separated by "; "
+func ReadCatalogue(r io.Reader) (Catalogue, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("%w: catalogue is empty", ErrBadCSV)
+	}
+	if err != nil {
+		return nil, err
+	}
+	changeColumn, labelColumn := 0, 1
+	for i, name := range header {
+		switch strings.TrimSpace(name) {
+		case "change":
+			changeColumn = i
+		case "label":
+			labelColumn = i
+		}
+	}
+
+	c := make(Catalogue)
+	for line := 2; ; line++ {
+		row, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if changeColumn >= len(row) || labelColumn >= len(row) {
+			return nil, fmt.Errorf("%w: catalogue line %d is too short", ErrBadCSV, line)
+		}
+		snp, err := ParseSNP(strings.TrimSpace(row[changeColumn]))
+		if err != nil {
+			return nil, fmt.Errorf("%w: catalogue line %d: %v", ErrBadCSV, line, err)
+		}
+		change, label := snp.String(), strings.TrimSpace(row[labelColumn])
+		if c[change] != "" {
+			label = c[change] + "; " + label
+		}
+		c[change] = label
+	}
+	return c, nil
+}
+
+// labels returns the SNPs that are in the catalogue with their labels, e.g.
+// A23403G (D614G)|E484K (antigenic), or "" if none of them are
+func (c Catalogue) labels(SNPs []SNP) string {
+	labels := make([]string, 0)
+	for _, snp := range SNPs {
+		if label, ok := c[snp.String()]; ok {
+			labels = append(labels, snp.String()+" ("+label+")")
+		}
+	}
+	return strings.Join(labels, "|")
+}
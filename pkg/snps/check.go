@@ -0,0 +1,115 @@
+package snps
+
+import (
+	"io"
+	"strconv"
+
+	"github.com/benjamincjackson/snps/pkg/fastaio"
+)
+
+// CheckReport is the result of checking a reference and an alignment before a run. OK
+// is true if no problems were found
+type CheckReport struct {
+	OK              bool      `json:"ok"`
+	ReferenceLength int       `json:"reference_length"`
+	Records         int       `json:"records"`
+	Problems        []Problem `json:"problems"`
+}
+
+// Problem is one thing wrong with the input. File is "reference" or "query", Record is
+// the ID of the record concerned, if there is one, and Kind is one of "format",
+// "records", "length", "character" and "duplicate_id"
+type Problem struct {
+	File    string `json:"file"`
+	Record  string `json:"record,omitempty"`
+	Kind    string `json:"kind"`
+	Message string `json:"message"`
+}
+
+// Check reads the reference in rR and the alignment in rQ and reports whether they are
+// fit for a run, without finding any SNPs: whether they are formatted as fasta, whether
+// the reference is one record, whether every query is as long as the reference and
+// made up of IUPAC codes, gaps and ?, and whether query IDs are unique. Only the first
+// invalid character in each record is reported. The alignment is read one record at a
+// time, so it can be of any size
+func Check(rQ io.Reader, rR io.Reader) CheckReport {
+	report := CheckReport{Problems: make([]Problem, 0)}
+	problem := func(file, record, kind, message string) {
+		report.Problems = append(report.Problems, Problem{File: file, Record: record, Kind: kind, Message: message})
+	}
+
+	refSeq := make([]byte, 0)
+	refRecords := 0
+	err := checkRecords(rR, func(FR fastaio.EncodedFastaRecord) {
+		refSeq = FR.Seq
+		refRecords++
+		if i := invalidPosition(FR.Seq); i > 0 {
+			problem("reference", FR.ID, "character", "invalid character at position "+strconv.Itoa(i))
+		}
+	})
+	if err != nil {
+		problem("reference", "", "format", err.Error())
+	} else if refRecords != 1 {
+		problem("reference", "", "records", "reference should have one record, but has "+strconv.Itoa(refRecords))
+	}
+	report.ReferenceLength = len(refSeq)
+
+	seen := make(map[string]bool)
+	err = checkRecords(rQ, func(FR fastaio.EncodedFastaRecord) {
+		report.Records++
+		if seen[FR.ID] {
+			problem("query", FR.ID, "duplicate_id", "ID "+FR.ID+" is used more than once")
+		}
+		seen[FR.ID] = true
+		if len(FR.Seq) != len(refSeq) {
+			problem("query", FR.ID, "length", "length is "+strconv.Itoa(len(FR.Seq))+", but the reference's is "+strconv.Itoa(len(refSeq)))
+		}
+		if i := invalidPosition(FR.Seq); i > 0 {
+			problem("query", FR.ID, "character", "invalid character at position "+strconv.Itoa(i))
+		}
+	})
+	if err != nil {
+		problem("query", "", "format", err.Error())
+	} else if report.Records == 0 {
+		problem("query", "", "records", "alignment has no records")
+	}
+
+	report.OK = len(report.Problems) == 0
+	return report
+}
+
+// checkRecords passes each record in r to f, and returns the first error reading it. An
+// empty file has no records
+func checkRecords(r io.Reader, f func(fastaio.EncodedFastaRecord)) error {
+	cErr := make(chan error)
+	cFR := make(chan fastaio.EncodedFastaRecord)
+	cDone := make(chan bool)
+
+	go fastaio.ReadEncodeAlignment(r, true, cFR, cErr, cDone)
+
+	for {
+		select {
+		case err := <-cErr:
+			return err
+		case FR := <-cFR:
+			// the reader gives an empty file one record with no ID
+			if FR.ID == "" && len(FR.Seq) == 0 {
+				continue
+			}
+			f(FR)
+		case <-cDone:
+			return nil
+		}
+	}
+}
+
+// invalidPosition returns the (1-based) position of the first character in seq that
+// isn't an IUPAC code, a gap or ?, or 0 if there isn't one
+func invalidPosition(seq []byte) int {
+	for i, nuc := range seq {
+		if nuc == 0 {
+			return i + 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,86 @@
+package snps
+
+import "bytes"
+
+// rotationK is the length of the k-mers of a query that are looked for in a circular
+// reference to find where the query starts, and rotationTries the most that are tried
+const (
+	rotationK     = 21
+	rotationTries = 100
+)
+
+// rotate returns a copy of seq rotated into the coordinates of a circular reference of
+// refLength bases, given that its first base is at the reference's offset'th base
+// (0-based). A query shorter than the reference is N where it has no bases
+func rotate(seq []byte, refLength int, offset int) []byte {
+	rotated := make([]byte, refLength)
+	for i := range rotated {
+		rotated[i] = 240
+	}
+	for i := 0; i < len(seq) && i < refLength; i++ {
+		rotated[(i+offset)%refLength] = seq[i]
+	}
+	return rotated
+}
+
+// findRotation returns the offset that seq has to be rotated by to be in the coordinates
+// of the circular refSeq: where in the reference a k-mer of seq with only A, C, G and T
+// is found, allowing for it spanning the origin. K-mers are tried from the start of seq
+// until one is found in the reference exactly once, so that a SNP near the start doesn't
+// stop the offset from being found. It returns false if none is
+func findRotation(refSeq []byte, seq []byte) (int, bool) {
+	n := len(refSeq)
+	if n < rotationK {
+		return 0, false
+	}
+	circle := make([]byte, 0, n+rotationK-1)
+	circle = append(circle, refSeq...)
+	circle = append(circle, refSeq[:rotationK-1]...)
+
+	run, tries := 0, 0
+	for i, nuc := range seq {
+		if nuc&8 != 8 {
+			run = 0
+			continue
+		}
+		run++
+		if run < rotationK {
+			continue
+		}
+		start := i - rotationK + 1
+		kmer := seq[start : i+1]
+		at := bytes.Index(circle, kmer)
+		if at >= 0 && bytes.Index(circle[at+1:], kmer) < 0 {
+			return ((at-start)%n + n) % n, true
+		}
+		tries++
+		if tries == rotationTries {
+			break
+		}
+	}
+	return 0, false
+}
+
+// rotateCircular rotates seq, query ID's sequence, into the coordinates of the circular
+// refSeq, by opts.RotationOffset or, if it is 0, by the offset found for it. If none is
+// found it is left as it is, with a warning
+func (opts Options) rotateCircular(refSeq []byte, seq []byte, ID string) []byte {
+	if len(refSeq) == 0 {
+		return seq
+	}
+	offset := opts.RotationOffset
+	if offset == 0 {
+		var ok bool
+		offset, ok = findRotation(refSeq, seq)
+		if !ok {
+			if opts.Warn != nil {
+				opts.Warn("couldn't find where " + ID + " starts in the circular reference, so it wasn't rotated")
+			}
+			return seq
+		}
+		if offset == 0 {
+			return seq
+		}
+	}
+	return rotate(seq, len(refSeq), offset%len(refSeq))
+}
@@ -0,0 +1,110 @@
+package snps
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/benjamincjackson/snps/pkg/stats"
+)
+
+// clockWriter estimates a molecular clock by regressing each query's distance from the
+// reference (its root-to-tip distance, if the reference is the root) on its collection
+// date. Queries whose residual from the fit is more than clockFilter interquartile
+// ranges from the median residual are flagged as outliers, as in the usual clock filter,
+// and the line is fitted again without them. It writes the number of queries fitted,
+// the outliers, the substitution rate (per year), the date that the line reaches zero
+// SNPs (an estimate of the root's date), and r squared, one per line. Queries without a
+// date are left out, and if there is no line to fit, its values are left empty
+type clockWriter struct {
+	w           *bufio.Writer
+	clockFilter float64
+	queries     []string
+	days        []float64
+	distances   []float64
+}
+
+func newClockWriter(w io.Writer, opts WriterOptions) OutputWriter {
+	clockFilter := opts.ClockFilter
+	if clockFilter <= 0 {
+		clockFilter = 3
+	}
+	return &clockWriter{w: bufio.NewWriter(w), clockFilter: clockFilter}
+}
+
+func (cw *clockWriter) WriteHeader() error {
+	_, err := cw.w.WriteString("statistic,value\n")
+	return err
+}
+
+func (cw *clockWriter) WriteRecord(record Record) error {
+	if record.Date.IsZero() {
+		return nil
+	}
+	cw.queries = append(cw.queries, record.Query)
+	cw.days = append(cw.days, float64(record.Date.Unix())/86400)
+	cw.distances = append(cw.distances, float64(record.Distance))
+	return nil
+}
+
+func (cw *clockWriter) WriteAggregate(Aggregate) error {
+	outliers := make([]string, 0)
+	days, distances := cw.days, cw.distances
+
+	slope, intercept, _, err := stats.LinearRegression(days, distances)
+	if err == nil {
+		residuals := make([]float64, len(days))
+		for i := range days {
+			residuals[i] = distances[i] - (intercept + slope*days[i])
+		}
+		sorted := append([]float64(nil), residuals...)
+		sort.Float64s(sorted)
+		median := stats.Quantile(sorted, 0.5)
+		iqr := stats.Quantile(sorted, 0.75) - stats.Quantile(sorted, 0.25)
+
+		days, distances = make([]float64, 0, len(cw.days)), make([]float64, 0, len(cw.days))
+		for i, r := range residuals {
+			if math.Abs(r-median) > cw.clockFilter*iqr {
+				outliers = append(outliers, cw.queries[i])
+				continue
+			}
+			days = append(days, cw.days[i])
+			distances = append(distances, cw.distances[i])
+		}
+	}
+
+	lines := []string{
+		"queries," + strconv.Itoa(len(days)),
+		"outliers," + strconv.Itoa(len(outliers)),
+	}
+	slope, intercept, r2, err := stats.LinearRegression(days, distances)
+	if err != nil {
+		lines = append(lines, "rate,", "root_date,", "r_squared,")
+	} else {
+		root := ""
+		if slope != 0 {
+			root = time.Unix(int64(-intercept/slope*86400), 0).UTC().Format("2006-01-02")
+		}
+		lines = append(lines,
+			"rate,"+strconv.FormatFloat(slope*365.25, 'f', 6, 64),
+			"root_date,"+root,
+			"r_squared,"+strconv.FormatFloat(r2, 'f', 6, 64),
+		)
+	}
+	lines = append(lines, "outlier_queries,"+csvField(strings.Join(outliers, "|")))
+
+	for _, line := range lines {
+		if _, err := cw.w.WriteString(line + "\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (cw *clockWriter) Close() error {
+	return cw.w.Flush()
+}
@@ -0,0 +1,54 @@
+package snps
+
+import "strconv"
+
+// ClusterOptions define an unusually dense cluster of SNPs: at least Count SNPs within
+// Window bases of each other. Queries with one are worth a look as possible recombinants
+// or contaminated samples. Changes to gaps aren't counted, since one deletion would
+// otherwise look like a cluster
+type ClusterOptions struct {
+	Count  int
+	Window int
+}
+
+// enabled returns whether clusters are to be looked for at all
+func (o ClusterOptions) enabled() bool {
+	return o.Count > 0 && o.Window > 0
+}
+
+// find returns the (1-based, inclusive) ranges that clusters of SNPs span, with
+// overlapping clusters merged. SNPs are sorted by position
+func (o ClusterOptions) find(SNPs []SNP) [][2]int {
+	positions := make([]int, 0, len(SNPs))
+	for _, snp := range SNPs {
+		if snp.Alt != "-" {
+			positions = append(positions, snp.Position)
+		}
+	}
+
+	clusters := make([][2]int, 0)
+	for i := 0; i+o.Count-1 < len(positions); i++ {
+		start, end := positions[i], positions[i+o.Count-1]
+		if end-start >= o.Window {
+			continue
+		}
+		if n := len(clusters); n > 0 && start <= clusters[n-1][1] {
+			clusters[n-1][1] = end
+			continue
+		}
+		clusters = append(clusters, [2]int{start, end})
+	}
+	return clusters
+}
+
+// formatClusters returns clusters in the form 100-180|2000-2050
+func formatClusters(clusters [][2]int) string {
+	s := ""
+	for i, c := range clusters {
+		if i > 0 {
+			s += "|"
+		}
+		s += strconv.Itoa(c[0]) + "-" + strconv.Itoa(c[1])
+	}
+	return s
+}
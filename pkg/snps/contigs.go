@@ -0,0 +1,104 @@
+package snps
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/benjamincjackson/snps/pkg/fastaio"
+)
+
+// Contigs are the records of a reference made up of more than one, e.g. the segments of
+// an influenza genome, or a bacterial chromosome and its plasmids. Each query is compared
+// with the contig it matches: the one that Map names for its ID, if there is one, or else
+// the one whose name is its ID or the longest that is in its ID between non-alphanumeric
+// characters, e.g. HA in A/Texas/50/2012|HA
+type Contigs struct {
+	Names []string
+	Map   map[string]string
+	seqs  map[string][]byte
+}
+
+// ReadContigs reads every record of a reference as a contig
+func ReadContigs(r io.Reader, hardGaps bool) (*Contigs, error) {
+	c := &Contigs{seqs: make(map[string][]byte)}
+	err := eachRecord(r, hardGaps, func(FR fastaio.EncodedFastaRecord) error {
+		if _, ok := c.seqs[FR.ID]; ok {
+			return fmt.Errorf("%w: contig %s is in it more than once", ErrBadReference, FR.ID)
+		}
+		c.Names = append(c.Names, FR.ID)
+		c.seqs[FR.ID] = FR.Seq
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(c.Names) == 0 {
+		return nil, fmt.Errorf("%w: it has no records", ErrBadReference)
+	}
+	return c, nil
+}
+
+// match returns the name and sequence of the contig that the query id matches
+func (c *Contigs) match(id string) (string, []byte, bool) {
+	if name, ok := c.Map[id]; ok {
+		seq, ok := c.seqs[name]
+		return name, seq, ok
+	}
+	if seq, ok := c.seqs[id]; ok {
+		return id, seq, true
+	}
+	best := ""
+	for _, name := range c.Names {
+		if len(name) > len(best) && containsField(id, name) {
+			best = name
+		}
+	}
+	return best, c.seqs[best], best != ""
+}
+
+// containsField returns whether name is in s with neither a letter nor a digit either
+// side of it
+func containsField(s string, name string) bool {
+	isAlphanumeric := func(b byte) bool {
+		return b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= '0' && b <= '9'
+	}
+	for i := 0; i+len(name) <= len(s); i++ {
+		if s[i:i+len(name)] != name {
+			continue
+		}
+		if (i == 0 || !isAlphanumeric(s[i-1])) && (i+len(name) == len(s) || !isAlphanumeric(s[i+len(name)])) {
+			return true
+		}
+	}
+	return false
+}
+
+// RunContigs is RunReference with a reference made up of contigs, each query being
+// compared with the one it matches. Records that match none are an error. opts.Regions
+// is ignored, since annotations are of a single sequence
+func RunContigs(rQ io.Reader, contigs *Contigs, opts Options, ow OutputWriter) error {
+	return RunContigsContext(context.Background(), rQ, contigs, opts, ow)
+}
+
+// RunContigsContext is RunContigs, but stops once ctx is done, as RunContext does
+func RunContigsContext(ctx context.Context, rQ io.Reader, contigs *Contigs, opts Options, ow OutputWriter) error {
+	resolved := &Contigs{Names: contigs.Names, Map: contigs.Map, seqs: make(map[string][]byte, len(contigs.seqs))}
+	for i, name := range contigs.Names {
+		seq, err := opts.resolveQuestionMarks(contigs.seqs[name], name, i+1)
+		if err != nil {
+			return fmt.Errorf("reference: %w", err)
+		}
+		resolved.seqs[name] = seq
+	}
+	opts.contigs = resolved
+	opts.Regions = nil
+	return run(ctx, rQ, nil, false, opts, ow)
+}
+
+// setContig sets the contig of each of SNPs
+func setContig(SNPs []SNP, contig string) {
+	for i := range SNPs {
+		SNPs[i].Contig = contig
+	}
+}
@@ -0,0 +1,328 @@
+package snps
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CSVReader reads records back from the csv output format, so that they can be written
+// in other formats (see Convert) without comparing the alignment again. Whichever of
+// the optional columns are there are read. If Filter is not nil, only the records it
+// keeps are read, with it applied. If Liftover is not nil, the records are lifted over
+// to its other reference. If Annotator is not nil, the SNPs of the records read are then
+// annotated with it, replacing any annotations they had
+type CSVReader struct {
+	Filter    *Filter
+	Liftover  *Liftover
+	Annotator *Annotator
+	r         *csv.Reader
+	columns   map[string]int
+	line      int
+	catalogue Catalogue // the labels read so far, if there is a labels column
+}
+
+// NewCSVReader reads the header of csv output from r. The long and JSON output formats
+// can't be read back, and are an error that says so
+func NewCSVReader(r io.Reader) (*CSVReader, error) {
+	br := bufio.NewReader(r)
+	if start, _ := br.Peek(1); len(start) == 1 && (start[0] == '[' || start[0] == '{') {
+		return nil, fmt.Errorf("%w: it looks like JSON output, which can't be converted (only the per-query csv output can)", ErrBadCSV)
+	}
+	cr := &CSVReader{r: csv.NewReader(br), columns: make(map[string]int), line: 1}
+	cr.r.ReuseRecord = true
+	header, err := cr.r.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("%w: it is empty", ErrBadCSV)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(header) == 1 && strings.HasPrefix(header[0], "query\t") {
+		return nil, fmt.Errorf("%w: it looks like long output, which can't be converted (only the per-query csv output can)", ErrBadCSV)
+	}
+	for i, name := range header {
+		cr.columns[name] = i
+	}
+	for _, name := range []string{"query", "SNPs"} {
+		if _, ok := cr.columns[name]; !ok {
+			return nil, fmt.Errorf("%w: no %s column", ErrBadCSV, name)
+		}
+	}
+	if _, ok := cr.columns["labels"]; ok {
+		cr.catalogue = make(Catalogue)
+	}
+	return cr, nil
+}
+
+// WriterOptions returns the options to write the records with, so that none of the
+// columns that were read are lost. The labels of catalogued changes are kept by passing
+// on a catalogue that is filled in as records are read. The columns that depend on the
+// reference's sequence, e.g. annotations and labels, are dropped if the records are
+// lifted over to another reference, unless they are annotated again
+func (cr *CSVReader) WriterOptions() WriterOptions {
+	has := func(name string) bool {
+		_, ok := cr.columns[name]
+		return ok && (cr.Liftover == nil || !referenceColumns[name])
+	}
+	catalogue := cr.catalogue
+	if cr.Liftover != nil {
+		catalogue = nil
+	}
+	return WriterOptions{
+		Annotated:      has("annotated_SNPs") || cr.Annotator != nil,
+		CodonPositions: has("codon_positions") || cr.Annotator != nil,
+		Effects:        has("effects") || cr.Annotator != nil,
+		Weights:        has("weighted_SNPs"),
+		Scores:         has("scored_SNPs"),
+		Contexts:       has("flagged_SNPs"),
+		Contigs:        has("contig"),
+		Description:    has("description"),
+		Source:         has("source"),
+		Dates:          has("date"),
+		Ambiguities:    has("compatible_ambiguities"),
+		Resolutions:    has("reference_resolutions"),
+		Clusters:       has("SNP_clusters"),
+		Parents:        has("parents"),
+		Dropouts:       has("amplicon_dropouts"),
+		Missing:        has("missing"),
+		Lineages:       has("lineage"),
+		Catalogue:      catalogue,
+	}
+}
+
+// referenceColumns are the columns of csv output that Liftover can't carry over to
+// another reference
+var referenceColumns = map[string]bool{
+	"annotated_SNPs":  true,
+	"codon_positions": true,
+	"effects":         true,
+	"weighted_SNPs":   true,
+	"scored_SNPs":     true,
+	"flagged_SNPs":    true,
+	"SNP_clusters":    true,
+	"parents":         true,
+	"labels":          true,
+}
+
+// Read returns the next record, or io.EOF after the last one
+func (cr *CSVReader) Read() (Record, error) {
+	for {
+		record, err := cr.read()
+		if err != nil {
+			return record, err
+		}
+		if cr.Filter != nil {
+			var ok bool
+			if record, ok = cr.Filter.apply(record); !ok {
+				continue
+			}
+		}
+		if cr.Liftover != nil {
+			record = cr.Liftover.lift(record)
+		}
+		if cr.Annotator != nil {
+			record = cr.Annotator.annotate(record)
+		}
+		return record, nil
+	}
+}
+
+func (cr *CSVReader) read() (Record, error) {
+	row, err := cr.r.Read()
+	if err != nil {
+		return Record{}, err
+	}
+	cr.line++
+
+	field := func(name string) string {
+		if i, ok := cr.columns[name]; ok && i < len(row) {
+			return row[i]
+		}
+		return ""
+	}
+	fail := func(err error) (Record, error) {
+		return Record{}, fmt.Errorf("%w: line %d: %v", ErrBadCSV, cr.line, err)
+	}
+
+	record := Record{Query: field("query"), Contig: field("contig"), Description: field("description"), Source: field("source"), Lineage: field("lineage")}
+
+	if date := field("date"); date != "" {
+		record.Date, err = time.Parse("2006-01-02", date)
+		if err != nil {
+			return fail(err)
+		}
+	}
+	if score := field("lineage_score"); score != "" {
+		record.LineageScore, err = strconv.ParseFloat(score, 64)
+		if err != nil {
+			return fail(err)
+		}
+	}
+
+	record.SNPs, err = parseSNPs(field("SNPs"))
+	if err != nil {
+		return fail(err)
+	}
+	record.Distance = len(record.SNPs)
+	for _, column := range []string{"annotated_SNPs", "codon_positions", "weighted_SNPs", "scored_SNPs", "flagged_SNPs"} {
+		if _, ok := cr.columns[column]; !ok {
+			continue
+		}
+		notes := splitList(field(column))
+		if len(notes) != len(record.SNPs) {
+			return fail(errors.New(column + " doesn't match SNPs"))
+		}
+		for i, note := range notes {
+			// e.g. A23403G (S:D614G)
+			if j := strings.Index(note, " ("); j >= 0 && strings.HasSuffix(note, ")") {
+				note = note[j+2 : len(note)-1]
+			} else {
+				note = ""
+			}
+			switch column {
+			case "annotated_SNPs":
+				record.SNPs[i].Annotation = note
+			case "codon_positions":
+				record.SNPs[i].CodonPosition = note
+			case "weighted_SNPs":
+				record.SNPs[i].Weight, err = strconv.ParseFloat(note, 64)
+				if err != nil {
+					return fail(err)
+				}
+			case "flagged_SNPs":
+				record.SNPs[i].Context = note
+			default:
+				record.SNPs[i].Score = math.NaN()
+				if note != "NA" {
+					record.SNPs[i].Score, err = strconv.ParseFloat(note, 64)
+					if err != nil {
+						return fail(err)
+					}
+				}
+			}
+		}
+	}
+	for _, labelled := range splitList(field("labels")) {
+		// e.g. A23403G (D614G)
+		i := strings.Index(labelled, " (")
+		if i < 0 || !strings.HasSuffix(labelled, ")") {
+			return fail(errors.New("bad label: " + labelled))
+		}
+		cr.catalogue[labelled[:i]] = labelled[i+2 : len(labelled)-1]
+	}
+	record.Ambiguities, err = parseSNPs(field("compatible_ambiguities"))
+	if err != nil {
+		return fail(err)
+	}
+	record.Resolutions, err = parseSNPs(field("reference_resolutions"))
+	if err != nil {
+		return fail(err)
+	}
+	record.Missing, err = parseSNPs(field("missing"))
+	if err != nil {
+		return fail(err)
+	}
+	record.Segments, err = parseSegments(field("parents"))
+	if err != nil {
+		return fail(err)
+	}
+	record.Dropouts = splitList(field("amplicon_dropouts"))
+	for _, cluster := range splitList(field("SNP_clusters")) {
+		bounds := strings.SplitN(cluster, "-", 2)
+		if len(bounds) != 2 {
+			return fail(errors.New("bad cluster: " + cluster))
+		}
+		start, err1 := strconv.Atoi(bounds[0])
+		end, err2 := strconv.Atoi(bounds[1])
+		if err1 != nil || err2 != nil {
+			return fail(errors.New("bad cluster: " + cluster))
+		}
+		record.Clusters = append(record.Clusters, [2]int{start, end})
+	}
+
+	return record, nil
+}
+
+// splitList splits a list of the form a|b|c, which may be empty
+func splitList(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "|")
+}
+
+// parseSNPs parses a list of SNPs of the form G6C|A9T
+func parseSNPs(s string) ([]SNP, error) {
+	items := splitList(s)
+	SNPs := make([]SNP, len(items))
+	for i, item := range items {
+		snp, err := ParseSNP(item)
+		if err != nil {
+			return nil, err
+		}
+		SNPs[i] = snp
+	}
+	return SNPs, nil
+}
+
+// ParseSNP parses a SNP of the form G6C or HA:G6C, as SNP.String writes it
+func ParseSNP(s string) (SNP, error) {
+	contig, change := "", s
+	if i := strings.LastIndex(s, ":"); i >= 0 {
+		contig, change = s[:i], s[i+1:]
+	}
+	if len(change) < 3 {
+		return SNP{}, errors.New("bad SNP: " + s)
+	}
+	pos, err := strconv.Atoi(change[1 : len(change)-1])
+	if err != nil || pos < 1 {
+		return SNP{}, errors.New("bad SNP: " + s)
+	}
+	return SNP{Contig: contig, Position: pos, Ref: change[:1], Alt: change[len(change)-1:]}, nil
+}
+
+// Convert writes the records read by cr to ow, as a run would have
+func Convert(cr *CSVReader, ow OutputWriter) error {
+	err := ow.WriteHeader()
+	if err != nil {
+		return err
+	}
+
+	var agg *aggregator
+	if needsAggregate(ow) {
+		agg = newAggregator()
+	}
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		err = ow.WriteRecord(record)
+		if err != nil {
+			return err
+		}
+		if agg != nil {
+			agg.add(record)
+		}
+	}
+
+	var aggregate Aggregate
+	if agg != nil {
+		aggregate = agg.aggregate()
+	}
+	err = ow.WriteAggregate(aggregate)
+	if err != nil {
+		return err
+	}
+	return ow.Close()
+}
@@ -0,0 +1,90 @@
+package snps
+
+import (
+	"errors"
+	"fmt"
+)
+
+// checkCore returns an error if opts.Core can't be used
+func (opts Options) checkCore() error {
+	if opts.Core == 0 {
+		return nil
+	}
+	if opts.Core < 0 || opts.Core > 1 {
+		return fmt.Errorf("the proportion of queries that core sites are called in should be between 0 and 1, not %v", opts.Core)
+	}
+	if opts.CountOnly || opts.contigs != nil {
+		return errors.New("core sites can't be found when SNPs are only counted, or with contigs")
+	}
+	return nil
+}
+
+// coreWriter holds records back until every query has been compared, then passes them
+// on to ow with only their SNPs (and ambiguities, resolutions and missing sites) at core
+// sites, which at least proportion of the queries call as A, C, G or T, with the
+// aggregate of what is left
+type coreWriter struct {
+	ow         OutputWriter
+	proportion float64
+	records    []Record
+	// uncalled counts the queries that don't call each site, as the differences between
+	// each site's count and the one before's, so that a range is added in two steps
+	uncalled []int
+}
+
+func newCoreWriter(ow OutputWriter, proportion float64, refLength int) OutputWriter {
+	return &coreWriter{ow: ow, proportion: proportion, uncalled: make([]int, refLength+1)}
+}
+
+func (cw *coreWriter) WriteHeader() error {
+	return cw.ow.WriteHeader()
+}
+
+func (cw *coreWriter) WriteRecord(record Record) error {
+	for _, r := range record.uncalled {
+		cw.uncalled[r[0]-1]++
+		cw.uncalled[r[1]]--
+	}
+	record.uncalled = nil
+	cw.records = append(cw.records, record)
+	return nil
+}
+
+// WriteAggregate ignores the aggregate of all the SNPs, and writes the records and the
+// aggregate of their SNPs at core sites
+func (cw *coreWriter) WriteAggregate(Aggregate) error {
+	core := make([]bool, len(cw.uncalled)-1)
+	queries := len(cw.records)
+	uncalled := 0
+	for i := range core {
+		uncalled += cw.uncalled[i]
+		core[i] = float64(queries-uncalled) >= cw.proportion*float64(queries)
+	}
+	atCore := func(SNPs []SNP) []SNP {
+		kept := make([]SNP, 0, len(SNPs))
+		for _, snp := range SNPs {
+			if snp.Position <= len(core) && core[snp.Position-1] {
+				kept = append(kept, snp)
+			}
+		}
+		return kept
+	}
+
+	a := newAggregator()
+	for _, record := range cw.records {
+		record.SNPs = atCore(record.SNPs)
+		record.Distance = len(record.SNPs)
+		record.Ambiguities = atCore(record.Ambiguities)
+		record.Resolutions = atCore(record.Resolutions)
+		record.Missing = atCore(record.Missing)
+		if err := cw.ow.WriteRecord(record); err != nil {
+			return err
+		}
+		a.add(record)
+	}
+	return cw.ow.WriteAggregate(a.aggregate())
+}
+
+func (cw *coreWriter) Close() error {
+	return cw.ow.Close()
+}
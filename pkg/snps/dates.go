@@ -0,0 +1,70 @@
+package snps
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// DateOptions say where to find a query's collection date in its header line. If
+// Regex is not nil, the date is its first submatch (or the whole match, if it has no
+// groups). Otherwise, if Field is greater than zero, the date is that field (counting
+// from one) of the header line split on Delimiter. Dates are in the form YYYY-MM-DD
+type DateOptions struct {
+	Regex     *regexp.Regexp
+	Field     int
+	Delimiter string
+}
+
+// enabled returns whether dates are to be parsed at all
+func (o DateOptions) enabled() bool {
+	return o.Regex != nil || o.Field > 0
+}
+
+// parse returns the date in the header line, or the zero time if there isn't one
+// (including if it is incomplete, like 2021-01 or 2021-01-XX)
+func (o DateOptions) parse(description string) time.Time {
+	var s string
+	switch {
+	case o.Regex != nil:
+		match := o.Regex.FindStringSubmatch(description)
+		if len(match) == 0 {
+			return time.Time{}
+		}
+		s = match[0]
+		if len(match) > 1 {
+			s = match[1]
+		}
+	case o.Field > 0:
+		fields := strings.Split(description, o.Delimiter)
+		if o.Field > len(fields) {
+			return time.Time{}
+		}
+		s = fields[o.Field-1]
+	default:
+		return time.Time{}
+	}
+
+	date, err := time.Parse("2006-01-02", strings.TrimSpace(s))
+	if err != nil {
+		return time.Time{}
+	}
+	return date
+}
+
+// ISOWeek returns the ISO 8601 week of date, e.g. 2020-W53, in which weeks start on a
+// Monday and week 1 is the week with the year's first Thursday in it
+func ISOWeek(date time.Time) string {
+	year, week := date.ISOWeek()
+	return fmt.Sprintf("%d-W%02d", year, week)
+}
+
+// EpiWeek returns the epidemiological (CDC/MMWR) week of date, e.g. 2020-W53, in which
+// weeks start on a Sunday and week 1 is the first week with at least four days of the
+// year in it
+func EpiWeek(date time.Time) string {
+	// the year a week belongs to is the year of its Wednesday
+	wednesday := date.AddDate(0, 0, 3-int(date.Weekday()))
+	return fmt.Sprintf("%d-W%02d", wednesday.Year(), (wednesday.YearDay()-1)/7+1)
+}
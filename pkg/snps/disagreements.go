@@ -0,0 +1,106 @@
+package snps
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/benjamincjackson/snps/pkg/encoding"
+	"github.com/benjamincjackson/snps/pkg/fastaio"
+)
+
+// Disagreement is where the base calls for one sample differ between two alignments of
+// the same samples. Each of Sites is the call in the first alignment, the position and
+// the call in the second, e.g. A100G. If the sample is only in one of the alignments,
+// MissingFrom is the other, "a" or "b", and Sites is empty
+type Disagreement struct {
+	Query       string
+	Sites       []SNP
+	MissingFrom string
+}
+
+// CompareAlignments returns, for each sample in either of the alignments rA and rB, the
+// positions where its sequences in the two differ, e.g. to validate one pipeline against
+// another. Samples are matched by ID, and are in rB's order, followed by those only in
+// rA. rA is held in memory, and rB is read one record at a time. If ignoreMissing is
+// true, positions where either sequence is N, ? or a gap are left out
+func CompareAlignments(rA io.Reader, rB io.Reader, hardGaps bool, ignoreMissing bool) ([]Disagreement, error) {
+	seqs := make(map[string][]byte)
+	order := make([]string, 0)
+	err := eachRecord(rA, hardGaps, func(FR fastaio.EncodedFastaRecord) error {
+		if _, ok := seqs[FR.ID]; !ok {
+			order = append(order, FR.ID)
+		}
+		seqs[FR.ID] = FR.Seq
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("a: %w", err)
+	}
+
+	DA := encoding.MakeDecodingArray()
+	missing := func(nuc byte) bool {
+		return nuc == 240 || nuc == 242 || nuc == 244 || nuc == 4
+	}
+
+	disagreements := make([]Disagreement, 0, len(order))
+	seen := make(map[string]bool)
+	err = eachRecord(rB, hardGaps, func(FR fastaio.EncodedFastaRecord) error {
+		seen[FR.ID] = true
+		a, ok := seqs[FR.ID]
+		if !ok {
+			disagreements = append(disagreements, Disagreement{Query: FR.ID, Sites: []SNP{}, MissingFrom: "a"})
+			return nil
+		}
+		if len(a) != len(FR.Seq) {
+			return fmt.Errorf("%w: %s is %d long in a and %d long in b", ErrLengthMismatch, FR.ID, len(a), len(FR.Seq))
+		}
+		d := Disagreement{Query: FR.ID, Sites: make([]SNP, 0)}
+		for i, nuc := range FR.Seq {
+			if a[i] == nuc || (ignoreMissing && (missing(a[i]) || missing(nuc))) {
+				continue
+			}
+			d.Sites = append(d.Sites, SNP{Position: i + 1, Ref: DA[a[i]], Alt: DA[nuc]})
+		}
+		disagreements = append(disagreements, d)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("b: %w", err)
+	}
+
+	for _, id := range order {
+		if !seen[id] {
+			disagreements = append(disagreements, Disagreement{Query: id, Sites: []SNP{}, MissingFrom: "b"})
+		}
+	}
+	return disagreements, nil
+}
+
+// WriteDisagreements writes disagreements in csv format, one line per sample, with the
+// number of positions that differ, the positions themselves joined by "|", and which
+// alignment the sample is missing from, if either
+func WriteDisagreements(w io.Writer, disagreements []Disagreement) error {
+	bw := bufio.NewWriter(w)
+	_, err := bw.WriteString("query,disagreements,sites,missing_from\n")
+	if err != nil {
+		return err
+	}
+	for _, d := range disagreements {
+		sites := make([]string, len(d.Sites))
+		for i, site := range d.Sites {
+			sites[i] = site.String()
+		}
+		count := strconv.Itoa(len(sites))
+		if d.MissingFrom != "" {
+			count = ""
+		}
+		_, err := bw.WriteString(csvField(d.Query) + "," + count + "," + strings.Join(sites, "|") + "," + d.MissingFrom + "\n")
+		if err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
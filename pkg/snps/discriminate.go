@@ -0,0 +1,156 @@
+package snps
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strconv"
+)
+
+// discriminateWriter selects a small set of SNPs that tells the queries of two groups
+// apart, e.g. for designing a typing assay. A pair of queries, one from each group, is
+// separated by a SNP that one has and the other doesn't, and SNPs are chosen greedily,
+// each the one that separates the most pairs that aren't already separated, until every
+// pair is or no SNP separates any more (a greedy set cover of the pairs). For each SNP
+// it writes the number of queries in each group that have it, the number of pairs it
+// newly separates and the proportion of all pairs separated so far. Only SNPs to A, C,
+// G or T are used, and a query without a SNP is taken to have the reference, even if it
+// is missing data there. Queries that aren't in either group are left out
+type discriminateWriter struct {
+	w       *bufio.Writer
+	groups  []string
+	queries [2][]map[string]bool
+	changes map[string]SNP
+}
+
+func newDiscriminateWriter(w io.Writer, opts WriterOptions) OutputWriter {
+	return &discriminateWriter{w: bufio.NewWriter(w), groups: opts.Discriminate, changes: make(map[string]SNP)}
+}
+
+func (dw *discriminateWriter) WriteHeader() error {
+	if len(dw.groups) != 2 {
+		return errors.New("discriminating SNPs need exactly two groups, got " + strconv.Itoa(len(dw.groups)))
+	}
+	_, err := dw.w.WriteString("change," + csvField(dw.groups[0]+"_count") + "," + csvField(dw.groups[1]+"_count") + ",pairs_separated,cumulative_proportion_separated\n")
+	return err
+}
+
+func (dw *discriminateWriter) WriteRecord(record Record) error {
+	g := -1
+	for i, group := range dw.groups {
+		if record.Group == group {
+			g = i
+		}
+	}
+	if g < 0 {
+		return nil
+	}
+	has := make(map[string]bool)
+	for _, snp := range record.SNPs {
+		if !isACGT(snp.Alt) {
+			continue
+		}
+		key := snp.String()
+		has[key] = true
+		if _, ok := dw.changes[key]; !ok {
+			dw.changes[key] = SNP{Contig: snp.Contig, Position: snp.Position, Ref: snp.Ref, Alt: snp.Alt}
+		}
+	}
+	dw.queries[g] = append(dw.queries[g], has)
+	return nil
+}
+
+func (dw *discriminateWriter) WriteAggregate(Aggregate) error {
+	for i, queries := range dw.queries {
+		if len(queries) == 0 {
+			return errors.New("no queries are in group " + dw.groups[i])
+		}
+	}
+	changes := make([]Change, 0, len(dw.changes))
+	for _, snp := range dw.changes {
+		changes = append(changes, Change{SNP: snp})
+	}
+	sortChanges(changes)
+
+	// the queries are split into classes that no chosen SNP separates, which start as
+	// one. The pairs that aren't yet separated are those within a class
+	type class [2][]map[string]bool
+	classes := []class{dw.queries}
+	total := len(dw.queries[0]) * len(dw.queries[1])
+	separated := 0
+	chosen := make(map[string]bool)
+
+	for separated < total {
+		// the pairs that each SNP would separate, from the queries in each class with it
+		pairs := make(map[string]int)
+		for _, c := range classes {
+			with := make(map[string]*[2]int)
+			for g := range c {
+				for _, has := range c[g] {
+					for key := range has {
+						if with[key] == nil {
+							with[key] = new([2]int)
+						}
+						with[key][g]++
+					}
+				}
+			}
+			for key, n := range with {
+				pairs[key] += n[0]*(len(c[1])-n[1]) + (len(c[0])-n[0])*n[1]
+			}
+		}
+		best, bestPairs := "", 0
+		var bestSNP SNP
+		for _, change := range changes {
+			key := change.SNP.String()
+			if !chosen[key] && pairs[key] > bestPairs {
+				best, bestPairs, bestSNP = key, pairs[key], change.SNP
+			}
+		}
+		if bestPairs == 0 {
+			break
+		}
+		chosen[best] = true
+		separated += bestPairs
+
+		split := make([]class, 0, 2*len(classes))
+		for _, c := range classes {
+			var with, without class
+			for g := range c {
+				for _, has := range c[g] {
+					if has[best] {
+						with[g] = append(with[g], has)
+					} else {
+						without[g] = append(without[g], has)
+					}
+				}
+			}
+			for _, part := range []class{with, without} {
+				// classes with queries from only one group have no pairs left
+				if len(part[0]) > 0 && len(part[1]) > 0 {
+					split = append(split, part)
+				}
+			}
+		}
+		classes = split
+
+		var counts [2]int
+		for g, queries := range dw.queries {
+			for _, has := range queries {
+				if has[best] {
+					counts[g]++
+				}
+			}
+		}
+
+		line := bestSNP.String() + "," + strconv.Itoa(counts[0]) + "," + strconv.Itoa(counts[1]) + "," + strconv.Itoa(bestPairs) + "," + strconv.FormatFloat(float64(separated)/float64(total), 'f', 9, 64)
+		if _, err := dw.w.WriteString(line + "\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (dw *discriminateWriter) Close() error {
+	return dw.w.Flush()
+}
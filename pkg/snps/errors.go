@@ -0,0 +1,43 @@
+package snps
+
+import (
+	"errors"
+
+	"github.com/benjamincjackson/snps/pkg/expr"
+	"github.com/benjamincjackson/snps/pkg/fastaio"
+)
+
+// The causes of the errors that runs return, which callers can check for with errors.Is.
+// Errors about one sequence are a *RecordError, which says which sequence, and where in it
+var (
+	ErrBadFasta       = fastaio.ErrBadFasta
+	ErrEmptyHeader    = fastaio.ErrEmptyHeader
+	ErrBadTwoBit      = fastaio.ErrBadTwoBit
+	ErrBadEncoded     = fastaio.ErrBadEncoded
+	ErrBadPhylip      = fastaio.ErrBadPhylip
+	ErrBadNexus       = fastaio.ErrBadNexus
+	ErrBadMAF         = fastaio.ErrBadMAF
+	ErrBadGenBank     = fastaio.ErrBadGenBank
+	ErrBadReference   = errors.New("bad reference")
+	ErrLengthMismatch = errors.New("length differs from the reference's")
+	ErrInvalidChar    = errors.New("invalid character")
+	ErrQuestionMark   = errors.New("? is not allowed")
+	ErrBadCSV         = errors.New("badly formatted csv")
+	ErrUnknownFormat  = errors.New("unknown output format")
+	ErrUnknownPolicy  = errors.New("unknown policy")
+	ErrBadIndex       = errors.New("badly formatted index")
+	ErrBadPattern     = errors.New("bad search pattern")
+	ErrBadBED         = errors.New("badly formatted bed")
+	ErrNotInAlignment = errors.New("not in the alignment")
+	ErrNoContig       = errors.New("matches no contig of the reference")
+	ErrBadProfile     = errors.New("bad SNP profile")
+	ErrBadWeights     = errors.New("badly formatted weights")
+	ErrBadTrack       = errors.New("badly formatted track")
+	ErrBadRegion      = errors.New("bad region")
+	ErrBadFaidx       = fastaio.ErrBadFaidx
+	ErrBadExpression  = expr.ErrSyntax
+	ErrExpressionType = expr.ErrType
+)
+
+// RecordError is an error in one record of an alignment
+type RecordError = fastaio.RecordError
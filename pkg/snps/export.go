@@ -0,0 +1,138 @@
+package snps
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"sort"
+	"strings"
+)
+
+// auspiceWriter writes the SNPs of each query as an Augur node-data JSON file, which
+// augur export reads with a tree to make an Auspice dataset: each query is a node with
+// its SNPs in muts and, if the reference is annotated, its amino acid changes by gene in
+// aa_muts. Columns of metadata, if there is any, are added to each node as its traits
+type auspiceWriter struct {
+	w         *bufio.Writer
+	annotated bool
+	metadata  Metadata
+	nodes     int
+}
+
+func newAuspiceWriter(w io.Writer, opts WriterOptions) OutputWriter {
+	return &auspiceWriter{w: bufio.NewWriter(w), annotated: opts.Annotated, metadata: opts.Metadata}
+}
+
+func (aw *auspiceWriter) WriteHeader() error {
+	_, err := aw.w.WriteString("{\n  \"generated_by\": {\"program\": \"snps\"},\n  \"nodes\": {")
+	return err
+}
+
+func (aw *auspiceWriter) WriteRecord(record Record) error {
+	node := make(map[string]interface{})
+	for column, value := range aw.metadata.Values[record.Query] {
+		node[column] = value
+	}
+	muts := make([]string, len(record.SNPs))
+	for i, snp := range record.SNPs {
+		muts[i] = snp.String()
+	}
+	node["muts"] = muts
+	if aw.annotated {
+		_, node["aa_muts"] = geneChanges(record.SNPs)
+	}
+
+	name, err := json.Marshal(record.Query)
+	if err != nil {
+		return err
+	}
+	value, err := json.Marshal(node)
+	if err != nil {
+		return err
+	}
+	sep := ","
+	if aw.nodes == 0 {
+		sep = ""
+	}
+	aw.nodes++
+	_, err = aw.w.WriteString(sep + "\n    " + string(name) + ": " + string(value))
+	return err
+}
+
+func (aw *auspiceWriter) WriteAggregate(Aggregate) error {
+	_, err := aw.w.WriteString("\n  }\n}\n")
+	return err
+}
+
+func (aw *auspiceWriter) Close() error {
+	return aw.w.Flush()
+}
+
+// microreactWriter writes the SNPs of each query as a JSON array of rows for Microreact:
+// each query is a row with its ID in id, its SNPs in mutations and, if the reference is
+// annotated, its amino acid changes in amino_acid_mutations (e.g. S:D614G), both joined
+// by "|", and the columns of metadata, if there is any
+type microreactWriter struct {
+	w         *bufio.Writer
+	annotated bool
+	metadata  Metadata
+	rows      int
+}
+
+func newMicroreactWriter(w io.Writer, opts WriterOptions) OutputWriter {
+	return &microreactWriter{w: bufio.NewWriter(w), annotated: opts.Annotated, metadata: opts.Metadata}
+}
+
+func (mw *microreactWriter) WriteHeader() error {
+	_, err := mw.w.WriteString("[")
+	return err
+}
+
+func (mw *microreactWriter) WriteRecord(record Record) error {
+	row := make(map[string]string)
+	for column, value := range mw.metadata.Values[record.Query] {
+		row[column] = value
+	}
+	row["id"] = record.Query
+	muts := make([]string, len(record.SNPs))
+	for i, snp := range record.SNPs {
+		muts[i] = snp.String()
+	}
+	row["mutations"] = strings.Join(muts, "|")
+	if mw.annotated {
+		_, aaMuts := geneChanges(record.SNPs)
+		genes := make([]string, 0, len(aaMuts))
+		for gene := range aaMuts {
+			genes = append(genes, gene)
+		}
+		sort.Strings(genes)
+		changes := make([]string, 0)
+		for _, gene := range genes {
+			for _, aa := range aaMuts[gene] {
+				changes = append(changes, gene+":"+aa)
+			}
+		}
+		row["amino_acid_mutations"] = strings.Join(changes, "|")
+	}
+
+	value, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+	sep := ","
+	if mw.rows == 0 {
+		sep = ""
+	}
+	mw.rows++
+	_, err = mw.w.WriteString(sep + "\n  " + string(value))
+	return err
+}
+
+func (mw *microreactWriter) WriteAggregate(Aggregate) error {
+	_, err := mw.w.WriteString("\n]\n")
+	return err
+}
+
+func (mw *microreactWriter) Close() error {
+	return mw.w.Flush()
+}
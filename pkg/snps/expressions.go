@@ -0,0 +1,112 @@
+package snps
+
+import (
+	"github.com/benjamincjackson/snps/pkg/expr"
+)
+
+// RecordVariables are the variables that a record filter can use:
+//
+//	query, description, contig, lineage, group  strings, "" if unknown
+//	source                                       the file the query was read from, or "" if there was only one
+//	date                                         YYYY-MM-DD, or "" if unknown
+//	length                                       the length of the sequence
+//	snp_count                                    the number of SNPs, after any SNP filter
+//	acgt_count, n_count, gap_count               the number of sites that are A, C, G or T, N or ?, or a gap
+//	ambiguous_count                              the number of sites that are any other ambiguity code
+//	completeness                                 acgt_count / length
+//	dropout_count                                the number of amplicons that dropped out
+var RecordVariables = []string{"query", "description", "contig", "lineage", "group", "source", "date", "length", "snp_count", "acgt_count", "n_count", "gap_count", "ambiguous_count", "completeness", "dropout_count"}
+
+// SNPVariables are the variables that a SNP filter can use: position, ref, alt, contig,
+// annotation (e.g. S:D614G) and codon_position (e.g. S:614:2), which are "" outside
+// coding regions or without an annotation, weight, the weight of the SNP's site, or 0 if
+// sites aren't weighted, and score, the score of its site from a track, which is NaN
+// (so that comparisons with it are false) if the track has none there, or 0 if sites
+// aren't scored, and context, the error-prone context it is in (e.g. homopolymer:6), or
+// "" if it isn't in one or contexts aren't looked for
+var SNPVariables = []string{"position", "ref", "alt", "contig", "annotation", "codon_position", "weight", "score", "context"}
+
+// CompileFilter compiles a record filter, e.g. snp_count < 40 && completeness > 0.9,
+// for Options.Filter
+func CompileFilter(src string) (*expr.Expr, error) {
+	return expr.Compile(src, RecordVariables)
+}
+
+// CompileSNPFilter compiles a SNP filter, e.g. alt != "N" && position > 100, for
+// Options.SNPFilter
+func CompileSNPFilter(src string) (*expr.Expr, error) {
+	return expr.Compile(src, SNPVariables)
+}
+
+// filterSNPs returns the SNPs that pass opts.SNPFilter
+func (opts Options) filterSNPs(SNPs []SNP) ([]SNP, error) {
+	if opts.SNPFilter == nil {
+		return SNPs, nil
+	}
+	kept := SNPs[:0]
+	for _, snp := range SNPs {
+		ok, err := opts.SNPFilter.Bool(expr.Env{
+			"position":       float64(snp.Position),
+			"ref":            snp.Ref,
+			"alt":            snp.Alt,
+			"contig":         snp.Contig,
+			"annotation":     snp.Annotation,
+			"codon_position": snp.CodonPosition,
+			"weight":         snp.Weight,
+			"score":          snp.Score,
+			"context":        snp.Context,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			kept = append(kept, snp)
+		}
+	}
+	return kept, nil
+}
+
+// passes returns whether a record, whose sequence is seq, passes opts.Filter
+func (opts Options) passes(record Record, seq []byte) (bool, error) {
+	if opts.Filter == nil {
+		return true, nil
+	}
+	var acgt, n, gaps, ambiguous int
+	for _, nuc := range seq {
+		switch {
+		case nuc&8 == 8:
+			acgt++
+		case nuc == 240 || nuc == 242:
+			n++
+		case nuc == 244 || nuc == 4:
+			gaps++
+		default:
+			ambiguous++
+		}
+	}
+	completeness := 0.0
+	if len(seq) > 0 {
+		completeness = float64(acgt) / float64(len(seq))
+	}
+	date := ""
+	if !record.Date.IsZero() {
+		date = record.Date.Format("2006-01-02")
+	}
+	return opts.Filter.Bool(expr.Env{
+		"query":           record.Query,
+		"description":     record.Description,
+		"contig":          record.Contig,
+		"lineage":         record.Lineage,
+		"group":           record.Group,
+		"source":          record.Source,
+		"date":            date,
+		"length":          float64(len(seq)),
+		"snp_count":       float64(record.Distance),
+		"acgt_count":      float64(acgt),
+		"n_count":         float64(n),
+		"gap_count":       float64(gaps),
+		"ambiguous_count": float64(ambiguous),
+		"completeness":    completeness,
+		"dropout_count":   float64(len(record.Dropouts)),
+	})
+}
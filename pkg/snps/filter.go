@@ -0,0 +1,103 @@
+package snps
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Filter selects queries and SNPs from earlier output. Queries are kept if Keep is nil or
+// has their name, and Drop hasn't. SNPs, ambiguities and missing sites in Mask (1-based,
+// inclusive ranges) are dropped, and so are SNPs not in IncludeSNPs, if it isn't nil, or
+// in ExcludeSNPs. Then queries with fewer than MinSNPs SNPs, or (if MaxSNPs isn't
+// negative) more than MaxSNPs, are dropped. Clusters of SNPs are left as they were found
+type Filter struct {
+	Keep        map[string]bool
+	Drop        map[string]bool
+	Mask        [][2]int
+	IncludeSNPs map[string]bool
+	ExcludeSNPs map[string]bool
+	MinSNPs     int
+	MaxSNPs     int
+}
+
+// apply returns the record with the filter applied, and whether it is kept
+func (f *Filter) apply(record Record) (Record, bool) {
+	if (f.Keep != nil && !f.Keep[record.Query]) || f.Drop[record.Query] {
+		return record, false
+	}
+
+	record.SNPs = f.filterSNPs(record.SNPs, true)
+	record.Distance = len(record.SNPs)
+	record.Ambiguities = f.filterSNPs(record.Ambiguities, false)
+	record.Resolutions = f.filterSNPs(record.Resolutions, false)
+	record.Missing = f.filterSNPs(record.Missing, false)
+
+	if len(record.SNPs) < f.MinSNPs || (f.MaxSNPs >= 0 && len(record.SNPs) > f.MaxSNPs) {
+		return record, false
+	}
+	return record, true
+}
+
+// filterSNPs returns the SNPs that aren't masked, and if lists is true, that pass the
+// include and exclude lists
+func (f *Filter) filterSNPs(SNPs []SNP, lists bool) []SNP {
+	kept := make([]SNP, 0, len(SNPs))
+	for _, snp := range SNPs {
+		if f.masked(snp.Position) {
+			continue
+		}
+		if lists && ((f.IncludeSNPs != nil && !f.IncludeSNPs[snp.String()]) || f.ExcludeSNPs[snp.String()]) {
+			continue
+		}
+		kept = append(kept, snp)
+	}
+	return kept
+}
+
+func (f *Filter) masked(pos int) bool {
+	for _, r := range f.Mask {
+		if pos >= r[0] && pos <= r[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseRanges parses a comma-separated list of positions and ranges of positions, e.g.
+// 1-55,100,29804-29903
+func ParseRanges(s string) ([][2]int, error) {
+	ranges := make([][2]int, 0)
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		bounds := strings.SplitN(item, "-", 2)
+		start, err := strconv.Atoi(bounds[0])
+		end := start
+		if err == nil && len(bounds) == 2 {
+			end, err = strconv.Atoi(bounds[1])
+		}
+		if err != nil || start < 1 || end < start {
+			return nil, errors.New("bad range: " + item)
+		}
+		ranges = append(ranges, [2]int{start, end})
+	}
+	return ranges, nil
+}
+
+// ReadList reads a set of names, one per line. Blank lines are ignored
+func ReadList(r io.Reader) (map[string]bool, error) {
+	list := make(map[string]bool)
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line != "" {
+			list[line] = true
+		}
+	}
+	return list, s.Err()
+}
@@ -0,0 +1,111 @@
+package snps
+
+import (
+	"bufio"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/benjamincjackson/snps/pkg/annotation"
+)
+
+// GeneNames returns the names of regions, in the order they are first found, for
+// WriterOptions.Genes
+func GeneNames(regions []annotation.CDS) []string {
+	names := make([]string, 0, len(regions))
+	seen := make(map[string]bool)
+	for _, region := range regions {
+		if !seen[region.Name] {
+			seen[region.Name] = true
+			names = append(names, region.Name)
+		}
+	}
+	return names
+}
+
+// genesWriter writes the number of nucleotide and amino acid changes in each gene of
+// each query, one line per query per gene, from the SNPs' annotations. A SNP counts once
+// towards each gene it is in, and an amino acid change once however many of its codon's
+// sites changed; synonymous changes and those to or from an untranslatable codon (X)
+// aren't amino acid changes. Every gene in genes gets a line, even if it has no changes,
+// and genes that aren't in it, or every gene if it is empty, get one only if they have a
+// SNP
+type genesWriter struct {
+	w     *bufio.Writer
+	genes []string
+}
+
+func newGenesWriter(w io.Writer, opts WriterOptions) OutputWriter {
+	return &genesWriter{w: bufio.NewWriter(w), genes: opts.Genes}
+}
+
+func (gw *genesWriter) WriteHeader() error {
+	_, err := gw.w.WriteString("query,gene,nucleotide_changes,amino_acid_changes\n")
+	return err
+}
+
+// geneChanges returns the number of SNPs in each gene that SNPs' annotations name, and
+// the distinct amino acid changes in each, e.g. D614G, in the order they are found
+func geneChanges(SNPs []SNP) (map[string]int, map[string][]string) {
+	nucleotides := make(map[string]int)
+	aminoAcids := make(map[string][]string)
+	seen := make(map[string]bool)
+	for _, snp := range SNPs {
+		if snp.Annotation == "" {
+			continue
+		}
+		counted := make(map[string]bool)
+		for _, change := range strings.Split(snp.Annotation, ";") {
+			// the gene's name can have colons in it, but the change, e.g. D614G, can't
+			i := strings.LastIndex(change, ":")
+			if i < 0 {
+				continue
+			}
+			gene, aa := change[:i], change[i+1:]
+			if !counted[gene] {
+				counted[gene] = true
+				nucleotides[gene]++
+			}
+			if len(aa) >= 3 && aa[0] != aa[len(aa)-1] && aa[0] != 'X' && aa[len(aa)-1] != 'X' && !seen[change] {
+				seen[change] = true
+				aminoAcids[gene] = append(aminoAcids[gene], aa)
+			}
+		}
+	}
+	return nucleotides, aminoAcids
+}
+
+func (gw *genesWriter) WriteRecord(record Record) error {
+	nucleotides, aminoAcids := geneChanges(record.SNPs)
+
+	genes := gw.genes
+	extra := make([]string, 0)
+	listed := make(map[string]bool)
+	for _, gene := range genes {
+		listed[gene] = true
+	}
+	for gene := range nucleotides {
+		if !listed[gene] {
+			extra = append(extra, gene)
+		}
+	}
+	sort.Strings(extra)
+	genes = append(genes[:len(genes):len(genes)], extra...)
+
+	for _, gene := range genes {
+		line := csvField(record.Query) + "," + csvField(gene) + "," + strconv.Itoa(nucleotides[gene]) + "," + strconv.Itoa(len(aminoAcids[gene])) + "\n"
+		if _, err := gw.w.WriteString(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (gw *genesWriter) WriteAggregate(Aggregate) error {
+	return nil
+}
+
+func (gw *genesWriter) Close() error {
+	return gw.w.Flush()
+}
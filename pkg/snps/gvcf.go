@@ -0,0 +1,213 @@
+package snps
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/benjamincjackson/snps/pkg/encoding"
+)
+
+// gvcfBands is the number of bands that the proportion of queries called at a site is
+// put in. Reference blocks are split where it moves from one band to another, as gVCFs
+// split them by genotype quality
+const gvcfBands = 20
+
+// gvcfWriter writes a gVCF-like summary of the whole alignment against the reference:
+// one line for each site where any query has a SNP to A, C, G or T, with the number of
+// queries with each allele (AC), the number called at the site (AN), and the allele
+// frequencies (AF), and between them blocks of sites where no query has one, with the
+// smallest number of queries called at any of them (MinAN). COV and MinCOV are AN and
+// MinAN as proportions of the queries. This distinguishes a site without a SNP, where
+// AN is high, from one without data, where it is low, e.g. when merging runs.
+//
+// A query isn't called at a site where it is N, ?, a gap (without hard gaps), masked,
+// or an ambiguity code or hard gap that differs from the reference, and is called as the
+// reference anywhere else without a SNP. Sites that aren't called are only known if
+// the run looked for them, with Options.MissingRanges; otherwise every query is called
+// everywhere. The writer needs the reference, so can't be used with contigs.
+//
+// If sitesOnly is true, it writes a sites-only population VCF instead: only the variant
+// lines, without reference blocks, and only alleles found in at least the threshold
+// proportion of queries and at least minCount of them, as aggregate output filters them
+type gvcfWriter struct {
+	w         *bufio.Writer
+	name      string
+	sitesOnly bool
+	threshold float64
+	minCount  int
+	refSeq    []byte
+	queries   int
+	missing   []int // the change in the number of queries that are missing at each site
+	uncalled  map[int]int
+	alts      map[int]map[string]int
+}
+
+func newGVCFWriter(w io.Writer, opts WriterOptions) OutputWriter {
+	name := opts.ReferenceName
+	if name == "" {
+		name = "reference"
+	}
+	return &gvcfWriter{w: bufio.NewWriter(w), name: name, uncalled: make(map[int]int), alts: make(map[int]map[string]int)}
+}
+
+func newPopulationVCFWriter(w io.Writer, opts WriterOptions) OutputWriter {
+	gw := newGVCFWriter(w, opts).(*gvcfWriter)
+	gw.sitesOnly, gw.threshold, gw.minCount = true, opts.Threshold, opts.MinCount
+	return gw
+}
+
+func (gw *gvcfWriter) SetReference(refSeq []byte) {
+	gw.refSeq = refSeq
+	gw.missing = make([]int, len(refSeq)+2)
+}
+
+func (gw *gvcfWriter) WriteHeader() error {
+	if gw.refSeq == nil {
+		return errors.New("vcf output needs a single reference sequence")
+	}
+	header := []string{
+		"##fileformat=VCFv4.2",
+		"##source=snps",
+		"##contig=<ID=" + gw.name + ",length=" + strconv.Itoa(len(gw.refSeq)) + ">",
+	}
+	if !gw.sitesOnly {
+		header = append(header,
+			`##ALT=<ID=*,Description="Any allele other than the reference">`,
+			`##INFO=<ID=END,Number=1,Type=Integer,Description="End position of the reference block">`)
+	}
+	header = append(header,
+		`##INFO=<ID=AC,Number=A,Type=Integer,Description="Number of queries with each alternative allele">`,
+		`##INFO=<ID=AN,Number=1,Type=Integer,Description="Number of queries called at the site">`,
+		`##INFO=<ID=AF,Number=A,Type=Float,Description="Frequency of each alternative allele among the queries called">`,
+		`##INFO=<ID=COV,Number=1,Type=Float,Description="Proportion of queries called at the site">`)
+	if !gw.sitesOnly {
+		header = append(header,
+			`##INFO=<ID=MinAN,Number=1,Type=Integer,Description="Smallest number of queries called at any site in the reference block">`,
+			`##INFO=<ID=MinCOV,Number=1,Type=Float,Description="Smallest proportion of queries called at any site in the reference block">`)
+	}
+	header = append(header, "#CHROM\tPOS\tID\tREF\tALT\tQUAL\tFILTER\tINFO")
+	_, err := gw.w.WriteString(strings.Join(header, "\n") + "\n")
+	return err
+}
+
+func (gw *gvcfWriter) WriteRecord(record Record) error {
+	gw.queries++
+	for _, r := range record.MissingRanges {
+		if r[0] > len(gw.refSeq) {
+			continue
+		}
+		end := r[1]
+		if end > len(gw.refSeq) {
+			end = len(gw.refSeq)
+		}
+		gw.missing[r[0]]++
+		gw.missing[end+1]--
+	}
+	for _, snp := range record.SNPs {
+		if snp.Position > len(gw.refSeq) {
+			continue
+		}
+		if !isACGT(snp.Alt) {
+			gw.uncalled[snp.Position]++
+			continue
+		}
+		if gw.alts[snp.Position] == nil {
+			gw.alts[snp.Position] = make(map[string]int)
+		}
+		gw.alts[snp.Position][snp.Alt]++
+	}
+	return nil
+}
+
+func (gw *gvcfWriter) WriteAggregate(Aggregate) error {
+	DA := encoding.MakeDecodingArray()
+	proportion := func(n int) string {
+		if gw.queries == 0 {
+			return "0.0000"
+		}
+		return strconv.FormatFloat(float64(n)/float64(gw.queries), 'f', 4, 64)
+	}
+	band := func(n int) int {
+		if gw.queries == 0 {
+			return 0
+		}
+		return n * gvcfBands / gw.queries
+	}
+
+	blockStart, blockMin := 0, 0
+	endBlock := func(end int) error {
+		if blockStart == 0 || gw.sitesOnly {
+			return nil
+		}
+		line := gw.name + "\t" + strconv.Itoa(blockStart) + "\t.\t" + refAllele(gw.refSeq, blockStart, DA) + "\t<*>\t.\t.\tEND=" + strconv.Itoa(end) + ";MinAN=" + strconv.Itoa(blockMin) + ";MinCOV=" + proportion(blockMin)
+		blockStart = 0
+		_, err := gw.w.WriteString(line + "\n")
+		return err
+	}
+
+	missing := 0
+	for pos := 1; pos <= len(gw.refSeq); pos++ {
+		missing += gw.missing[pos]
+		called := gw.queries - missing - gw.uncalled[pos]
+
+		alts, ok := gw.alts[pos]
+		if !ok {
+			if blockStart > 0 && band(called) != band(blockMin) {
+				if err := endBlock(pos - 1); err != nil {
+					return err
+				}
+			}
+			if blockStart == 0 {
+				blockStart, blockMin = pos, called
+			}
+			if called < blockMin {
+				blockMin = called
+			}
+			continue
+		}
+
+		if err := endBlock(pos - 1); err != nil {
+			return err
+		}
+		alleles := make([]string, 0, len(alts))
+		for alt, count := range alts {
+			if gw.sitesOnly && (float64(count)/float64(gw.queries) < gw.threshold || count < gw.minCount) {
+				continue
+			}
+			alleles = append(alleles, alt)
+		}
+		if len(alleles) == 0 {
+			continue
+		}
+		sort.Strings(alleles)
+		ac := make([]string, len(alleles))
+		af := make([]string, len(alleles))
+		for i, alt := range alleles {
+			ac[i] = strconv.Itoa(alts[alt])
+			af[i] = strconv.FormatFloat(float64(alts[alt])/float64(called), 'f', 4, 64)
+		}
+		info := "AC=" + strings.Join(ac, ",") + ";AN=" + strconv.Itoa(called) + ";AF=" + strings.Join(af, ",") + ";COV=" + proportion(called)
+		line := gw.name + "\t" + strconv.Itoa(pos) + "\t.\t" + refAllele(gw.refSeq, pos, DA) + "\t" + strings.Join(alleles, ",") + "\t.\t.\t" + info
+		if _, err := gw.w.WriteString(line + "\n"); err != nil {
+			return err
+		}
+	}
+	return endBlock(len(gw.refSeq))
+}
+
+// refAllele returns the reference's allele at pos, or N if it isn't A, C, G or T, since
+// VCF has no other ambiguity codes
+func refAllele(refSeq []byte, pos int, DA []string) string {
+	if refSeq[pos-1]&8 != 8 {
+		return "N"
+	}
+	return DA[refSeq[pos-1]]
+}
+
+func (gw *gvcfWriter) Close() error {
+	return gw.w.Flush()
+}
@@ -0,0 +1,102 @@
+package snps
+
+import "strconv"
+
+// ContextOptions flag the SNPs that are in reference contexts where consensus genomes
+// are error-prone, which for nanopore data are mostly homopolymers: runs of at least
+// Homopolymer of one base, and tandem repeats of a 2- or 3-base unit (e.g. ATATAT) at
+// least LowComplexity long. A length of 0 turns a check off
+type ContextOptions struct {
+	Homopolymer   int
+	LowComplexity int
+}
+
+func (co ContextOptions) enabled() bool {
+	return co.Homopolymer > 0 || co.LowComplexity > 0
+}
+
+// flag sets the Context of each of SNPs to the error-prone context it is in, e.g.
+// homopolymer:6, or "" if it isn't in one. A SNP is in a homopolymer if the run of one
+// base through its site is long enough, either in the reference or with its alt in the
+// reference, so that a SNP that lengthens a run is flagged too. Gaps (deletions, with
+// HardGaps) are flagged by the run that they are in. DA decodes refSeq
+func (co ContextOptions) flag(refSeq []byte, SNPs []SNP, DA []string) {
+	for i := range SNPs {
+		SNPs[i].Context = ""
+		pos := SNPs[i].Position - 1
+		if pos >= len(refSeq) {
+			continue
+		}
+		if co.Homopolymer > 0 {
+			run := 0
+			if refSeq[pos]&8 == 8 {
+				run = homopolymerRun(refSeq, pos, DA[refSeq[pos]], DA)
+			}
+			if isACGT(SNPs[i].Alt) {
+				if altRun := homopolymerRun(refSeq, pos, SNPs[i].Alt, DA); altRun > run {
+					run = altRun
+				}
+			}
+			if run >= co.Homopolymer {
+				SNPs[i].Context = "homopolymer:" + strconv.Itoa(run)
+				continue
+			}
+		}
+		if co.LowComplexity > 0 && refSeq[pos]&8 == 8 {
+			repeat := 0
+			for unit := 2; unit <= 3; unit++ {
+				if length := tandemRepeat(refSeq, pos, unit); length > repeat {
+					repeat = length
+				}
+			}
+			if repeat >= co.LowComplexity {
+				SNPs[i].Context = "low_complexity:" + strconv.Itoa(repeat)
+			}
+		}
+	}
+}
+
+// homopolymerRun returns the length of the run of base through pos of refSeq, if pos
+// were base
+func homopolymerRun(refSeq []byte, pos int, base string, DA []string) int {
+	run := 1
+	for j := pos - 1; j >= 0 && DA[refSeq[j]] == base; j-- {
+		run++
+	}
+	for j := pos + 1; j < len(refSeq) && DA[refSeq[j]] == base; j++ {
+		run++
+	}
+	return run
+}
+
+// tandemRepeat returns the length of the longest stretch of refSeq through pos that
+// repeats with a period of unit, if it is at least two units long, or 0. Stretches that
+// aren't all A, C, G or T don't count, so that runs of N aren't repeats
+func tandemRepeat(refSeq []byte, pos int, unit int) int {
+	// a stretch from start to end repeats if every site up to end-unit matches the one a
+	// unit on, so the stretches through pos are made of runs of such sites that start
+	// within a unit of pos
+	matches := func(i int) bool {
+		return i >= 0 && i+unit < len(refSeq) && refSeq[i]&8 == 8 && refSeq[i] == refSeq[i+unit]
+	}
+	longest := 0
+	for i := pos - unit; i <= pos; i++ {
+		if !matches(i) {
+			continue
+		}
+		first, last := i, i
+		for matches(first - 1) {
+			first--
+		}
+		for matches(last + 1) {
+			last++
+		}
+		if length := last + unit - first + 1; length > longest {
+			longest = length
+		}
+	}
+	if longest < 2*unit {
+		return 0
+	}
+	return longest
+}
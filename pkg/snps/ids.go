@@ -0,0 +1,75 @@
+package snps
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+)
+
+// IDOptions control how record IDs are rewritten before they are output. They are
+// applied in the order Truncate, Rename, Sanitize
+type IDOptions struct {
+	// Truncate, if not empty, cuts each ID at the first occurrence of this string
+	Truncate string
+	// Rename replaces IDs that are keys with their values
+	Rename map[string]string
+	// Sanitize replaces every character other than a letter, digit or one of ._-/| with _
+	Sanitize bool
+}
+
+// apply returns the rewritten ID
+func (o IDOptions) apply(id string) string {
+	if o.Truncate != "" {
+		if i := strings.Index(id, o.Truncate); i >= 0 {
+			id = id[:i]
+		}
+	}
+	if newID, ok := o.Rename[id]; ok {
+		id = newID
+	}
+	if o.Sanitize {
+		id = strings.Map(sanitizeRune, id)
+	}
+	return id
+}
+
+func sanitizeRune(r rune) rune {
+	switch {
+	case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		return r
+	case strings.ContainsRune("._-/|", r):
+		return r
+	}
+	return '_'
+}
+
+// ReadRenameMap reads a file with one old and new ID per line, separated by a tab or
+// a comma, to use as IDOptions.Rename. Empty lines are skipped
+func ReadRenameMap(r io.Reader) (map[string]string, error) {
+	rename := make(map[string]string)
+
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimRight(s.Text(), "\r")
+		if line == "" {
+			continue
+		}
+
+		sep := ","
+		if strings.Contains(line, "\t") {
+			sep = "\t"
+		}
+		fields := strings.Split(line, sep)
+		if len(fields) != 2 {
+			return nil, errors.New("badly formatted line in rename file: " + line)
+		}
+
+		rename[fields[0]] = fields[1]
+	}
+	if s.Err() != nil {
+		return nil, s.Err()
+	}
+
+	return rename, nil
+}
@@ -0,0 +1,266 @@
+package snps
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// indexMagic starts every index file. Then come the number of samples and their names,
+// and the number of changes and, for each, its name and the bitset of the samples that
+// have it, packed 8 samples to a byte. Numbers and the lengths of names are uvarints
+var indexMagic = []byte("SNPSIDX\x01")
+
+// indexMaxName is the longest sample or change name that is read from an index, so that
+// a corrupt length is an error rather than an allocation of that size
+const indexMaxName = 1 << 20
+
+// Index records which samples have which changes, so that an alignment only has to be
+// compared with the reference once to be searched many times. Samples are numbered in
+// the order they were in the alignment
+type Index struct {
+	Samples []string
+	changes []string // sorted by position then alternative allele
+	sets    map[string]bitset
+}
+
+// Changes returns the changes in the index, sorted by position then alternative allele
+func (idx *Index) Changes() []string {
+	return append([]string(nil), idx.changes...)
+}
+
+// Has returns whether each sample has change
+func (idx *Index) Has(change string) []bool {
+	has := make([]bool, len(idx.Samples))
+	if b, ok := idx.sets[change]; ok {
+		for i := range has {
+			has[i] = b.get(i)
+		}
+	}
+	return has
+}
+
+// WriteTo writes the index to w
+func (idx *Index) WriteTo(w io.Writer) (int64, error) {
+	bw := bufio.NewWriter(w)
+	cw := &byteCounter{w: bw}
+	buf := make([]byte, binary.MaxVarintLen64)
+	putUvarint := func(n int) {
+		cw.Write(buf[:binary.PutUvarint(buf, uint64(n))])
+	}
+	putString := func(s string) {
+		putUvarint(len(s))
+		io.WriteString(cw, s)
+	}
+
+	cw.Write(indexMagic)
+	putUvarint(len(idx.Samples))
+	for _, sample := range idx.Samples {
+		putString(sample)
+	}
+	putUvarint(len(idx.changes))
+	for _, change := range idx.changes {
+		putString(change)
+		cw.Write(idx.sets[change].pack(len(idx.Samples)))
+	}
+	if cw.err != nil {
+		return cw.n, cw.err
+	}
+	return cw.n, bw.Flush()
+}
+
+// ReadIndex reads an index written by Index.WriteTo. The lengths and counts in it aren't
+// trusted: names are checked against indexMaxName, and samples are read one at a time
+// rather than allocated by their count, so a corrupt index is an error
+func ReadIndex(r io.Reader) (*Index, error) {
+	br := bufio.NewReader(r)
+	bad := func(err error) (*Index, error) {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, fmt.Errorf("%w: %v", ErrBadIndex, err)
+	}
+
+	magic := make([]byte, len(indexMagic))
+	if _, err := io.ReadFull(br, magic); err != nil {
+		return bad(err)
+	}
+	if !bytes.Equal(magic, indexMagic) {
+		return nil, fmt.Errorf("%w: not an index", ErrBadIndex)
+	}
+	readString := func() (string, error) {
+		n, err := binary.ReadUvarint(br)
+		if err != nil {
+			return "", err
+		}
+		if n > indexMaxName {
+			return "", fmt.Errorf("a name of %d bytes is too long", n)
+		}
+		b := make([]byte, n)
+		_, err = io.ReadFull(br, b)
+		return string(b), err
+	}
+
+	n, err := binary.ReadUvarint(br)
+	if err != nil {
+		return bad(err)
+	}
+	idx := &Index{Samples: make([]string, 0, min(n, 1<<16)), sets: make(map[string]bitset)}
+	for i := uint64(0); i < n; i++ {
+		sample, err := readString()
+		if err != nil {
+			return bad(err)
+		}
+		idx.Samples = append(idx.Samples, sample)
+	}
+	n, err = binary.ReadUvarint(br)
+	if err != nil {
+		return bad(err)
+	}
+	packed := make([]byte, (len(idx.Samples)+7)/8)
+	for i := uint64(0); i < n; i++ {
+		change, err := readString()
+		if err != nil {
+			return bad(err)
+		}
+		if _, err := io.ReadFull(br, packed); err != nil {
+			return bad(err)
+		}
+		idx.changes = append(idx.changes, change)
+		idx.sets[change] = unpack(packed, len(idx.Samples))
+	}
+	return idx, nil
+}
+
+// byteCounter counts the bytes written to w, and keeps the first error
+type byteCounter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (cw *byteCounter) Write(p []byte) (int, error) {
+	if cw.err != nil {
+		return 0, cw.err
+	}
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	cw.err = err
+	return n, err
+}
+
+// bitset is a set of sample numbers
+type bitset []uint64
+
+func newBitset(n int) bitset {
+	return make(bitset, (n+63)/64)
+}
+
+func (b bitset) set(i int) {
+	b[i/64] |= 1 << uint(i%64)
+}
+
+func (b bitset) get(i int) bool {
+	return b[i/64]&(1<<uint(i%64)) != 0
+}
+
+// and returns a new set of the elements in both b and c
+func (b bitset) and(c bitset) bitset {
+	d := make(bitset, len(b))
+	for i := range b {
+		d[i] = b[i] & c[i]
+	}
+	return d
+}
+
+// or returns a new set of the elements in either b or c
+func (b bitset) or(c bitset) bitset {
+	d := make(bitset, len(b))
+	for i := range b {
+		d[i] = b[i] | c[i]
+	}
+	return d
+}
+
+// not returns a new set of the elements less than n that aren't in b
+func (b bitset) not(n int) bitset {
+	d := make(bitset, len(b))
+	for i := range b {
+		d[i] = ^b[i]
+	}
+	if n%64 != 0 {
+		d[len(d)-1] &= 1<<uint(n%64) - 1
+	}
+	return d
+}
+
+// pack returns the first n bits of b, 8 to a byte
+func (b bitset) pack(n int) []byte {
+	packed := make([]byte, (n+7)/8)
+	for i := range packed {
+		packed[i] = byte(b[i/8] >> uint(8*(i%8)))
+	}
+	return packed
+}
+
+// unpack is the inverse of pack
+func unpack(packed []byte, n int) bitset {
+	b := newBitset(n)
+	for i, p := range packed {
+		b[i/8] |= uint64(p) << uint(8*(i%8))
+	}
+	return b
+}
+
+// indexWriter builds an index of the SNPs in each record, and writes it once they have
+// all been seen
+type indexWriter struct {
+	w       io.Writer
+	samples []string
+	changes map[string][]int // the samples that have each change, in order
+}
+
+func newIndexWriter(w io.Writer, opts WriterOptions) OutputWriter {
+	return &indexWriter{w: w, changes: make(map[string][]int)}
+}
+
+func (iw *indexWriter) WriteHeader() error {
+	return nil
+}
+
+func (iw *indexWriter) WriteRecord(record Record) error {
+	for _, snp := range record.SNPs {
+		iw.changes[snp.String()] = append(iw.changes[snp.String()], len(iw.samples))
+	}
+	iw.samples = append(iw.samples, record.Query)
+	return nil
+}
+
+func (iw *indexWriter) NeedsAggregate() bool {
+	return true
+}
+
+func (iw *indexWriter) WriteAggregate(agg Aggregate) error {
+	idx := &Index{Samples: iw.samples, sets: make(map[string]bitset, len(iw.changes))}
+	// the aggregate's changes are already sorted, and may include missing data too
+	for _, change := range agg.Changes {
+		samples, ok := iw.changes[change.SNP.String()]
+		if !ok {
+			continue
+		}
+		b := newBitset(len(iw.samples))
+		for _, i := range samples {
+			b.set(i)
+		}
+		idx.changes = append(idx.changes, change.SNP.String())
+		idx.sets[change.SNP.String()] = b
+	}
+	_, err := idx.WriteTo(iw.w)
+	return err
+}
+
+func (iw *indexWriter) Close() error {
+	return nil
+}
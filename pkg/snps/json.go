@@ -0,0 +1,126 @@
+package snps
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+)
+
+// jsonWriter writes each query as a JSON object, with its SNPs as an array of objects
+// rather than joined into one string, e.g. to index them in a search engine. The objects
+// are the elements of one array, or, if ndjson is true, newline-delimited JSON: one
+// object per line, which can be streamed. The options that add columns to csv output
+// add the same fields, which are left out where they are empty
+type jsonWriter struct {
+	w       *bufio.Writer
+	opts    WriterOptions
+	ndjson  bool
+	records int
+}
+
+// jsonRecord is the JSON object of a query
+type jsonRecord struct {
+	Query       string    `json:"query"`
+	Contig      string    `json:"contig,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Source      string    `json:"source,omitempty"`
+	Date        string    `json:"date,omitempty"`
+	Lineage     string    `json:"lineage,omitempty"`
+	SNPs        []jsonSNP `json:"snps"`
+	Ambiguities []jsonSNP `json:"ambiguities,omitempty"`
+	Resolutions []jsonSNP `json:"resolutions,omitempty"`
+	Missing     []jsonSNP `json:"missing,omitempty"`
+}
+
+// jsonSNP is the JSON object of a SNP
+type jsonSNP struct {
+	Contig     string `json:"contig,omitempty"`
+	Position   int    `json:"position"`
+	Ref        string `json:"ref"`
+	Alt        string `json:"alt"`
+	Annotation string `json:"annotation,omitempty"`
+}
+
+func newJSONWriter(w io.Writer, opts WriterOptions) OutputWriter {
+	return &jsonWriter{w: bufio.NewWriter(w), opts: opts}
+}
+
+func newNDJSONWriter(w io.Writer, opts WriterOptions) OutputWriter {
+	return &jsonWriter{w: bufio.NewWriter(w), opts: opts, ndjson: true}
+}
+
+func (jw *jsonWriter) WriteHeader() error {
+	if jw.ndjson {
+		return nil
+	}
+	_, err := jw.w.WriteString("[")
+	return err
+}
+
+// jsonSNPs returns the JSON objects of SNPs, with their annotations if annotated
+func jsonSNPs(SNPs []SNP, annotated bool) []jsonSNP {
+	objects := make([]jsonSNP, len(SNPs))
+	for i, snp := range SNPs {
+		objects[i] = jsonSNP{Contig: snp.Contig, Position: snp.Position, Ref: snp.Ref, Alt: snp.Alt}
+		if annotated {
+			objects[i].Annotation = snp.Annotation
+		}
+	}
+	return objects
+}
+
+func (jw *jsonWriter) WriteRecord(record Record) error {
+	object := jsonRecord{Query: record.Query, SNPs: jsonSNPs(record.SNPs, jw.opts.Annotated)}
+	if jw.opts.Contigs {
+		object.Contig = record.Contig
+	}
+	if jw.opts.Description {
+		object.Description = record.Description
+	}
+	if jw.opts.Source {
+		object.Source = record.Source
+	}
+	if jw.opts.Dates && !record.Date.IsZero() {
+		object.Date = record.Date.Format("2006-01-02")
+	}
+	if jw.opts.Lineages {
+		object.Lineage = record.Lineage
+	}
+	if jw.opts.Ambiguities {
+		object.Ambiguities = jsonSNPs(record.Ambiguities, false)
+	}
+	if jw.opts.Resolutions {
+		object.Resolutions = jsonSNPs(record.Resolutions, false)
+	}
+	if jw.opts.Missing {
+		object.Missing = jsonSNPs(record.Missing, false)
+	}
+
+	value, err := json.Marshal(object)
+	if err != nil {
+		return err
+	}
+	if jw.ndjson {
+		_, err = jw.w.Write(append(value, '\n'))
+		return err
+	}
+	sep := ",\n  "
+	if jw.records == 0 {
+		sep = "\n  "
+	}
+	jw.records++
+	_, err = jw.w.WriteString(sep + string(value))
+	return err
+}
+
+func (jw *jsonWriter) WriteAggregate(Aggregate) error {
+	if jw.ndjson {
+		return nil
+	}
+	_, err := jw.w.WriteString("\n]\n")
+	return err
+}
+
+func (jw *jsonWriter) Close() error {
+	return jw.w.Flush()
+}
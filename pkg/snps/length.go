@@ -0,0 +1,66 @@
+package snps
+
+import (
+	"fmt"
+
+	"github.com/benjamincjackson/snps/pkg/fastaio"
+)
+
+// What to do with queries whose length differs from the reference's. By default a query
+// longer than the reference is an error, and a shorter one is compared as far as it goes
+const (
+	LengthMismatchError    = "error"    // either is an error
+	LengthMismatchSkip     = "skip"     // either is skipped, with a warning
+	LengthMismatchPad      = "pad"      // shorter queries are padded with N; longer ones are an error
+	LengthMismatchTruncate = "truncate" // longer queries are cut to the reference's length
+)
+
+// checkLengthMismatch returns an error if policy isn't one of the LengthMismatch
+// constants or ""
+func checkLengthMismatch(policy string) error {
+	switch policy {
+	case "", LengthMismatchError, LengthMismatchSkip, LengthMismatchPad, LengthMismatchTruncate:
+		return nil
+	}
+	return fmt.Errorf("%w for length mismatches: %s (should be error, skip, pad or truncate)", ErrUnknownPolicy, policy)
+}
+
+// resolveLength applies opts.LengthMismatch to FR's sequence, given the reference's
+// length. It returns the sequence to compare, which is a copy if it had to be padded, or
+// false if FR should be skipped
+func (opts Options) resolveLength(FR fastaio.EncodedFastaRecord, refLength int) ([]byte, bool, error) {
+	seq := FR.Seq
+	if len(seq) == refLength {
+		return seq, true, nil
+	}
+
+	mismatch := &RecordError{Record: FR.ID, Index: FR.Idx + 1, Err: fmt.Errorf("%w: %d bases, not %d", ErrLengthMismatch, len(seq), refLength)}
+
+	switch opts.LengthMismatch {
+	case LengthMismatchError:
+		return nil, false, mismatch
+	case LengthMismatchSkip:
+		if opts.Warn != nil {
+			opts.Warn("skipping " + mismatch.Error())
+		}
+		return nil, false, nil
+	case LengthMismatchTruncate:
+		if len(seq) > refLength {
+			seq = seq[:refLength]
+		}
+		return seq, true, nil
+	}
+
+	if len(seq) > refLength {
+		return nil, false, mismatch
+	}
+	if opts.LengthMismatch == LengthMismatchPad {
+		padded := make([]byte, refLength)
+		copy(padded, seq)
+		for i := len(seq); i < refLength; i++ {
+			padded[i] = 240
+		}
+		seq = padded
+	}
+	return seq, true, nil
+}
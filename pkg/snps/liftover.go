@@ -0,0 +1,356 @@
+package snps
+
+import (
+	"bufio"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/benjamincjackson/snps/pkg/encoding"
+)
+
+// anchorLength is the length of the k-mers, found once in each reference, that anchor
+// the alignment of two references
+const anchorLength = 16
+
+// maxGapCells is the largest number of cells of the dynamic programming matrix for the
+// stretch between two anchors. Longer stretches are aligned without indels
+const maxGapCells = 16 << 20
+
+// RefDifference is a difference between two references, A and B: a substitution of
+// AlleleA at PositionA for AlleleB at PositionB, a deletion from B of AlleleA, which
+// starts at PositionA and follows PositionB, or an insertion into B of AlleleB, which
+// starts at PositionB and follows PositionA. Positions are 1-based, and a deletion or
+// insertion at the start of a reference follows position 0 of the other
+type RefDifference struct {
+	Type      string
+	PositionA int
+	AlleleA   string
+	PositionB int
+	AlleleB   string
+}
+
+// The types of RefDifference
+const (
+	DifferenceSubstitution = "substitution"
+	DifferenceInsertion    = "insertion"
+	DifferenceDeletion     = "deletion"
+)
+
+// Liftover maps the records of one reference, A, onto another, B, e.g. an update of it,
+// from an alignment of the two. The alignment is anchored on the k-mers that occur once
+// in each reference, in the order they are found in both, and the stretches between
+// them are aligned base by base, so the references should be mostly similar
+type Liftover struct {
+	refB        []byte
+	DA          []string
+	positions   []int // the position in B of each position in A, or 0 if it was deleted
+	differences []RefDifference
+	unlifted    int
+}
+
+// NewLiftover aligns refA and refB, which were read by ReadReference
+func NewLiftover(refA []byte, refB []byte) *Liftover {
+	DA := encoding.MakeDecodingArray()
+	decode := func(seq []byte) string {
+		var sb strings.Builder
+		for _, nuc := range seq {
+			sb.WriteString(DA[nuc])
+		}
+		return sb.String()
+	}
+
+	lo := &Liftover{refB: refB, DA: DA, positions: make([]int, len(refA))}
+	ops := alignReferences(refA, refB)
+	i, j := 0, 0
+	for k := 0; k < len(ops); {
+		switch ops[k] {
+		case 'M':
+			lo.positions[i] = j + 1
+			if refA[i] != refB[j] {
+				lo.differences = append(lo.differences, RefDifference{Type: DifferenceSubstitution, PositionA: i + 1, AlleleA: DA[refA[i]], PositionB: j + 1, AlleleB: DA[refB[j]]})
+			}
+			i, j, k = i+1, j+1, k+1
+		case 'D':
+			start := i
+			for ; k < len(ops) && ops[k] == 'D'; k++ {
+				i++
+			}
+			lo.differences = append(lo.differences, RefDifference{Type: DifferenceDeletion, PositionA: start + 1, AlleleA: decode(refA[start:i]), PositionB: j})
+		case 'I':
+			start := j
+			for ; k < len(ops) && ops[k] == 'I'; k++ {
+				j++
+			}
+			lo.differences = append(lo.differences, RefDifference{Type: DifferenceInsertion, PositionA: i, PositionB: start + 1, AlleleB: decode(refB[start:j])})
+		}
+	}
+	return lo
+}
+
+// Differences returns the differences between the references, in order along them
+func (lo *Liftover) Differences() []RefDifference {
+	return lo.differences
+}
+
+// Position returns the position in B of a position in A, or 0 if it was deleted from B
+func (lo *Liftover) Position(pos int) int {
+	if pos < 1 || pos > len(lo.positions) {
+		return 0
+	}
+	return lo.positions[pos-1]
+}
+
+// Unlifted returns the number of SNPs that have been dropped from the records lifted
+// over so far, because their sites were deleted from B
+func (lo *Liftover) Unlifted() int {
+	return lo.unlifted
+}
+
+// lift moves record's SNPs, and its ambiguities, resolutions and missing sites, to their
+// positions in B, with B's bases as their reference alleles. Those that B has the same
+// base as the query at are dropped, and the query gets a SNP at each site where A and B
+// differ and it had A's base, i.e. nothing was recorded there. Resolutions of sites
+// that are A, C, G or T in B become SNPs, if the query differs from B there. Columns
+// that depend on A's sequence, e.g. annotations and clusters, are cleared
+func (lo *Liftover) lift(record Record) Record {
+	recorded := make(map[int]bool)
+	for _, SNPs := range [][]SNP{record.SNPs, record.Ambiguities, record.Resolutions, record.Missing} {
+		for _, snp := range SNPs {
+			recorded[snp.Position] = true
+		}
+	}
+
+	SNPs := lo.liftSNPs(record.SNPs, true)
+	resolutions := make([]SNP, 0)
+	for _, snp := range lo.liftSNPs(record.Resolutions, false) {
+		if isACGT(snp.Ref) {
+			SNPs = append(SNPs, snp)
+		} else {
+			resolutions = append(resolutions, snp)
+		}
+	}
+	for _, d := range lo.differences {
+		if d.Type == DifferenceSubstitution && !recorded[d.PositionA] && isACGT(d.AlleleA) && isACGT(d.AlleleB) {
+			SNPs = append(SNPs, SNP{Position: d.PositionB, Ref: d.AlleleB, Alt: d.AlleleA})
+		}
+	}
+	sort.SliceStable(SNPs, func(i, j int) bool {
+		return SNPs[i].Position < SNPs[j].Position
+	})
+
+	record.SNPs = SNPs
+	record.Distance = len(SNPs)
+	record.Ambiguities = lo.liftSNPs(record.Ambiguities, false)
+	record.Resolutions = resolutions
+	record.Missing = lo.liftSNPs(record.Missing, false)
+	record.Clusters, record.Segments, record.MissingRanges = nil, nil, nil
+	return record
+}
+
+// liftSNPs returns SNPs at their positions in B, leaving out those whose sites were
+// deleted from B (counting them if count is true) and those whose Alt is B's base
+func (lo *Liftover) liftSNPs(SNPs []SNP, count bool) []SNP {
+	lifted := make([]SNP, 0, len(SNPs))
+	for _, snp := range SNPs {
+		pos := lo.Position(snp.Position)
+		if pos == 0 {
+			if count {
+				lo.unlifted++
+			}
+			continue
+		}
+		ref := lo.DA[lo.refB[pos-1]]
+		if ref == snp.Alt {
+			continue
+		}
+		lifted = append(lifted, SNP{Position: pos, Ref: ref, Alt: snp.Alt})
+	}
+	return lifted
+}
+
+// alignReferences returns a global alignment of a and b, as one operation per column:
+// M if both have a base there, D if only a has and I if only b has
+func alignReferences(a []byte, b []byte) []byte {
+	ops := make([]byte, 0, len(a)+len(b))
+	i, j := 0, 0
+	for _, anchor := range chainAnchors(a, b) {
+		// anchors on the same diagonal overlap, so each starts where the last one ended
+		ai, bj, length := anchor[0], anchor[1], anchorLength
+		d := i - ai
+		if j-bj > d {
+			d = j - bj
+		}
+		if d > 0 {
+			ai, bj, length = ai+d, bj+d, length-d
+		}
+		if length <= 0 {
+			continue
+		}
+		ops = append(ops, alignGap(a[i:ai], b[j:bj])...)
+		for k := 0; k < length; k++ {
+			ops = append(ops, 'M')
+		}
+		i, j = ai+length, bj+length
+	}
+	return append(ops, alignGap(a[i:], b[j:])...)
+}
+
+// chainAnchors returns the positions in a and b of the k-mers that occur once in each,
+// in the longest chain of them that is in the same order in both
+func chainAnchors(a []byte, b []byte) [][2]int {
+	positionsA := uniqueKmers(a)
+	positionsB := uniqueKmers(b)
+	anchors := make([][2]int, 0)
+	eachKmer(b, func(j int, kmer uint32) {
+		if i, ok := positionsA[kmer]; ok && i >= 0 && positionsB[kmer] == j {
+			anchors = append(anchors, [2]int{i, j})
+		}
+	})
+
+	// the anchors are in order in b, so the chain is their longest increasing
+	// subsequence in a
+	tails := make([]int, 0)
+	prev := make([]int, len(anchors))
+	for n, anchor := range anchors {
+		k := sort.Search(len(tails), func(k int) bool {
+			return anchors[tails[k]][0] >= anchor[0]
+		})
+		prev[n] = -1
+		if k > 0 {
+			prev[n] = tails[k-1]
+		}
+		if k == len(tails) {
+			tails = append(tails, n)
+		} else {
+			tails[k] = n
+		}
+	}
+	chain := make([][2]int, len(tails))
+	if len(tails) == 0 {
+		return chain
+	}
+	for n, k := tails[len(tails)-1], len(tails)-1; k >= 0; n, k = prev[n], k-1 {
+		chain[k] = anchors[n]
+	}
+	return chain
+}
+
+// uniqueKmers returns the position of each k-mer of seq, or -1 if it occurs more than once
+func uniqueKmers(seq []byte) map[uint32]int {
+	positions := make(map[uint32]int)
+	eachKmer(seq, func(i int, kmer uint32) {
+		if _, ok := positions[kmer]; ok {
+			positions[kmer] = -1
+		} else {
+			positions[kmer] = i
+		}
+	})
+	return positions
+}
+
+// eachKmer calls f with the start of each k-mer of seq that is all A, C, G or T, packed
+// into two bits a base
+func eachKmer(seq []byte, f func(int, uint32)) {
+	EA := encoding.MakeEncodingArray()
+	codes := map[byte]uint32{EA['A']: 0, EA['C']: 1, EA['G']: 2, EA['T']: 3}
+	var kmer uint32
+	run := 0
+	for i, nuc := range seq {
+		code, ok := codes[nuc]
+		if !ok {
+			run = 0
+			continue
+		}
+		kmer = kmer<<2 | code
+		run++
+		if run >= anchorLength {
+			f(i-anchorLength+1, kmer)
+		}
+	}
+}
+
+// alignGap returns a global alignment of a and b, which are the stretch between two
+// anchors, by Needleman-Wunsch with linear gap penalties, or without indels (matching
+// bases up as far as the shorter goes) if it would take too much memory
+func alignGap(a []byte, b []byte) []byte {
+	n, m := len(a), len(b)
+	ops := make([]byte, 0, n+m)
+	if n == 0 || m == 0 || (n+1)*(m+1) > maxGapCells {
+		for k := 0; k < n && k < m; k++ {
+			ops = append(ops, 'M')
+		}
+		for k := m; k < n; k++ {
+			ops = append(ops, 'D')
+		}
+		for k := n; k < m; k++ {
+			ops = append(ops, 'I')
+		}
+		return ops
+	}
+
+	const match, mismatch, gap = 1, -1, -2
+	// score is one row of the matrix, which is filled in place, and trace is the whole of
+	// it, for the traceback
+	score := make([]int, m+1)
+	trace := make([]byte, (n+1)*(m+1))
+	for j := 1; j <= m; j++ {
+		score[j] = j * gap
+		trace[j] = 'I'
+	}
+	for i := 1; i <= n; i++ {
+		diag := score[0]
+		score[0] = i * gap
+		trace[i*(m+1)] = 'D'
+		for j := 1; j <= m; j++ {
+			s, op := diag+mismatch, byte('M')
+			if a[i-1] == b[j-1] {
+				s = diag + match
+			}
+			if up := score[j] + gap; up > s {
+				s, op = up, 'D'
+			}
+			if left := score[j-1] + gap; left > s {
+				s, op = left, 'I'
+			}
+			diag = score[j]
+			score[j] = s
+			trace[i*(m+1)+j] = op
+		}
+	}
+
+	for i, j := n, m; i > 0 || j > 0; {
+		op := trace[i*(m+1)+j]
+		ops = append(ops, op)
+		switch op {
+		case 'M':
+			i, j = i-1, j-1
+		case 'D':
+			i--
+		case 'I':
+			j--
+		}
+	}
+	for l, r := 0, len(ops)-1; l < r; l, r = l+1, r-1 {
+		ops[l], ops[r] = ops[r], ops[l]
+	}
+	return ops
+}
+
+// WriteRefDifferences writes the differences between two references in csv format, one
+// line per difference
+func WriteRefDifferences(w io.Writer, differences []RefDifference) error {
+	bw := bufio.NewWriter(w)
+	_, err := bw.WriteString("type,position_a,allele_a,position_b,allele_b\n")
+	if err != nil {
+		return err
+	}
+	for _, d := range differences {
+		_, err := bw.WriteString(d.Type + "," + strconv.Itoa(d.PositionA) + "," + d.AlleleA + "," + strconv.Itoa(d.PositionB) + "," + d.AlleleB + "\n")
+		if err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,61 @@
+package snps
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// longWriter writes the SNPs in tidy (long) form, as tab-separated values with one line
+// per SNP of each query, so that they can be loaded into R or pandas without splitting
+// the SNPs column of csv output. If the reference is made up of contigs each SNP's
+// contig is written after the query, and if it is annotated its amino acid consequences
+// are written after the alternative allele. Queries without SNPs have no lines
+type longWriter struct {
+	w         *bufio.Writer
+	contigs   bool
+	annotated bool
+}
+
+func newLongWriter(w io.Writer, opts WriterOptions) OutputWriter {
+	return &longWriter{w: bufio.NewWriter(w), contigs: opts.Contigs, annotated: opts.Annotated}
+}
+
+func (lw *longWriter) WriteHeader() error {
+	columns := []string{"query"}
+	if lw.contigs {
+		columns = append(columns, "contig")
+	}
+	columns = append(columns, "position", "ref", "alt")
+	if lw.annotated {
+		columns = append(columns, "annotation")
+	}
+	_, err := lw.w.WriteString(strings.Join(columns, "\t") + "\n")
+	return err
+}
+
+func (lw *longWriter) WriteRecord(record Record) error {
+	for _, snp := range record.SNPs {
+		fields := []string{record.Query}
+		if lw.contigs {
+			fields = append(fields, snp.Contig)
+		}
+		fields = append(fields, strconv.Itoa(snp.Position), snp.Ref, snp.Alt)
+		if lw.annotated {
+			fields = append(fields, snp.Annotation)
+		}
+		if _, err := lw.w.WriteString(strings.Join(fields, "\t") + "\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (lw *longWriter) WriteAggregate(Aggregate) error {
+	return nil
+}
+
+func (lw *longWriter) Close() error {
+	return lw.w.Flush()
+}
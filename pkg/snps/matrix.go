@@ -0,0 +1,215 @@
+package snps
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// The layouts that distance matrices can be written in
+const (
+	// LayoutSquare is a csv of the whole matrix, with a header of query names
+	LayoutSquare = "square"
+	// LayoutLower is LayoutSquare with only the distances below the diagonal in each row
+	LayoutLower = "lower"
+	// LayoutPhylip is PHYLIP's square distance matrix format: the number of queries on
+	// the first line, then a line per query of its name and distances, separated by spaces
+	LayoutPhylip = "phylip"
+	// LayoutLong is a csv of each pair of queries and the distance between them
+	LayoutLong = "long"
+)
+
+// MatrixLayouts are the layouts that distance matrices can be written in
+var MatrixLayouts = []string{LayoutSquare, LayoutLower, LayoutPhylip, LayoutLong}
+
+// distanceWriter writes the matrix of pairwise SNP distances between the queries: the
+// number of SNPs that one query of each pair has and the other hasn't. Missing data is
+// ignored, so this is only a good estimate of the distance between sequences without
+// much of it. The matrix is written in one of the MatrixLayouts, by default square
+type distanceWriter struct {
+	w       *bufio.Writer
+	layout  string
+	queries []string
+	SNPs    [][]string // each query's SNPs, sorted
+}
+
+func newDistanceWriter(w io.Writer, opts WriterOptions) OutputWriter {
+	layout := opts.MatrixLayout
+	if layout == "" {
+		layout = LayoutSquare
+	}
+	return &distanceWriter{w: bufio.NewWriter(w), layout: layout}
+}
+
+// the header is written with the matrix
+func (dw *distanceWriter) WriteHeader() error {
+	return nil
+}
+
+func (dw *distanceWriter) WriteRecord(record Record) error {
+	SNPs := make([]string, len(record.SNPs))
+	for i, snp := range record.SNPs {
+		SNPs[i] = snp.String()
+	}
+	sort.Strings(SNPs)
+	dw.queries = append(dw.queries, record.Query)
+	dw.SNPs = append(dw.SNPs, SNPs)
+	return nil
+}
+
+func (dw *distanceWriter) WriteAggregate(Aggregate) error {
+	n := len(dw.queries)
+	distances := make([][]int, n)
+	for i := range distances {
+		distances[i] = make([]int, n)
+		for j := 0; j < i; j++ {
+			distances[i][j] = snpDistance(dw.SNPs[i], dw.SNPs[j])
+			distances[j][i] = distances[i][j]
+		}
+	}
+
+	lines := make([]string, 0, n+1)
+	switch dw.layout {
+	case LayoutSquare, LayoutLower:
+		header := "query"
+		for _, query := range dw.queries {
+			header += "," + csvField(query)
+		}
+		lines = append(lines, header)
+		for i, query := range dw.queries {
+			row := distances[i]
+			if dw.layout == LayoutLower {
+				row = row[:i]
+			}
+			line := csvField(query)
+			for _, d := range row {
+				line += "," + strconv.Itoa(d)
+			}
+			lines = append(lines, line)
+		}
+	case LayoutPhylip:
+		lines = append(lines, strconv.Itoa(n))
+		for i, query := range dw.queries {
+			// names are padded to PHYLIP's 10 characters, and longer ones are kept whole,
+			// as relaxed PHYLIP readers expect
+			line := fmt.Sprintf("%-10s", query)
+			for _, d := range distances[i] {
+				line += " " + strconv.Itoa(d)
+			}
+			lines = append(lines, line)
+		}
+	case LayoutLong:
+		lines = append(lines, "query_a,query_b,distance")
+		for i := range dw.queries {
+			for j := i + 1; j < n; j++ {
+				lines = append(lines, csvField(dw.queries[i])+","+csvField(dw.queries[j])+","+strconv.Itoa(distances[i][j]))
+			}
+		}
+	default:
+		return fmt.Errorf("%w: unknown matrix layout %s", ErrUnknownFormat, dw.layout)
+	}
+
+	for _, line := range lines {
+		_, err := dw.w.WriteString(line + "\n")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (dw *distanceWriter) Close() error {
+	return dw.w.Flush()
+}
+
+// snpDistance returns the size of the symmetric difference of two sorted lists of SNPs
+func snpDistance(a []string, b []string) int {
+	d := 0
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			i++
+			j++
+		case a[i] < b[j]:
+			d++
+			i++
+		default:
+			d++
+			j++
+		}
+	}
+	return d + len(a) - i + len(b) - j
+}
+
+// presenceWriter writes a matrix of which queries have which SNPs, with a row per query
+// and a column per SNP, holding 1 if the query has it and 0 if it hasn't
+type presenceWriter struct {
+	w       *bufio.Writer
+	queries []string
+	SNPs    []map[string]bool
+}
+
+func newPresenceWriter(w io.Writer, opts WriterOptions) OutputWriter {
+	return &presenceWriter{w: bufio.NewWriter(w)}
+}
+
+// the header depends on all the SNPs, so it is written with the matrix
+func (pw *presenceWriter) WriteHeader() error {
+	return nil
+}
+
+func (pw *presenceWriter) WriteRecord(record Record) error {
+	SNPs := make(map[string]bool, len(record.SNPs))
+	for _, snp := range record.SNPs {
+		SNPs[snp.String()] = true
+	}
+	pw.queries = append(pw.queries, record.Query)
+	pw.SNPs = append(pw.SNPs, SNPs)
+	return nil
+}
+
+func (pw *presenceWriter) NeedsAggregate() bool {
+	return true
+}
+
+func (pw *presenceWriter) WriteAggregate(agg Aggregate) error {
+	columns := make([]string, 0, len(agg.Changes))
+	for _, change := range agg.Changes {
+		// aggregates count missing data too, if it was looked for
+		if change.SNP.Alt != "N" && change.SNP.Alt != "?" {
+			columns = append(columns, change.SNP.String())
+		}
+	}
+
+	header := "query"
+	for _, column := range columns {
+		header += "," + column
+	}
+	_, err := pw.w.WriteString(header + "\n")
+	if err != nil {
+		return err
+	}
+
+	for i, query := range pw.queries {
+		line := csvField(query)
+		for _, column := range columns {
+			if pw.SNPs[i][column] {
+				line += ",1"
+			} else {
+				line += ",0"
+			}
+		}
+		_, err := pw.w.WriteString(line + "\n")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (pw *presenceWriter) Close() error {
+	return pw.w.Flush()
+}
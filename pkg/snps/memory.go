@@ -0,0 +1,150 @@
+package snps
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+
+	"github.com/benjamincjackson/snps/pkg/encoding"
+	"github.com/benjamincjackson/snps/pkg/fastaio"
+)
+
+// Sequence is a query held in memory, as IUPAC codes, e.g. []byte("ACGTN"). Description
+// is its whole header line, as in a fasta file, which is taken to be its ID if it is ""
+type Sequence struct {
+	ID          string
+	Description string
+	Seq         []byte
+}
+
+// Compare returns the SNPs between ref and query, which are held in memory as IUPAC
+// codes, with everything else that opts asks for, e.g. annotations. It is CompareAll for
+// a single query with no ID
+func Compare(ref []byte, query []byte, opts Options) ([]SNP, error) {
+	records, err := CompareAll(ref, []Sequence{{Seq: query}}, opts)
+	if err != nil || len(records) == 0 {
+		return nil, err
+	}
+	return records[0].SNPs, nil
+}
+
+// CompareAll compares each of queries with ref, which are held in memory as IUPAC codes,
+// and returns their records in the same order, for embedding snps where the sequences
+// are already in memory, without readers, writers or channels. Queries that opts filters
+// out aren't returned, and characters that aren't IUPAC codes, gaps or ? are an error.
+// Queries are compared in parallel. opts.Core is applied as it is by Run, once every
+// query has been compared. opts.Limit and opts.MaxMemory are ignored, since the
+// sequences are already in memory. Queries are only compared with ref: RunContigs
+// compares them with contigs
+func CompareAll(ref []byte, queries []Sequence, opts Options) ([]Record, error) {
+	if err := checkQuestionMarks(opts.QuestionMarks); err != nil {
+		return nil, err
+	}
+	if err := opts.checkCore(); err != nil {
+		return nil, err
+	}
+	if err := checkLengthMismatch(opts.LengthMismatch); err != nil {
+		return nil, err
+	}
+	EA := encoding.MakeEncodingArray()
+	if opts.HardGaps {
+		EA = encoding.MakeEncodingArrayHardGaps()
+	}
+	refSeq, bad := encode(ref, EA)
+	if bad > 0 {
+		return nil, &RecordError{Record: "reference", Index: 1, Position: bad, Err: fmt.Errorf("%w in the reference", ErrInvalidChar)}
+	}
+	refSeq, err := opts.resolveQuestionMarks(refSeq, "", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := make([]snpLine, len(queries))
+	errs := make([]error, len(queries))
+	workers := runtime.NumCPU()
+	if workers > len(queries) {
+		workers = len(queries)
+	}
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func(w int) {
+			defer wg.Done()
+			c := newComparer()
+			for i := w; i < len(queries); i += workers {
+				seq, bad := encode(queries[i].Seq, EA)
+				if bad > 0 {
+					errs[i] = &RecordError{Record: queries[i].ID, Index: i + 1, Position: bad, Err: ErrInvalidChar}
+					continue
+				}
+				description := queries[i].Description
+				if description == "" {
+					description = queries[i].ID
+				}
+				FR := fastaio.EncodedFastaRecord{ID: queries[i].ID, Description: description, Seq: seq, Idx: i}
+				lines[i], errs[i] = c.compare(refSeq, FR, opts)
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	records := make([]Record, 0, len(queries))
+	for i, SL := range lines {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		if !SL.skip {
+			records = append(records, SL.Record)
+		}
+	}
+	if opts.Core > 0 {
+		rc := &recordCollector{}
+		cw := newCoreWriter(rc, opts.Core, len(refSeq))
+		for _, record := range records {
+			cw.WriteRecord(record)
+		}
+		cw.WriteAggregate(Aggregate{})
+		records = rc.records
+	}
+	return records, nil
+}
+
+// recordCollector is an OutputWriter that keeps the records it is given, for CompareAll
+// to pass its records through coreWriter
+type recordCollector struct {
+	records []Record
+}
+
+func (rc *recordCollector) WriteHeader() error { return nil }
+
+func (rc *recordCollector) WriteRecord(record Record) error {
+	rc.records = append(rc.records, record)
+	return nil
+}
+
+func (rc *recordCollector) WriteAggregate(Aggregate) error { return nil }
+
+func (rc *recordCollector) Close() error { return nil }
+
+// AggregateRecords returns the number of records that have each change, as aggregate
+// output counts them, e.g. for records from CompareAll
+func AggregateRecords(records []Record) Aggregate {
+	a := newAggregator()
+	for _, record := range records {
+		a.add(record)
+	}
+	return a.aggregate()
+}
+
+// encode returns seq in Paradis' encoding, using EA, and the 1-based position
+// of its first character that EA has no encoding for, or 0 if there isn't one
+func encode(seq []byte, EA []byte) ([]byte, int) {
+	encoded := make([]byte, len(seq))
+	for i, nuc := range seq {
+		encoded[i] = EA[nuc]
+		if encoded[i] == 0 {
+			return nil, i + 1
+		}
+	}
+	return encoded, 0
+}
@@ -0,0 +1,149 @@
+package snps
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"strings"
+)
+
+// ReadGroups reads a metadata table and returns the value of its groupColumn for each
+// ID in its idColumn, to use as Options.Groups. If idColumn is empty, IDs are in the
+// first column. The table can be comma or tab separated, and must have a header
+func ReadGroups(r io.Reader, idColumn string, groupColumn string) (map[string]string, error) {
+	rows, err := readTable(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, errors.New("metadata is empty")
+	}
+
+	header := rows[0]
+
+	idIdx := 0
+	groupIdx := -1
+	for i, name := range header {
+		if idColumn != "" && name == idColumn {
+			idIdx = i
+		}
+		if name == groupColumn {
+			groupIdx = i
+		}
+	}
+	if idColumn != "" && header[idIdx] != idColumn {
+		return nil, errors.New("metadata has no " + idColumn + " column")
+	}
+	if groupIdx == -1 {
+		return nil, errors.New("metadata has no " + groupColumn + " column")
+	}
+
+	groups := make(map[string]string)
+	for _, row := range rows[1:] {
+		if idIdx >= len(row) || groupIdx >= len(row) {
+			continue
+		}
+		groups[row[idIdx]] = row[groupIdx]
+	}
+
+	return groups, nil
+}
+
+// Metadata is a table of metadata about the queries, for output formats that carry it
+// through, e.g. auspice. Columns are the names of its columns other than the ID column, in
+// order, and Values maps each ID to its row's values of them
+type Metadata struct {
+	Columns []string
+	Values  map[string]map[string]string
+}
+
+// ReadMetadata reads a metadata table like ReadGroups does, and returns its columns, or
+// only those named in columns if it isn't empty
+func ReadMetadata(r io.Reader, idColumn string, columns []string) (Metadata, error) {
+	rows, err := readTable(r)
+	if err != nil {
+		return Metadata{}, err
+	}
+	if len(rows) == 0 {
+		return Metadata{}, errors.New("metadata is empty")
+	}
+
+	header := rows[0]
+
+	idIdx := 0
+	if idColumn != "" {
+		idIdx = -1
+		for i, name := range header {
+			if name == idColumn {
+				idIdx = i
+			}
+		}
+		if idIdx == -1 {
+			return Metadata{}, errors.New("metadata has no " + idColumn + " column")
+		}
+	}
+
+	indices := make([]int, 0, len(header))
+	if len(columns) == 0 {
+		for i := range header {
+			if i != idIdx {
+				indices = append(indices, i)
+			}
+		}
+	}
+	for _, column := range columns {
+		found := false
+		for i, name := range header {
+			if name == column {
+				indices = append(indices, i)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return Metadata{}, errors.New("metadata has no " + column + " column")
+		}
+	}
+
+	md := Metadata{Columns: make([]string, len(indices)), Values: make(map[string]map[string]string)}
+	for j, i := range indices {
+		md.Columns[j] = header[i]
+	}
+	for _, row := range rows[1:] {
+		if idIdx >= len(row) {
+			continue
+		}
+		values := make(map[string]string)
+		for j, i := range indices {
+			if i < len(row) {
+				values[md.Columns[j]] = row[i]
+			}
+		}
+		md.Values[row[idIdx]] = values
+	}
+
+	return md, nil
+}
+
+// readTable reads all of a comma or tab separated table. It is tab separated if its
+// first line has a tab in it
+func readTable(r io.Reader) ([][]string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	firstLine := string(data)
+	if i := strings.IndexByte(firstLine, '\n'); i >= 0 {
+		firstLine = firstLine[:i]
+	}
+
+	cr := csv.NewReader(strings.NewReader(string(data)))
+	cr.FieldsPerRecord = -1
+	if strings.Contains(firstLine, "\t") {
+		cr.Comma = '\t'
+		cr.LazyQuotes = true
+	}
+
+	return cr.ReadAll()
+}
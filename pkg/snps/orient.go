@@ -0,0 +1,52 @@
+package snps
+
+import (
+	"github.com/benjamincjackson/snps/pkg/fastaio"
+)
+
+// orientSites is the largest number of sites, evenly spaced along the sequence, that a
+// query is compared with the reference at in each orientation to decide which it is in
+const orientSites = 2000
+
+// orient returns FR's sequence reverse-complemented, and true, if it looks like the
+// reverse complement of refSeq: if, at the sites checked where both are A, C, G or T,
+// it differs from the reference at less than half as many sites reverse-complemented as
+// it does as it is. Otherwise it returns the sequence unchanged. The reverse complement
+// is a copy
+func orient(refSeq []byte, FR fastaio.EncodedFastaRecord, CA []byte) ([]byte, bool) {
+	seq := FR.Seq
+	n := len(seq)
+	if len(refSeq) < n {
+		n = len(refSeq)
+	}
+	if n == 0 {
+		return seq, false
+	}
+	step := n/orientSites + 1
+
+	forward, reverse := 0, 0
+	for i := 0; i < n; i += step {
+		if refSeq[i]&8 != 8 {
+			continue
+		}
+		if seq[i]&8 == 8 && seq[i] != refSeq[i] {
+			forward++
+		}
+		if rc := CA[seq[len(seq)-1-i]]; rc&8 == 8 && rc != refSeq[i] {
+			reverse++
+		}
+	}
+	if 2*reverse >= forward {
+		return seq, false
+	}
+	return reverseComplement(seq, CA), true
+}
+
+// reverseComplement returns a reverse-complemented copy of seq
+func reverseComplement(seq []byte, CA []byte) []byte {
+	rc := make([]byte, len(seq))
+	for i, nuc := range seq {
+		rc[len(seq)-1-i] = CA[nuc]
+	}
+	return rc
+}
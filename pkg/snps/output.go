@@ -0,0 +1,860 @@
+package snps
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SNP is one difference between a query sequence and the reference. If the reference
+// is annotated, Annotation is its amino acid consequence(s), and CodonPosition is where
+// it is in its codon(s), e.g. S:614:2. If the reference is made up of contigs, Contig is
+// the one that Position is in. If sites are weighted, Weight is the weight of its site,
+// and if they are scored, Score is the score of its site from a track, or NaN if it has
+// none. If error-prone contexts were looked for, Context is the one it is in, e.g.
+// homopolymer:6, or "" if it isn't in one
+type SNP struct {
+	Contig        string
+	Position      int
+	Ref           string
+	Alt           string
+	Annotation    string
+	CodonPosition string
+	Weight        float64
+	Score         float64
+	Context       string
+}
+
+// String returns the SNP in the form G6C, or HA:G6C if it is in a contig
+func (snp SNP) String() string {
+	s := snp.Ref + strconv.Itoa(snp.Position) + snp.Alt
+	if snp.Contig != "" {
+		s = snp.Contig + ":" + s
+	}
+	return s
+}
+
+// Record is the set of SNPs found in one query sequence, and Distance is how many there
+// are, even if they were only counted and not listed. Description is the query's
+// whole header line, and Date is its collection date, if one was parsed from it. Source
+// is the file the query was read from, if it was read from more than one. If
+// the query was assigned a lineage from barcodes, Lineage is its name and LineageScore
+// how well it matched. Group is the query's metadata group, if it has one. Ambiguities
+// are the sites where the query resolves an ambiguity in the reference or vice versa,
+// and Resolutions the sites where it resolves one in the reference to A, C, G or T.
+// Clusters are the ranges spanned by unusually dense clusters of its SNPs, if they were
+// looked for. Missing are the sites where the reference is A, C, G or T and the query
+// is N or ?, if they were looked for. Segments are the runs of the query closest to each
+// of a set of parents, if it was compared with them. Dropouts are the amplicons that are
+// mostly missing from the query, if it was checked for them. Contig is the contig of the
+// reference that the query was compared with, if it is made up of contigs. MissingSites
+// is the number of sites in the query that are missing data, and MissingRanges the runs
+// of sites that aren't called, if they were looked for
+type Record struct {
+	Query         string
+	Contig        string
+	Description   string
+	Source        string
+	Date          time.Time
+	SNPs          []SNP
+	Distance      int
+	Ambiguities   []SNP
+	Resolutions   []SNP
+	Lineage       string
+	LineageScore  float64
+	Group         string
+	Clusters      [][2]int
+	Segments      []Segment
+	Dropouts      []string
+	Missing       []SNP
+	MissingSites  int
+	MissingRanges [][2]int
+
+	// uncalled are the runs of sites that aren't A, C, G or T, with Options.Core
+	uncalled [][2]int
+}
+
+// Change is one SNP and the number of query sequences it was found in
+type Change struct {
+	SNP   SNP
+	Count int
+}
+
+// Aggregate is the set of SNPs found across all the query sequences, sorted by
+// position then alternative allele
+type Aggregate struct {
+	Queries int
+	Changes []Change
+}
+
+// OutputWriter writes the results of a run in one format. WriteHeader is called once
+// before anything else, WriteRecord once per query in input order, WriteAggregate once
+// after the last query, and then Close, which should flush any buffered output but
+// not close the underlying io.Writer
+type OutputWriter interface {
+	WriteHeader() error
+	WriteRecord(Record) error
+	WriteAggregate(Aggregate) error
+	Close() error
+}
+
+// ReferenceWriter is an OutputWriter that needs the reference, e.g. to write the
+// reference alleles of sites without SNPs. SetReference is given the encoded reference
+// before WriteHeader is called, unless the reference is made up of contigs
+type ReferenceWriter interface {
+	OutputWriter
+	SetReference(refSeq []byte)
+}
+
+// AggregateConsumer is an OutputWriter that reads the Aggregate it is given. Runs only
+// count every record's SNPs for writers whose NeedsAggregate is true, so that memory use
+// doesn't grow with the number of queries for the rest, which are given an empty
+// Aggregate
+type AggregateConsumer interface {
+	OutputWriter
+	NeedsAggregate() bool
+}
+
+// needsAggregate returns whether ow reads the Aggregate it is given
+func needsAggregate(ow OutputWriter) bool {
+	ac, ok := ow.(AggregateConsumer)
+	return ok && ac.NeedsAggregate()
+}
+
+// WriterOptions are the options an OutputWriter can be constructed with
+type WriterOptions struct {
+	Annotated   bool
+	Threshold   float64
+	Description bool
+	// Source adds a column of the file each query was read from
+	Source      bool
+	Dates       bool
+	Lineages    bool
+	MinCount    int
+	Ambiguities bool
+	// Resolutions adds a column of the sites where the query resolves an ambiguity code,
+	// N or ? in the reference to A, C, G or T
+	Resolutions bool
+	// UnambiguousAlts restricts aggregate output to SNPs whose alternative allele is
+	// A, C, G or T
+	UnambiguousAlts bool
+	// CodonPositions adds a column of where each SNP is in its codon(s), if Annotated
+	CodonPositions bool
+	// Effects adds a column of the kind of change each SNP makes to its codon(s), e.g.
+	// missense, if Annotated
+	Effects bool
+	// Clusters adds a column of the ranges spanned by dense clusters of SNPs
+	Clusters bool
+	// Contigs adds a column of the contig that each query was compared with
+	Contigs bool
+	// Parents adds columns of the segments closest to each parent, and the breakpoints
+	// between them
+	Parents bool
+	// Dropouts adds a column of the amplicons that have dropped out
+	Dropouts bool
+	// Missing adds a column of the sites where the query is missing data
+	Missing bool
+	// MissingSites says that records have their MissingSites counted
+	MissingSites bool
+	// WithSamples adds a column to aggregate output of the queries each SNP is found
+	// in, up to MaxSamples of them if MaxSamples is greater than zero
+	WithSamples bool
+	MaxSamples  int
+	// MatrixLayout is the layout of distance matrices, one of MatrixLayouts, or "" for
+	// LayoutSquare
+	MatrixLayout string
+	// ClockFilter is the number of interquartile ranges that a query's residual from the
+	// clock has to be from the median for it to be an outlier, or 0 for the default of 3
+	ClockFilter float64
+	// Catalogue, if not nil, adds a column of the labels of the catalogued changes found,
+	// to per-query and aggregate output
+	Catalogue Catalogue
+	// Weights adds a column pairing each SNP with the weight of its site and one of the
+	// sum of their weights, and a column of weighted proportions to aggregate output
+	Weights bool
+	// Scores adds a column pairing each SNP with the score of its site from a track, and a
+	// column of scores to aggregate output
+	Scores bool
+	// Contexts adds a column pairing each SNP with the error-prone context it is in, if
+	// it is in one, and a column of contexts to aggregate output
+	Contexts bool
+	// Trinucleotide splits spectrum output by the reference's bases either side of each
+	// substitution
+	Trinucleotide bool
+	// Discriminate is the two groups that discriminate output finds SNPs to tell apart
+	Discriminate []string
+	// Genes are the genes that genes output writes a line for in every query, e.g. from
+	// GeneNames, in order
+	Genes []string
+	// Metadata is carried through to the output formats that have room for it, e.g.
+	// auspice and microreact
+	Metadata Metadata
+	// SignaturePositions, if not nil, is where signature output writes the sites that
+	// its signatures are made of
+	SignaturePositions io.Writer
+	// ReferenceName is the name of the reference, for formats that need one, e.g. the
+	// chromosome of gvcf and population-vcf output. If it is "", "reference" is used
+	ReferenceName string
+}
+
+var outputWriters = make(map[string]func(io.Writer, WriterOptions) OutputWriter)
+
+// RegisterOutputWriter makes an output format available by name. Its writers are only
+// given the aggregate if they are AggregateConsumers
+func RegisterOutputWriter(name string, newWriter func(io.Writer, WriterOptions) OutputWriter) {
+	outputWriters[name] = newWriter
+}
+
+// NewOutputWriter returns an OutputWriter for a registered output format
+func NewOutputWriter(name string, w io.Writer, opts WriterOptions) (OutputWriter, error) {
+	newWriter, ok := outputWriters[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownFormat, name)
+	}
+	return newWriter(w, opts), nil
+}
+
+// OutputFormats returns the names of the registered output formats, in alphabetical order
+func OutputFormats() []string {
+	names := make([]string, 0, len(outputWriters))
+	for name := range outputWriters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// MultiWriter returns an OutputWriter that passes everything to each of writers in
+// turn, so that one run can write several outputs. It stops at the first error
+func MultiWriter(writers ...OutputWriter) OutputWriter {
+	return multiWriter(writers)
+}
+
+type multiWriter []OutputWriter
+
+func (mw multiWriter) WriteHeader() error {
+	for _, ow := range mw {
+		if err := ow.WriteHeader(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (mw multiWriter) WriteRecord(record Record) error {
+	for _, ow := range mw {
+		if err := ow.WriteRecord(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetReference passes refSeq to each writer that needs it
+func (mw multiWriter) SetReference(refSeq []byte) {
+	for _, ow := range mw {
+		if rw, ok := ow.(ReferenceWriter); ok {
+			rw.SetReference(refSeq)
+		}
+	}
+}
+
+// NeedsAggregate is true if any writer reads the aggregate
+func (mw multiWriter) NeedsAggregate() bool {
+	for _, ow := range mw {
+		if needsAggregate(ow) {
+			return true
+		}
+	}
+	return false
+}
+
+func (mw multiWriter) WriteAggregate(agg Aggregate) error {
+	for _, ow := range mw {
+		if err := ow.WriteAggregate(agg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes every writer, even if one fails, and returns the first error
+func (mw multiWriter) Close() error {
+	var first error
+	for _, ow := range mw {
+		if err := ow.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+func init() {
+	RegisterOutputWriter("csv", newCSVWriter)
+	RegisterOutputWriter("long", newLongWriter)
+	RegisterOutputWriter("json", newJSONWriter)
+	RegisterOutputWriter("ndjson", newNDJSONWriter)
+	RegisterOutputWriter("parquet", newParquetWriter)
+	RegisterOutputWriter("aggregate", newAggregateWriter)
+	RegisterOutputWriter("association", newAssociationWriter)
+	RegisterOutputWriter("stratified", newStratifiedWriter)
+	RegisterOutputWriter("trend", newTrendWriter)
+	RegisterOutputWriter("counts", newCountsWriter)
+	RegisterOutputWriter("summary", newSummaryWriter)
+	RegisterOutputWriter("distance", newDistanceWriter)
+	RegisterOutputWriter("presence", newPresenceWriter)
+	RegisterOutputWriter("index", newIndexWriter)
+	RegisterOutputWriter("distance-only", newDistanceOnlyWriter)
+	RegisterOutputWriter("clock", newClockWriter)
+	RegisterOutputWriter("report", newReportWriter)
+	RegisterOutputWriter("gvcf", newGVCFWriter)
+	RegisterOutputWriter("vcf", newVCFWriter)
+	RegisterOutputWriter("population-vcf", newPopulationVCFWriter)
+	RegisterOutputWriter("discriminate", newDiscriminateWriter)
+	RegisterOutputWriter("signature", newSignatureWriter)
+	RegisterOutputWriter("genes", newGenesWriter)
+	RegisterOutputWriter("auspice", newAuspiceWriter)
+	RegisterOutputWriter("microreact", newMicroreactWriter)
+	RegisterOutputWriter("spectrum", newSpectrumWriter)
+}
+
+// csvWriter writes one line per query, with its SNPs joined by "|". If the reference
+// is annotated, an extra column pairs each SNP with its amino acid consequence(s). If
+// description is true, the query's header line is written after its ID, if source is
+// true, so is the file it was read from, and if dates
+// is true, so are its collection date and the ISO and epidemiological weeks it falls in.
+// If ambiguities is true, the sites where the query and reference are compatible but
+// one is more ambiguous are written after the SNPs, in the same form, and if
+// resolutions is true, so are the sites where the query resolves an ambiguous reference
+// to A, C, G or T. If lineages is
+// true, the lineage assigned to the query and its score are written last. If
+// codonPositions is true (and the reference is annotated), a column pairs each SNP with
+// its position in its codon(s), and if effects is true, a column pairs each SNP with the
+// kind of change it makes, e.g. missense. If clusters is true, the ranges spanned by dense
+// clusters of SNPs are written before the lineage. If dropouts is true, so are the
+// amplicons that have dropped out. If missing is true, so are the sites where the query
+// has N or ? against A, C, G or T in the reference, e.g. A100N. If weights is true, a
+// column pairs each SNP with the weight of its site, and another has their sum, and if
+// scores is true, a column pairs each SNP with the score of its site. If contexts is
+// true, a column pairs each SNP in an error-prone context with the context
+type csvWriter struct {
+	w              *bufio.Writer
+	annotated      bool
+	codonPositions bool
+	effects        bool
+	weights        bool
+	scores         bool
+	contexts       bool
+	contigs        bool
+	description    bool
+	source         bool
+	dates          bool
+	ambiguities    bool
+	resolutions    bool
+	clusters       bool
+	parents        bool
+	dropouts       bool
+	missing        bool
+	catalogue      Catalogue
+	lineages       bool
+}
+
+func newCSVWriter(w io.Writer, opts WriterOptions) OutputWriter {
+	return &csvWriter{
+		w:              bufio.NewWriter(w),
+		annotated:      opts.Annotated,
+		codonPositions: opts.Annotated && opts.CodonPositions,
+		effects:        opts.Annotated && opts.Effects,
+		weights:        opts.Weights,
+		scores:         opts.Scores,
+		contexts:       opts.Contexts,
+		contigs:        opts.Contigs,
+		description:    opts.Description,
+		source:         opts.Source,
+		dates:          opts.Dates,
+		ambiguities:    opts.Ambiguities,
+		resolutions:    opts.Resolutions,
+		clusters:       opts.Clusters,
+		parents:        opts.Parents,
+		dropouts:       opts.Dropouts,
+		missing:        opts.Missing,
+		catalogue:      opts.Catalogue,
+		lineages:       opts.Lineages,
+	}
+}
+
+func (cw *csvWriter) WriteHeader() error {
+	header := "query"
+	if cw.contigs {
+		header += ",contig"
+	}
+	if cw.description {
+		header += ",description"
+	}
+	if cw.source {
+		header += ",source"
+	}
+	if cw.dates {
+		header += ",date,iso_week,epi_week"
+	}
+	header += ",SNPs"
+	if cw.annotated {
+		header += ",annotated_SNPs"
+	}
+	if cw.codonPositions {
+		header += ",codon_positions"
+	}
+	if cw.effects {
+		header += ",effects"
+	}
+	if cw.weights {
+		header += ",weighted_SNPs,weighted_distance"
+	}
+	if cw.scores {
+		header += ",scored_SNPs"
+	}
+	if cw.contexts {
+		header += ",flagged_SNPs"
+	}
+	if cw.ambiguities {
+		header += ",compatible_ambiguities"
+	}
+	if cw.resolutions {
+		header += ",reference_resolutions"
+	}
+	if cw.clusters {
+		header += ",SNP_clusters"
+	}
+	if cw.parents {
+		header += ",parents,breakpoints"
+	}
+	if cw.dropouts {
+		header += ",amplicon_dropouts"
+	}
+	if cw.missing {
+		header += ",missing"
+	}
+	if cw.catalogue != nil {
+		header += ",labels"
+	}
+	if cw.lineages {
+		header += ",lineage,lineage_score"
+	}
+	_, err := cw.w.WriteString(header + "\n")
+	return err
+}
+
+func (cw *csvWriter) WriteRecord(record Record) error {
+	snps := make([]string, len(record.SNPs))
+	for i, snp := range record.SNPs {
+		snps[i] = snp.String()
+	}
+	line := record.Query
+	if cw.contigs {
+		line += "," + csvField(record.Contig)
+	}
+	if cw.description {
+		line += "," + csvField(record.Description)
+	}
+	if cw.source {
+		line += "," + csvField(record.Source)
+	}
+	if cw.dates {
+		if record.Date.IsZero() {
+			line += ",,,"
+		} else {
+			line += "," + record.Date.Format("2006-01-02") + "," + ISOWeek(record.Date) + "," + EpiWeek(record.Date)
+		}
+	}
+	line += "," + strings.Join(snps, "|")
+
+	if cw.annotated {
+		annotated := make([]string, len(record.SNPs))
+		for i, snp := range record.SNPs {
+			annotated[i] = snps[i]
+			if snp.Annotation != "" {
+				annotated[i] += " (" + snp.Annotation + ")"
+			}
+		}
+		line += "," + strings.Join(annotated, "|")
+	}
+
+	if cw.codonPositions {
+		positions := make([]string, len(record.SNPs))
+		for i, snp := range record.SNPs {
+			positions[i] = snps[i]
+			if snp.CodonPosition != "" {
+				positions[i] += " (" + snp.CodonPosition + ")"
+			}
+		}
+		line += "," + strings.Join(positions, "|")
+	}
+
+	if cw.effects {
+		effects := make([]string, len(record.SNPs))
+		for i, snp := range record.SNPs {
+			effects[i] = snps[i] + " (" + effect(snp.Annotation) + ")"
+		}
+		line += "," + strings.Join(effects, "|")
+	}
+
+	if cw.weights {
+		weighted := make([]string, len(record.SNPs))
+		for i, snp := range record.SNPs {
+			weighted[i] = snps[i] + " (" + strconv.FormatFloat(snp.Weight, 'f', -1, 64) + ")"
+		}
+		line += "," + strings.Join(weighted, "|") + "," + strconv.FormatFloat(weightedDistance(record.SNPs), 'f', -1, 64)
+	}
+
+	if cw.scores {
+		scored := make([]string, len(record.SNPs))
+		for i, snp := range record.SNPs {
+			scored[i] = snps[i] + " (" + formatScore(snp.Score) + ")"
+		}
+		line += "," + strings.Join(scored, "|")
+	}
+
+	if cw.contexts {
+		flagged := make([]string, len(record.SNPs))
+		for i, snp := range record.SNPs {
+			flagged[i] = snps[i]
+			if snp.Context != "" {
+				flagged[i] += " (" + snp.Context + ")"
+			}
+		}
+		line += "," + strings.Join(flagged, "|")
+	}
+
+	if cw.ambiguities {
+		ambiguities := make([]string, len(record.Ambiguities))
+		for i, ambiguity := range record.Ambiguities {
+			ambiguities[i] = ambiguity.String()
+		}
+		line += "," + strings.Join(ambiguities, "|")
+	}
+
+	if cw.resolutions {
+		resolutions := make([]string, len(record.Resolutions))
+		for i, resolution := range record.Resolutions {
+			resolutions[i] = resolution.String()
+		}
+		line += "," + strings.Join(resolutions, "|")
+	}
+
+	if cw.clusters {
+		line += "," + formatClusters(record.Clusters)
+	}
+
+	if cw.parents {
+		line += "," + csvField(formatSegments(record.Segments)) + "," + formatBreakpoints(record.Segments)
+	}
+
+	if cw.dropouts {
+		line += "," + csvField(strings.Join(record.Dropouts, "|"))
+	}
+
+	if cw.missing {
+		missing := make([]string, len(record.Missing))
+		for i, site := range record.Missing {
+			missing[i] = site.String()
+		}
+		line += "," + strings.Join(missing, "|")
+	}
+
+	if cw.catalogue != nil {
+		line += "," + csvField(cw.catalogue.labels(record.SNPs))
+	}
+
+	if cw.lineages {
+		line += "," + csvField(record.Lineage) + "," + strconv.FormatFloat(record.LineageScore, 'f', 4, 64)
+	}
+
+	_, err := cw.w.WriteString(line + "\n")
+	return err
+}
+
+// csvField quotes s if it contains a comma, a double quote or a newline
+func csvField(s string) string {
+	if !strings.ContainsAny(s, ",\"\r\n") {
+		return s
+	}
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
+
+func (cw *csvWriter) WriteAggregate(agg Aggregate) error {
+	return nil
+}
+
+func (cw *csvWriter) Close() error {
+	return cw.w.Flush()
+}
+
+// aggregateWriter writes the proportion of queries that each SNP is found in, for
+// those SNPs whose proportion is at least the threshold and which are found in at
+// least minCount queries. If unambiguous is true, SNPs to ambiguity codes (e.g. G6W) or
+// gaps are left out. If samples is not nil, the queries each SNP is found in are
+// written after its proportion, up to maxSamples of them (if maxSamples is greater than
+// zero) followed by ... if there are more. If catalogue is not nil, each SNP's label is
+// written after its proportion. If weights is true, each SNP's proportion multiplied by
+// the weight of its site is written after its proportion, and if scores is true, so is
+// the score of its site. If contexts is true, so is the error-prone context it is in
+type aggregateWriter struct {
+	w           *bufio.Writer
+	weights     bool
+	scores      bool
+	contexts    bool
+	threshold   float64
+	minCount    int
+	unambiguous bool
+	catalogue   Catalogue
+	samples     map[string][]string
+	maxSamples  int
+}
+
+func newAggregateWriter(w io.Writer, opts WriterOptions) OutputWriter {
+	aw := &aggregateWriter{w: bufio.NewWriter(w), weights: opts.Weights, scores: opts.Scores, contexts: opts.Contexts, threshold: opts.Threshold, minCount: opts.MinCount, unambiguous: opts.UnambiguousAlts, catalogue: opts.Catalogue, maxSamples: opts.MaxSamples}
+	if opts.WithSamples {
+		aw.samples = make(map[string][]string)
+	}
+	return aw
+}
+
+func (aw *aggregateWriter) WriteHeader() error {
+	header := "change,proportion"
+	if aw.weights {
+		header += ",weighted_proportion"
+	}
+	if aw.scores {
+		header += ",score"
+	}
+	if aw.contexts {
+		header += ",context"
+	}
+	if aw.catalogue != nil {
+		header += ",label"
+	}
+	if aw.samples != nil {
+		header += ",samples"
+	}
+	_, err := aw.w.WriteString(header + "\n")
+	return err
+}
+
+func (aw *aggregateWriter) WriteRecord(record Record) error {
+	if aw.samples == nil {
+		return nil
+	}
+	aw.addSamples(record.Query, record.SNPs)
+	aw.addSamples(record.Query, record.Missing)
+	return nil
+}
+
+func (aw *aggregateWriter) addSamples(query string, SNPs []SNP) {
+	for _, snp := range SNPs {
+		key := snp.String()
+		// one more than the cap is kept, to know that there are more
+		if aw.maxSamples > 0 && len(aw.samples[key]) > aw.maxSamples {
+			continue
+		}
+		aw.samples[key] = append(aw.samples[key], query)
+	}
+}
+
+func (aw *aggregateWriter) NeedsAggregate() bool {
+	return true
+}
+
+func (aw *aggregateWriter) WriteAggregate(agg Aggregate) error {
+	for _, change := range agg.Changes {
+		prop := float64(change.Count) / float64(agg.Queries)
+		if prop < aw.threshold || change.Count < aw.minCount {
+			continue
+		}
+		if aw.unambiguous && !isACGT(change.SNP.Alt) {
+			continue
+		}
+		line := change.SNP.String() + "," + strconv.FormatFloat(prop, 'f', 9, 64)
+		if aw.weights {
+			line += "," + strconv.FormatFloat(prop*change.SNP.Weight, 'f', 9, 64)
+		}
+		if aw.scores {
+			line += "," + formatScore(change.SNP.Score)
+		}
+		if aw.contexts {
+			line += "," + change.SNP.Context
+		}
+		if aw.catalogue != nil {
+			line += "," + csvField(aw.catalogue[change.SNP.String()])
+		}
+		if aw.samples != nil {
+			samples := aw.samples[change.SNP.String()]
+			if aw.maxSamples > 0 && len(samples) > aw.maxSamples {
+				samples = append(samples[:aw.maxSamples:aw.maxSamples], "...")
+			}
+			line += "," + csvField(strings.Join(samples, "|"))
+		}
+		_, err := aw.w.WriteString(line + "\n")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (aw *aggregateWriter) Close() error {
+	return aw.w.Flush()
+}
+
+// stratifiedWriter writes the proportion of queries in each group that each SNP is
+// found in, with one column per group in alphabetical order, for those SNPs whose
+// proportion is at least the threshold in at least one group. Queries without a group
+// are left out. If unambiguous is true, SNPs to ambiguity codes or gaps are left out
+type stratifiedWriter struct {
+	w           *bufio.Writer
+	threshold   float64
+	unambiguous bool
+	groups      map[string]*aggregator
+}
+
+func newStratifiedWriter(w io.Writer, opts WriterOptions) OutputWriter {
+	return &stratifiedWriter{w: bufio.NewWriter(w), threshold: opts.Threshold, unambiguous: opts.UnambiguousAlts, groups: make(map[string]*aggregator)}
+}
+
+// the header depends on the groups, so it is written with the aggregate
+func (sw *stratifiedWriter) WriteHeader() error {
+	return nil
+}
+
+func (sw *stratifiedWriter) WriteRecord(record Record) error {
+	if record.Group == "" {
+		return nil
+	}
+	agg, ok := sw.groups[record.Group]
+	if !ok {
+		agg = newAggregator()
+		sw.groups[record.Group] = agg
+	}
+	agg.add(record)
+	return nil
+}
+
+func (sw *stratifiedWriter) WriteAggregate(Aggregate) error {
+	names := make([]string, 0, len(sw.groups))
+	for name := range sw.groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	header := "change"
+	for _, name := range names {
+		header += "," + csvField(name)
+	}
+	_, err := sw.w.WriteString(header + "\n")
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool)
+	changes := make([]Change, 0)
+	for _, name := range names {
+		for key, change := range sw.groups[name].counts {
+			if !seen[key] {
+				seen[key] = true
+				changes = append(changes, Change{SNP: change.SNP})
+			}
+		}
+	}
+	sortChanges(changes)
+
+	for _, change := range changes {
+		if sw.unambiguous && !isACGT(change.SNP.Alt) {
+			continue
+		}
+		key := change.SNP.String()
+		line := key
+		keep := false
+		for _, name := range names {
+			agg := sw.groups[name]
+			prop := 0.0
+			if c, ok := agg.counts[key]; ok {
+				prop = float64(c.Count) / float64(agg.queries)
+			}
+			if prop >= sw.threshold {
+				keep = true
+			}
+			line += "," + strconv.FormatFloat(prop, 'f', 9, 64)
+		}
+		if !keep {
+			continue
+		}
+		_, err = sw.w.WriteString(line + "\n")
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (sw *stratifiedWriter) Close() error {
+	return sw.w.Flush()
+}
+
+// aggregator counts the number of queries that each SNP is found in, and each site
+// that is missing data in, if that was looked for
+type aggregator struct {
+	queries int
+	counts  map[string]*Change
+}
+
+func newAggregator() *aggregator {
+	return &aggregator{counts: make(map[string]*Change)}
+}
+
+func (a *aggregator) add(record Record) {
+	a.queries++
+	a.count(record.SNPs)
+	a.count(record.Missing)
+}
+
+func (a *aggregator) count(SNPs []SNP) {
+	for _, snp := range SNPs {
+		key := snp.String()
+		if change, ok := a.counts[key]; ok {
+			change.Count++
+		} else {
+			a.counts[key] = &Change{SNP: SNP{Contig: snp.Contig, Position: snp.Position, Ref: snp.Ref, Alt: snp.Alt, Weight: snp.Weight, Score: snp.Score, Context: snp.Context}, Count: 1}
+		}
+	}
+}
+
+func (a *aggregator) aggregate() Aggregate {
+	changes := make([]Change, 0, len(a.counts))
+	for _, change := range a.counts {
+		changes = append(changes, *change)
+	}
+
+	sortChanges(changes)
+
+	return Aggregate{Queries: a.queries, Changes: changes}
+}
+
+// isACGT returns whether a nucleotide is A, C, G or T
+func isACGT(nuc string) bool {
+	return nuc == "A" || nuc == "C" || nuc == "G" || nuc == "T"
+}
+
+// sortChanges sorts changes by position then alternative allele
+func sortChanges(changes []Change) {
+	sort.Slice(changes, func(i, j int) bool {
+		a, b := changes[i].SNP, changes[j].SNP
+		if a.Contig != b.Contig {
+			return a.Contig < b.Contig
+		}
+		return a.Position < b.Position || (a.Position == b.Position && a.Alt < b.Alt)
+	})
+}
@@ -0,0 +1,163 @@
+package snps
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/benjamincjackson/snps/pkg/annotation"
+	"github.com/benjamincjackson/snps/pkg/encoding"
+	"github.com/benjamincjackson/snps/pkg/fastaio"
+)
+
+// Pair is two sequences to compare with each other
+type Pair struct {
+	A string
+	B string
+}
+
+// PairSNPs are the SNPs between the sequences of a pair, with A as the reference
+type PairSNPs struct {
+	Pair
+	SNPs []SNP
+}
+
+// ReadPairs reads pairs of sequence names in CSV format, with a header. The names are
+// taken from its name_a and name_b columns, or if it hasn't got them, from its first two
+// columns
+func ReadPairs(r io.Reader) ([]Pair, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("%w: pairs file is empty", ErrBadCSV)
+	}
+	if err != nil {
+		return nil, err
+	}
+	aColumn, bColumn := 0, 1
+	for i, name := range header {
+		switch strings.TrimSpace(name) {
+		case "name_a":
+			aColumn = i
+		case "name_b":
+			bColumn = i
+		}
+	}
+
+	pairs := make([]Pair, 0)
+	for line := 2; ; line++ {
+		row, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if aColumn >= len(row) || bColumn >= len(row) {
+			return nil, fmt.Errorf("%w: pairs line %d is too short", ErrBadCSV, line)
+		}
+		pairs = append(pairs, Pair{A: strings.TrimSpace(row[aColumn]), B: strings.TrimSpace(row[bColumn])})
+	}
+	return pairs, nil
+}
+
+// ComparePairs finds the SNPs between the sequences of each pair, which are read from
+// the alignment rQ by their IDs (after opts.IDs are applied). Only the sequences in pairs
+// are kept in memory, so this is much cheaper than comparing every sequence with every
+// other. Positions are in the alignment's coordinates, and opts.Regions is ignored since
+// neither sequence is the annotated reference
+func ComparePairs(rQ io.Reader, pairs []Pair, opts Options) ([]PairSNPs, error) {
+	wanted := make(map[string]bool)
+	for _, pair := range pairs {
+		wanted[pair.A] = true
+		wanted[pair.B] = true
+	}
+
+	seqs := make(map[string][]byte)
+	err := eachRecord(rQ, opts.HardGaps, func(FR fastaio.EncodedFastaRecord) error {
+		id := opts.IDs.apply(FR.ID)
+		if !wanted[id] {
+			return nil
+		}
+		seq, err := opts.resolveQuestionMarks(FR.Seq, FR.ID, FR.Idx+1)
+		seqs[id] = seq
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	opts.Regions = nil
+	DA := encoding.MakeDecodingArray()
+	codonTable := annotation.MakeCodonTable()
+
+	results := make([]PairSNPs, len(pairs))
+	for i, pair := range pairs {
+		a, okA := seqs[pair.A]
+		b, okB := seqs[pair.B]
+		switch {
+		case !okA:
+			return nil, fmt.Errorf("%w: %s", ErrNotInAlignment, pair.A)
+		case !okB:
+			return nil, fmt.Errorf("%w: %s", ErrNotInAlignment, pair.B)
+		case len(a) != len(b):
+			return nil, fmt.Errorf("%w: %s and %s", ErrLengthMismatch, pair.A, pair.B)
+		}
+		results[i] = PairSNPs{Pair: pair, SNPs: findSNPs(a, b, 0, len(b), opts, DA, codonTable)}
+	}
+	return results, nil
+}
+
+// eachRecord passes each record in the alignment r to f in turn, and stops at the first
+// error from either
+func eachRecord(r io.Reader, hardGaps bool, f func(fastaio.EncodedFastaRecord) error) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cErr := make(chan error)
+	cFR := make(chan fastaio.EncodedFastaRecord)
+	cDone := make(chan bool)
+
+	go fastaio.ReadEncodeAlignmentContext(ctx, r, hardGaps, cFR, cErr, cDone)
+
+	for n := 1; n > 0; {
+		select {
+		case err := <-cErr:
+			return err
+		case FR := <-cFR:
+			if err := f(FR); err != nil {
+				return err
+			}
+		case <-cDone:
+			n--
+		}
+	}
+	return nil
+}
+
+// WritePairSNPs writes the SNPs between each pair in csv format, one line per pair, with
+// the number of SNPs and the SNPs themselves joined by "|"
+func WritePairSNPs(w io.Writer, results []PairSNPs) error {
+	bw := bufio.NewWriter(w)
+	_, err := bw.WriteString("name_a,name_b,distance,SNPs\n")
+	if err != nil {
+		return err
+	}
+	for _, result := range results {
+		snps := make([]string, len(result.SNPs))
+		for i, snp := range result.SNPs {
+			snps[i] = snp.String()
+		}
+		_, err := bw.WriteString(csvField(result.A) + "," + csvField(result.B) + "," + strconv.Itoa(len(snps)) + "," + strings.Join(snps, "|") + "\n")
+		if err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
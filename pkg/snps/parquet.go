@@ -0,0 +1,349 @@
+package snps
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// parquetRowGroupRows is how many rows parquetWriter keeps before writing them as a row
+// group, and parquetPageRows how many rows of each column go in one page
+const (
+	parquetRowGroupRows = 1 << 20
+	parquetPageRows     = 1 << 16
+)
+
+// Parquet's physical types, encodings and compression codecs, and the Thrift compact
+// protocol's field types that its metadata is written with
+const (
+	parquetInt64     = 2
+	parquetByteArray = 6
+	parquetPlain     = 0
+	parquetRLE       = 3
+	parquetZstd      = 6
+
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// parquetWriter writes the same table as long output, one row per SNP of each query, as
+// an Apache Parquet file, which analytics tools (DuckDB, Spark, pandas and the like) load
+// much faster than text, and which is much smaller: each column is stored on its own and
+// compressed with zstd. Rows are written in row groups of parquetRowGroupRows, so memory
+// use doesn't grow with the number of queries, and the file's metadata, which says where
+// each row group is, is written once every query has been read
+type parquetWriter struct {
+	w            *bufio.Writer
+	enc          *zstd.Encoder
+	contigs      bool
+	annotated    bool
+	rowGroupRows int
+	offset       int64
+	rows         int64
+	rowGroups    []parquetRowGroup
+	query        []string
+	contig       []string
+	position     []int64
+	ref          []string
+	alt          []string
+	annotation   []string
+}
+
+// parquetColumn is one column of the rows that parquetWriter hasn't written yet: its
+// values are ints if it is an integer column, or else strings
+type parquetColumn struct {
+	name    string
+	integer bool
+	strings []string
+	ints    []int64
+}
+
+// parquetRowGroup is where a row group was written, for the file's metadata
+type parquetRowGroup struct {
+	rows   int64
+	size   int64
+	chunks []parquetChunk
+}
+
+// parquetChunk is where one column of a row group was written
+type parquetChunk struct {
+	offset       int64
+	values       int64
+	size         int64
+	uncompressed int64
+}
+
+func newParquetWriter(w io.Writer, opts WriterOptions) OutputWriter {
+	return &parquetWriter{w: bufio.NewWriter(w), contigs: opts.Contigs, annotated: opts.Annotated, rowGroupRows: parquetRowGroupRows}
+}
+
+func (pw *parquetWriter) write(b []byte) error {
+	n, err := pw.w.Write(b)
+	pw.offset += int64(n)
+	return err
+}
+
+func (pw *parquetWriter) WriteHeader() error {
+	var err error
+	pw.enc, err = zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+	if err != nil {
+		return err
+	}
+	return pw.write([]byte("PAR1"))
+}
+
+// columns returns the rows that haven't been written yet as columns, in order
+func (pw *parquetWriter) columns() []parquetColumn {
+	columns := []parquetColumn{{name: "query", strings: pw.query}}
+	if pw.contigs {
+		columns = append(columns, parquetColumn{name: "contig", strings: pw.contig})
+	}
+	columns = append(columns,
+		parquetColumn{name: "position", integer: true, ints: pw.position},
+		parquetColumn{name: "ref", strings: pw.ref},
+		parquetColumn{name: "alt", strings: pw.alt},
+	)
+	if pw.annotated {
+		columns = append(columns, parquetColumn{name: "annotation", strings: pw.annotation})
+	}
+	return columns
+}
+
+func (pw *parquetWriter) WriteRecord(record Record) error {
+	for _, snp := range record.SNPs {
+		pw.query = append(pw.query, record.Query)
+		if pw.contigs {
+			pw.contig = append(pw.contig, snp.Contig)
+		}
+		pw.position = append(pw.position, int64(snp.Position))
+		pw.ref = append(pw.ref, snp.Ref)
+		pw.alt = append(pw.alt, snp.Alt)
+		if pw.annotated {
+			pw.annotation = append(pw.annotation, snp.Annotation)
+		}
+		if len(pw.query) == pw.rowGroupRows {
+			if err := pw.writeRowGroup(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeRowGroup writes the rows that haven't been written yet as a row group: each
+// column in turn, in pages of PLAIN-encoded values compressed with zstd
+func (pw *parquetWriter) writeRowGroup() error {
+	rg := parquetRowGroup{rows: int64(len(pw.query))}
+	var data []byte
+	for _, column := range pw.columns() {
+		chunk := parquetChunk{offset: pw.offset, values: rg.rows}
+		for start := 0; start < len(pw.query); start += parquetPageRows {
+			end := min(start+parquetPageRows, len(pw.query))
+			data = data[:0]
+			for i := start; i < end; i++ {
+				if column.integer {
+					data = binary.LittleEndian.AppendUint64(data, uint64(column.ints[i]))
+				} else {
+					data = binary.LittleEndian.AppendUint32(data, uint32(len(column.strings[i])))
+					data = append(data, column.strings[i]...)
+				}
+			}
+			compressed := pw.enc.EncodeAll(data, nil)
+
+			var tw thriftWriter
+			tw.begin(0)
+			tw.i32(1, 0) // a data page
+			tw.i32(2, int32(len(data)))
+			tw.i32(3, int32(len(compressed)))
+			tw.begin(5)
+			tw.i32(1, int32(end-start))
+			tw.i32(2, parquetPlain)
+			tw.i32(3, parquetRLE)
+			tw.i32(4, parquetRLE)
+			tw.end()
+			tw.end()
+
+			if err := pw.write(tw.b); err != nil {
+				return err
+			}
+			if err := pw.write(compressed); err != nil {
+				return err
+			}
+			chunk.size += int64(len(tw.b) + len(compressed))
+			chunk.uncompressed += int64(len(tw.b) + len(data))
+		}
+		rg.size += chunk.uncompressed
+		rg.chunks = append(rg.chunks, chunk)
+	}
+	pw.rowGroups = append(pw.rowGroups, rg)
+	pw.rows += rg.rows
+
+	pw.query, pw.contig, pw.position, pw.ref, pw.alt, pw.annotation = pw.query[:0], pw.contig[:0], pw.position[:0], pw.ref[:0], pw.alt[:0], pw.annotation[:0]
+	return nil
+}
+
+// WriteAggregate writes the last row group, then the file's metadata: its schema, and
+// where each row group's columns are
+func (pw *parquetWriter) WriteAggregate(Aggregate) error {
+	if len(pw.query) > 0 {
+		if err := pw.writeRowGroup(); err != nil {
+			return err
+		}
+	}
+	columns := pw.columns()
+
+	var tw thriftWriter
+	tw.begin(0)
+	tw.i32(1, 1)
+	tw.list(2, thriftStruct, len(columns)+1)
+	tw.begin(0)
+	tw.string(4, "schema")
+	tw.i32(5, int32(len(columns)))
+	tw.end()
+	for _, column := range columns {
+		tw.begin(0)
+		if column.integer {
+			tw.i32(1, parquetInt64)
+		} else {
+			tw.i32(1, parquetByteArray)
+		}
+		tw.i32(3, 0) // required
+		tw.string(4, column.name)
+		if !column.integer {
+			tw.i32(6, 0) // UTF8, and the STRING logical type that replaces it
+			tw.begin(10)
+			tw.begin(1)
+			tw.end()
+			tw.end()
+		}
+		tw.end()
+	}
+	tw.i64(3, pw.rows)
+	tw.list(4, thriftStruct, len(pw.rowGroups))
+	for _, rg := range pw.rowGroups {
+		tw.begin(0)
+		tw.list(1, thriftStruct, len(rg.chunks))
+		for i, chunk := range rg.chunks {
+			tw.begin(0)
+			tw.i64(2, chunk.offset)
+			tw.begin(3)
+			if columns[i].integer {
+				tw.i32(1, parquetInt64)
+			} else {
+				tw.i32(1, parquetByteArray)
+			}
+			tw.list(2, thriftI32, 1)
+			tw.element(parquetPlain)
+			tw.list(3, thriftBinary, 1)
+			tw.elementString(columns[i].name)
+			tw.i32(4, parquetZstd)
+			tw.i64(5, chunk.values)
+			tw.i64(6, chunk.uncompressed)
+			tw.i64(7, chunk.size)
+			tw.i64(9, chunk.offset)
+			tw.end()
+			tw.end()
+		}
+		tw.i64(2, rg.size)
+		tw.i64(3, rg.rows)
+		tw.end()
+	}
+	tw.string(6, "snps")
+	tw.end()
+
+	if err := pw.write(tw.b); err != nil {
+		return err
+	}
+	if err := pw.write(binary.LittleEndian.AppendUint32(nil, uint32(len(tw.b)))); err != nil {
+		return err
+	}
+	return pw.write([]byte("PAR1"))
+}
+
+func (pw *parquetWriter) Close() error {
+	if pw.enc != nil {
+		pw.enc.Close()
+	}
+	return pw.w.Flush()
+}
+
+// thriftWriter writes Thrift's compact protocol, which Parquet's metadata is written in.
+// Each field's ID is written as the difference from the last one in the same struct, so
+// the last IDs of the structs that are open are kept
+type thriftWriter struct {
+	b    []byte
+	last []int16
+}
+
+func (tw *thriftWriter) varint(v uint64) {
+	tw.b = binary.AppendUvarint(tw.b, v)
+}
+
+func (tw *thriftWriter) zigzag(v int64) {
+	tw.varint(uint64(v<<1 ^ v>>63))
+}
+
+func (tw *thriftWriter) field(id int16, kind byte) {
+	last := tw.last[len(tw.last)-1]
+	if id > last && id-last <= 15 {
+		tw.b = append(tw.b, byte(id-last)<<4|kind)
+	} else {
+		tw.b = append(tw.b, kind)
+		tw.zigzag(int64(id))
+	}
+	tw.last[len(tw.last)-1] = id
+}
+
+func (tw *thriftWriter) i32(id int16, v int32) {
+	tw.field(id, thriftI32)
+	tw.zigzag(int64(v))
+}
+
+func (tw *thriftWriter) i64(id int16, v int64) {
+	tw.field(id, thriftI64)
+	tw.zigzag(v)
+}
+
+func (tw *thriftWriter) string(id int16, s string) {
+	tw.field(id, thriftBinary)
+	tw.elementString(s)
+}
+
+// begin starts a struct, as field id of the struct it is in, or, if id is 0, as the
+// outermost struct or an element of a list
+func (tw *thriftWriter) begin(id int16) {
+	if id != 0 {
+		tw.field(id, thriftStruct)
+	}
+	tw.last = append(tw.last, 0)
+}
+
+func (tw *thriftWriter) end() {
+	tw.b = append(tw.b, 0)
+	tw.last = tw.last[:len(tw.last)-1]
+}
+
+// list starts a list of n elements of a kind, which are written after it
+func (tw *thriftWriter) list(id int16, kind byte, n int) {
+	tw.field(id, thriftList)
+	if n < 15 {
+		tw.b = append(tw.b, byte(n)<<4|kind)
+	} else {
+		tw.b = append(tw.b, 0xf0|kind)
+		tw.varint(uint64(n))
+	}
+}
+
+func (tw *thriftWriter) element(v int32) {
+	tw.zigzag(int64(v))
+}
+
+func (tw *thriftWriter) elementString(s string) {
+	tw.varint(uint64(len(s)))
+	tw.b = append(tw.b, s...)
+}
@@ -0,0 +1,125 @@
+package snps
+
+import (
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// Perf collects performance counters during a run, so that it can be seen whether
+// reading, comparing or writing is the bottleneck: how long each stage took and how many
+// records it handled, how long the comparing workers spent busy and waiting on the
+// channels either side of them, and how long the writer spent busy and waiting for
+// records. Give a new one to each run, in Options.Perf, and call Report once it returns
+type Perf struct {
+	start    time.Time
+	workers  int
+	counters [perfCounters]int64
+}
+
+// perfCounter is one of a Perf's counters. Times are in nanoseconds, and the workers'
+// are summed over them
+type perfCounter int
+
+const (
+	// the time from the start of the run that each stage ended
+	perfReadEnd perfCounter = iota
+	perfCompareEnd
+	perfWriteEnd
+	// records compared (which have all been read), and written
+	perfCompared
+	perfWritten
+	// time the workers spent comparing, waiting for records to compare, and waiting to
+	// pass them on to the writer
+	perfCompareBusy
+	perfCompareIn
+	perfCompareOut
+	// time the writer spent in the OutputWriter, and waiting for records
+	perfWriteBusy
+	perfWriteIn
+	perfCounters
+)
+
+// begin starts the clock for a run with the given number of comparing workers. The
+// other methods do nothing if p is nil, so that a run without one needn't check
+func (p *Perf) begin(workers int) {
+	if p == nil {
+		return
+	}
+	*p = Perf{start: time.Now(), workers: workers}
+}
+
+// end records that a stage has ended, now
+func (p *Perf) end(stage perfCounter) {
+	if p == nil {
+		return
+	}
+	atomic.StoreInt64(&p.counters[stage], int64(time.Since(p.start)))
+}
+
+// add adds the time since t to a counter
+func (p *Perf) add(counter perfCounter, t time.Time) {
+	if p == nil {
+		return
+	}
+	atomic.AddInt64(&p.counters[counter], int64(time.Since(t)))
+}
+
+// count adds one to a counter
+func (p *Perf) count(counter perfCounter) {
+	if p == nil {
+		return
+	}
+	atomic.AddInt64(&p.counters[counter], 1)
+}
+
+// Report writes the counters to w, with the stage that looks like the bottleneck. It
+// should be called once the run has returned
+func (p *Perf) Report(w io.Writer) error {
+	seconds := func(ns int64) float64 {
+		return time.Duration(ns).Seconds()
+	}
+	rate := func(records int64, ns int64) float64 {
+		if ns <= 0 {
+			return 0
+		}
+		return float64(records) / seconds(ns)
+	}
+	percent := func(part int64, whole int64) float64 {
+		if whole <= 0 {
+			return 0
+		}
+		return 100 * float64(part) / float64(whole)
+	}
+
+	c := p.counters
+	// the workers' time, and the writer's, is split between being busy and waiting on
+	// the stage before or after them
+	workerTime := int64(p.workers) * c[perfCompareEnd]
+	lines := []string{
+		fmt.Sprintf("read: %d records in %.3fs (%.1f records/s)", c[perfCompared], seconds(c[perfReadEnd]), rate(c[perfCompared], c[perfReadEnd])),
+		fmt.Sprintf("compare: %d records in %.3fs (%.1f records/s); the workers (%d) were %.1f%% busy, %.1f%% waiting for records to compare and %.1f%% waiting to pass them on",
+			c[perfCompared], seconds(c[perfCompareEnd]), rate(c[perfCompared], c[perfCompareEnd]), p.workers,
+			percent(c[perfCompareBusy], workerTime), percent(c[perfCompareIn], workerTime), percent(c[perfCompareOut], workerTime)),
+		fmt.Sprintf("write: %d records in %.3fs (%.1f records/s); the writer was %.1f%% busy and %.1f%% waiting for records to write",
+			c[perfWritten], seconds(c[perfWriteEnd]), rate(c[perfWritten], c[perfWriteEnd]), percent(c[perfWriteBusy], c[perfWriteEnd]), percent(c[perfWriteIn], c[perfWriteEnd])),
+	}
+
+	// the workers sit between the reader and the writer, so where their time goes says
+	// which of the three is holding the others up
+	bottleneck := "comparing"
+	if c[perfCompareIn] > c[perfCompareBusy] && c[perfCompareIn] >= c[perfCompareOut] {
+		bottleneck = "reading"
+	} else if c[perfCompareOut] > c[perfCompareBusy] {
+		bottleneck = "writing"
+	}
+	lines = append(lines, "bottleneck: "+bottleneck)
+
+	for _, line := range lines {
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package snps
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/benjamincjackson/snps/pkg/encoding"
+	"github.com/benjamincjackson/snps/pkg/fastaio"
+)
+
+// Profile is a set of changes that a hypothesised variant has, e.g. A23403G and C3037T
+type Profile []SNP
+
+// ReadProfile reads a profile: changes such as A23403G, separated by new lines, commas,
+// "|" or spaces. Lines starting with # are comments
+func ReadProfile(r io.Reader) (Profile, error) {
+	p := make(Profile, 0)
+	s := bufio.NewScanner(r)
+	for line := 1; s.Scan(); line++ {
+		text := strings.TrimSpace(s.Text())
+		if strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.FieldsFunc(text, func(r rune) bool {
+			return r == ',' || r == '|' || r == ' ' || r == '\t'
+		})
+		for _, field := range fields {
+			snp, err := ParseSNP(strings.ToUpper(field))
+			if err != nil || snp.Contig != "" {
+				return nil, fmt.Errorf("%w: line %d: %s isn't a change like A23403G", ErrBadProfile, line, field)
+			}
+			p = append(p, snp)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if len(p) == 0 {
+		return nil, fmt.Errorf("%w: it has no changes", ErrBadProfile)
+	}
+	return p, nil
+}
+
+// ProfileMatch is how well a query matches a profile, at each of its sites: Matched if the
+// query has the profile's change, Missing if it is N, ? or a gap there, or an ambiguity
+// code that includes the change, and Mismatched otherwise. MismatchedSites and
+// MissingSites are the profile's changes at the sites that aren't matched
+type ProfileMatch struct {
+	Query           string
+	Matched         int
+	Mismatched      int
+	Missing         int
+	MismatchedSites []SNP
+	MissingSites    []SNP
+}
+
+// RankProfile compares each query in rQ with profile, at the sites it lists, and returns
+// the queries ranked by how completely they match it: by the number of sites matched,
+// then the number mismatched, then their order in rQ. opts.IDs and the Include and
+// Exclude filters are applied. The profile's reference alleles have to be those of refSeq
+func RankProfile(rQ io.Reader, refSeq []byte, profile Profile, opts Options) ([]ProfileMatch, error) {
+	EA := encoding.MakeEncodingArray()
+	if opts.HardGaps {
+		EA = encoding.MakeEncodingArrayHardGaps()
+	}
+	DA := encoding.MakeDecodingArray()
+	alts := make([]byte, len(profile))
+	for i, snp := range profile {
+		if snp.Position > len(refSeq) {
+			return nil, fmt.Errorf("%w: %s is beyond the end of the reference", ErrBadProfile, snp)
+		}
+		if DA[refSeq[snp.Position-1]] != snp.Ref {
+			return nil, fmt.Errorf("%w: %s, but the reference has %s there", ErrBadProfile, snp, DA[refSeq[snp.Position-1]])
+		}
+		alts[i] = EA[snp.Alt[0]]
+		if alts[i] == 0 {
+			return nil, fmt.Errorf("%w: %s", ErrBadProfile, snp)
+		}
+	}
+
+	matches := make([]ProfileMatch, 0)
+	err := eachRecord(rQ, opts.HardGaps, func(FR fastaio.EncodedFastaRecord) error {
+		if !opts.keep(FR) {
+			return nil
+		}
+		seq, err := opts.resolveQuestionMarks(FR.Seq, FR.ID, FR.Idx+1)
+		if err != nil {
+			return err
+		}
+		if len(seq) != len(refSeq) {
+			return &RecordError{Record: FR.ID, Index: FR.Idx + 1, Err: ErrLengthMismatch}
+		}
+		m := ProfileMatch{Query: opts.IDs.apply(FR.ID), MismatchedSites: make([]SNP, 0), MissingSites: make([]SNP, 0)}
+		for i, snp := range profile {
+			nuc := seq[snp.Position-1]
+			switch {
+			case nuc == alts[i]:
+				m.Matched++
+			case nuc == 240 || nuc == 242 || nuc == 244 || (nuc&8 != 8 && nuc&alts[i] >= 16):
+				m.Missing++
+				m.MissingSites = append(m.MissingSites, snp)
+			default:
+				m.Mismatched++
+				m.MismatchedSites = append(m.MismatchedSites, snp)
+			}
+		}
+		matches = append(matches, m)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].Matched != matches[j].Matched {
+			return matches[i].Matched > matches[j].Matched
+		}
+		return matches[i].Mismatched < matches[j].Mismatched
+	})
+	return matches, nil
+}
+
+// WriteProfileMatches writes matches in csv format, one line per query, with the counts
+// of sites matched, mismatched and missing, the proportion of the profile matched, and
+// the changes that are mismatched and missing joined by "|"
+func WriteProfileMatches(w io.Writer, matches []ProfileMatch) error {
+	bw := bufio.NewWriter(w)
+	_, err := bw.WriteString("query,matched,mismatched,missing,proportion_matched,mismatched_sites,missing_sites\n")
+	if err != nil {
+		return err
+	}
+	join := func(SNPs []SNP) string {
+		s := make([]string, len(SNPs))
+		for i, snp := range SNPs {
+			s[i] = snp.String()
+		}
+		return strings.Join(s, "|")
+	}
+	for _, m := range matches {
+		total := m.Matched + m.Mismatched + m.Missing
+		prop := strconv.FormatFloat(float64(m.Matched)/float64(total), 'f', 4, 64)
+		line := csvField(m.Query) + "," + strconv.Itoa(m.Matched) + "," + strconv.Itoa(m.Mismatched) + "," + strconv.Itoa(m.Missing) + "," + prop + "," + join(m.MismatchedSites) + "," + join(m.MissingSites)
+		_, err := bw.WriteString(line + "\n")
+		if err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
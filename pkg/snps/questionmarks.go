@@ -0,0 +1,58 @@
+package snps
+
+import (
+	"fmt"
+)
+
+// What to do with ? in the reference and queries. By default it is kept as its own
+// code, which is missing data like N but is reported as ? and isn't compatible with
+// gaps in the same way. Alignment producers use it with different meanings, so it can
+// instead be read as N or as a gap, or be an error
+const (
+	QuestionMarkN     = "n"
+	QuestionMarkGap   = "gap"
+	QuestionMarkError = "error"
+)
+
+// checkQuestionMarks returns an error if policy isn't one of the QuestionMark constants
+// or ""
+func checkQuestionMarks(policy string) error {
+	switch policy {
+	case "", QuestionMarkN, QuestionMarkGap, QuestionMarkError:
+		return nil
+	}
+	return fmt.Errorf("%w for ?: %s (should be n, gap or error)", ErrUnknownPolicy, policy)
+}
+
+// resolveQuestionMarks applies opts.QuestionMarks to seq, the sequence of record id, which
+// is the index-th in its alignment (0 if it isn't known). If
+// seq has a ? and is changed, a copy is returned, so that a shared reference is left
+// alone
+func (opts Options) resolveQuestionMarks(seq []byte, id string, index int) ([]byte, error) {
+	if opts.QuestionMarks == "" {
+		return seq, nil
+	}
+	// ? is encoded as 242 whether or not gaps are hard
+	copied := false
+	for i, nuc := range seq {
+		if nuc != 242 {
+			continue
+		}
+		if opts.QuestionMarks == QuestionMarkError {
+			return nil, &RecordError{Record: id, Index: index, Position: i + 1, Err: ErrQuestionMark}
+		}
+		if !copied {
+			seq = append([]byte(nil), seq...)
+			copied = true
+		}
+		switch {
+		case opts.QuestionMarks == QuestionMarkN:
+			seq[i] = 240
+		case opts.HardGaps:
+			seq[i] = 4
+		default:
+			seq[i] = 244
+		}
+	}
+	return seq, nil
+}
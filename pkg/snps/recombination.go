@@ -0,0 +1,186 @@
+package snps
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/benjamincjackson/snps/pkg/fastaio"
+)
+
+// Parents are two or more candidate parent sequences, aligned to the reference, that
+// the windows of each query are assigned to, as a lightweight screen for recombinants.
+// Only the informative sites, where the parents are all A, C, G or T and not all the
+// same, are compared
+type Parents struct {
+	Names  []string
+	seqs   [][]byte
+	sites  []int // informative sites, 0-based
+	window int
+}
+
+// Segment is a run of a query that is closest to one parent. Start and End are the
+// (1-based) first and last informative sites in it
+type Segment struct {
+	Parent string
+	Start  int
+	End    int
+}
+
+// ReadParents reads parent sequences in fasta format, aligned to the reference. Queries
+// are split into windows of window bases, and each window is assigned to the parent it
+// differs least from at the informative sites in it
+func ReadParents(r io.Reader, window int) (*Parents, error) {
+	if window < 1 {
+		return nil, errors.New("parent window must be at least 1")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cErr := make(chan error)
+	cFR := make(chan fastaio.EncodedFastaRecord)
+	cDone := make(chan bool)
+
+	go fastaio.ReadEncodeAlignmentContext(ctx, r, false, cFR, cErr, cDone)
+
+	p := &Parents{window: window}
+	for n := 1; n > 0; {
+		select {
+		case err := <-cErr:
+			return nil, err
+		case FR := <-cFR:
+			p.Names = append(p.Names, FR.ID)
+			p.seqs = append(p.seqs, FR.Seq)
+		case <-cDone:
+			n--
+		}
+	}
+
+	if len(p.seqs) < 2 {
+		return nil, errors.New("need at least two parents, but got " + strconv.Itoa(len(p.seqs)))
+	}
+	length := len(p.seqs[0])
+	for _, seq := range p.seqs {
+		if len(seq) < length {
+			length = len(seq)
+		}
+	}
+	for i := 0; i < length; i++ {
+		informative := false
+		for _, seq := range p.seqs {
+			if seq[i]&8 != 8 {
+				informative = false
+				break
+			}
+			if seq[i] != p.seqs[0][i] {
+				informative = true
+			}
+		}
+		if informative {
+			p.sites = append(p.sites, i)
+		}
+	}
+
+	return p, nil
+}
+
+// Assign returns the segments of seq that are closest to each parent, in order. A
+// window is assigned to the parent it has the fewest differences from at informative
+// sites, if there is just one. Windows without informative sites that the query has
+// data at, or where parents tie, are left out, so that segments either side of them
+// are joined if they have the same parent
+func (p *Parents) Assign(seq []byte) []Segment {
+	segments := make([]Segment, 0)
+
+	// the informative sites that the query has data at, in the current window
+	window := make([]int, 0)
+	flush := func() {
+		if len(window) == 0 {
+			return
+		}
+		best, bestDiffs, tie := -1, 0, false
+		for parent, pseq := range p.seqs {
+			diffs := 0
+			for _, site := range window {
+				if seq[site] != pseq[site] {
+					diffs++
+				}
+			}
+			switch {
+			case best == -1 || diffs < bestDiffs:
+				best, bestDiffs, tie = parent, diffs, false
+			case diffs == bestDiffs:
+				tie = true
+			}
+		}
+		if !tie {
+			start, end := window[0]+1, window[len(window)-1]+1
+			if n := len(segments); n > 0 && segments[n-1].Parent == p.Names[best] {
+				segments[n-1].End = end
+			} else {
+				segments = append(segments, Segment{Parent: p.Names[best], Start: start, End: end})
+			}
+		}
+		window = window[:0]
+	}
+
+	current := 0
+	for _, site := range p.sites {
+		if site >= len(seq) {
+			break
+		}
+		if site/p.window != current {
+			flush()
+			current = site / p.window
+		}
+		if seq[site]&8 == 8 {
+			window = append(window, site)
+		}
+	}
+	flush()
+
+	return segments
+}
+
+// formatSegments returns segments in the form A:1-21000|B:21500-29000
+func formatSegments(segments []Segment) string {
+	s := make([]string, len(segments))
+	for i, seg := range segments {
+		s[i] = seg.Parent + ":" + strconv.Itoa(seg.Start) + "-" + strconv.Itoa(seg.End)
+	}
+	return strings.Join(s, "|")
+}
+
+// formatBreakpoints returns the ranges that the breakpoints between segments are in, in
+// the form 21000-21500|...: between the last informative site of one segment and the
+// first of the next
+func formatBreakpoints(segments []Segment) string {
+	s := make([]string, 0)
+	for i := 1; i < len(segments); i++ {
+		s = append(s, strconv.Itoa(segments[i-1].End)+"-"+strconv.Itoa(segments[i].Start))
+	}
+	return strings.Join(s, "|")
+}
+
+// parseSegments is the inverse of formatSegments
+func parseSegments(s string) ([]Segment, error) {
+	items := splitList(s)
+	segments := make([]Segment, len(items))
+	for i, item := range items {
+		j := strings.LastIndex(item, ":")
+		bounds := strings.SplitN(item[j+1:], "-", 2)
+		if j < 1 || len(bounds) != 2 {
+			return nil, errors.New("bad segment: " + item)
+		}
+		start, err1 := strconv.Atoi(bounds[0])
+		end, err2 := strconv.Atoi(bounds[1])
+		if err1 != nil || err2 != nil {
+			return nil, errors.New("bad segment: " + item)
+		}
+		segments[i] = Segment{Parent: item[:j], Start: start, End: end}
+	}
+	return segments, nil
+}
@@ -0,0 +1,146 @@
+package snps
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/benjamincjackson/snps/pkg/fastaio"
+)
+
+// Region is the stretch of one record of a reference, e.g. one locus of a bacterial
+// chromosome, that a run is restricted to, from Start to End, 1-based and inclusive. An
+// End of 0 is the end of the record
+type Region struct {
+	Contig string
+	Start  int
+	End    int
+}
+
+// ParseRegion reads a region written as samtools writes them: contig, contig:start-end
+// or contig:start-, where the numbers may have commas in them, e.g. chr1:10,000-20,000
+func ParseRegion(s string) (Region, error) {
+	i := strings.LastIndexByte(s, ':')
+	if i < 0 {
+		if s == "" {
+			return Region{}, fmt.Errorf("%w: it is empty", ErrBadRegion)
+		}
+		return Region{Contig: s, Start: 1}, nil
+	}
+	r := Region{Contig: s[:i]}
+	ends := strings.SplitN(strings.ReplaceAll(s[i+1:], ",", ""), "-", 2)
+	var err error
+	r.Start, err = strconv.Atoi(ends[0])
+	if err != nil || r.Start < 1 || r.Contig == "" {
+		return Region{}, fmt.Errorf("%w: %s", ErrBadRegion, s)
+	}
+	r.End = r.Start
+	if len(ends) == 2 {
+		r.End = 0
+		if ends[1] != "" {
+			r.End, err = strconv.Atoi(ends[1])
+			if err != nil || r.End < r.Start {
+				return Region{}, fmt.Errorf("%w: %s", ErrBadRegion, s)
+			}
+		}
+	}
+	return r, nil
+}
+
+// String writes the region as ParseRegion reads it
+func (r Region) String() string {
+	if r.End == 0 {
+		return fmt.Sprintf("%s:%d-", r.Contig, r.Start)
+	}
+	return fmt.Sprintf("%s:%d-%d", r.Contig, r.Start, r.End)
+}
+
+// bounds returns the region's 0-based start and end (exclusive) in a record of length
+// bases, or an error if it doesn't fit in it
+func (r Region) bounds(length int) (int, int, error) {
+	end := r.End
+	if end == 0 {
+		end = length
+	}
+	if r.Start > length || end > length {
+		return 0, 0, fmt.Errorf("%w: %s is outside %s, which is %d long", ErrBadRegion, r, r.Contig, length)
+	}
+	return r.Start - 1, end, nil
+}
+
+// Mask returns m with everything outside the region in a reference of length bases
+// masked as well, so that only the region is compared
+func (r Region) Mask(length int, m Mask) Mask {
+	start, end, err := r.bounds(length)
+	if err != nil {
+		start, end = 0, 0
+	}
+	masked := make(Mask, length)
+	copy(masked, m)
+	for i := range masked {
+		if i < start || i >= end {
+			masked[i] = true
+		}
+	}
+	return masked
+}
+
+// regionReference returns the region of a reference of length bases, whose bases are
+// read by read, in the reference's coordinates: it is the length of the whole record,
+// and N outside the region, which Region.Mask masks
+func regionReference(r Region, length int, read func(start int, end int) ([]byte, error)) ([]byte, error) {
+	start, end, err := r.bounds(length)
+	if err != nil {
+		return nil, err
+	}
+	bases, err := read(start, end)
+	if err != nil {
+		return nil, err
+	}
+	ref := bytes.Repeat([]byte{240}, length)
+	copy(ref[start:end], bases)
+	return ref, nil
+}
+
+// ReadReferenceRegion is ReadReference for the region of one record of a reference made
+// up of several, e.g. a bacterial chromosome and its plasmids. The record whose ID is
+// the region's contig is read, and the sequence outside the region is replaced with N.
+// The rest of the reference is read through, but not kept
+func ReadReferenceRegion(rR io.Reader, r Region, hardGaps bool) ([]byte, error) {
+	var ref []byte
+	err := eachRecord(rR, hardGaps, func(FR fastaio.EncodedFastaRecord) error {
+		if FR.ID == r.Contig && ref == nil {
+			ref = FR.Seq
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if ref == nil {
+		return nil, fmt.Errorf("%w: it has no record called %s", ErrBadReference, r.Contig)
+	}
+	return regionReference(r, len(ref), func(start int, end int) ([]byte, error) {
+		return ref[start:end], nil
+	})
+}
+
+// ReadIndexedReferenceRegion is ReadReferenceRegion for a fasta file indexed with samtools
+// faidx, of which only the region itself is read, using the index in fai
+func ReadIndexedReferenceRegion(rR io.ReaderAt, fai io.Reader, r Region, hardGaps bool) ([]byte, error) {
+	records, err := fastaio.ReadFaidx(fai)
+	if err != nil {
+		return nil, err
+	}
+	for _, rec := range records {
+		if rec.Name != r.Contig {
+			continue
+		}
+		return regionReference(r, int(rec.Length), func(start int, end int) ([]byte, error) {
+			return fastaio.ReadFaidxRange(rR, rec, int64(start), int64(end), hardGaps)
+		})
+	}
+	return nil, fmt.Errorf("%w: its index has no record called %s", ErrBadReference, r.Contig)
+}
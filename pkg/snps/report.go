@@ -0,0 +1,269 @@
+package snps
+
+import (
+	"bufio"
+	"html/template"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// reportTop is the number of changes in a report's chart of the most common ones, and of
+// queries in its list of those with the most missing data
+const reportTop = 20
+
+// reportWriter writes a standalone HTML report of a run, for sharing with people who
+// don't use the command line: summary statistics, a chart of the most common changes, a
+// histogram of the number of SNPs per query, an overview of missing data (if it was
+// counted, with Options.CountMissing) and a table of every change, filtered as it is for
+// aggregate output. It has no scripts or external resources, so it can be emailed
+type reportWriter struct {
+	w             *bufio.Writer
+	opts          WriterOptions
+	counts        []int
+	missing       []queryMissing
+	countsMissing bool
+}
+
+type queryMissing struct {
+	Query   string
+	Missing int
+}
+
+func newReportWriter(w io.Writer, opts WriterOptions) OutputWriter {
+	return &reportWriter{w: bufio.NewWriter(w), opts: opts}
+}
+
+func (rw *reportWriter) WriteHeader() error {
+	return nil
+}
+
+func (rw *reportWriter) WriteRecord(record Record) error {
+	rw.counts = append(rw.counts, record.Distance)
+	rw.missing = append(rw.missing, queryMissing{Query: record.Query, Missing: record.MissingSites})
+	return nil
+}
+
+// reportChange is one row of a report's tables of changes. Width is its proportion as a
+// percentage of the largest in the table, for drawing a bar
+type reportChange struct {
+	Change     string
+	Annotation string
+	Count      int
+	Proportion string
+	Width      float64
+}
+
+// reportBin is one bar of a histogram
+type reportBin struct {
+	Label string
+	Count int
+	Width float64
+}
+
+type reportData struct {
+	Stats            [][2]string
+	Annotated        bool
+	Top              []reportChange
+	Changes          []reportChange
+	SNPHistogram     []reportBin
+	MissingCounted   bool
+	MissingHistogram []reportBin
+	MostMissing      []queryMissing
+}
+
+func (rw *reportWriter) NeedsAggregate() bool {
+	return true
+}
+
+func (rw *reportWriter) WriteAggregate(agg Aggregate) error {
+	data := reportData{Annotated: rw.opts.Annotated, MissingCounted: rw.opts.MissingSites}
+
+	changes := make([]Change, 0, len(agg.Changes))
+	for _, change := range agg.Changes {
+		// aggregates count missing data too, if it was looked for
+		if change.SNP.Alt == "N" || change.SNP.Alt == "?" {
+			continue
+		}
+		changes = append(changes, change)
+	}
+	singletons := 0
+	for _, change := range changes {
+		if change.Count == 1 {
+			singletons++
+		}
+	}
+	data.Stats = [][2]string{
+		{"Queries", strconv.Itoa(len(rw.counts))},
+		{"Distinct SNPs", strconv.Itoa(len(changes))},
+		{"Singleton SNPs", strconv.Itoa(singletons)},
+		{"Median SNPs per query", strconv.FormatFloat(medianInt(rw.counts), 'f', 1, 64)},
+	}
+
+	row := func(change Change) reportChange {
+		prop := 0.0
+		if agg.Queries > 0 {
+			prop = float64(change.Count) / float64(agg.Queries)
+		}
+		return reportChange{Change: change.SNP.String(), Annotation: change.SNP.Annotation, Count: change.Count, Proportion: strconv.FormatFloat(prop, 'f', 4, 64), Width: 100 * prop}
+	}
+	for _, change := range changes {
+		prop := float64(change.Count) / float64(agg.Queries)
+		if prop < rw.opts.Threshold || change.Count < rw.opts.MinCount {
+			continue
+		}
+		if rw.opts.UnambiguousAlts && !isACGT(change.SNP.Alt) {
+			continue
+		}
+		data.Changes = append(data.Changes, row(change))
+	}
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Count > changes[j].Count
+	})
+	for i := 0; i < len(changes) && i < reportTop; i++ {
+		data.Top = append(data.Top, row(changes[i]))
+	}
+	scale(data.Top)
+
+	data.SNPHistogram = histogram(rw.counts)
+	if data.MissingCounted {
+		missing := make([]int, len(rw.missing))
+		for i, q := range rw.missing {
+			missing[i] = q.Missing
+		}
+		data.MissingHistogram = histogram(missing)
+		sort.SliceStable(rw.missing, func(i, j int) bool {
+			return rw.missing[i].Missing > rw.missing[j].Missing
+		})
+		for i := 0; i < len(rw.missing) && i < reportTop && rw.missing[i].Missing > 0; i++ {
+			data.MostMissing = append(data.MostMissing, rw.missing[i])
+		}
+	}
+
+	return reportTemplate.Execute(rw.w, data)
+}
+
+func (rw *reportWriter) Close() error {
+	return rw.w.Flush()
+}
+
+// scale sets the widths of rows relative to the widest
+func scale(rows []reportChange) {
+	max := 0.0
+	for _, row := range rows {
+		if row.Width > max {
+			max = row.Width
+		}
+	}
+	for i := range rows {
+		if max > 0 {
+			rows[i].Width = 100 * rows[i].Width / max
+		}
+	}
+}
+
+// histogram bins values, one bin per value if there are at most 30 of them from 0 to
+// the largest, and otherwise 20 bins of equal width
+func histogram(values []int) []reportBin {
+	if len(values) == 0 {
+		return nil
+	}
+	max := 0
+	for _, v := range values {
+		if v > max {
+			max = v
+		}
+	}
+	width := 1
+	if max >= 30 {
+		width = max/20 + 1
+	}
+	bins := make([]reportBin, max/width+1)
+	for i := range bins {
+		bins[i].Label = strconv.Itoa(i * width)
+		if width > 1 {
+			bins[i].Label += "–" + strconv.Itoa((i+1)*width-1)
+		}
+	}
+	most := 0
+	for _, v := range values {
+		bins[v/width].Count++
+		if bins[v/width].Count > most {
+			most = bins[v/width].Count
+		}
+	}
+	for i := range bins {
+		bins[i].Width = 100 * float64(bins[i].Count) / float64(most)
+	}
+	return bins
+}
+
+// medianInt returns the median of values, which it sorts, or 0 if there are none
+func medianInt(values []int) float64 {
+	n := len(values)
+	if n == 0 {
+		return 0
+	}
+	sort.Ints(values)
+	if n%2 == 0 {
+		return float64(values[n/2-1]+values[n/2]) / 2
+	}
+	return float64(values[n/2])
+}
+
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>snps report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { padding: 0.2em 0.8em; text-align: left; border-bottom: 1px solid #ddd; }
+td.bar { width: 30em; }
+div.bar { background: #4a7fb0; height: 1em; }
+</style>
+</head>
+<body>
+<h1>snps report</h1>
+
+<h2>Summary</h2>
+<table>
+{{range .Stats}}<tr><th>{{index . 0}}</th><td>{{index . 1}}</td></tr>
+{{end}}</table>
+
+<h2>Most common changes</h2>
+{{if .Top}}<table>
+<tr><th>Change</th>{{if $.Annotated}}<th>Annotation</th>{{end}}<th>Queries</th><th>Proportion</th><th></th></tr>
+{{range .Top}}<tr><td>{{.Change}}</td>{{if $.Annotated}}<td>{{.Annotation}}</td>{{end}}<td>{{.Count}}</td><td>{{.Proportion}}</td><td class="bar"><div class="bar" style="width: {{printf "%.1f" .Width}}%"></div></td></tr>
+{{end}}</table>
+{{else}}<p>No SNPs were found.</p>
+{{end}}
+<h2>SNPs per query</h2>
+{{if .SNPHistogram}}<table>
+<tr><th>SNPs</th><th>Queries</th><th></th></tr>
+{{range .SNPHistogram}}<tr><td>{{.Label}}</td><td>{{.Count}}</td><td class="bar"><div class="bar" style="width: {{printf "%.1f" .Width}}%"></div></td></tr>
+{{end}}</table>
+{{else}}<p>There were no queries.</p>
+{{end}}
+<h2>Missing data</h2>
+{{if .MissingCounted}}<table>
+<tr><th>Missing sites</th><th>Queries</th><th></th></tr>
+{{range .MissingHistogram}}<tr><td>{{.Label}}</td><td>{{.Count}}</td><td class="bar"><div class="bar" style="width: {{printf "%.1f" .Width}}%"></div></td></tr>
+{{end}}</table>
+{{if .MostMissing}}<h3>Queries with the most missing data</h3>
+<table>
+<tr><th>Query</th><th>Missing sites</th></tr>
+{{range .MostMissing}}<tr><td>{{.Query}}</td><td>{{.Missing}}</td></tr>
+{{end}}</table>
+{{end}}{{else}}<p>Missing data wasn't counted.</p>
+{{end}}
+<h2>All changes</h2>
+{{if .Changes}}<table>
+<tr><th>Change</th>{{if $.Annotated}}<th>Annotation</th>{{end}}<th>Queries</th><th>Proportion</th></tr>
+{{range .Changes}}<tr><td>{{.Change}}</td>{{if $.Annotated}}<td>{{.Annotation}}</td>{{end}}<td>{{.Count}}</td><td>{{.Proportion}}</td></tr>
+{{end}}</table>
+{{else}}<p>No changes passed the filters.</p>
+{{end}}</body>
+</html>
+`))
@@ -0,0 +1,211 @@
+package snps
+
+import "sort"
+
+// SchemaVersion is the version of the output schemas. It goes up whenever a column of a
+// built-in output format is renamed, removed or changes type, so that loaders can tell
+// which schema a file was written with. Adding a column doesn't change it
+const SchemaVersion = 1
+
+// The kinds of file that output formats write
+const (
+	KindCSV     = "csv"
+	KindTSV     = "tsv"
+	KindFasta   = "fasta"
+	KindVCF     = "vcf"
+	KindHTML    = "html"
+	KindBinary  = "binary"
+	KindParquet = "parquet"
+	KindJSON    = "json"
+)
+
+// The types of the columns of csv, tsv and parquet output. Lists are of strings,
+// separated by |
+const (
+	TypeString  = "string"
+	TypeInteger = "integer"
+	TypeNumber  = "number"
+	TypeBoolean = "boolean"
+	TypeDate    = "date"
+	TypeList    = "list"
+)
+
+// Column is one column of a csv, tsv or parquet output format. Option is the WriterOptions
+// field that adds it, or "" if it is always written. Columns whose names depend on the
+// data, e.g. one per group, have a Name in braces, e.g. {group}, and are Repeated if
+// there can be more than one. Nullable columns can be empty, e.g. a date that couldn't be
+// parsed
+type Column struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Nullable    bool   `json:"nullable,omitempty"`
+	Repeated    bool   `json:"repeated,omitempty"`
+	Option      string `json:"option,omitempty"`
+	Description string `json:"description"`
+}
+
+// Schema describes what an output format writes: its kind of file and, if it is csv, tsv
+// or parquet, its columns in the order that they are written
+type Schema struct {
+	Format      string   `json:"format"`
+	Version     int      `json:"version"`
+	Kind        string   `json:"kind"`
+	Description string   `json:"description"`
+	Columns     []Column `json:"columns,omitempty"`
+}
+
+// OutputSchema returns the schema of a built-in output format, and false if there isn't
+// one, e.g. for an output format registered by an application
+func OutputSchema(format string) (Schema, bool) {
+	s, ok := schemas[format]
+	if ok {
+		s.Format, s.Version = format, SchemaVersion
+	}
+	return s, ok
+}
+
+// OutputSchemas returns the schemas of the built-in output formats, sorted by format
+func OutputSchemas() []Schema {
+	formats := make([]string, 0, len(schemas))
+	for format := range schemas {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	all := make([]Schema, len(formats))
+	for i, format := range formats {
+		all[i], _ = OutputSchema(format)
+	}
+	return all
+}
+
+// change is the first column of most aggregate formats
+var changeColumn = Column{Name: "change", Type: TypeString, Description: "the change, e.g. A23403G, prefixed with its contig if the reference is made up of contigs, e.g. HA:A100G"}
+
+// longColumns are the columns of the SNPs in tidy form, one row per SNP
+var longColumns = []Column{
+	{Name: "query", Type: TypeString, Description: "the query's ID"},
+	{Name: "contig", Type: TypeString, Option: "Contigs", Description: "the contig of the reference that the SNP is in"},
+	{Name: "position", Type: TypeInteger, Description: "the SNP's position in the reference, from 1"},
+	{Name: "ref", Type: TypeString, Description: "the reference's allele"},
+	{Name: "alt", Type: TypeString, Description: "the query's allele"},
+	{Name: "annotation", Type: TypeString, Nullable: true, Option: "Annotated", Description: "the SNP's amino acid consequences, separated by ;, e.g. S:D614G"},
+}
+
+var statisticColumns = []Column{
+	{Name: "statistic", Type: TypeString, Description: "the name of the statistic"},
+	{Name: "value", Type: TypeString, Nullable: true, Description: "its value, which is a number, a date or a list depending on the statistic"},
+}
+
+var schemas = map[string]Schema{
+	"csv": {Kind: KindCSV, Description: "the SNPs in each query, one row per query", Columns: []Column{
+		{Name: "query", Type: TypeString, Description: "the query's ID"},
+		{Name: "contig", Type: TypeString, Option: "Contigs", Description: "the contig of the reference that the query was compared with"},
+		{Name: "description", Type: TypeString, Option: "Description", Description: "the query's whole header line"},
+		{Name: "source", Type: TypeString, Option: "Source", Description: "the file the query was read from"},
+		{Name: "date", Type: TypeDate, Nullable: true, Option: "Dates", Description: "the query's collection date, YYYY-MM-DD"},
+		{Name: "iso_week", Type: TypeString, Nullable: true, Option: "Dates", Description: "the ISO week of the date, e.g. 2021-W09"},
+		{Name: "epi_week", Type: TypeString, Nullable: true, Option: "Dates", Description: "the epidemiological (CDC/MMWR) week of the date, e.g. 2020-W53"},
+		{Name: "SNPs", Type: TypeList, Description: "the SNPs, e.g. A23403G"},
+		{Name: "annotated_SNPs", Type: TypeList, Option: "Annotated", Description: "the SNPs with their amino acid consequences, e.g. A23403G (S:D614G)"},
+		{Name: "codon_positions", Type: TypeList, Option: "CodonPositions", Description: "the SNPs with their codons and positions in them, e.g. A23403G (S:614:2)"},
+		{Name: "effects", Type: TypeList, Option: "Effects", Description: "the SNPs with their effects, e.g. A23403G (missense)"},
+		{Name: "weighted_SNPs", Type: TypeList, Option: "Weights", Description: "the SNPs with the weights of their sites, e.g. T8A (0.25)"},
+		{Name: "weighted_distance", Type: TypeNumber, Option: "Weights", Description: "the sum of the weights of the SNPs"},
+		{Name: "scored_SNPs", Type: TypeList, Option: "Scores", Description: "the SNPs with the scores of their sites, or NA, e.g. T8A (-2)"},
+		{Name: "flagged_SNPs", Type: TypeList, Option: "Contexts", Description: "the SNPs with the error-prone contexts they are in, if any, e.g. A100G (homopolymer:6)"},
+		{Name: "compatible_ambiguities", Type: TypeList, Option: "Ambiguities", Description: "the sites where the query resolves an ambiguity code in the reference or vice versa, e.g. R5A"},
+		{Name: "reference_resolutions", Type: TypeList, Option: "Resolutions", Description: "the sites where the reference is ambiguous and the query is A, C, G or T, e.g. R5A"},
+		{Name: "SNP_clusters", Type: TypeList, Option: "Clusters", Description: "the ranges spanned by dense clusters of SNPs, e.g. 100-150"},
+		{Name: "parents", Type: TypeList, Option: "Parents", Description: "the segments of the query closest to each parent, e.g. P1:1-5000"},
+		{Name: "breakpoints", Type: TypeList, Option: "Parents", Description: "the ranges between segments, e.g. 5000-5100"},
+		{Name: "amplicon_dropouts", Type: TypeList, Option: "Dropouts", Description: "the amplicons that have dropped out"},
+		{Name: "missing", Type: TypeList, Option: "Missing", Description: "the sites where the query is N or ? and the reference is A, C, G or T, e.g. A100N"},
+		{Name: "labels", Type: TypeList, Option: "Catalogue", Description: "the catalogued changes found, with their labels, e.g. A23403G (D614G)"},
+		{Name: "lineage", Type: TypeString, Option: "Lineages", Description: "the lineage that the query matches best"},
+		{Name: "lineage_score", Type: TypeNumber, Option: "Lineages", Description: "the Jaccard similarity between the query's SNPs and the lineage's"},
+	}},
+	"aggregate": {Kind: KindCSV, Description: "the proportion of queries that each change is found in, one row per change", Columns: []Column{
+		changeColumn,
+		{Name: "proportion", Type: TypeNumber, Description: "the proportion of queries with the change"},
+		{Name: "weighted_proportion", Type: TypeNumber, Option: "Weights", Description: "the proportion times the weight of the change's site"},
+		{Name: "score", Type: TypeNumber, Nullable: true, Option: "Scores", Description: "the score of the change's site, or NA"},
+		{Name: "context", Type: TypeString, Option: "Contexts", Description: "the error-prone context the change is in, e.g. homopolymer:6, or empty"},
+		{Name: "label", Type: TypeString, Option: "Catalogue", Description: "the change's label in the catalogue, or empty"},
+		{Name: "samples", Type: TypeList, Option: "WithSamples", Description: "the queries with the change, followed by ... if there are more than MaxSamples"},
+	}},
+	"stratified": {Kind: KindCSV, Description: "the proportion of queries in each group that each change is found in, one row per change", Columns: []Column{
+		changeColumn,
+		{Name: "{group}", Type: TypeNumber, Repeated: true, Description: "the proportion of the queries in the group with the change, one column per group in alphabetical order"},
+	}},
+	"association": {Kind: KindCSV, Description: "Fisher's exact test of each change for an association with one of two groups, A and B, one row per change", Columns: []Column{
+		changeColumn,
+		{Name: "{A}_count", Type: TypeInteger, Description: "the number of queries in the first group with the change"},
+		{Name: "{A}_proportion", Type: TypeNumber, Description: "the proportion of queries in the first group with the change"},
+		{Name: "{B}_count", Type: TypeInteger, Description: "the number of queries in the second group with the change"},
+		{Name: "{B}_proportion", Type: TypeNumber, Description: "the proportion of queries in the second group with the change"},
+		{Name: "odds_ratio", Type: TypeNumber, Description: "the odds ratio of the change in the first group against the second"},
+		{Name: "p_value", Type: TypeNumber, Description: "the p-value of Fisher's exact test"},
+		{Name: "adjusted_p_value", Type: TypeNumber, Description: "the p-value adjusted by Benjamini-Hochberg"},
+	}},
+	"discriminate": {Kind: KindCSV, Description: "a small set of changes that tells two groups, A and B, apart, in the order they were chosen", Columns: []Column{
+		changeColumn,
+		{Name: "{A}_count", Type: TypeInteger, Description: "the number of queries in the first group with the change"},
+		{Name: "{B}_count", Type: TypeInteger, Description: "the number of queries in the second group with the change"},
+		{Name: "pairs_separated", Type: TypeInteger, Description: "the number of pairs of queries from different groups that the change tells apart and earlier changes didn't"},
+		{Name: "cumulative_proportion_separated", Type: TypeNumber, Description: "the proportion of pairs told apart by this change and the earlier ones"},
+	}},
+	"trend": {Kind: KindCSV, Description: "a logistic growth rate over time of each change, one row per change", Columns: []Column{
+		changeColumn,
+		{Name: "count", Type: TypeInteger, Description: "the number of dated queries with the change"},
+		{Name: "proportion", Type: TypeNumber, Description: "the proportion of dated queries with the change"},
+		{Name: "growth_rate", Type: TypeNumber, Nullable: true, Description: "the change in log odds per week, or empty if the fit failed"},
+		{Name: "ci_lower", Type: TypeNumber, Nullable: true, Description: "the lower end of its 95% confidence interval"},
+		{Name: "ci_upper", Type: TypeNumber, Nullable: true, Description: "the upper end of its 95% confidence interval"},
+		{Name: "rising", Type: TypeBoolean, Nullable: true, Description: "whether the interval is above zero"},
+	}},
+	"spectrum": {Kind: KindCSV, Description: "the number of changes of each of the 12 substitution types, or of the 96 trinucleotide categories, one row per type", Columns: []Column{
+		{Name: "substitution", Type: TypeString, Description: "the substitution, e.g. C>T, from the pyrimidine strand if the spectrum is trinucleotide"},
+		{Name: "context", Type: TypeString, Option: "Trinucleotide", Description: "the substitution with the reference's bases either side of it, e.g. T[C>T]A"},
+		{Name: "changes", Type: TypeInteger, Description: "the number of distinct changes of the type"},
+		{Name: "count", Type: TypeInteger, Description: "the number of changes of the type summed over the queries they are in"},
+		{Name: "proportion", Type: TypeNumber, Description: "the proportion of the queries' substitutions that are of the type"},
+	}},
+	"counts": {Kind: KindCSV, Description: "the numbers of SNPs, ambiguities and missing sites in each query, one row per query", Columns: []Column{
+		{Name: "query", Type: TypeString, Description: "the query's ID"},
+		{Name: "SNPs", Type: TypeInteger, Description: "the number of SNPs"},
+		{Name: "ambiguities", Type: TypeInteger, Description: "the number of compatible ambiguities, if they were looked for"},
+		{Name: "missing", Type: TypeInteger, Description: "the number of missing sites, if they were looked for"},
+	}},
+	"distance-only": {Kind: KindCSV, Description: "the number of SNPs in each query, one row per query", Columns: []Column{
+		{Name: "query", Type: TypeString, Description: "the query's ID"},
+		{Name: "distance", Type: TypeInteger, Description: "the number of SNPs"},
+	}},
+	"summary": {Kind: KindCSV, Description: "summary statistics of the run, one row per statistic", Columns: statisticColumns},
+	"long":    {Kind: KindTSV, Description: "the SNPs in each query in tidy form, one row per SNP", Columns: longColumns},
+	"parquet": {Kind: KindParquet, Description: "the same table as long, as an Apache Parquet file", Columns: longColumns},
+	"clock":   {Kind: KindCSV, Description: "a root-to-tip regression of distance on date, one row per statistic", Columns: statisticColumns},
+	"distance": {Kind: KindCSV, Description: "the pairwise SNP distances between the queries, in the square layout; the long layout has query_a, query_b and distance columns, and the phylip layout isn't csv", Columns: []Column{
+		{Name: "query", Type: TypeString, Description: "the query's ID"},
+		{Name: "{query}", Type: TypeInteger, Repeated: true, Description: "the distance to each query, one column per query in the order they were read"},
+	}},
+	"presence": {Kind: KindCSV, Description: "which queries have which changes, one row per query", Columns: []Column{
+		{Name: "query", Type: TypeString, Description: "the query's ID"},
+		{Name: "{change}", Type: TypeInteger, Repeated: true, Description: "1 if the query has the change and 0 if it hasn't, one column per change"},
+	}},
+	"genes": {Kind: KindCSV, Description: "the numbers of nucleotide and amino acid changes in each gene of each query, one row per query per gene", Columns: []Column{
+		{Name: "query", Type: TypeString, Description: "the query's ID"},
+		{Name: "gene", Type: TypeString, Description: "the gene's name, from the annotation"},
+		{Name: "nucleotide_changes", Type: TypeInteger, Description: "the number of SNPs in the gene"},
+		{Name: "amino_acid_changes", Type: TypeInteger, Description: "the number of non-synonymous changes to the gene's codons"},
+	}},
+	"json":           {Kind: KindJSON, Description: "a JSON array of an object per query, with its ID in query and its SNPs in snps, an array of objects with position, ref and alt, and the fields that the options that add columns to csv output add"},
+	"ndjson":         {Kind: KindJSON, Description: "the objects of json output as newline-delimited JSON, one per line"},
+	"auspice":        {Kind: KindJSON, Description: "an Augur node-data JSON file of each query's SNPs (muts), amino acid changes by gene (aa_muts) and metadata, for augur export"},
+	"microreact":     {Kind: KindJSON, Description: "a JSON array of rows for Microreact, one per query, with its id, mutations, amino_acid_mutations and metadata"},
+	"index":          {Kind: KindBinary, Description: "an index of which samples have which changes, for snps search"},
+	"report":         {Kind: KindHTML, Description: "a standalone HTML report of the run"},
+	"vcf":            {Kind: KindVCF, Description: "a multi-sample VCF of the sites where any query has a SNP, with each query's haploid genotype"},
+	"gvcf":           {Kind: KindVCF, Description: "a VCF of the number of queries with each allele at the sites where any query has a SNP, with reference blocks"},
+	"population-vcf": {Kind: KindVCF, Description: "a sites-only VCF of the frequency of each change"},
+	"signature":      {Kind: KindFasta, Description: "each query's bases at the sites where any query has a SNP to A, C, G or T"},
+}
@@ -0,0 +1,124 @@
+package snps
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Search returns the samples in the index that match pattern, in index order. A pattern
+// is made of changes (e.g. A23403G), which match the samples that have them, combined
+// with NOT, AND and OR (in that order of precedence, and in any case) and parentheses. A
+// comma is the same as AND, so C23604A,A23403G matches samples with both. A change that
+// isn't in the index matches no samples
+func (idx *Index) Search(pattern string) ([]string, error) {
+	p := &patternParser{idx: idx, tokens: tokenize(pattern)}
+	b, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("%w: unexpected %s", ErrBadPattern, p.tokens[p.pos])
+	}
+	matches := make([]string, 0)
+	for i, sample := range idx.Samples {
+		if b.get(i) {
+			matches = append(matches, sample)
+		}
+	}
+	return matches, nil
+}
+
+// tokenize splits a pattern into changes, operators and parentheses
+func tokenize(pattern string) []string {
+	pattern = strings.NewReplacer("(", " ( ", ")", " ) ", ",", " , ").Replace(pattern)
+	return strings.Fields(pattern)
+}
+
+// patternParser parses a pattern by recursive descent, evaluating it as it goes
+type patternParser struct {
+	idx    *Index
+	tokens []string
+	pos    int
+}
+
+// next returns the next token in upper case, or "" at the end
+func (p *patternParser) next() string {
+	if p.pos == len(p.tokens) {
+		return ""
+	}
+	return strings.ToUpper(p.tokens[p.pos])
+}
+
+func (p *patternParser) or() (bitset, error) {
+	b, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.next() == "OR" {
+		p.pos++
+		c, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		b = b.or(c)
+	}
+	return b, nil
+}
+
+func (p *patternParser) and() (bitset, error) {
+	b, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+	for p.next() == "AND" || p.next() == "," {
+		p.pos++
+		c, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		b = b.and(c)
+	}
+	return b, nil
+}
+
+func (p *patternParser) not() (bitset, error) {
+	if p.next() == "NOT" {
+		p.pos++
+		b, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return b.not(len(p.idx.Samples)), nil
+	}
+	return p.term()
+}
+
+func (p *patternParser) term() (bitset, error) {
+	switch token := p.next(); token {
+	case "":
+		return nil, fmt.Errorf("%w: unexpected end", ErrBadPattern)
+	case "(":
+		p.pos++
+		b, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, fmt.Errorf("%w: missing )", ErrBadPattern)
+		}
+		p.pos++
+		return b, nil
+	case ")", ",", "AND", "OR":
+		return nil, fmt.Errorf("%w: unexpected %s", ErrBadPattern, p.tokens[p.pos])
+	default:
+		snp, err := ParseSNP(token)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrBadPattern, err)
+		}
+		p.pos++
+		if b, ok := p.idx.sets[snp.String()]; ok {
+			return b, nil
+		}
+		return newBitset(len(p.idx.Samples)), nil
+	}
+}
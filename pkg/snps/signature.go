@@ -0,0 +1,102 @@
+package snps
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// signatureWriter writes a short FASTA "signature" of each query: its bases at the union
+// of the sites where any query has a SNP to A, C, G or T, in order, with the reference's
+// base where it has no SNP. Signatures are compact enough to hash or cluster quickly.
+// If positions is not nil, the sites are written to it, one line per base of the
+// signatures, with the contig if contigs is true. Queries without a SNP at a site are
+// taken to have the reference there, unless missing data is included in their SNPs
+type signatureWriter struct {
+	w         *bufio.Writer
+	positions io.Writer
+	contigs   bool
+	queries   []string
+	alts      []map[string]string
+	sites     map[string]SNP
+}
+
+func newSignatureWriter(w io.Writer, opts WriterOptions) OutputWriter {
+	return &signatureWriter{w: bufio.NewWriter(w), positions: opts.SignaturePositions, contigs: opts.Contigs, sites: make(map[string]SNP)}
+}
+
+// siteKey is the key of a SNP's site, which is its contig and position
+func siteKey(snp SNP) string {
+	return snp.Contig + ":" + strconv.Itoa(snp.Position)
+}
+
+// the sites aren't known until every query has been read
+func (sw *signatureWriter) WriteHeader() error {
+	return nil
+}
+
+func (sw *signatureWriter) WriteRecord(record Record) error {
+	alts := make(map[string]string, len(record.SNPs))
+	for _, snp := range record.SNPs {
+		key := siteKey(snp)
+		alts[key] = snp.Alt
+		if _, ok := sw.sites[key]; !ok && isACGT(snp.Alt) {
+			sw.sites[key] = SNP{Contig: snp.Contig, Position: snp.Position, Ref: snp.Ref}
+		}
+	}
+	sw.queries = append(sw.queries, record.Query)
+	sw.alts = append(sw.alts, alts)
+	return nil
+}
+
+func (sw *signatureWriter) WriteAggregate(Aggregate) error {
+	sites := make([]Change, 0, len(sw.sites))
+	for _, snp := range sw.sites {
+		sites = append(sites, Change{SNP: snp})
+	}
+	sortChanges(sites)
+
+	if sw.positions != nil {
+		pw := bufio.NewWriter(sw.positions)
+		header := "position,ref"
+		if sw.contigs {
+			header = "contig," + header
+		}
+		if _, err := pw.WriteString(header + "\n"); err != nil {
+			return err
+		}
+		for _, site := range sites {
+			line := strconv.Itoa(site.SNP.Position) + "," + site.SNP.Ref
+			if sw.contigs {
+				line = csvField(site.SNP.Contig) + "," + line
+			}
+			if _, err := pw.WriteString(line + "\n"); err != nil {
+				return err
+			}
+		}
+		if err := pw.Flush(); err != nil {
+			return err
+		}
+	}
+
+	var sb strings.Builder
+	for i, query := range sw.queries {
+		sb.Reset()
+		for _, site := range sites {
+			if alt, ok := sw.alts[i][siteKey(site.SNP)]; ok {
+				sb.WriteString(alt)
+			} else {
+				sb.WriteString(site.SNP.Ref)
+			}
+		}
+		if _, err := sw.w.WriteString(">" + query + "\n" + sb.String() + "\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (sw *signatureWriter) Close() error {
+	return sw.w.Flush()
+}
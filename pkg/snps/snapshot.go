@@ -0,0 +1,93 @@
+package snps
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"time"
+)
+
+// SnapshotOptions say how often a snapshot writer writes: after every Every records, and
+// whenever a record arrives at least Interval after the last snapshot. Either can be 0
+// to not snapshot on it
+type SnapshotOptions struct {
+	Every    int
+	Interval time.Duration
+}
+
+// snapshotWriter writes the proportion of queries that each SNP has been found in so far
+// at intervals during a run, so that a dashboard can show a long run's results while it
+// is still going. Each snapshot is one line per SNP, with the time and the number of
+// queries so far, and is flushed as soon as it is written. The last snapshot, once all
+// the queries have been seen, is the same as the aggregate output. SNPs are filtered
+// as they are for the aggregate output
+type snapshotWriter struct {
+	w           *bufio.Writer
+	so          SnapshotOptions
+	threshold   float64
+	minCount    int
+	unambiguous bool
+	agg         *aggregator
+	last        time.Time // when the last snapshot was written
+	lastQueries int       // and how many queries it was of
+	now         func() time.Time
+}
+
+// NewSnapshotWriter returns an OutputWriter that writes snapshots of the aggregate so
+// far to w, as often as so says
+func NewSnapshotWriter(w io.Writer, so SnapshotOptions, opts WriterOptions) OutputWriter {
+	return &snapshotWriter{w: bufio.NewWriter(w), so: so, threshold: opts.Threshold, minCount: opts.MinCount, unambiguous: opts.UnambiguousAlts, agg: newAggregator(), now: time.Now}
+}
+
+func (sw *snapshotWriter) WriteHeader() error {
+	sw.last = sw.now()
+	_, err := sw.w.WriteString("time,queries,change,count,proportion\n")
+	if err != nil {
+		return err
+	}
+	return sw.w.Flush()
+}
+
+func (sw *snapshotWriter) WriteRecord(record Record) error {
+	sw.agg.add(record)
+	if sw.so.Every > 0 && sw.agg.queries%sw.so.Every == 0 {
+		return sw.snapshot()
+	}
+	if sw.so.Interval > 0 && sw.now().Sub(sw.last) >= sw.so.Interval {
+		return sw.snapshot()
+	}
+	return nil
+}
+
+func (sw *snapshotWriter) WriteAggregate(Aggregate) error {
+	if sw.lastQueries == sw.agg.queries && sw.agg.queries > 0 {
+		return nil
+	}
+	return sw.snapshot()
+}
+
+func (sw *snapshotWriter) snapshot() error {
+	sw.last, sw.lastQueries = sw.now(), sw.agg.queries
+	prefix := sw.last.UTC().Format(time.RFC3339) + "," + strconv.Itoa(sw.agg.queries) + ","
+
+	agg := sw.agg.aggregate()
+	for _, change := range agg.Changes {
+		prop := float64(change.Count) / float64(agg.Queries)
+		if prop < sw.threshold || change.Count < sw.minCount {
+			continue
+		}
+		if sw.unambiguous && !isACGT(change.SNP.Alt) {
+			continue
+		}
+		line := prefix + change.SNP.String() + "," + strconv.Itoa(change.Count) + "," + strconv.FormatFloat(prop, 'f', 9, 64)
+		_, err := sw.w.WriteString(line + "\n")
+		if err != nil {
+			return err
+		}
+	}
+	return sw.w.Flush()
+}
+
+func (sw *snapshotWriter) Close() error {
+	return sw.w.Flush()
+}
@@ -0,0 +1,1040 @@
+// Package snps finds the nucleotide changes between each sequence in an alignment and
+// a reference sequence
+package snps
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/benjamincjackson/snps/pkg/annotation"
+	"github.com/benjamincjackson/snps/pkg/encoding"
+	"github.com/benjamincjackson/snps/pkg/expr"
+	"github.com/benjamincjackson/snps/pkg/fastaio"
+)
+
+// Options configure a run
+type Options struct {
+	// Regions, if not nil, are used to annotate SNPs with their amino acid consequences
+	Regions []annotation.CDS
+	// HardGaps treats alignment gaps as a fifth character state rather than as missing data
+	HardGaps bool
+	// OnlyACGT treats ambiguity codes in the query as missing data, so that only changes
+	// to A, C, G or T (or gaps, with HardGaps) are reported
+	OnlyACGT bool
+	// SkipAmbiguousRef ignores alignment columns where the reference isn't A, C, G or T
+	SkipAmbiguousRef bool
+	// Mask, if not nil, is a set of sites that are ignored, e.g. primer-binding sites
+	Mask Mask
+	// Weights, if not nil, are the weights of sites, which each SNP is given the weight
+	// of its site from
+	Weights Weights
+	// Track, if not nil, is a numeric track of the reference, e.g. conservation scores,
+	// which each SNP is given the score of its site from
+	Track Track
+	// Context, if enabled, flags SNPs in error-prone reference contexts, e.g. homopolymers
+	Context ContextOptions
+	// MaxMemory, if greater than zero, limits the total length of the query sequences
+	// that are held in memory at once (the reference isn't counted)
+	MaxMemory int64
+	// Ambiguities finds the positions where the query and the reference differ but are
+	// compatible, because one is an ambiguity code that the other resolves
+	Ambiguities bool
+	// Resolutions finds the positions where the reference is an ambiguity code, N or ?,
+	// and the query is A, C, G or T, e.g. to improve a draft reference
+	Resolutions bool
+	// QuestionMarks says what to do with ? in the reference and queries: one of
+	// QuestionMarkN, QuestionMarkGap or QuestionMarkError, or "" to keep it as ?
+	QuestionMarks string
+	// LengthMismatch says what to do with queries whose length differs from the
+	// reference's: one of the LengthMismatch constants, or "" for the default
+	LengthMismatch string
+	// Reorient reverse-complements queries that look like the reverse complement of the
+	// reference before they are compared, with a warning
+	Reorient bool
+	// Core, if greater than zero, restricts the output to core sites, which are called as
+	// A, C, G or T (and not masked) in at least this proportion of the queries, as in
+	// core-genome SNP workflows. Records are held back until every query has been
+	// compared. It can't be used with CountOnly or contigs
+	Core float64
+	// Circular says that the reference is circular, e.g. a plasmid or a mitochondrion, so
+	// each query is rotated into its coordinates: by RotationOffset, the 0-based position
+	// in the reference of the query's first base, or, if it is 0, by the offset found by
+	// looking for the start of the query in the reference
+	Circular       bool
+	RotationOffset int
+	// Warn, if not nil, is given warnings about records that are skipped. It may be
+	// called from more than one goroutine at once
+	Warn func(message string)
+	// Source, if not nil, returns the file that the query record at index (0-based, in
+	// the order they are read) was read from, e.g. when several are read as one alignment
+	Source func(index int) string
+	// IncludeMissing finds the positions where the reference is A, C, G or T and the
+	// query is N or ?, which are otherwise invisible
+	IncludeMissing bool
+	// CountOnly only counts each record's SNPs, into Record.Distance, without listing
+	// them, which is much faster when only divergence is needed. Nothing that depends on
+	// the SNPs themselves (annotation, clusters, lineages) is found
+	CountOnly bool
+	// CountMissing counts the sites in each record that are N, ? or (without HardGaps)
+	// a gap, into Record.MissingSites
+	CountMissing bool
+	// MissingRanges finds the runs of sites in each record that aren't called, because
+	// they are N, ?, a gap (without HardGaps), masked, or beyond the end of a query that
+	// is shorter than the reference, into Record.MissingRanges
+	MissingRanges bool
+	// Clusters, if enabled, finds unusually dense clusters of SNPs in each record
+	Clusters ClusterOptions
+	// Limit, if greater than zero, is the number of records to read from the alignment
+	// (not counting the references read from it, with RunRefFirst). The rest of the
+	// alignment is left unread
+	Limit int
+	// Tracer, if not nil, is given a span for each stage of the run
+	Tracer Tracer
+	// Perf, if not nil, collects performance counters for the run, e.g. the time the
+	// workers spend waiting for records to compare
+	Perf *Perf
+	// Include, if not nil, restricts the output to records whose header line matches it
+	Include *regexp.Regexp
+	// Exclude, if not nil, drops records whose header line matches it
+	Exclude *regexp.Regexp
+	// Filter, if not nil, drops records for which it is false. It is compiled with
+	// CompileFilter
+	Filter *expr.Expr
+	// SNPFilter, if not nil, drops the SNPs for which it is false, before anything else
+	// is done with them. It is compiled with CompileSNPFilter, and is ignored with
+	// CountOnly
+	SNPFilter *expr.Expr
+	// IDs control how record IDs are rewritten in the output
+	IDs IDOptions
+	// Dates say where to find each record's collection date
+	Dates DateOptions
+	// Barcodes, if not nil, are used to assign each record to a lineage
+	Barcodes *Barcodes
+	// Parents, if not nil, are used to split each record into segments closest to each
+	// parent, to screen for recombinants
+	Parents *Parents
+	// Amplicons, if not nil, are checked for dropouts in each record
+	Amplicons *Amplicons
+	// Groups maps record IDs (after they have been rewritten) to metadata groups
+	Groups map[string]string
+	// GroupBy, if Groups is nil, derives each record's group from one of its other
+	// fields: GroupLineage, GroupMonth, GroupISOWeek or GroupEpiWeek
+	GroupBy string
+
+	// contigs, if not nil, are compared with the records that match them, instead of
+	// the reference
+	contigs *Contigs
+}
+
+// The fields that records can be grouped by, other than metadata
+const (
+	GroupLineage = "lineage"
+	GroupMonth   = "month"
+	GroupISOWeek = "iso_week"
+	GroupEpiWeek = "epi_week"
+)
+
+// group returns the group of a record, or "" if it hasn't got one
+func (opts Options) group(record Record) string {
+	if opts.Groups != nil {
+		return opts.Groups[record.Query]
+	}
+	if opts.GroupBy == GroupLineage {
+		return record.Lineage
+	}
+	if record.Date.IsZero() {
+		return ""
+	}
+	switch opts.GroupBy {
+	case GroupMonth:
+		return record.Date.Format("2006-01")
+	case GroupISOWeek:
+		return ISOWeek(record.Date)
+	case GroupEpiWeek:
+		return EpiWeek(record.Date)
+	}
+	return ""
+}
+
+// keep returns whether a record passes the Include and Exclude filters
+func (opts Options) keep(FR fastaio.EncodedFastaRecord) bool {
+	if opts.Include != nil && !opts.Include.MatchString(FR.Description) {
+		return false
+	}
+	if opts.Exclude != nil && opts.Exclude.MatchString(FR.Description) {
+		return false
+	}
+	return true
+}
+
+// snpLine is a struct for one Fasta record's SNPs. If skip is true, the record was
+// filtered out and is not written. size is the length of the record's sequence
+type snpLine struct {
+	Record
+	idx  int
+	skip bool
+	size int64
+}
+
+// getSNPs gets the SNPs between the reference and each Fasta record at a time
+func getSNPs(ctx context.Context, refSeq []byte, refs *sourceReferences, opts Options, cFR chan fastaio.EncodedFastaRecord, cSNPs chan snpLine, cErr chan error) {
+
+	c := newComparer()
+	p := opts.Perf
+
+	for {
+		var FR fastaio.EncodedFastaRecord
+		var ok bool
+		waiting := time.Now()
+		select {
+		case FR, ok = <-cFR:
+			if !ok {
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+		p.add(perfCompareIn, waiting)
+
+		busy := time.Now()
+		var SL snpLine
+		ref, ok := refSeq, true
+		if refs != nil {
+			ref, ok = refs.get(FR.Idx)
+		}
+		if ok {
+			var err error
+			SL, err = c.compare(ref, FR, opts)
+			if err != nil {
+				sendError(ctx, cErr, err)
+				return
+			}
+		} else {
+			// the record is the reference of its source, which isn't reported
+			SL = snpLine{idx: FR.Idx, skip: true, size: int64(len(FR.Seq))}
+		}
+		p.add(perfCompareBusy, busy)
+		p.count(perfCompared)
+
+		waiting = time.Now()
+		select {
+		case cSNPs <- SL:
+		case <-ctx.Done():
+			return
+		}
+		p.add(perfCompareOut, waiting)
+	}
+}
+
+// comparer holds the lookup tables that comparing a record needs, so that they are
+// made once per worker rather than once per record
+type comparer struct {
+	DA         []string
+	CA         []byte
+	codonTable map[string]byte
+}
+
+func newComparer() comparer {
+	return comparer{DA: encoding.MakeDecodingArray(), CA: encoding.MakeComplementArray(), codonTable: annotation.MakeCodonTable()}
+}
+
+// compare finds the SNPs between refSeq and FR, with everything else that opts asks for.
+// The snpLine it returns is skipped if FR is filtered out
+func (c comparer) compare(refSeq []byte, FR fastaio.EncodedFastaRecord, opts Options) (snpLine, error) {
+	DA, CA, codonTable := c.DA, c.CA, c.codonTable
+
+	// the size that is released from the budget is what was taken for the record
+	size := int64(len(FR.Seq))
+	skip := snpLine{idx: FR.Idx, skip: true, size: size}
+	if !opts.keep(FR) {
+		return skip, nil
+	}
+	// with contigs, each record is compared with the one it matches
+	contig := ""
+	if opts.contigs != nil {
+		var ok bool
+		contig, refSeq, ok = opts.contigs.match(FR.ID)
+		if !ok {
+			return snpLine{}, &RecordError{Record: FR.ID, Index: FR.Idx + 1, Err: ErrNoContig}
+		}
+	}
+	if opts.Reorient {
+		var reoriented bool
+		FR.Seq, reoriented = orient(refSeq, FR, CA)
+		if reoriented && opts.Warn != nil {
+			opts.Warn("reverse-complemented " + FR.ID + ", which looks like the reverse complement of the reference")
+		}
+	}
+	seq, ok, err := opts.resolveLength(FR, len(refSeq))
+	if err != nil {
+		return snpLine{}, err
+	}
+	if !ok {
+		return skip, nil
+	}
+	FR.Seq = seq
+	seq, err = opts.resolveQuestionMarks(FR.Seq, FR.ID, FR.Idx+1)
+	if err != nil {
+		return snpLine{}, err
+	}
+	FR.Seq = seq
+	if opts.Circular {
+		FR.Seq = opts.rotateCircular(refSeq, FR.Seq, FR.ID)
+	}
+	SL := snpLine{}
+	SL.Query = opts.IDs.apply(FR.ID)
+	SL.Description = FR.Description
+	if opts.Source != nil {
+		SL.Source = opts.Source(FR.Idx)
+	}
+	if opts.Dates.enabled() {
+		SL.Date = opts.Dates.parse(FR.Description)
+	}
+	SL.idx = FR.Idx
+	SL.size = size
+	SL.Contig = contig
+	if opts.CountMissing {
+		SL.MissingSites = countMissing(FR.Seq)
+	}
+	if opts.MissingRanges {
+		SL.MissingRanges = findMissingRanges(len(refSeq), FR.Seq, opts)
+	}
+	if opts.Core > 0 {
+		SL.uncalled = findRanges(len(refSeq), FR.Seq, opts, func(nuc byte) bool {
+			return nuc&8 != 8
+		})
+	}
+	// filtered returns SL, or skips it if it fails opts.Filter
+	filtered := func(seq []byte) (snpLine, error) {
+		ok, err := opts.passes(SL.Record, seq)
+		if err != nil {
+			return snpLine{}, &RecordError{Record: FR.ID, Index: FR.Idx + 1, Err: err}
+		}
+		if !ok {
+			return skip, nil
+		}
+		return SL, nil
+	}
+	if opts.CountOnly {
+		SL.Distance = countSNPs(refSeq, FR.Seq, opts)
+		return filtered(FR.Seq)
+	}
+	var SNPs []SNP
+	if len(FR.Seq) > chunkSize {
+		SNPs = findSNPsParallel(refSeq, FR.Seq, opts, DA, codonTable)
+	} else {
+		SNPs = findSNPs(refSeq, FR.Seq, 0, len(FR.Seq), opts, DA, codonTable)
+	}
+	if contig != "" {
+		setContig(SNPs, contig)
+	}
+	if opts.Weights != nil {
+		opts.Weights.weigh(SNPs)
+	}
+	if opts.Track != nil {
+		opts.Track.score(SNPs)
+	}
+	if opts.Context.enabled() {
+		opts.Context.flag(refSeq, SNPs, DA)
+	}
+	SNPs, err = opts.filterSNPs(SNPs)
+	if err != nil {
+		return snpLine{}, &RecordError{Record: FR.ID, Index: FR.Idx + 1, Err: err}
+	}
+	SL.SNPs = SNPs
+	SL.Distance = len(SNPs)
+	if opts.Ambiguities {
+		SL.Ambiguities = findAmbiguities(refSeq, FR.Seq, opts, DA)
+	}
+	if opts.Resolutions {
+		SL.Resolutions = findResolutions(refSeq, FR.Seq, opts, DA)
+	}
+	if opts.IncludeMissing {
+		SL.Missing = findMissing(refSeq, FR.Seq, opts, DA)
+	}
+	if contig != "" {
+		for _, SNPs := range [][]SNP{SL.Ambiguities, SL.Resolutions, SL.Missing} {
+			setContig(SNPs, contig)
+		}
+	}
+	if opts.Clusters.enabled() {
+		SL.Clusters = opts.Clusters.find(SNPs)
+	}
+	if opts.Barcodes != nil {
+		SL.Lineage, SL.LineageScore = opts.Barcodes.Assign(FR.Seq, SNPs)
+	}
+	if opts.Parents != nil {
+		SL.Segments = opts.Parents.Assign(FR.Seq)
+	}
+	if opts.Amplicons != nil {
+		SL.Dropouts = opts.Amplicons.Dropouts(FR.Seq)
+	}
+	SL.Group = opts.group(SL.Record)
+	return filtered(FR.Seq)
+}
+
+// chunkSize is the length of the pieces that sequences longer than it are split into,
+// so that the positions of one long sequence are compared on more than one core
+var chunkSize = 1 << 20
+
+// findSNPs returns the SNPs between refSeq and seq from start up to but not including end
+func findSNPs(refSeq []byte, seq []byte, start int, end int, opts Options, DA []string, codonTable map[string]byte) []SNP {
+	SNPs := make([]SNP, 0)
+	for i := start; i < end; i++ {
+		nuc := seq[i]
+		// A, C, G and T are the only encodings with the 8 bit set, and hard gaps
+		// are encoded as 4
+		if opts.OnlyACGT && nuc&8 != 8 && nuc != 4 {
+			continue
+		}
+		if opts.SkipAmbiguousRef && refSeq[i]&8 != 8 {
+			continue
+		}
+		if opts.Mask.masked(i) {
+			continue
+		}
+		if (refSeq[i] & nuc) < 16 {
+			snp := SNP{Position: i + 1, Ref: DA[refSeq[i]], Alt: DA[nuc]}
+			if opts.Regions != nil {
+				snp.Annotation = annotation.AnnotateSNP(i+1, refSeq, seq, opts.Regions, DA, codonTable)
+				snp.CodonPosition = annotation.CodonPosition(i+1, opts.Regions)
+			}
+			SNPs = append(SNPs, snp)
+		}
+	}
+	return SNPs
+}
+
+// countSNPs returns the number of SNPs between refSeq and seq, as findSNPs would find
+// them, without the cost of listing them
+func countSNPs(refSeq []byte, seq []byte, opts Options) int {
+	n := 0
+	for i, nuc := range seq {
+		if opts.OnlyACGT && nuc&8 != 8 && nuc != 4 {
+			continue
+		}
+		if opts.SkipAmbiguousRef && refSeq[i]&8 != 8 {
+			continue
+		}
+		if opts.Mask.masked(i) {
+			continue
+		}
+		if (refSeq[i] & nuc) < 16 {
+			n++
+		}
+	}
+	return n
+}
+
+// findAmbiguities returns the positions where one of refSeq and seq is an ambiguity
+// code that the other resolves: where the bases in one are a strict subset of those in
+// the other, so that they are compatible and aren't SNPs. N, gaps and ? are missing
+// data rather than ambiguities, and are left out
+func findAmbiguities(refSeq []byte, seq []byte, opts Options, DA []string) []SNP {
+	ambiguities := make([]SNP, 0)
+	for i, nuc := range seq {
+		if opts.OnlyACGT && nuc&8 != 8 {
+			continue
+		}
+		if opts.SkipAmbiguousRef && refSeq[i]&8 != 8 {
+			continue
+		}
+		if opts.Mask.masked(i) {
+			continue
+		}
+		// the top four bits are the set of possible bases, and all four are set
+		// for N, gaps and ?
+		r, q := refSeq[i]>>4, nuc>>4
+		if r == 15 || q == 15 || r == q || r&q == 0 {
+			continue
+		}
+		if r&q == q || r&q == r {
+			ambiguities = append(ambiguities, SNP{Position: i + 1, Ref: DA[refSeq[i]], Alt: DA[nuc]})
+		}
+	}
+	return ambiguities
+}
+
+// findResolutions returns the positions where refSeq is an ambiguity code, N or ? and
+// seq is one of the bases it could be. Gaps in the reference are left out, since a base
+// there is an insertion rather than a resolution
+func findResolutions(refSeq []byte, seq []byte, opts Options, DA []string) []SNP {
+	resolutions := make([]SNP, 0)
+	for i, nuc := range seq {
+		r := refSeq[i]
+		if r&8 == 8 || r == 244 || r == 4 || nuc&8 != 8 || opts.Mask.masked(i) {
+			continue
+		}
+		// the top four bits are the set of possible bases
+		if r>>4&(nuc>>4) == nuc>>4 {
+			resolutions = append(resolutions, SNP{Position: i + 1, Ref: DA[r], Alt: DA[nuc]})
+		}
+	}
+	return resolutions
+}
+
+// findMissing returns the positions where refSeq is A, C, G or T and seq is N or ?,
+// other than masked ones
+func findMissing(refSeq []byte, seq []byte, opts Options, DA []string) []SNP {
+	missing := make([]SNP, 0)
+	for i, nuc := range seq {
+		if refSeq[i]&8 == 8 && (nuc == 240 || nuc == 242) && !opts.Mask.masked(i) {
+			missing = append(missing, SNP{Position: i + 1, Ref: DA[refSeq[i]], Alt: DA[nuc]})
+		}
+	}
+	return missing
+}
+
+// countMissing returns the number of sites in seq that are N, ? or a gap. Hard gaps are
+// encoded as 4, so aren't counted
+func countMissing(seq []byte) int {
+	n := 0
+	for _, nuc := range seq {
+		if nuc == 240 || nuc == 242 || nuc == 244 {
+			n++
+		}
+	}
+	return n
+}
+
+// findMissingRanges returns the runs of sites up to refLength that aren't called in seq,
+// as ranges of 1-based positions, inclusive
+func findMissingRanges(refLength int, seq []byte, opts Options) [][2]int {
+	return findRanges(refLength, seq, opts, func(nuc byte) bool {
+		return nuc == 240 || nuc == 242 || nuc == 244
+	})
+}
+
+// findRanges returns the runs of sites up to refLength where uncalled is true of seq, or
+// that are masked or beyond the end of seq, as ranges of 1-based positions, inclusive
+func findRanges(refLength int, seq []byte, opts Options, uncalled func(nuc byte) bool) [][2]int {
+	ranges := make([][2]int, 0)
+	start := 0
+	for i := 0; i <= refLength; i++ {
+		missing := false
+		if i < refLength {
+			missing = i >= len(seq) || uncalled(seq[i]) || opts.Mask.masked(i)
+		}
+		switch {
+		case missing && start == 0:
+			start = i + 1
+		case !missing && start > 0:
+			ranges = append(ranges, [2]int{start, i})
+			start = 0
+		}
+	}
+	return ranges
+}
+
+// findSNPsParallel is findSNPs over the whole of seq, with chunks of chunkSize
+// positions compared concurrently
+func findSNPsParallel(refSeq []byte, seq []byte, opts Options, DA []string, codonTable map[string]byte) []SNP {
+	nChunks := (len(seq) + chunkSize - 1) / chunkSize
+	chunks := make([][]SNP, nChunks)
+
+	cChunk := make(chan int)
+	var wg sync.WaitGroup
+	workers := runtime.NumCPU()
+	if workers > nChunks {
+		workers = nChunks
+	}
+	wg.Add(workers)
+	for n := 0; n < workers; n++ {
+		go func() {
+			for c := range cChunk {
+				end := (c + 1) * chunkSize
+				if end > len(seq) {
+					end = len(seq)
+				}
+				chunks[c] = findSNPs(refSeq, seq, c*chunkSize, end, opts, DA, codonTable)
+			}
+			wg.Done()
+		}()
+	}
+	for c := 0; c < nChunks; c++ {
+		cChunk <- c
+	}
+	close(cChunk)
+	wg.Wait()
+
+	SNPs := make([]SNP, 0)
+	for _, chunk := range chunks {
+		SNPs = append(SNPs, chunk...)
+	}
+	return SNPs
+}
+
+// writeOutput passes the output to an OutputWriter as it arrives. It uses a map to write things
+// in the same order as they are in the input file, and counts SNPs as it goes for the aggregate
+// if ow reads it. first is the index of the first record to write. If b is not nil, each record's size is
+// released from it once the record has been written. p, which may be nil, is given the
+// writer's counters
+func writeOutput(ctx context.Context, ow OutputWriter, first int, b *budget, p *Perf, cSNPs chan snpLine, cErr chan error, cWriteDone chan bool) {
+
+	outputMap := make(map[int]snpLine)
+
+	counter := first
+
+	var agg *aggregator
+	if needsAggregate(ow) {
+		agg = newAggregator()
+	}
+
+	var err error
+
+	err = ow.WriteHeader()
+	if err != nil {
+		sendError(ctx, cErr, err)
+		return
+	}
+
+	for {
+		var snpLine snpLine
+		var ok bool
+		waiting := time.Now()
+		select {
+		case snpLine, ok = <-cSNPs:
+		case <-ctx.Done():
+			return
+		}
+		p.add(perfWriteIn, waiting)
+		if !ok {
+			break
+		}
+
+		outputMap[snpLine.idx] = snpLine
+
+		for {
+			if SL, ok := outputMap[counter]; ok {
+				if !SL.skip {
+					busy := time.Now()
+					err = ow.WriteRecord(SL.Record)
+					if err != nil {
+						sendError(ctx, cErr, err)
+						return
+					}
+					if agg != nil {
+						agg.add(SL.Record)
+					}
+					p.add(perfWriteBusy, busy)
+					p.count(perfWritten)
+				}
+				if b != nil {
+					b.release(SL.size)
+				}
+				delete(outputMap, counter)
+				counter++
+			} else {
+				break
+			}
+		}
+	}
+
+	busy := time.Now()
+	var aggregate Aggregate
+	if agg != nil {
+		aggregate = agg.aggregate()
+	}
+	err = ow.WriteAggregate(aggregate)
+	if err != nil {
+		sendError(ctx, cErr, err)
+		return
+	}
+
+	err = ow.Close()
+	if err != nil {
+		sendError(ctx, cErr, err)
+		return
+	}
+	p.add(perfWriteBusy, busy)
+
+	select {
+	case cWriteDone <- true:
+	case <-ctx.Done():
+	}
+}
+
+// sendError sends err to cErr, unless ctx is done first, in which case no one is
+// listening any more
+func sendError(ctx context.Context, cErr chan error, err error) {
+	select {
+	case cErr <- err:
+	case <-ctx.Done():
+	}
+}
+
+// ReadReference reads the reference sequence from rR and encodes it, so that it can be
+// reused across calls to RunReference
+func ReadReference(rR io.Reader, hardGaps bool) ([]byte, error) {
+	ref, _, err := readReference(rR, hardGaps)
+	return ref.Seq, err
+}
+
+// ReadValidReference is ReadReference for references that have to be clean: it returns
+// an error unless rR holds exactly one record made up of A, C, G and T (and N, if allowN)
+func ReadValidReference(rR io.Reader, hardGaps bool, allowN bool) ([]byte, error) {
+	ref, err := ReadReferenceRecord(rR, hardGaps, true, allowN)
+	return ref.Seq, err
+}
+
+// ReadReferenceRecord is ReadReference, or ReadValidReference if validate is true, but
+// returns the reference's whole record, e.g. for its ID
+func ReadReferenceRecord(rR io.Reader, hardGaps bool, validate bool, allowN bool) (fastaio.EncodedFastaRecord, error) {
+	ref, records, err := readReference(rR, hardGaps)
+	if err != nil || !validate {
+		return ref, err
+	}
+
+	if records != 1 {
+		return ref, fmt.Errorf("%w: should have one record, but has %d", ErrBadReference, records)
+	}
+	if len(ref.Seq) == 0 {
+		return ref, fmt.Errorf("%w: it is empty", ErrBadReference)
+	}
+
+	DA := encoding.MakeDecodingArray()
+	for i, nuc := range ref.Seq {
+		if nuc&8 == 8 || (allowN && nuc == 240) {
+			continue
+		}
+		err := fmt.Errorf("%w in the reference", ErrInvalidChar)
+		if base := DA[nuc]; base != "" {
+			err = fmt.Errorf("%w: %s", err, base)
+		}
+		return ref, &RecordError{Record: ref.ID, Index: 1, Position: i + 1, Err: err}
+	}
+
+	return ref, nil
+}
+
+// readReference returns the last record in rR, and the number of records
+func readReference(rR io.Reader, hardGaps bool) (fastaio.EncodedFastaRecord, int, error) {
+
+	// the reader is stopped if this returns early
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cErr := make(chan error)
+
+	cRef := make(chan fastaio.EncodedFastaRecord)
+	cRefDone := make(chan bool)
+
+	go fastaio.ReadEncodeAlignmentContext(ctx, rR, hardGaps, cRef, cErr, cRefDone)
+
+	var ref fastaio.EncodedFastaRecord
+	records := 0
+
+	for n := 1; n > 0; {
+		select {
+		case err := <-cErr:
+			return ref, records, err
+		case FR := <-cRef:
+			ref = FR
+			records++
+		case <-cRefDone:
+			close(cRef)
+			n--
+		}
+	}
+
+	return ref, records, nil
+}
+
+// Run finds the SNPs between each record in the alignment rQ and the reference in rR,
+// and passes them to ow
+func Run(rQ io.Reader, rR io.Reader, opts Options, ow OutputWriter) error {
+	return RunContext(context.Background(), rQ, rR, opts, ow)
+}
+
+// RunContext is Run, but stops with ctx's error once ctx is done. Nothing is left running
+// when it returns, whether it returns early or not
+func RunContext(ctx context.Context, rQ io.Reader, rR io.Reader, opts Options, ow OutputWriter) error {
+
+	st := newStages(opts.Tracer)
+	st.start("snps.read_reference")
+	refSeq, err := ReadReference(rR, opts.HardGaps)
+	st.end("snps.read_reference", err)
+	if err != nil {
+		return err
+	}
+
+	return RunReferenceContext(ctx, rQ, refSeq, opts, ow)
+}
+
+// RunReference is Run with a reference that has already been read by ReadReference
+func RunReference(rQ io.Reader, refSeq []byte, opts Options, ow OutputWriter) error {
+	return run(context.Background(), rQ, refSeq, false, opts, ow)
+}
+
+// RunReferenceContext is RunReference, but stops once ctx is done, as RunContext does
+func RunReferenceContext(ctx context.Context, rQ io.Reader, refSeq []byte, opts Options, ow OutputWriter) error {
+	return run(ctx, rQ, refSeq, false, opts, ow)
+}
+
+// RunRefFirst is Run with the first record in the alignment rQ used as the reference.
+// The reference is not included in the output, and is not subject to opts.Include or
+// opts.Exclude. If opts.Source is set, e.g. because rQ is several files read one after
+// another, the first record from each source is the reference of the rest of that source
+func RunRefFirst(rQ io.Reader, opts Options, ow OutputWriter) error {
+	return run(context.Background(), rQ, nil, true, opts, ow)
+}
+
+// RunRefFirstContext is RunRefFirst, but stops once ctx is done, as RunContext does
+func RunRefFirstContext(ctx context.Context, rQ io.Reader, opts Options, ow OutputWriter) error {
+	return run(ctx, rQ, nil, true, opts, ow)
+}
+
+// run finds the SNPs in rQ. If refFirst is true, the first record in rQ is the reference.
+// Every goroutine it starts gives up once ctx is done, and ctx is cancelled when it
+// returns, so that none of them are left blocked if it returns early
+func run(ctx context.Context, rQ io.Reader, refSeq []byte, refFirst bool, opts Options, ow OutputWriter) (err error) {
+
+	st := newStages(opts.Tracer)
+	st.start("snps.run")
+	st.start("snps.read")
+	st.start("snps.compare")
+	st.start("snps.write")
+	defer func() { st.endAll(err) }()
+	opts.Perf.begin(runtime.NumCPU())
+
+	if err := checkQuestionMarks(opts.QuestionMarks); err != nil {
+		return err
+	}
+	if err := checkLengthMismatch(opts.LengthMismatch); err != nil {
+		return err
+	}
+	if err := opts.checkCore(); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	cErr := make(chan error)
+
+	cFR := make(chan fastaio.EncodedFastaRecord)
+	cFRDone := make(chan bool)
+
+	cSNPs := make(chan snpLine, runtime.NumCPU())
+	cSNPsDone := make(chan bool)
+
+	cWriteDone := make(chan bool)
+
+	go fastaio.ReadEncodeAlignmentContext(ctx, rQ, opts.HardGaps, cFR, cErr, cFRDone)
+
+	first := 0
+	refID, refIndex := "", 0
+	if refFirst {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-cErr:
+			return err
+		case FR := <-cFR:
+			refSeq = FR.Seq
+			first = FR.Idx + 1
+			refID, refIndex = FR.ID, FR.Idx+1
+		}
+	}
+	refSeq, err = opts.resolveQuestionMarks(refSeq, refID, refIndex)
+	if err != nil {
+		return fmt.Errorf("reference: %w", err)
+	}
+
+	cWork := cFR
+	var refs *sourceReferences
+	if refFirst && opts.Source != nil {
+		refs = &sourceReferences{source: opts.Source(refIndex - 1), starts: []int{refIndex - 1}, seqs: [][]byte{refSeq}}
+		cWork = refs.relay(ctx, cFR, opts, cErr)
+	}
+
+	// with a memory budget or a limit, records go through a relay that holds the reader
+	// up while the budget is used up, and stops passing records on at the limit
+	cIn := cWork
+	cLimit := make(chan bool, 1)
+	var b *budget
+	if opts.MaxMemory > 0 {
+		b = newBudget(opts.MaxMemory)
+		go func() {
+			<-ctx.Done()
+			b.stop()
+		}()
+	}
+	if opts.MaxMemory > 0 || opts.Limit > 0 {
+		cWork = make(chan fastaio.EncodedFastaRecord)
+		go func() {
+			defer close(cWork)
+			n := 0
+			for {
+				var FR fastaio.EncodedFastaRecord
+				var ok bool
+				select {
+				case FR, ok = <-cIn:
+					if !ok {
+						return
+					}
+				case <-ctx.Done():
+					return
+				}
+				if b != nil && !b.acquire(int64(len(FR.Seq))) {
+					return
+				}
+				select {
+				case cWork <- FR:
+				case <-ctx.Done():
+					return
+				}
+				// with --ref-first, the references of later sources aren't queries, so
+				// they don't count towards the limit
+				if refs != nil {
+					if _, query := refs.get(FR.Idx); !query {
+						continue
+					}
+				}
+				n++
+				if n == opts.Limit {
+					cLimit <- true
+					return
+				}
+			}
+		}()
+	}
+
+	if rw, ok := ow.(ReferenceWriter); ok && opts.contigs == nil {
+		rw.SetReference(refSeq)
+	}
+	if opts.Core > 0 {
+		ow = newCoreWriter(ow, opts.Core, len(refSeq))
+	}
+	go writeOutput(ctx, ow, first, b, opts.Perf, cSNPs, cErr, cWriteDone)
+
+	var wgSNPs sync.WaitGroup
+	wgSNPs.Add(runtime.NumCPU())
+
+	for n := 0; n < runtime.NumCPU(); n++ {
+		go func() {
+			getSNPs(ctx, refSeq, refs, opts, cWork, cSNPs, cErr)
+			wgSNPs.Done()
+		}()
+	}
+
+	go func() {
+		wgSNPs.Wait()
+		select {
+		case cSNPsDone <- true:
+		case <-ctx.Done():
+		}
+	}()
+
+	for n := 1; n > 0; {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-cErr:
+			return err
+		case <-cFRDone:
+			close(cFR)
+			st.end("snps.read", nil)
+			opts.Perf.end(perfReadEnd)
+			n--
+		case <-cLimit:
+			// the rest of rQ is left unread
+			st.end("snps.read", nil)
+			opts.Perf.end(perfReadEnd)
+			n--
+		}
+	}
+
+	for n := 1; n > 0; {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-cErr:
+			return err
+		case <-cSNPsDone:
+			close(cSNPs)
+			st.end("snps.compare", nil)
+			opts.Perf.end(perfCompareEnd)
+			n--
+		}
+	}
+
+	for n := 1; n > 0; {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-cErr:
+			return err
+		case <-cWriteDone:
+			st.end("snps.write", nil)
+			opts.Perf.end(perfWriteEnd)
+			n--
+		}
+	}
+
+	return nil
+}
+
+// sourceReferences are the references of a run with refFirst whose records come from
+// more than one source, e.g. several files: the first record of each source is the
+// reference of the rest of it. starts are the indexes of the references, in order
+type sourceReferences struct {
+	source string
+	mu     sync.RWMutex
+	starts []int
+	seqs   [][]byte
+}
+
+// relay passes on the records from cIn, keeping the first of each source as its
+// reference before it is passed on, so that it is there by the time the records after
+// it are compared
+func (sr *sourceReferences) relay(ctx context.Context, cIn chan fastaio.EncodedFastaRecord, opts Options, cErr chan error) chan fastaio.EncodedFastaRecord {
+	cOut := make(chan fastaio.EncodedFastaRecord)
+	go func() {
+		defer close(cOut)
+		for {
+			var FR fastaio.EncodedFastaRecord
+			var ok bool
+			select {
+			case FR, ok = <-cIn:
+				if !ok {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+			if source := opts.Source(FR.Idx); source != sr.source {
+				seq, err := opts.resolveQuestionMarks(FR.Seq, FR.ID, FR.Idx+1)
+				if err != nil {
+					sendError(ctx, cErr, fmt.Errorf("reference of %s: %w", source, err))
+					return
+				}
+				sr.mu.Lock()
+				sr.starts = append(sr.starts, FR.Idx)
+				sr.seqs = append(sr.seqs, seq)
+				sr.mu.Unlock()
+				sr.source = source
+			}
+			select {
+			case cOut <- FR:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return cOut
+}
+
+// get returns the reference of the record at index, or false if it is a reference
+func (sr *sourceReferences) get(index int) ([]byte, bool) {
+	sr.mu.RLock()
+	defer sr.mu.RUnlock()
+	i := sort.SearchInts(sr.starts, index+1) - 1
+	return sr.seqs[i], sr.starts[i] != index
+}
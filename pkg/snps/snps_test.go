@@ -0,0 +1,4317 @@
+package snps
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/benjamincjackson/snps/pkg/annotation"
+	"github.com/benjamincjackson/snps/pkg/fastaio"
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestSNPs(t *testing.T) {
+	refData := []byte(`>ref
+ATGATG
+`)
+	queryData := []byte(
+		`>Query1
+ATGATG
+>Query2
+ATGATC
+>Query3
+ATTTTW
+`)
+
+	ref := bytes.NewReader(refData)
+	query := bytes.NewReader(queryData)
+
+	out := new(bytes.Buffer)
+
+	ow, err := NewOutputWriter("csv", out, WriterOptions{})
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = Run(query, ref, Options{}, ow)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if string(out.Bytes()) != `query,SNPs
+Query1,
+Query2,G6C
+Query3,G3T|A4T|G6W
+` {
+		t.Errorf("problem in TestSNPs()")
+		fmt.Println(string(out.Bytes()))
+	}
+}
+
+func TestSNPsHardGaps(t *testing.T) {
+	refData := []byte(`>ref
+ATGATG
+`)
+	queryData := []byte(
+		`>Query1
+--GATG
+>Query2
+ATGATC
+>Query3
+ATTTTW
+`)
+
+	ref := bytes.NewReader(refData)
+	query := bytes.NewReader(queryData)
+
+	out := new(bytes.Buffer)
+
+	ow, err := NewOutputWriter("csv", out, WriterOptions{})
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = Run(query, ref, Options{HardGaps: true}, ow)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if string(out.Bytes()) != `query,SNPs
+Query1,A1-|T2-
+Query2,G6C
+Query3,G3T|A4T|G6W
+` {
+		t.Errorf("problem in TestSNPsHardGaps()")
+		fmt.Println(string(out.Bytes()))
+	}
+}
+
+func TestSNPsAggregate(t *testing.T) {
+	refData := []byte(`>ref
+ATGATG
+`)
+	queryData := []byte(
+		`>Query1
+ATGATG
+>Query2
+ATGATC
+>Query3
+ATTTTW
+>Query4
+ATTTTG
+`)
+
+	ref := bytes.NewReader(refData)
+	query := bytes.NewReader(queryData)
+
+	out := new(bytes.Buffer)
+
+	ow, err := NewOutputWriter("aggregate", out, WriterOptions{})
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = Run(query, ref, Options{}, ow)
+	if err != nil {
+		t.Error(err)
+	}
+
+	// strconv.FormatFloat(propMap[snp]/counter, 'f', 4, 64) + "\n")
+
+	if string(out.Bytes()) != `change,proportion
+G3T,0.500000000
+A4T,0.500000000
+G6C,0.250000000
+G6W,0.250000000
+` {
+		t.Errorf("problem in TestSNPsAggregate()")
+		fmt.Println(string(out.Bytes()))
+	}
+}
+
+func TestSNPsAggregateThresh(t *testing.T) {
+	refData := []byte(`>ref
+ATGATG
+`)
+	queryData := []byte(
+		`>Query1
+ATGATG
+>Query2
+ATGATC
+>Query3
+ATTTTW
+>Query4
+ATTTTG
+`)
+
+	ref := bytes.NewReader(refData)
+	query := bytes.NewReader(queryData)
+
+	out := new(bytes.Buffer)
+
+	ow, err := NewOutputWriter("aggregate", out, WriterOptions{Threshold: 0.26})
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = Run(query, ref, Options{}, ow)
+	if err != nil {
+		t.Error(err)
+	}
+
+	// strconv.FormatFloat(propMap[snp]/counter, 'f', 4, 64) + "\n")
+
+	if string(out.Bytes()) != `change,proportion
+G3T,0.500000000
+A4T,0.500000000
+` {
+		t.Errorf("problem in TestSNPsAggregateThresh()")
+		fmt.Println(string(out.Bytes()))
+	}
+}
+
+func TestSNPsAggregateMinCount(t *testing.T) {
+	refData := []byte(`>ref
+ATGATG
+`)
+	queryData := []byte(
+		`>Query1
+ATGATG
+>Query2
+ATGATC
+>Query3
+ATTTTW
+>Query4
+ATTTTG
+`)
+
+	out := new(bytes.Buffer)
+
+	ow, err := NewOutputWriter("aggregate", out, WriterOptions{MinCount: 2})
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = Run(bytes.NewReader(queryData), bytes.NewReader(refData), Options{}, ow)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if string(out.Bytes()) != `change,proportion
+G3T,0.500000000
+A4T,0.500000000
+` {
+		t.Errorf("problem in TestSNPsAggregateMinCount()")
+		fmt.Println(string(out.Bytes()))
+	}
+}
+
+func TestSNPsAggregateUnambiguous(t *testing.T) {
+	refData := []byte(`>ref
+ATGATG
+`)
+	queryData := []byte(
+		`>Query1
+ATGATG
+>Query2
+ATGATC
+>Query3
+ATTTTW
+>Query4
+ATTTTG
+`)
+
+	out := new(bytes.Buffer)
+
+	ow, err := NewOutputWriter("aggregate", out, WriterOptions{UnambiguousAlts: true})
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = Run(bytes.NewReader(queryData), bytes.NewReader(refData), Options{}, ow)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if string(out.Bytes()) != `change,proportion
+G3T,0.500000000
+A4T,0.500000000
+G6C,0.250000000
+` {
+		t.Errorf("problem in TestSNPsAggregateUnambiguous()")
+		fmt.Println(string(out.Bytes()))
+	}
+}
+
+func TestSNPsAggregateWithSamples(t *testing.T) {
+	refData := []byte(`>ref
+ATGATG
+`)
+	queryData := []byte(
+		`>Query1
+ATTATG
+>Query2
+ATTATC
+>Query3
+ATTTTW
+>Query4
+ATTTTG
+`)
+
+	out := new(bytes.Buffer)
+
+	ow, err := NewOutputWriter("aggregate", out, WriterOptions{WithSamples: true, MaxSamples: 3})
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = Run(bytes.NewReader(queryData), bytes.NewReader(refData), Options{}, ow)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if string(out.Bytes()) != `change,proportion,samples
+G3T,1.000000000,Query1|Query2|Query3|...
+A4T,0.500000000,Query3|Query4
+G6C,0.250000000,Query2
+G6W,0.250000000,Query3
+` {
+		t.Errorf("problem in TestSNPsAggregateWithSamples()")
+		fmt.Println(string(out.Bytes()))
+	}
+}
+
+func TestCheck(t *testing.T) {
+	refData := []byte(`>ref
+ATGATG
+`)
+	queryData := []byte(
+		`>Query1
+ATGATG
+>Query2
+ATG
+>Query1
+ATG!TG
+`)
+
+	report := Check(bytes.NewReader(queryData), bytes.NewReader(refData))
+
+	expected := CheckReport{
+		OK:              false,
+		ReferenceLength: 6,
+		Records:         3,
+		Problems: []Problem{
+			{File: "query", Record: "Query2", Kind: "length", Message: "length is 3, but the reference's is 6"},
+			{File: "query", Record: "Query1", Kind: "duplicate_id", Message: "ID Query1 is used more than once"},
+			{File: "query", Record: "Query1", Kind: "character", Message: "invalid character at position 4"},
+		},
+	}
+	if !reflect.DeepEqual(report, expected) {
+		t.Errorf("problem in TestCheck()")
+		fmt.Println(report)
+	}
+
+	report = Check(bytes.NewReader([]byte("ATGATG\n")), bytes.NewReader(refData))
+	if report.OK || len(report.Problems) != 1 || report.Problems[0].Kind != "format" {
+		t.Errorf("problem in TestCheck(): unformatted query was accepted")
+		fmt.Println(report)
+	}
+
+	report = Check(bytes.NewReader(refData), bytes.NewReader(refData))
+	if !report.OK {
+		t.Errorf("problem in TestCheck(): good input was rejected")
+		fmt.Println(report)
+	}
+}
+
+func TestMultiWriter(t *testing.T) {
+	refData := []byte(`>ref
+ATGATG
+`)
+	queryData := []byte(
+		`>Query1
+ATGATC
+>Query2
+ATTATC
+`)
+
+	perQuery := new(bytes.Buffer)
+	aggregated := new(bytes.Buffer)
+
+	csv, err := NewOutputWriter("csv", perQuery, WriterOptions{})
+	if err != nil {
+		t.Error(err)
+	}
+	agg, err := NewOutputWriter("aggregate", aggregated, WriterOptions{})
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = Run(bytes.NewReader(queryData), bytes.NewReader(refData), Options{}, MultiWriter(csv, agg))
+	if err != nil {
+		t.Error(err)
+	}
+
+	if perQuery.String() != `query,SNPs
+Query1,G6C
+Query2,G3T|G6C
+` || aggregated.String() != `change,proportion
+G3T,0.500000000
+G6C,1.000000000
+` {
+		t.Errorf("problem in TestMultiWriter()")
+		fmt.Println(perQuery.String())
+		fmt.Println(aggregated.String())
+	}
+}
+
+func TestSNPsIncludeMissing(t *testing.T) {
+	refData := []byte(`>ref
+ATGNTG
+`)
+	queryData := []byte(
+		`>Query1
+ATGNTG
+>Query2
+NTG?TC
+>Query3
+NT-ATG
+`)
+
+	out := new(bytes.Buffer)
+	ow, err := NewOutputWriter("csv", out, WriterOptions{Missing: true})
+	if err != nil {
+		t.Error(err)
+	}
+	err = Run(bytes.NewReader(queryData), bytes.NewReader(refData), Options{IncludeMissing: true}, ow)
+	if err != nil {
+		t.Error(err)
+	}
+	if out.String() != `query,SNPs,missing
+Query1,,
+Query2,G6C,A1N
+Query3,,A1N
+` {
+		t.Errorf("problem in TestSNPsIncludeMissing()")
+		fmt.Println(out.String())
+	}
+
+	out = new(bytes.Buffer)
+	ow, err = NewOutputWriter("aggregate", out, WriterOptions{})
+	if err != nil {
+		t.Error(err)
+	}
+	err = Run(bytes.NewReader(queryData), bytes.NewReader(refData), Options{IncludeMissing: true}, ow)
+	if err != nil {
+		t.Error(err)
+	}
+	if out.String() != `change,proportion
+A1N,0.666666667
+G6C,0.333333333
+` {
+		t.Errorf("problem in TestSNPsIncludeMissing()")
+		fmt.Println(out.String())
+	}
+}
+
+func TestSNPsQuestionMarks(t *testing.T) {
+	refData := []byte(`>ref
+ATGATG
+`)
+	queryData := []byte(
+		`>Query1
+AT?ATC
+`)
+
+	expected := map[string]string{
+		"":              "query,SNPs,missing\nQuery1,G6C,G3?\n",
+		QuestionMarkN:   "query,SNPs,missing\nQuery1,G6C,G3N\n",
+		QuestionMarkGap: "query,SNPs,missing\nQuery1,G3-|G6C,\n",
+	}
+	for policy, e := range expected {
+		out := new(bytes.Buffer)
+		ow, err := NewOutputWriter("csv", out, WriterOptions{Missing: true})
+		if err != nil {
+			t.Error(err)
+		}
+		err = Run(bytes.NewReader(queryData), bytes.NewReader(refData), Options{HardGaps: true, IncludeMissing: true, QuestionMarks: policy}, ow)
+		if err != nil {
+			t.Error(err)
+		}
+		if out.String() != e {
+			t.Errorf("problem in TestSNPsQuestionMarks(): policy %q", policy)
+			fmt.Println(out.String())
+		}
+	}
+
+	err := Run(bytes.NewReader(queryData), bytes.NewReader(refData), Options{QuestionMarks: QuestionMarkError}, &countingWriter{})
+	if !errors.Is(err, ErrQuestionMark) || err.Error() != "sequence Query1, position 3: ? is not allowed" {
+		t.Errorf("problem in TestSNPsQuestionMarks(): expected an error, got %v", err)
+	}
+
+	err = Run(bytes.NewReader(queryData), bytes.NewReader(refData), Options{QuestionMarks: "x"}, &countingWriter{})
+	if !errors.Is(err, ErrUnknownPolicy) {
+		t.Errorf("problem in TestSNPsQuestionMarks(): unknown policy was accepted")
+	}
+}
+
+func TestSNPsEncoded(t *testing.T) {
+	refData := []byte(`>ref
+ATGATG
+`)
+	queryData := []byte(
+		`>Query1 some description
+AT-ATC
+>Query2
+ATTTTW
+`)
+
+	// encode the query with hard gaps, and read it without
+	encoded := new(bytes.Buffer)
+	ew, err := fastaio.NewEncodedWriter(encoded, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cErr := make(chan error)
+	cFR := make(chan fastaio.EncodedFastaRecord)
+	cDone := make(chan bool)
+	go fastaio.ReadEncodeAlignment(bytes.NewReader(queryData), true, cFR, cErr, cDone)
+	for done := false; !done; {
+		select {
+		case err := <-cErr:
+			t.Fatal(err)
+		case FR := <-cFR:
+			if err := ew.Write(FR); err != nil {
+				t.Fatal(err)
+			}
+		case <-cDone:
+			done = true
+		}
+	}
+	if err := ew.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, hardGaps := range []bool{false, true} {
+		fromFasta := new(bytes.Buffer)
+		fromEncoded := new(bytes.Buffer)
+		for _, run := range []struct {
+			query []byte
+			out   *bytes.Buffer
+		}{{queryData, fromFasta}, {encoded.Bytes(), fromEncoded}} {
+			ow, err := NewOutputWriter("csv", run.out, WriterOptions{Description: true})
+			if err != nil {
+				t.Error(err)
+			}
+			err = Run(bytes.NewReader(run.query), bytes.NewReader(refData), Options{HardGaps: hardGaps}, ow)
+			if err != nil {
+				t.Error(err)
+			}
+		}
+		if fromFasta.String() != fromEncoded.String() {
+			t.Errorf("problem in TestSNPsEncoded(): hard gaps %v", hardGaps)
+			fmt.Println(fromFasta.String())
+			fmt.Println(fromEncoded.String())
+		}
+	}
+
+	// corrupt lengths are errors, not allocations of that size
+	header := append([]byte("SNPSSEP\x01"), 0)
+	for _, corrupt := range [][]byte{
+		append(append([]byte{}, header...), 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01),
+		append(append([]byte{}, header...), 0xe8, 0x07, 'Q'),
+		append(append([]byte{}, header...), 0x01, 'Q', 0xe8, 0x07),
+		append(append([]byte{}, header...), 0x80),
+	} {
+		err = Run(bytes.NewReader(corrupt), bytes.NewReader(refData), Options{}, nullWriter{})
+		if !errors.Is(err, ErrBadEncoded) {
+			t.Errorf("problem in TestSNPsEncoded(): %q gave %v", corrupt, err)
+		}
+	}
+}
+
+// twoBit returns sequences, which are names and then A, C, G, T and N, in .2bit format
+func twoBit(order binary.ByteOrder, sequences [][2]string) []byte {
+	header := new(bytes.Buffer)
+	data := new(bytes.Buffer)
+	u32 := func(b *bytes.Buffer, v int) {
+		bs := make([]byte, 4)
+		order.PutUint32(bs, uint32(v))
+		b.Write(bs)
+	}
+
+	indexSize := 16
+	for _, s := range sequences {
+		indexSize += 1 + len(s[0]) + 4
+	}
+
+	u32(header, 0x1A412743)
+	u32(header, 0)
+	u32(header, len(sequences))
+	u32(header, 0)
+	for _, s := range sequences {
+		header.WriteByte(byte(len(s[0])))
+		header.WriteString(s[0])
+		u32(header, indexSize+data.Len())
+
+		seq := s[1]
+		nBlocks := make([][2]int, 0)
+		for i := 0; i < len(seq); i++ {
+			if seq[i] == 'N' && (i == 0 || seq[i-1] != 'N') {
+				nBlocks = append(nBlocks, [2]int{i, 0})
+			}
+			if seq[i] == 'N' {
+				nBlocks[len(nBlocks)-1][1]++
+			}
+		}
+		u32(data, len(seq))
+		u32(data, len(nBlocks))
+		for _, b := range nBlocks {
+			u32(data, b[0])
+		}
+		for _, b := range nBlocks {
+			u32(data, b[1])
+		}
+		u32(data, 0)
+		u32(data, 0)
+		packed := make([]byte, (len(seq)+3)/4)
+		for i := 0; i < len(seq); i++ {
+			code := map[byte]byte{'T': 0, 'C': 1, 'A': 2, 'G': 3, 'N': 0}[seq[i]]
+			packed[i/4] |= code << (6 - 2*uint(i%4))
+		}
+		data.Write(packed)
+	}
+
+	return append(header.Bytes(), data.Bytes()...)
+}
+
+func TestSNPsTwoBit(t *testing.T) {
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		refData := twoBit(order, [][2]string{{"ref", "ATGATGCCA"}})
+		queryData := twoBit(order, [][2]string{{"Query1", "ATGATGCCA"}, {"Query2", "NNGATCCCT"}, {"Query3", "ATGANNNCA"}})
+
+		out := new(bytes.Buffer)
+		ow, err := NewOutputWriter("csv", out, WriterOptions{})
+		if err != nil {
+			t.Error(err)
+		}
+		err = Run(bytes.NewReader(queryData), bytes.NewReader(refData), Options{}, ow)
+		if err != nil {
+			t.Error(err)
+		}
+		if out.String() != `query,SNPs
+Query1,
+Query2,G6C|A9T
+Query3,
+` {
+			t.Errorf("problem in TestSNPsTwoBit()")
+			fmt.Println(out.String())
+		}
+
+		// a corrupt count of sequences, and a truncated file, are errors, not allocations
+		corrupt := append([]byte{}, queryData...)
+		order.PutUint32(corrupt[8:], 0xffffffff)
+		for _, bad := range [][]byte{corrupt, queryData[:len(queryData)-2]} {
+			err = Run(bytes.NewReader(bad), bytes.NewReader(refData), Options{}, nullWriter{})
+			if !errors.Is(err, ErrBadTwoBit) {
+				t.Errorf("problem in TestSNPsTwoBit(): a corrupt file gave %v", err)
+			}
+		}
+	}
+}
+
+func TestSNPsPhylip(t *testing.T) {
+	refData := []byte(`>ref
+ATGATGCCA
+`)
+	// sequential and interleaved, with relaxed and strict names
+	for _, queryData := range []string{
+		" 3 9\nQuery1 ATGATGCCA\nQuery2  NNGAT CCCT\nQuery3 ATGANNNCA\n",
+		"3 9\nQuery1 ATGAT\nQuery2 NNGAT\nQuery3 ATGAN\n\nGCCA\nCCCT\nNNCA\n",
+		"3 9\nQuery1 ATG\nATGCCA\nQuery2 NNGATC\nCCT\nQuery3 ATGANNNCA\n",
+		"3 9\r\nQuery1    ATGATGCCA\r\nQuery2    NNGATCCCT\r\nQuery3    ATGANNNCA\r\n",
+	} {
+		out := new(bytes.Buffer)
+		ow, err := NewOutputWriter("csv", out, WriterOptions{})
+		if err != nil {
+			t.Error(err)
+		}
+		err = Run(strings.NewReader(queryData), bytes.NewReader(refData), Options{}, ow)
+		if err != nil {
+			t.Error(err)
+		}
+		if out.String() != `query,SNPs
+Query1,
+Query2,G6C|A9T
+Query3,
+` {
+			t.Errorf("problem in TestSNPsPhylip()")
+			fmt.Println(out.String())
+		}
+	}
+
+	// names that are 10 characters long can run into their sequences
+	out := new(bytes.Buffer)
+	ow, err := NewOutputWriter("csv", out, WriterOptions{})
+	if err != nil {
+		t.Error(err)
+	}
+	err = Run(strings.NewReader("2 9\nHomo sapieNNGATCCCT\nPan       ATGATGCCA\n"), bytes.NewReader(refData), Options{}, ow)
+	if err != nil {
+		t.Error(err)
+	}
+	if out.String() != "query,SNPs\nHomo sapie,G6C|A9T\nPan,\n" {
+		t.Errorf("problem in TestSNPsPhylip()")
+		fmt.Println(out.String())
+	}
+
+	// sequences that are the wrong length can't be read
+	ow, _ = NewOutputWriter("csv", new(bytes.Buffer), WriterOptions{})
+	err = Run(strings.NewReader("2 9\nQuery1 ATGATGCCA\nQuery2 ATGATG\n"), bytes.NewReader(refData), Options{}, ow)
+	if !errors.Is(err, fastaio.ErrBadPhylip) {
+		t.Errorf("problem in TestSNPsPhylip(): %v", err)
+	}
+}
+
+func TestSNPsNexus(t *testing.T) {
+	refData := []byte(`>ref
+ATGATGCCA
+`)
+	// interleaved, with a quoted name, comments and the block's own symbols, and not
+	for _, queryData := range []string{`#NEXUS
+[ written by hand ]
+BEGIN TAXA;
+	DIMENSIONS NTAX=3;
+	TAXLABELS Query1 'Query 2' Query3;
+END;
+BEGIN DATA;
+	DIMENSIONS NTAX=3 NCHAR=9;
+	FORMAT DATATYPE=DNA MISSING=X GAP=- MATCHCHAR=. INTERLEAVE;
+	MATRIX
+	Query1     ATGAT [the first block]
+	'Query 2'  XXGAT
+	Query3     ....X
+
+	Query1     GCCA
+	'Query 2'  CCCT
+	Query3     XX..
+	;
+END;
+`, `#nexus
+begin characters;
+	dimensions nchar=9;
+	format datatype=rna;
+	matrix
+	Query1 AUGAUGCCA
+	'Query 2' ??GAU
+	CCCU
+	Query3 AUGA??? CA
+	;
+end;
+`} {
+		out := new(bytes.Buffer)
+		ow, err := NewOutputWriter("csv", out, WriterOptions{})
+		if err != nil {
+			t.Error(err)
+		}
+		err = Run(strings.NewReader(queryData), bytes.NewReader(refData), Options{}, ow)
+		if err != nil {
+			t.Error(err)
+		}
+		if out.String() != `query,SNPs
+Query1,
+Query 2,G6C|A9T
+Query3,
+` {
+			t.Errorf("problem in TestSNPsNexus()")
+			fmt.Println(out.String())
+		}
+	}
+
+	// only nucleotides can be read, and the matrix has to be as big as it says, and end
+	for _, queryData := range []string{
+		"#NEXUS\nBEGIN DATA;\nDIMENSIONS NTAX=1 NCHAR=3;\nFORMAT DATATYPE=PROTEIN;\nMATRIX\nQuery1 MKV\n;\nEND;\n",
+		"#NEXUS\nBEGIN DATA;\nDIMENSIONS NTAX=3 NCHAR=9;\nMATRIX\nQuery1 ATGATGCCA\nQuery2 ATGATGCCA\n;\nEND;\n",
+		"#NEXUS\nBEGIN TAXA;\nDIMENSIONS NTAX=3;\nEND;\nBEGIN CHARACTERS;\nDIMENSIONS NCHAR=9;\nMATRIX\nQuery1 ATGATGCCA\nQuery2 ATGATGCCA\n;\nEND;\n",
+		"#NEXUS\nBEGIN DATA;\nDIMENSIONS NTAX=2 NCHAR=9;\nFORMAT INTERLEAVE;\nMATRIX\nQuery1 ATGATGCCA\nQuery2 ATGATGCC\n;\nEND;\n",
+		"#NEXUS\nBEGIN DATA;\nDIMENSIONS NTAX=2 NCHAR=9;\nMATRIX\nQuery1 ATGATGCCA\nQuery2 ATGATGCCA\n",
+	} {
+		ow, _ := NewOutputWriter("csv", new(bytes.Buffer), WriterOptions{})
+		err := Run(strings.NewReader(queryData), bytes.NewReader(refData), Options{}, ow)
+		if !errors.Is(err, fastaio.ErrBadNexus) {
+			t.Errorf("problem in TestSNPsNexus(): %v", err)
+		}
+	}
+}
+
+func TestSNPsMAF(t *testing.T) {
+	// the second block is on the reverse strand of the reference, and the reference's
+	// last two sites aren't in either
+	queryData := `##maf version=1 scoring=test
+# a comment
+
+a score=10.0
+s hg38.chr1   0 5 + 12 ATG-ATG
+s panTro.chr1 3 6 + 50 ATGCATC
+s mm10.chr4   9 4 + 90 TT--ATG
+
+a score=5.0
+s hg38.chr1   2 4 - 12 CCCA
+s mm10.chr4   0 4 - 90 CCTA
+s mm10.chr9   0 4 - 90 GGGG
+`
+	out := new(bytes.Buffer)
+	ow, err := NewOutputWriter("csv", out, WriterOptions{})
+	if err != nil {
+		t.Error(err)
+	}
+	err = RunRefFirst(strings.NewReader(queryData), Options{}, ow)
+	if err != nil {
+		t.Error(err)
+	}
+	if out.String() != `query,SNPs
+panTro,G6C
+mm10,A1T|G8A
+` {
+		t.Errorf("problem in TestSNPsMAF()")
+		fmt.Println(out.String())
+	}
+
+	// the reference can only be aligned on one sequence
+	ow, _ = NewOutputWriter("csv", new(bytes.Buffer), WriterOptions{})
+	err = RunRefFirst(strings.NewReader(queryData+"\na\ns hg38.chr2 0 4 + 12 ATGA\n"), Options{}, ow)
+	if !errors.Is(err, fastaio.ErrBadMAF) {
+		t.Errorf("problem in TestSNPsMAF(): %v", err)
+	}
+}
+
+func TestSNPsGenBank(t *testing.T) {
+	refData := `LOCUS       TEST01                    12 bp    DNA     linear   VRL 01-JAN-2020
+DEFINITION  Test virus,
+            complete genome.
+VERSION     TEST01.1
+FEATURES             Location/Qualifiers
+     CDS             1..9
+                     /gene="g1"
+ORIGIN
+        1 atgatgcca tgg
+//
+`
+	queryData := `>Query1
+ATGATCCCATGG
+`
+	regions, err := annotation.ReadGenBank(strings.NewReader(refData))
+	if err != nil {
+		t.Error(err)
+	}
+	out := new(bytes.Buffer)
+	ow, err := NewOutputWriter("csv", out, WriterOptions{Annotated: true})
+	if err != nil {
+		t.Error(err)
+	}
+	err = Run(strings.NewReader(queryData), strings.NewReader(refData), Options{Regions: regions}, ow)
+	if err != nil {
+		t.Error(err)
+	}
+	if out.String() != `query,SNPs,annotated_SNPs
+Query1,G6C,G6C (g1:M2I)
+` {
+		t.Errorf("problem in TestSNPsGenBank()")
+		fmt.Println(out.String())
+	}
+
+	// a record has to end with //
+	ow, _ = NewOutputWriter("csv", new(bytes.Buffer), WriterOptions{})
+	err = Run(strings.NewReader(queryData), strings.NewReader(strings.TrimSuffix(refData, "//\n")), Options{}, ow)
+	if !errors.Is(err, fastaio.ErrBadGenBank) {
+		t.Errorf("problem in TestSNPsGenBank(): %v", err)
+	}
+}
+
+func TestSNPsRegion(t *testing.T) {
+	for s, want := range map[string]Region{
+		"chr1":                {Contig: "chr1", Start: 1},
+		"chr1:100":            {Contig: "chr1", Start: 100, End: 100},
+		"chr1:1,000-2,000":    {Contig: "chr1", Start: 1000, End: 2000},
+		"chr1:5-":             {Contig: "chr1", Start: 5},
+		"HLA-A*01:01:1-10":    {Contig: "HLA-A*01:01", Start: 1, End: 10},
+		"NC_045512.2:266-805": {Contig: "NC_045512.2", Start: 266, End: 805},
+	} {
+		r, err := ParseRegion(s)
+		if err != nil || r != want {
+			t.Errorf("problem in TestSNPsRegion(): %s: %v %v", s, r, err)
+		}
+	}
+	for _, s := range []string{"", "chr1:", "chr1:0-5", "chr1:5-2", ":1-5", "chr1:a-b"} {
+		if _, err := ParseRegion(s); !errors.Is(err, ErrBadRegion) {
+			t.Errorf("problem in TestSNPsRegion(): %s was accepted", s)
+		}
+	}
+
+	refData := `>chr
+ATGATGCCATGG
+AAAA
+>plasmid
+CCCCGGGG
+`
+	faiData := "chr\t16\t5\t12\t13\nplasmid\t8\t32\t8\t9\n"
+	queryData := `>q1
+TTGATGCCATGCAAAT
+`
+
+	region := Region{Contig: "chr", Start: 10, End: 16}
+	fromFasta, err := ReadReferenceRegion(strings.NewReader(refData), region, false)
+	if err != nil {
+		t.Error(err)
+	}
+	fromIndex, err := ReadIndexedReferenceRegion(strings.NewReader(refData), strings.NewReader(faiData), region, false)
+	if err != nil {
+		t.Error(err)
+	}
+	if !bytes.Equal(fromFasta, fromIndex) || len(fromIndex) != 16 {
+		t.Errorf("problem in TestSNPsRegion(): the reference read with the index is different")
+	}
+
+	out := new(bytes.Buffer)
+	ow, err := NewOutputWriter("csv", out, WriterOptions{Missing: true})
+	if err != nil {
+		t.Error(err)
+	}
+	err = RunReference(strings.NewReader(queryData), fromIndex, Options{Mask: region.Mask(len(fromIndex), nil), IncludeMissing: true}, ow)
+	if err != nil {
+		t.Error(err)
+	}
+	if out.String() != `query,SNPs,missing
+q1,G12C|A16T,
+` {
+		t.Errorf("problem in TestSNPsRegion()")
+		fmt.Println(out.String())
+	}
+
+	// the region has to be in the record, and the record in the reference
+	_, err = ReadIndexedReferenceRegion(strings.NewReader(refData), strings.NewReader(faiData), Region{Contig: "plasmid", Start: 5, End: 9}, false)
+	if !errors.Is(err, ErrBadRegion) {
+		t.Errorf("problem in TestSNPsRegion(): %v", err)
+	}
+	_, err = ReadReferenceRegion(strings.NewReader(refData), Region{Contig: "chr2", Start: 1}, false)
+	if !errors.Is(err, ErrBadReference) {
+		t.Errorf("problem in TestSNPsRegion(): %v", err)
+	}
+	// and the index has to match the fasta file
+	_, err = ReadIndexedReferenceRegion(strings.NewReader(refData), strings.NewReader("plasmid\t8\t30\t8\t9\n"), Region{Contig: "plasmid", Start: 1}, false)
+	if !errors.Is(err, ErrBadFaidx) {
+		t.Errorf("problem in TestSNPsRegion(): %v", err)
+	}
+}
+
+func TestConvert(t *testing.T) {
+	refData := []byte(`>ref
+ATGGATTAACCCAT
+`)
+	queryData := []byte(
+		`>Query1 2021-03-01,x
+ATGGATTAACCCAT
+>Query2 2021-03-02
+ATGGGTTAACCCNT
+>Query3
+CCCGACTAACCTAT
+`)
+	gffData := []byte(`ref	.	CDS	1	9	.	+	0	ID=cds-1;gene=g1
+ref	.	CDS	10	12	.	-	0	ID=cds-2;gene=g2
+`)
+	regions, err := annotation.ReadGFF(bytes.NewReader(gffData))
+	if err != nil {
+		t.Error(err)
+	}
+	opts := Options{Regions: regions, Dates: DateOptions{Regex: regexp.MustCompile(`\d{4}-\d\d-\d\d`)}, IncludeMissing: true, Clusters: ClusterOptions{Count: 3, Window: 5}}
+	wopts := WriterOptions{Annotated: true, CodonPositions: true, Description: true, Dates: true, Missing: true, Clusters: true}
+
+	for _, format := range []string{"csv", "aggregate"} {
+		direct := new(bytes.Buffer)
+		ow, err := NewOutputWriter(format, direct, wopts)
+		if err != nil {
+			t.Error(err)
+		}
+		err = Run(bytes.NewReader(queryData), bytes.NewReader(refData), opts, ow)
+		if err != nil {
+			t.Error(err)
+		}
+
+		perQuery := new(bytes.Buffer)
+		ow, err = NewOutputWriter("csv", perQuery, wopts)
+		if err != nil {
+			t.Error(err)
+		}
+		err = Run(bytes.NewReader(queryData), bytes.NewReader(refData), opts, ow)
+		if err != nil {
+			t.Error(err)
+		}
+		cr, err := NewCSVReader(perQuery)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(cr.WriterOptions(), wopts) {
+			t.Errorf("problem in TestConvert(): options %v", cr.WriterOptions())
+		}
+		converted := new(bytes.Buffer)
+		ow, err = NewOutputWriter(format, converted, cr.WriterOptions())
+		if err != nil {
+			t.Error(err)
+		}
+		err = Convert(cr, ow)
+		if err != nil {
+			t.Error(err)
+		}
+
+		if converted.String() != direct.String() {
+			t.Errorf("problem in TestConvert(): %s", format)
+			fmt.Println(direct.String())
+			fmt.Println(converted.String())
+		}
+	}
+
+	_, err = NewCSVReader(bytes.NewReader([]byte("change,proportion\n")))
+	if err == nil {
+		t.Errorf("problem in TestConvert(): aggregate output was accepted")
+	}
+
+	// long and JSON output can't be read back, and say so
+	for format, data := range map[string]string{"long": "query\tposition\tref\talt\nQuery1\t6\tG\tC\n", "json": "[{\"query\":\"Query1\"}]\n", "ndjson": "{\"query\":\"Query1\"}\n"} {
+		_, err = NewCSVReader(strings.NewReader(data))
+		if err == nil || !strings.Contains(err.Error(), "can't be converted") {
+			t.Errorf("problem in TestConvert(): %s output gave %v", format, err)
+		}
+	}
+}
+
+func TestSummary(t *testing.T) {
+	csvData := []byte(`query,SNPs,missing
+Query1,,A1N
+Query2,G6C|A9T,
+Query3,G6C|T10A|C11A,A1N
+Query4,G6C,
+`)
+
+	summary := new(bytes.Buffer)
+	counts := new(bytes.Buffer)
+	cr, err := NewCSVReader(bytes.NewReader(csvData))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sw, err := NewOutputWriter("summary", summary, cr.WriterOptions())
+	if err != nil {
+		t.Error(err)
+	}
+	cw, err := NewOutputWriter("counts", counts, cr.WriterOptions())
+	if err != nil {
+		t.Error(err)
+	}
+	err = Convert(cr, MultiWriter(sw, cw))
+	if err != nil {
+		t.Error(err)
+	}
+
+	if summary.String() != `statistic,value
+queries,4
+distinct_SNPs,4
+singleton_SNPs,3
+mean_SNPs_per_query,1.5000
+median_SNPs_per_query,1.5
+min_SNPs_per_query,0
+max_SNPs_per_query,3
+` || counts.String() != `query,SNPs,ambiguities,missing
+Query1,0,0,1
+Query2,2,0,0
+Query3,3,0,1
+Query4,1,0,0
+` {
+		t.Errorf("problem in TestSummary()")
+		fmt.Println(summary.String())
+		fmt.Println(counts.String())
+	}
+}
+
+func TestFilter(t *testing.T) {
+	csvData := []byte(`query,SNPs,annotated_SNPs,missing
+Query1,,,A1N
+Query2,G6C|A9T,G6C (g1:M2I)|A9T,
+Query3,C2T|G6C|T10A,C2T|G6C (g1:M2I)|T10A,A1N
+Query4,G6C,G6C (g1:M2I),
+Query5,A9T,A9T,
+`)
+
+	mask, err := ParseRanges("1-2, 10")
+	if err != nil {
+		t.Error(err)
+	}
+	filter := &Filter{
+		Drop:        map[string]bool{"Query4": true},
+		Mask:        mask,
+		ExcludeSNPs: map[string]bool{"A9T": true},
+		MinSNPs:     1,
+		MaxSNPs:     -1,
+	}
+
+	cr, err := NewCSVReader(bytes.NewReader(csvData))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cr.Filter = filter
+	out := new(bytes.Buffer)
+	ow, err := NewOutputWriter("csv", out, cr.WriterOptions())
+	if err != nil {
+		t.Error(err)
+	}
+	err = Convert(cr, ow)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if out.String() != `query,SNPs,annotated_SNPs,missing
+Query2,G6C,G6C (g1:M2I),
+Query3,G6C,G6C (g1:M2I),
+` {
+		t.Errorf("problem in TestFilter()")
+		fmt.Println(out.String())
+	}
+
+	for _, s := range []string{"0-5", "5-1", "x"} {
+		if _, err := ParseRanges(s); err == nil {
+			t.Errorf("problem in TestFilter(): bad range %s was accepted", s)
+		}
+	}
+}
+
+func TestMatrices(t *testing.T) {
+	csvData := `query,SNPs
+Query1,
+Query2,G6C|A9T
+Query3,C2T|G6C
+`
+	expected := map[string]string{
+		"distance": `query,Query1,Query2,Query3
+Query1,0,2,2
+Query2,2,0,2
+Query3,2,2,0
+`,
+		"presence": `query,C2T,G6C,A9T
+Query1,0,0,0
+Query2,0,1,1
+Query3,1,1,0
+`,
+		"distance/lower": `query,Query1,Query2,Query3
+Query1
+Query2,2
+Query3,2,2
+`,
+		"distance/phylip": `3
+Query1     0 2 2
+Query2     2 0 2
+Query3     2 2 0
+`,
+		"distance/long": `query_a,query_b,distance
+Query1,Query2,2
+Query1,Query3,2
+Query2,Query3,2
+`,
+	}
+
+	for name, e := range expected {
+		cr, err := NewCSVReader(bytes.NewReader([]byte(csvData)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := new(bytes.Buffer)
+		// e.g. distance/lower is the distance format in the lower layout
+		format, wopts := name, cr.WriterOptions()
+		if i := strings.Index(name, "/"); i >= 0 {
+			format, wopts.MatrixLayout = name[:i], name[i+1:]
+		}
+		ow, err := NewOutputWriter(format, out, wopts)
+		if err != nil {
+			t.Error(err)
+		}
+		err = Convert(cr, ow)
+		if err != nil {
+			t.Error(err)
+		}
+		if out.String() != e {
+			t.Errorf("problem in TestMatrices(): %s", name)
+			fmt.Println(out.String())
+		}
+	}
+}
+
+// countingWriter is an OutputWriter that only counts what it is given
+type countingWriter struct {
+	headers, records, aggregates, closes int
+	queries                              int
+}
+
+func (cw *countingWriter) WriteHeader() error {
+	cw.headers++
+	return nil
+}
+
+func (cw *countingWriter) WriteRecord(record Record) error {
+	cw.records++
+	return nil
+}
+
+func (cw *countingWriter) NeedsAggregate() bool {
+	return true
+}
+
+func (cw *countingWriter) WriteAggregate(agg Aggregate) error {
+	cw.aggregates++
+	cw.queries = agg.Queries
+	return nil
+}
+
+func (cw *countingWriter) Close() error {
+	cw.closes++
+	return nil
+}
+
+func TestRegisterOutputWriter(t *testing.T) {
+	refData := []byte(`>ref
+ATGATG
+`)
+	queryData := []byte(
+		`>Query1
+ATGATG
+>Query2
+ATGATC
+`)
+
+	cw := &countingWriter{}
+	RegisterOutputWriter("counting", func(w io.Writer, opts WriterOptions) OutputWriter {
+		return cw
+	})
+
+	ow, err := NewOutputWriter("counting", new(bytes.Buffer), WriterOptions{})
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = Run(bytes.NewReader(queryData), bytes.NewReader(refData), Options{}, ow)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if cw.headers != 1 || cw.records != 2 || cw.aggregates != 1 || cw.closes != 1 || cw.queries != 2 {
+		t.Errorf("problem in TestRegisterOutputWriter(): %+v", *cw)
+	}
+
+	_, err = NewOutputWriter("not-a-format", new(bytes.Buffer), WriterOptions{})
+	if err == nil {
+		t.Errorf("problem in TestRegisterOutputWriter(): unknown format was accepted")
+	}
+}
+
+func TestSNPsAnnotated(t *testing.T) {
+	refData := []byte(`>ref
+ATGGATTAACCCAT
+`)
+	queryData := []byte(
+		`>Query1
+ATGGATTAACCCAT
+>Query2
+ATGGGTTAACCCAT
+>Query3
+ATGGACTAACCTAT
+`)
+	gffData := []byte(`ref	.	CDS	1	9	.	+	0	ID=cds-1;gene=g1
+ref	.	CDS	10	12	.	-	0	ID=cds-2;gene=g2
+`)
+
+	regions, err := annotation.ReadGFF(bytes.NewReader(gffData))
+	if err != nil {
+		t.Error(err)
+	}
+
+	ref := bytes.NewReader(refData)
+	query := bytes.NewReader(queryData)
+
+	out := new(bytes.Buffer)
+
+	ow, err := NewOutputWriter("csv", out, WriterOptions{Annotated: true})
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = Run(query, ref, Options{Regions: regions}, ow)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if string(out.Bytes()) != `query,SNPs,annotated_SNPs
+Query1,,
+Query2,A5G,A5G (g1:D2G)
+Query3,T6C|C12T,T6C (g1:D2D)|C12T (g2:G1R)
+` {
+		t.Errorf("problem in TestSNPsAnnotated()")
+		fmt.Println(string(out.Bytes()))
+	}
+}
+
+func TestSNPsCodonPositions(t *testing.T) {
+	refData := []byte(`>ref
+ATGGATTAACCCAT
+`)
+	queryData := []byte(
+		`>Query1
+ATGGGTTAACCTAT
+`)
+	gffData := []byte(`ref	.	CDS	1	9	.	+	0	ID=cds-1;gene=g1
+ref	.	CDS	10	12	.	-	0	ID=cds-2;gene=g2
+`)
+
+	regions, err := annotation.ReadGFF(bytes.NewReader(gffData))
+	if err != nil {
+		t.Error(err)
+	}
+
+	out := new(bytes.Buffer)
+
+	ow, err := NewOutputWriter("csv", out, WriterOptions{Annotated: true, CodonPositions: true})
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = Run(bytes.NewReader(queryData), bytes.NewReader(refData), Options{Regions: regions}, ow)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if string(out.Bytes()) != `query,SNPs,annotated_SNPs,codon_positions
+Query1,A5G|C12T,A5G (g1:D2G)|C12T (g2:G1R),A5G (g1:2:2)|C12T (g2:1:1)
+` {
+		t.Errorf("problem in TestSNPsCodonPositions()")
+		fmt.Println(string(out.Bytes()))
+	}
+}
+
+func TestSNPsClusters(t *testing.T) {
+	refData := []byte(`>ref
+ATGATGATGATGATGATGATGATG
+`)
+	queryData := []byte(
+		`>Query1
+ATGATGATGATGATGATGATGATG
+>Query2
+CCCATGATGATGATGATGATGATC
+>Query3
+ATGCCGATGATGATGATGCGAATG
+>Query4
+AT-----TGATGATGATGATGATG
+`)
+
+	out := new(bytes.Buffer)
+
+	ow, err := NewOutputWriter("csv", out, WriterOptions{Clusters: true})
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = Run(bytes.NewReader(queryData), bytes.NewReader(refData), Options{HardGaps: true, Clusters: ClusterOptions{Count: 3, Window: 5}}, ow)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if string(out.Bytes()) != `query,SNPs,SNP_clusters
+Query1,,
+Query2,A1C|T2C|G3C|G24C,1-3
+Query3,A4C|T5C|A19C|T20G|G21A,19-21
+Query4,G3-|A4-|T5-|G6-|A7-,
+` {
+		t.Errorf("problem in TestSNPsClusters()")
+		fmt.Println(string(out.Bytes()))
+	}
+}
+
+func TestSNPsRefFirst(t *testing.T) {
+	queryData := []byte(
+		`>ref
+ATGATG
+>Query1
+ATGATG
+>Query2
+ATGATC
+>Query3
+ATTTTW
+`)
+
+	out := new(bytes.Buffer)
+
+	ow, err := NewOutputWriter("csv", out, WriterOptions{})
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = RunRefFirst(bytes.NewReader(queryData), Options{}, ow)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if string(out.Bytes()) != `query,SNPs
+Query1,
+Query2,G6C
+Query3,G3T|A4T|G6W
+` {
+		t.Errorf("problem in TestSNPsRefFirst()")
+		fmt.Println(string(out.Bytes()))
+	}
+}
+
+func TestSNPsRefFirstSources(t *testing.T) {
+	// two files read as one alignment, each with its own reference first
+	queryData := []byte(
+		`>refA
+ATGATG
+>a1
+ATGATC
+>a2
+ATGATG
+>refB
+CCCCCCCC
+>b1
+CCCCCCCA
+`)
+	sources := []string{"fa1.fa", "fa1.fa", "fa1.fa", "fa2.fa", "fa2.fa"}
+	opts := Options{Source: func(index int) string { return sources[index] }}
+
+	out := new(bytes.Buffer)
+	ow, err := NewOutputWriter("csv", out, WriterOptions{Source: true})
+	if err != nil {
+		t.Error(err)
+	}
+	err = RunRefFirst(bytes.NewReader(queryData), opts, ow)
+	if err != nil {
+		t.Error(err)
+	}
+	if out.String() != `query,source,SNPs
+a1,fa1.fa,G6C
+a2,fa1.fa,
+b1,fa2.fa,C8A
+` {
+		t.Errorf("problem in TestSNPsRefFirstSources()")
+		fmt.Println(out.String())
+	}
+
+	// refB isn't a query, so it doesn't count towards the limit
+	out.Reset()
+	ow, err = NewOutputWriter("csv", out, WriterOptions{Source: true})
+	if err != nil {
+		t.Error(err)
+	}
+	opts.Limit = 3
+	err = RunRefFirst(bytes.NewReader(queryData), opts, ow)
+	if err != nil {
+		t.Error(err)
+	}
+	if out.String() != `query,source,SNPs
+a1,fa1.fa,G6C
+a2,fa1.fa,
+b1,fa2.fa,C8A
+` {
+		t.Errorf("problem in TestSNPsRefFirstSources(): limit")
+		fmt.Println(out.String())
+	}
+}
+
+func TestSNPsOnlyACGT(t *testing.T) {
+	refData := []byte(`>ref
+ATGATG
+`)
+	queryData := []byte(
+		`>Query1
+ATGATC
+>Query2
+ATTTTW
+>Query3
+YTGATG
+`)
+
+	out := new(bytes.Buffer)
+
+	ow, err := NewOutputWriter("csv", out, WriterOptions{})
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = Run(bytes.NewReader(queryData), bytes.NewReader(refData), Options{OnlyACGT: true}, ow)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if string(out.Bytes()) != `query,SNPs
+Query1,G6C
+Query2,G3T|A4T
+Query3,
+` {
+		t.Errorf("problem in TestSNPsOnlyACGT()")
+		fmt.Println(string(out.Bytes()))
+	}
+}
+
+func TestSNPsSkipAmbiguousRef(t *testing.T) {
+	refData := []byte(`>ref
+ATGNTR-
+`)
+	queryData := []byte(
+		`>Query1
+ATCANCA
+`)
+
+	for _, skip := range []bool{false, true} {
+		out := new(bytes.Buffer)
+
+		ow, err := NewOutputWriter("csv", out, WriterOptions{})
+		if err != nil {
+			t.Error(err)
+		}
+
+		err = Run(bytes.NewReader(queryData), bytes.NewReader(refData), Options{SkipAmbiguousRef: skip, HardGaps: true}, ow)
+		if err != nil {
+			t.Error(err)
+		}
+
+		expected := "query,SNPs\nQuery1,G3C|R6C|-7A\n"
+		if skip {
+			expected = "query,SNPs\nQuery1,G3C\n"
+		}
+		if string(out.Bytes()) != expected {
+			t.Errorf("problem in TestSNPsSkipAmbiguousRef()")
+			fmt.Println(string(out.Bytes()))
+		}
+	}
+}
+
+func TestSNPsFilter(t *testing.T) {
+	refData := []byte(`>ref
+ATGATG
+`)
+	queryData := []byte(
+		`>England/1 2021-01-01
+ATGATC
+>Wales/1 2021-01-02
+ATTTTW
+>England/2 2021-02-01
+ATGATG
+>England/3 2021-02-02
+ATGTTG
+`)
+
+	out := new(bytes.Buffer)
+
+	ow, err := NewOutputWriter("csv", out, WriterOptions{})
+	if err != nil {
+		t.Error(err)
+	}
+
+	opts := Options{Include: regexp.MustCompile("^England/"), Exclude: regexp.MustCompile("2021-02-01")}
+
+	err = Run(bytes.NewReader(queryData), bytes.NewReader(refData), opts, ow)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if string(out.Bytes()) != `query,SNPs
+England/1,G6C
+England/3,A4T
+` {
+		t.Errorf("problem in TestSNPsFilter()")
+		fmt.Println(string(out.Bytes()))
+	}
+}
+
+func TestSNPsIDs(t *testing.T) {
+	refData := []byte(`>ref
+ATGATG
+`)
+	queryData := []byte(
+		`>hCoV-19/England/1/2021|EPI_ISL_1|2021-01-01
+ATGATC
+>hCoV-19/Wales/1/2021|EPI_ISL_2|2021-01-02
+ATTTTW
+>Scotland,1 "x"
+ATGATG
+`)
+
+	rename, err := ReadRenameMap(bytes.NewReader([]byte("hCoV-19/Wales/1/2021\tWales-1\r\n\nScotland,1,Scotland 1\n")))
+	if err == nil {
+		t.Errorf("problem in TestSNPsIDs(): expected an error for a line with three fields")
+	}
+
+	rename, err = ReadRenameMap(bytes.NewReader([]byte("hCoV-19/Wales/1/2021\tWales 1\r\n\n")))
+	if err != nil {
+		t.Error(err)
+	}
+
+	out := new(bytes.Buffer)
+
+	ow, err := NewOutputWriter("csv", out, WriterOptions{})
+	if err != nil {
+		t.Error(err)
+	}
+
+	opts := Options{IDs: IDOptions{Truncate: "|", Rename: rename, Sanitize: true}}
+
+	err = Run(bytes.NewReader(queryData), bytes.NewReader(refData), opts, ow)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if string(out.Bytes()) != `query,SNPs
+hCoV-19/England/1/2021,G6C
+Wales_1,G3T|A4T|G6W
+Scotland_1,
+` {
+		t.Errorf("problem in TestSNPsIDs()")
+		fmt.Println(string(out.Bytes()))
+	}
+}
+
+func TestSNPsDescription(t *testing.T) {
+	refData := []byte(`>ref
+ATGATG
+`)
+	queryData := []byte(
+		`>Query1 England, 2021-01-01
+ATGATC
+>Query2
+ATTTTW
+>Query3 "quoted"
+ATGATG
+`)
+
+	out := new(bytes.Buffer)
+
+	ow, err := NewOutputWriter("csv", out, WriterOptions{Description: true})
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = Run(bytes.NewReader(queryData), bytes.NewReader(refData), Options{}, ow)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if string(out.Bytes()) != `query,description,SNPs
+Query1,"Query1 England, 2021-01-01",G6C
+Query2,Query2,G3T|A4T|G6W
+Query3,"Query3 ""quoted""",
+` {
+		t.Errorf("problem in TestSNPsDescription()")
+		fmt.Println(string(out.Bytes()))
+	}
+}
+
+func TestSNPsDates(t *testing.T) {
+	refData := []byte(`>ref
+ATGATG
+`)
+	queryData := []byte(
+		`>Query1|EPI_ISL_1|2021-01-01
+ATGATC
+>Query2|EPI_ISL_2|2021-01-03
+ATTTTW
+>Query3|EPI_ISL_3|2021-01
+ATGATG
+>Query4|EPI_ISL_4
+ATGATG
+`)
+
+	out := new(bytes.Buffer)
+
+	ow, err := NewOutputWriter("csv", out, WriterOptions{Dates: true})
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = Run(bytes.NewReader(queryData), bytes.NewReader(refData), Options{Dates: DateOptions{Field: 3, Delimiter: "|"}}, ow)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if string(out.Bytes()) != `query,date,iso_week,epi_week,SNPs
+Query1|EPI_ISL_1|2021-01-01,2021-01-01,2020-W53,2020-W53,G6C
+Query2|EPI_ISL_2|2021-01-03,2021-01-03,2020-W53,2021-W01,G3T|A4T|G6W
+Query3|EPI_ISL_3|2021-01,,,,
+Query4|EPI_ISL_4,,,,
+` {
+		t.Errorf("problem in TestSNPsDates()")
+		fmt.Println(string(out.Bytes()))
+	}
+
+	dopts := DateOptions{Regex: regexp.MustCompile(`(\d{4}-\d\d-\d\d)$`)}
+	if date := dopts.parse("Query1 collected 2022-12-31"); EpiWeek(date) != "2022-W52" || ISOWeek(date) != "2022-W52" {
+		t.Errorf("problem in TestSNPsDates(): %s", date)
+	}
+	if date := dopts.parse("Query1 collected 2021-01-09"); EpiWeek(date) != "2021-W01" || ISOWeek(date) != "2021-W01" {
+		t.Errorf("problem in TestSNPsDates(): %s", date)
+	}
+}
+
+func TestSNPsBarcodes(t *testing.T) {
+	refData := []byte(`>ref
+ATGATGATG
+`)
+	queryData := []byte(
+		`>Query1
+ATGATCATG
+>Query2
+ATGATCATC
+>Query3
+ATNNNNATC
+>Query4
+ATGATGATG
+>Query5
+TTGATGATG
+`)
+	barcodesData := []byte(`,G6C,G9C,A7T
+B,0,0,0
+B.1,1,0,0
+B.1.1,1,1.0,0
+B.2,0,0,1
+`)
+
+	barcodes, err := ReadBarcodes(bytes.NewReader(barcodesData))
+	if err != nil {
+		t.Error(err)
+	}
+
+	out := new(bytes.Buffer)
+
+	ow, err := NewOutputWriter("csv", out, WriterOptions{Lineages: true})
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = Run(bytes.NewReader(queryData), bytes.NewReader(refData), Options{Barcodes: barcodes}, ow)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if string(out.Bytes()) != `query,SNPs,lineage,lineage_score
+Query1,G6C,B.1,1.0000
+Query2,G6C|G9C,B.1.1,1.0000
+Query3,G9C,B.1.1,1.0000
+Query4,,B,1.0000
+Query5,A1T,B,1.0000
+` {
+		t.Errorf("problem in TestSNPsBarcodes()")
+		fmt.Println(string(out.Bytes()))
+	}
+
+	_, err = ReadBarcodes(bytes.NewReader([]byte(",G6C,nonsense\nB,0,0\n")))
+	if err == nil {
+		t.Errorf("problem in TestSNPsBarcodes(): expected an error for a bad SNP")
+	}
+}
+
+func TestSNPsAssociation(t *testing.T) {
+	refData := []byte(`>ref
+ATGATG
+`)
+	queryData := []byte(
+		`>Query1
+ATGATC
+>Query2
+ATGATC
+>Query3
+ATGATC
+>Query4
+ATGATG
+>Query5
+ATTATG
+>Query6
+ATTATG
+>Query7
+ATGATC
+`)
+	metadata := []byte("country\tstrain\nEngland\tQuery1\nEngland\tQuery2\nEngland\tQuery3\nWales\tQuery4\nWales\tQuery5\nWales\tQuery6\n")
+
+	groups, err := ReadGroups(bytes.NewReader(metadata), "strain", "country")
+	if err != nil {
+		t.Error(err)
+	}
+
+	out := new(bytes.Buffer)
+
+	ow, err := NewOutputWriter("association", out, WriterOptions{})
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = Run(bytes.NewReader(queryData), bytes.NewReader(refData), Options{Groups: groups}, ow)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if string(out.Bytes()) != `change,England_count,England_proportion,Wales_count,Wales_proportion,odds_ratio,p_value,adjusted_p_value
+G3T,0,0.000000000,2,0.666666667,0.0857143,0.4,0.4
+G6C,3,1.000000000,0,0.000000000,49,0.1,0.2
+` {
+		t.Errorf("problem in TestSNPsAssociation()")
+		fmt.Println(string(out.Bytes()))
+	}
+
+	_, err = ReadGroups(bytes.NewReader(metadata), "strain", "region")
+	if err == nil {
+		t.Errorf("problem in TestSNPsAssociation(): expected an error for a missing column")
+	}
+}
+
+func TestSNPsStratified(t *testing.T) {
+	refData := []byte(`>ref
+ATGATG
+`)
+	queryData := []byte(
+		`>Query1|2021-01-05
+ATGATC
+>Query2|2021-01-20
+ATGATG
+>Query3|2021-02-01
+ATGATC
+>Query4|2021-02-10
+ATTATC
+>Query5|2021-02
+ATTATG
+`)
+
+	out := new(bytes.Buffer)
+
+	ow, err := NewOutputWriter("stratified", out, WriterOptions{Threshold: 0.6})
+	if err != nil {
+		t.Error(err)
+	}
+
+	opts := Options{Dates: DateOptions{Field: 2, Delimiter: "|"}, GroupBy: GroupMonth}
+
+	err = Run(bytes.NewReader(queryData), bytes.NewReader(refData), opts, ow)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if string(out.Bytes()) != `change,2021-01,2021-02
+G6C,0.500000000,1.000000000
+` {
+		t.Errorf("problem in TestSNPsStratified()")
+		fmt.Println(string(out.Bytes()))
+	}
+}
+
+func TestSNPsTrend(t *testing.T) {
+	refData := []byte(`>ref
+ATGATG
+`)
+	// G6C rises from 1 in 4 to 3 in 4, G3T is everywhere, and A4T is only at the end
+	queryData := []byte(
+		`>Query1|2021-01-01
+ATTATC
+>Query2|2021-01-01
+ATTATG
+>Query3|2021-01-01
+ATTATG
+>Query4|2021-01-01
+ATTATG
+>Query5|2021-01-08
+ATTATC
+>Query6|2021-01-08
+ATTATC
+>Query7|2021-01-08
+ATTATG
+>Query8|2021-01-08
+ATTATG
+>Query9|2021-01-15
+ATTATC
+>Query10|2021-01-15
+ATTATC
+>Query11|2021-01-15
+ATTTTC
+>Query12|2021-01-15
+ATTTTG
+>Query13
+ATGATG
+`)
+
+	out := new(bytes.Buffer)
+
+	ow, err := NewOutputWriter("trend", out, WriterOptions{})
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = Run(bytes.NewReader(queryData), bytes.NewReader(refData), Options{Dates: DateOptions{Field: 2, Delimiter: "|"}}, ow)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if string(out.Bytes()) != `change,count,proportion,growth_rate,ci_lower,ci_upper,rising
+G3T,12,1.000000000,,,,
+A4T,2,0.166666667,,,,
+G6C,6,0.500000000,1.098612,-0.501721,2.698946,false
+` {
+		t.Errorf("problem in TestSNPsTrend()")
+		fmt.Println(string(out.Bytes()))
+	}
+}
+
+func TestReadValidReference(t *testing.T) {
+	_, err := ReadValidReference(bytes.NewReader([]byte(">ref\nATGATG\n")), false, false)
+	if err != nil {
+		t.Error(err)
+	}
+
+	_, err = ReadValidReference(bytes.NewReader([]byte(">ref\nATGNTG\n")), false, true)
+	if err != nil {
+		t.Error(err)
+	}
+
+	_, err = ReadValidReference(bytes.NewReader([]byte(">ref\nATGNTG\n")), false, false)
+	if !errors.Is(err, ErrInvalidChar) || err.Error() != "sequence ref, position 4: invalid character in the reference: N" {
+		t.Errorf("problem in TestReadValidReference(): %v", err)
+	}
+
+	_, err = ReadValidReference(bytes.NewReader([]byte(">ref\nATGAT-\n")), true, true)
+	if !errors.Is(err, ErrInvalidChar) || err.Error() != "sequence ref, position 6: invalid character in the reference: -" {
+		t.Errorf("problem in TestReadValidReference(): %v", err)
+	}
+
+	_, err = ReadValidReference(bytes.NewReader([]byte(">ref\nATGXTG\n")), false, false)
+	if !errors.Is(err, ErrInvalidChar) || err.Error() != "sequence ref, position 4: invalid character in the reference" {
+		t.Errorf("problem in TestReadValidReference(): %v", err)
+	}
+
+	_, err = ReadValidReference(bytes.NewReader([]byte(">ref1\nATGATG\n>ref2\nATGATG\n")), false, false)
+	if !errors.Is(err, ErrBadReference) || err.Error() != "bad reference: should have one record, but has 2" {
+		t.Errorf("problem in TestReadValidReference(): %v", err)
+	}
+}
+
+func TestSNPsLongSequence(t *testing.T) {
+	defer func(size int) { chunkSize = size }(chunkSize)
+	chunkSize = 1000
+
+	// longer than bufio.Scanner's default line limit, and split into chunks
+	refSeq := bytes.Repeat([]byte("ATG"), 100000)
+	query1 := append([]byte{}, refSeq...)
+	query1[0] = 'C'
+	query1[999] = 'C'
+	query1[1000] = 'C'
+	query1[299999] = 'C'
+	query2 := append([]byte{}, refSeq...)
+
+	refData := append([]byte(">ref\n"), refSeq...)
+	queryData := append(append(append(append([]byte(">Query1\n"), query1...), []byte("\n>Query2\n")...), query2...), '\n')
+
+	out := new(bytes.Buffer)
+
+	ow, err := NewOutputWriter("csv", out, WriterOptions{})
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = Run(bytes.NewReader(queryData), bytes.NewReader(refData), Options{}, ow)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if string(out.Bytes()) != `query,SNPs
+Query1,A1C|A1000C|T1001C|G300000C
+Query2,
+` {
+		t.Errorf("problem in TestSNPsLongSequence()")
+		fmt.Println(string(out.Bytes()))
+	}
+}
+
+func TestSNPsMaxMemory(t *testing.T) {
+	refData := []byte(`>ref
+ATGATG
+`)
+	// budgets smaller than every sequence, that fit one sequence, and that fit them all
+	queryData := []byte(
+		`>Query1
+ATGATC
+>Query2
+ATTTTW
+>Query3
+ATGATG
+>Query4
+ATG
+`)
+
+	for _, maxMemory := range []int64{1, 6, 100} {
+		out := new(bytes.Buffer)
+
+		ow, err := NewOutputWriter("csv", out, WriterOptions{})
+		if err != nil {
+			t.Error(err)
+		}
+
+		err = Run(bytes.NewReader(queryData), bytes.NewReader(refData), Options{MaxMemory: maxMemory}, ow)
+		if err != nil {
+			t.Error(err)
+		}
+
+		if string(out.Bytes()) != `query,SNPs
+Query1,G6C
+Query2,G3T|A4T|G6W
+Query3,
+Query4,
+` {
+			t.Errorf("problem in TestSNPsMaxMemory()")
+			fmt.Println(string(out.Bytes()))
+		}
+	}
+}
+
+// testTracer records the spans that are ended, and the errors they are ended with
+type testTracer struct {
+	mu    sync.Mutex
+	ended map[string]error
+}
+
+type testSpan struct {
+	name   string
+	tracer *testTracer
+}
+
+func (tt *testTracer) Start(name string) Span {
+	return &testSpan{name: name, tracer: tt}
+}
+
+func (ts *testSpan) End(err error) {
+	ts.tracer.mu.Lock()
+	ts.tracer.ended[ts.name] = err
+	ts.tracer.mu.Unlock()
+}
+
+func TestSNPsTracer(t *testing.T) {
+	refData := []byte(`>ref
+ATGATG
+`)
+
+	tracer := &testTracer{ended: make(map[string]error)}
+
+	ow, err := NewOutputWriter("csv", new(bytes.Buffer), WriterOptions{})
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = Run(bytes.NewReader([]byte(">Query1\nATGATC\n")), bytes.NewReader(refData), Options{Tracer: tracer}, ow)
+	if err != nil {
+		t.Error(err)
+	}
+
+	for _, name := range []string{"snps.read_reference", "snps.run", "snps.read", "snps.compare", "snps.write"} {
+		if err, ok := tracer.ended[name]; !ok || err != nil {
+			t.Errorf("problem in TestSNPsTracer(): %s ended: %t, with error %v", name, ok, err)
+		}
+	}
+
+	tracer = &testTracer{ended: make(map[string]error)}
+
+	ow, err = NewOutputWriter("csv", new(bytes.Buffer), WriterOptions{})
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = Run(bytes.NewReader([]byte(">Query1\nATGATGATG\n")), bytes.NewReader(refData), Options{Tracer: tracer}, ow)
+	if err == nil {
+		t.Errorf("problem in TestSNPsTracer(): expected an error")
+	}
+	if tracer.ended["snps.run"] != err {
+		t.Errorf("problem in TestSNPsTracer(): snps.run should have ended with the error")
+	}
+}
+
+func TestSNPsLimit(t *testing.T) {
+	refData := []byte(`>ref
+ATGATG
+`)
+	queryData := []byte(
+		`>Query1
+ATGATC
+>Query2
+ATTTTW
+>Query3
+ATGATG
+`)
+
+	for limit, expected := range map[int]string{
+		1:  "query,SNPs\nQuery1,G6C\n",
+		2:  "query,SNPs\nQuery1,G6C\nQuery2,G3T|A4T|G6W\n",
+		10: "query,SNPs\nQuery1,G6C\nQuery2,G3T|A4T|G6W\nQuery3,\n",
+	} {
+		out := new(bytes.Buffer)
+
+		ow, err := NewOutputWriter("csv", out, WriterOptions{})
+		if err != nil {
+			t.Error(err)
+		}
+
+		err = Run(bytes.NewReader(queryData), bytes.NewReader(refData), Options{Limit: limit}, ow)
+		if err != nil {
+			t.Error(err)
+		}
+
+		if string(out.Bytes()) != expected {
+			t.Errorf("problem in TestSNPsLimit()")
+			fmt.Println(string(out.Bytes()))
+		}
+	}
+}
+
+func TestSNPsAmbiguities(t *testing.T) {
+	refData := []byte(`>ref
+RTGATGN
+`)
+	queryData := []byte(
+		`>Query1
+ATGATCA
+>Query2
+GTSAWNT
+>Query3
+CTG-TG?
+`)
+
+	out := new(bytes.Buffer)
+
+	ow, err := NewOutputWriter("csv", out, WriterOptions{Ambiguities: true})
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = Run(bytes.NewReader(queryData), bytes.NewReader(refData), Options{Ambiguities: true}, ow)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if string(out.Bytes()) != `query,SNPs,compatible_ambiguities
+Query1,G6C,R1A
+Query2,,R1G|G3S|T5W
+Query3,R1C,
+` {
+		t.Errorf("problem in TestSNPsAmbiguities()")
+		fmt.Println(string(out.Bytes()))
+	}
+}
+
+// endlessAlignment is an alignment that never ends
+type endlessAlignment struct {
+	record []byte
+	i      int
+}
+
+func (ea *endlessAlignment) Read(p []byte) (int, error) {
+	for n := range p {
+		p[n] = ea.record[ea.i%len(ea.record)]
+		ea.i++
+	}
+	return len(p), nil
+}
+
+func TestSNPsContext(t *testing.T) {
+	refData := []byte(`>ref
+ATGATG
+`)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := RunContext(ctx, bytes.NewReader([]byte(">Query1\nATGATC\n")), bytes.NewReader(refData), Options{}, nullWriter{})
+	if err != context.Canceled {
+		t.Errorf("problem in TestSNPsContext()")
+		fmt.Println(err)
+	}
+
+	for _, opts := range []Options{{}, {MaxMemory: 100}} {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		query := &endlessAlignment{record: []byte(">Query\nATGATC\n")}
+		err := RunContext(ctx, query, bytes.NewReader(refData), opts, nullWriter{})
+		cancel()
+		if err != context.DeadlineExceeded {
+			t.Errorf("problem in TestSNPsContext()")
+			fmt.Println(err)
+		}
+	}
+}
+
+// nullWriter is an OutputWriter that throws everything away
+type nullWriter struct{}
+
+func (nullWriter) WriteHeader() error             { return nil }
+func (nullWriter) WriteRecord(Record) error       { return nil }
+func (nullWriter) WriteAggregate(Aggregate) error { return nil }
+func (nullWriter) Close() error                   { return nil }
+
+// aggregateRecorder keeps the aggregate it is given, and reads it if needs is true
+type aggregateRecorder struct {
+	nullWriter
+	needs bool
+	agg   Aggregate
+}
+
+func (ar *aggregateRecorder) NeedsAggregate() bool { return ar.needs }
+
+func (ar *aggregateRecorder) WriteAggregate(agg Aggregate) error {
+	ar.agg = agg
+	return nil
+}
+
+func TestNeedsAggregate(t *testing.T) {
+	refData := []byte(">ref\nATGATG\n")
+	queryData := []byte(">Query1\nATGATC\n>Query2\nATTATG\n")
+
+	// the aggregate is only counted if a writer reads it
+	for _, needs := range [][]bool{{true}, {false}, {false, false}, {false, true}} {
+		writers := make([]OutputWriter, len(needs))
+		recorders := make([]*aggregateRecorder, len(needs))
+		counted := false
+		for i, n := range needs {
+			recorders[i] = &aggregateRecorder{needs: n}
+			writers[i] = recorders[i]
+			counted = counted || n
+		}
+		err := Run(bytes.NewReader(queryData), bytes.NewReader(refData), Options{}, MultiWriter(writers...))
+		if err != nil {
+			t.Error(err)
+		}
+		if (len(recorders[0].agg.Changes) > 0) != counted {
+			t.Errorf("problem in TestNeedsAggregate(): %v gave %d changes", needs, len(recorders[0].agg.Changes))
+		}
+	}
+
+	// writers that don't declare it, e.g. ones registered by other packages, don't get one
+	if needsAggregate(nullWriter{}) {
+		t.Errorf("problem in TestNeedsAggregate(): a writer that doesn't declare it needs the aggregate")
+	}
+	for _, format := range []string{"csv", "aggregate"} {
+		ow, err := NewOutputWriter(format, new(bytes.Buffer), WriterOptions{})
+		if err != nil {
+			t.Error(err)
+		}
+		if needsAggregate(ow) != (format == "aggregate") {
+			t.Errorf("problem in TestNeedsAggregate(): %s output", format)
+		}
+	}
+}
+
+func TestSNPsErrors(t *testing.T) {
+	refData := []byte(`>ref
+ATGATG
+`)
+
+	for query, expected := range map[string]struct {
+		cause  error
+		record string
+		index  int
+		line   int
+	}{
+		"ATGATG\n":                            {ErrBadFasta, "", 1, 1},
+		">Query1\nATGATG\n\n>\nATGATG\n":      {ErrEmptyHeader, "", 2, 4},
+		">Query1\nATGATG\n>Query2\nATGATGA\n": {ErrLengthMismatch, "Query2", 2, 0},
+	} {
+		err := Run(bytes.NewReader([]byte(query)), bytes.NewReader(refData), Options{}, nullWriter{})
+		var recordError *RecordError
+		if !errors.Is(err, expected.cause) || !errors.As(err, &recordError) {
+			t.Errorf("problem in TestSNPsErrors(): %v", err)
+			continue
+		}
+		if recordError.Record != expected.record || recordError.Index != expected.index || recordError.Line != expected.line {
+			t.Errorf("problem in TestSNPsErrors(): %v", err)
+		}
+	}
+
+	_, err := NewOutputWriter("xyz", io.Discard, WriterOptions{})
+	if !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("problem in TestSNPsErrors(): %v", err)
+	}
+}
+
+func TestSNPsLengthMismatch(t *testing.T) {
+	refData := []byte(`>ref
+ATGATG
+`)
+	queryData := []byte(
+		`>Query1
+ATGATC
+>Query2
+ATGA
+>Query3
+ATGATGCA
+`)
+
+	expected := map[string]string{
+		LengthMismatchSkip:     "query,SNPs,missing\nQuery1,G6C,\n",
+		LengthMismatchTruncate: "query,SNPs,missing\nQuery1,G6C,\nQuery2,,\nQuery3,,\n",
+	}
+	for policy, e := range expected {
+		var warnings []string
+		var mu sync.Mutex
+		warn := func(message string) {
+			mu.Lock()
+			warnings = append(warnings, message)
+			mu.Unlock()
+		}
+		out := new(bytes.Buffer)
+		ow, err := NewOutputWriter("csv", out, WriterOptions{Missing: true})
+		if err != nil {
+			t.Error(err)
+		}
+		err = Run(bytes.NewReader(queryData), bytes.NewReader(refData), Options{IncludeMissing: true, LengthMismatch: policy, Warn: warn}, ow)
+		if err != nil {
+			t.Error(err)
+		}
+		if out.String() != e {
+			t.Errorf("problem in TestSNPsLengthMismatch(): policy %q", policy)
+			fmt.Println(out.String())
+		}
+		if policy == LengthMismatchSkip && len(warnings) != 2 {
+			t.Errorf("problem in TestSNPsLengthMismatch(): expected 2 warnings, got %v", warnings)
+		}
+	}
+
+	// padding reports the end of a short query as missing
+	out := new(bytes.Buffer)
+	ow, err := NewOutputWriter("csv", out, WriterOptions{Missing: true})
+	if err != nil {
+		t.Error(err)
+	}
+	err = Run(bytes.NewReader(queryData[:28]), bytes.NewReader(refData), Options{IncludeMissing: true, LengthMismatch: LengthMismatchPad}, ow)
+	if err != nil {
+		t.Error(err)
+	}
+	if out.String() != "query,SNPs,missing\nQuery1,G6C,\nQuery2,,T5N|G6N\n" {
+		t.Errorf("problem in TestSNPsLengthMismatch(): policy pad")
+		fmt.Println(out.String())
+	}
+
+	for _, policy := range []string{"", LengthMismatchError, LengthMismatchPad} {
+		err = Run(bytes.NewReader(queryData), bytes.NewReader(refData), Options{LengthMismatch: policy}, &countingWriter{})
+		if !errors.Is(err, ErrLengthMismatch) {
+			t.Errorf("problem in TestSNPsLengthMismatch(): policy %q gave %v", policy, err)
+		}
+	}
+
+	err = Run(bytes.NewReader(queryData), bytes.NewReader(refData), Options{LengthMismatch: "x"}, &countingWriter{})
+	if !errors.Is(err, ErrUnknownPolicy) {
+		t.Errorf("problem in TestSNPsLengthMismatch(): unknown policy was accepted")
+	}
+}
+
+func TestCatalogue(t *testing.T) {
+	refData := []byte(`>ref
+ATGATG
+`)
+	queryData := []byte(
+		`>Query1
+ATGATC
+>Query2
+ATTTTW
+>Query3
+ATGATG
+`)
+	catalogueData := []byte(`label,change
+"resistance, high",G6C
+antigenic,G3T
+antigenic site 2,G6C
+`)
+
+	c, err := ReadCatalogue(bytes.NewReader(catalogueData))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(c, Catalogue{"G6C": "resistance, high; antigenic site 2", "G3T": "antigenic"}) {
+		t.Errorf("problem in TestCatalogue(): %v", c)
+	}
+
+	expected := map[string]string{
+		"csv": `query,SNPs,labels
+Query1,G6C,"G6C (resistance, high; antigenic site 2)"
+Query2,G3T|A4T|G6W,G3T (antigenic)
+Query3,,
+`,
+		"aggregate": `change,proportion,label
+G3T,0.333333333,antigenic
+A4T,0.333333333,
+G6C,0.333333333,"resistance, high; antigenic site 2"
+G6W,0.333333333,
+`,
+	}
+	for format, e := range expected {
+		out := new(bytes.Buffer)
+		ow, err := NewOutputWriter(format, out, WriterOptions{Catalogue: c})
+		if err != nil {
+			t.Error(err)
+		}
+		err = Run(bytes.NewReader(queryData), bytes.NewReader(refData), Options{}, ow)
+		if err != nil {
+			t.Error(err)
+		}
+		if out.String() != e {
+			t.Errorf("problem in TestCatalogue(): %s", format)
+			fmt.Println(out.String())
+		}
+
+		// the labels survive being read back
+		cr, err := NewCSVReader(strings.NewReader(expected["csv"]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		converted := new(bytes.Buffer)
+		ow, err = NewOutputWriter(format, converted, cr.WriterOptions())
+		if err != nil {
+			t.Error(err)
+		}
+		err = Convert(cr, ow)
+		if err != nil {
+			t.Error(err)
+		}
+		if converted.String() != e {
+			t.Errorf("problem in TestCatalogue(): converting %s", format)
+			fmt.Println(converted.String())
+		}
+	}
+
+	_, err = ReadCatalogue(bytes.NewReader([]byte("change,label\nxyz,label\n")))
+	if !errors.Is(err, ErrBadCSV) {
+		t.Errorf("problem in TestCatalogue(): bad change was accepted")
+	}
+}
+
+func TestIndex(t *testing.T) {
+	refData := []byte(`>ref
+ATGATG
+`)
+	queryData := []byte(
+		`>Query1
+ATGATC
+>Query2
+ATTTTW
+>Query3
+ATGNTG
+`)
+
+	out := new(bytes.Buffer)
+	ow, err := NewOutputWriter("index", out, WriterOptions{})
+	if err != nil {
+		t.Error(err)
+	}
+	err = Run(bytes.NewReader(queryData), bytes.NewReader(refData), Options{IncludeMissing: true}, ow)
+	if err != nil {
+		t.Error(err)
+	}
+
+	idx, err := ReadIndex(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(idx.Samples, []string{"Query1", "Query2", "Query3"}) {
+		t.Errorf("problem in TestIndex(): samples %v", idx.Samples)
+	}
+	if !reflect.DeepEqual(idx.Changes(), []string{"G3T", "A4T", "G6C", "G6W"}) {
+		t.Errorf("problem in TestIndex(): changes %v", idx.Changes())
+	}
+	if !reflect.DeepEqual(idx.Has("G6C"), []bool{true, false, false}) || !reflect.DeepEqual(idx.Has("A4N"), []bool{false, false, false}) {
+		t.Errorf("problem in TestIndex(): G6C %v", idx.Has("G6C"))
+	}
+
+	b := newBitset(70)
+	for _, i := range []int{0, 9, 63, 64, 69} {
+		b.set(i)
+	}
+	if !reflect.DeepEqual(unpack(b.pack(70), 70), b) {
+		t.Errorf("problem in TestIndex(): bitsets don't survive packing")
+	}
+
+	_, err = ReadIndex(bytes.NewReader([]byte("query,SNPs\n")))
+	if !errors.Is(err, ErrBadIndex) {
+		t.Errorf("problem in TestIndex(): csv was read as an index")
+	}
+
+	// corrupt sample counts and name lengths are errors, not allocations of that size
+	huge := []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x7f}
+	for _, corrupt := range [][]byte{
+		append([]byte("SNPSIDX\x01"), huge...),
+		append([]byte("SNPSIDX\x01\x01"), huge...),
+		append([]byte("SNPSIDX\x01\x01\x01Q\x01"), huge...),
+	} {
+		_, err = ReadIndex(bytes.NewReader(corrupt))
+		if !errors.Is(err, ErrBadIndex) {
+			t.Errorf("problem in TestIndex(): %q gave %v", corrupt, err)
+		}
+	}
+}
+
+func TestSearch(t *testing.T) {
+	idx := &Index{Samples: []string{"s1", "s2", "s3", "s4"}, sets: map[string]bitset{
+		"G3T": {0b0011},
+		"G6C": {0b0101},
+		"A4T": {0b1000},
+	}}
+
+	for pattern, expected := range map[string][]string{
+		"G3T":                      {"s1", "s2"},
+		"G3T,G6C":                  {"s1"},
+		"g3t and g6c":              {"s1"},
+		"G3T OR A4T":               {"s1", "s2", "s4"},
+		"NOT G3T":                  {"s3", "s4"},
+		"G6C AND NOT G3T":          {"s3"},
+		"NOT (G3T OR G6C)":         {"s4"},
+		"A4T OR G3T AND G6C":       {"s1", "s4"},
+		"(A4T OR G3T) AND NOT G6C": {"s2", "s4"},
+		"C100T":                    {},
+		"NOT C100T":                {"s1", "s2", "s3", "s4"},
+	} {
+		matches, err := idx.Search(pattern)
+		if err != nil {
+			t.Error(err)
+		}
+		if !reflect.DeepEqual(matches, expected) {
+			t.Errorf("problem in TestSearch(): %s gave %v", pattern, matches)
+		}
+	}
+
+	for _, pattern := range []string{"", "G3T AND", "(G3T", "G3T)", "OR G3T", "G3T G6C", "xyz"} {
+		_, err := idx.Search(pattern)
+		if !errors.Is(err, ErrBadPattern) {
+			t.Errorf("problem in TestSearch(): %q gave %v", pattern, err)
+		}
+	}
+}
+
+func TestRecombination(t *testing.T) {
+	refData := []byte(`>ref
+ACGTACGTACGT
+`)
+	parentData := []byte(`>A
+ACGTACGTACGT
+>B
+AGGTTCGAACCT
+`)
+	queryData := []byte(
+		`>Query1
+ACGTACGAACCT
+>Query2
+AGGTTCGAACCT
+>Query3
+ANGTNCGAACCT
+`)
+
+	parents, err := ReadParents(bytes.NewReader(parentData), 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := new(bytes.Buffer)
+	ow, err := NewOutputWriter("csv", out, WriterOptions{Parents: true})
+	if err != nil {
+		t.Error(err)
+	}
+	err = Run(bytes.NewReader(queryData), bytes.NewReader(refData), Options{Parents: parents}, ow)
+	if err != nil {
+		t.Error(err)
+	}
+	if out.String() != `query,SNPs,parents,breakpoints
+Query1,T8A|G11C,A:2-5|B:8-11,5-8
+Query2,C2G|A5T|T8A|G11C,B:2-11,
+Query3,T8A|G11C,B:8-11,
+` {
+		t.Errorf("problem in TestRecombination()")
+		fmt.Println(out.String())
+	}
+
+	cr, err := NewCSVReader(bytes.NewReader(out.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	record, err := cr.Read()
+	if err != nil {
+		t.Error(err)
+	}
+	if !reflect.DeepEqual(record.Segments, []Segment{{"A", 2, 5}, {"B", 8, 11}}) {
+		t.Errorf("problem in TestRecombination(): read %v", record.Segments)
+	}
+
+	_, err = ReadParents(bytes.NewReader(parentData[:16]), 6)
+	if err == nil {
+		t.Errorf("problem in TestRecombination(): one parent was accepted")
+	}
+}
+
+func TestAmplicons(t *testing.T) {
+	refData := []byte(`>ref
+ACGTACGTACGTACGTACGT
+`)
+	queryData := []byte(
+		`>Query1
+ACGTACGTACGTACGTACGT
+>Query2
+ACGNNNNNACGTACGTACGT
+>Query3
+ACGTACGTACG--NNNNCGT
+`)
+	primerData := []byte(`# a primer bed
+ref	0	2	scheme_1_LEFT	1	+
+ref	1	3	scheme_1_LEFT_alt1	1	+
+ref	8	10	scheme_1_RIGHT	1	-
+ref	9	11	scheme_2_LEFT	1	+
+ref	17	19	scheme_2_RIGHT	1	-
+`)
+
+	amplicons, err := ReadAmplicons(bytes.NewReader(primerData), 0.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(amplicons.Amplicons, []Amplicon{{"scheme_1", 4, 8}, {"scheme_2", 12, 17}}) {
+		t.Errorf("problem in TestAmplicons(): read %v", amplicons.Amplicons)
+	}
+
+	out := new(bytes.Buffer)
+	ow, err := NewOutputWriter("csv", out, WriterOptions{Dropouts: true})
+	if err != nil {
+		t.Error(err)
+	}
+	err = Run(bytes.NewReader(queryData), bytes.NewReader(refData), Options{Amplicons: amplicons}, ow)
+	if err != nil {
+		t.Error(err)
+	}
+	if out.String() != `query,SNPs,amplicon_dropouts
+Query1,,
+Query2,,scheme_1
+Query3,,scheme_2
+` {
+		t.Errorf("problem in TestAmplicons()")
+		fmt.Println(out.String())
+	}
+
+	cr, err := NewCSVReader(bytes.NewReader(out.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cr.Read()
+	record, err := cr.Read()
+	if err != nil {
+		t.Error(err)
+	}
+	if !reflect.DeepEqual(record.Dropouts, []string{"scheme_1"}) {
+		t.Errorf("problem in TestAmplicons(): read %v", record.Dropouts)
+	}
+
+	// an amplicon bed
+	amplicons, err = ReadAmplicons(strings.NewReader("ref\t3\t8\tamplicon_a\nref\t10\t20\n"), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(amplicons.Amplicons, []Amplicon{{"amplicon_a", 4, 8}, {"ref:11-20", 11, 20}}) {
+		t.Errorf("problem in TestAmplicons(): read %v", amplicons.Amplicons)
+	}
+
+	_, err = ReadAmplicons(bytes.NewReader(primerData[:70]), 0.5)
+	if !errors.Is(err, ErrBadBED) {
+		t.Errorf("problem in TestAmplicons(): a primer without its pair gave %v", err)
+	}
+}
+
+func TestMask(t *testing.T) {
+	refData := []byte(`>ref
+ACGTACGTACGT
+`)
+	queryData := []byte(
+		`>Query1
+TCGTANGTACGA
+`)
+
+	mask, err := ReadMask(strings.NewReader("ref\t0\t2\tscheme_1_LEFT\nref\t4\t6\tscheme_1_RIGHT\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := new(bytes.Buffer)
+	ow, err := NewOutputWriter("csv", out, WriterOptions{Missing: true})
+	if err != nil {
+		t.Error(err)
+	}
+	err = Run(bytes.NewReader(queryData), bytes.NewReader(refData), Options{Mask: mask, IncludeMissing: true}, ow)
+	if err != nil {
+		t.Error(err)
+	}
+	if out.String() != `query,SNPs,missing
+Query1,T12A,
+` {
+		t.Errorf("problem in TestMask()")
+		fmt.Println(out.String())
+	}
+}
+
+func TestWeights(t *testing.T) {
+	refData := []byte(`>ref
+ACGTACGT
+`)
+	queryData := []byte(
+		`>Query1
+TCGTACGA
+>Query2
+ACGTACGA
+`)
+
+	weights, err := ReadWeights(strings.NewReader("position,weight\n# error-prone\n8\t0.25\n3,0\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(weights, Weights{8: 0.25, 3: 0}) {
+		t.Errorf("problem in TestWeights(): read %v", weights)
+	}
+	for _, bad := range []string{"8\n", "0,1\n", "8,-1\n", "8,0.5\nx,1\n"} {
+		_, err := ReadWeights(strings.NewReader(bad))
+		if !errors.Is(err, ErrBadWeights) {
+			t.Errorf("problem in TestWeights(): %q gave %v", bad, err)
+		}
+	}
+
+	out := new(bytes.Buffer)
+	ow, err := NewOutputWriter("csv", out, WriterOptions{Weights: true})
+	if err != nil {
+		t.Error(err)
+	}
+	err = Run(bytes.NewReader(queryData), bytes.NewReader(refData), Options{Weights: weights}, ow)
+	if err != nil {
+		t.Error(err)
+	}
+	if out.String() != `query,SNPs,weighted_SNPs,weighted_distance
+Query1,A1T|T8A,A1T (1)|T8A (0.25),1.25
+Query2,T8A,T8A (0.25),0.25
+` {
+		t.Errorf("problem in TestWeights()")
+		fmt.Println(out.String())
+	}
+
+	out = new(bytes.Buffer)
+	ow, err = NewOutputWriter("aggregate", out, WriterOptions{Weights: true})
+	if err != nil {
+		t.Error(err)
+	}
+	err = Run(bytes.NewReader(queryData), bytes.NewReader(refData), Options{Weights: weights}, ow)
+	if err != nil {
+		t.Error(err)
+	}
+	if out.String() != `change,proportion,weighted_proportion
+A1T,0.500000000,0.500000000
+T8A,1.000000000,0.250000000
+` {
+		t.Errorf("problem in TestWeights()")
+		fmt.Println(out.String())
+	}
+}
+
+func TestComparePairs(t *testing.T) {
+	queryData := []byte(
+		`>a
+ACGTACGT
+>b
+ACTTACGA
+>c
+NCGTAC-T
+`)
+	pairs, err := ReadPairs(strings.NewReader("id,name_b,name_a\n1,b,a\n2,c,b\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(pairs, []Pair{{"a", "b"}, {"b", "c"}}) {
+		t.Errorf("problem in TestComparePairs(): read %v", pairs)
+	}
+
+	results, err := ComparePairs(bytes.NewReader(queryData), pairs, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := new(bytes.Buffer)
+	err = WritePairSNPs(out, results)
+	if err != nil {
+		t.Error(err)
+	}
+	if out.String() != `name_a,name_b,distance,SNPs
+a,b,2,G3T|T8A
+b,c,2,T3G|A8T
+` {
+		t.Errorf("problem in TestComparePairs()")
+		fmt.Println(out.String())
+	}
+
+	_, err = ComparePairs(bytes.NewReader(queryData), []Pair{{"a", "d"}}, Options{})
+	if !errors.Is(err, ErrNotInAlignment) {
+		t.Errorf("problem in TestComparePairs(): a missing sequence gave %v", err)
+	}
+}
+
+func TestCountOnly(t *testing.T) {
+	refData := []byte(`>ref
+ATGATG
+`)
+	queryData := []byte(
+		`>Query1
+ATTATG
+>Query2
+ATTTNW
+`)
+
+	for _, countOnly := range []bool{false, true} {
+		out := new(bytes.Buffer)
+		ow, err := NewOutputWriter("distance-only", out, WriterOptions{})
+		if err != nil {
+			t.Error(err)
+		}
+		err = Run(bytes.NewReader(queryData), bytes.NewReader(refData), Options{CountOnly: countOnly}, ow)
+		if err != nil {
+			t.Error(err)
+		}
+		if out.String() != `query,distance
+Query1,1
+Query2,3
+` {
+			t.Errorf("problem in TestCountOnly()")
+			fmt.Println(out.String())
+		}
+	}
+}
+
+func TestClock(t *testing.T) {
+	out := new(bytes.Buffer)
+	ow, err := NewOutputWriter("clock", out, WriterOptions{})
+	if err != nil {
+		t.Error(err)
+	}
+	ow.WriteHeader()
+	// two SNPs a year from the start of 2020, one query with far too many, and one
+	// without a date
+	years := []int{2020, 2021, 2022, 2023, 2024, 2022, 0}
+	for i, distance := range []int{0, 2, 4, 6, 8, 30, 5} {
+		record := Record{Query: "Query" + strconv.Itoa(i+1), Distance: distance}
+		if years[i] > 0 {
+			record.Date = time.Date(years[i], 1, 1, 0, 0, 0, 0, time.UTC)
+		}
+		ow.WriteRecord(record)
+	}
+	ow.WriteAggregate(Aggregate{})
+	ow.Close()
+	if out.String() != `statistic,value
+queries,5
+outliers,1
+rate,2.000273
+root_date,2020-01-01
+r_squared,1.000000
+outlier_queries,Query6
+` {
+		t.Errorf("problem in TestClock()")
+		fmt.Println(out.String())
+	}
+}
+
+func TestSnapshots(t *testing.T) {
+	refData := []byte(`>ref
+ATGATG
+`)
+	queryData := []byte(
+		`>Query1
+ATTATG
+>Query2
+ATTATA
+>Query3
+ATGATA
+`)
+
+	out := new(bytes.Buffer)
+	ow := NewSnapshotWriter(out, SnapshotOptions{Every: 2}, WriterOptions{})
+	ow.(*snapshotWriter).now = func() time.Time {
+		return time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	}
+	err := Run(bytes.NewReader(queryData), bytes.NewReader(refData), Options{}, ow)
+	if err != nil {
+		t.Error(err)
+	}
+	if out.String() != `time,queries,change,count,proportion
+2021-06-01T12:00:00Z,2,G3T,2,1.000000000
+2021-06-01T12:00:00Z,2,G6A,1,0.500000000
+2021-06-01T12:00:00Z,3,G3T,2,0.666666667
+2021-06-01T12:00:00Z,3,G6A,2,0.666666667
+` {
+		t.Errorf("problem in TestSnapshots()")
+		fmt.Println(out.String())
+	}
+}
+
+func TestResolutions(t *testing.T) {
+	refData := []byte(`>ref
+ARGNTG?-
+`)
+	queryData := []byte(
+		`>Query1
+AAGCTGTA
+>Query2
+AGGYTGNA
+>Query3
+ACGNTG-A
+`)
+
+	out := new(bytes.Buffer)
+	ow, err := NewOutputWriter("csv", out, WriterOptions{Resolutions: true})
+	if err != nil {
+		t.Error(err)
+	}
+	err = Run(bytes.NewReader(queryData), bytes.NewReader(refData), Options{Resolutions: true}, ow)
+	if err != nil {
+		t.Error(err)
+	}
+	if out.String() != `query,SNPs,reference_resolutions
+Query1,,R2A|N4C|?7T
+Query2,,R2G
+Query3,R2C,
+` {
+		t.Errorf("problem in TestResolutions()")
+		fmt.Println(out.String())
+	}
+}
+
+func TestCompareAlignments(t *testing.T) {
+	aData := []byte(`>Query1
+ACGT
+>Query2
+AAAA
+>Query3
+TTTT
+`)
+	bData := []byte(`>Query2
+AANA
+>Query1
+ACGA
+>Query4
+GGGG
+`)
+
+	for _, ignoreMissing := range []bool{false, true} {
+		disagreements, err := CompareAlignments(bytes.NewReader(aData), bytes.NewReader(bData), false, ignoreMissing)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := new(bytes.Buffer)
+		err = WriteDisagreements(out, disagreements)
+		if err != nil {
+			t.Error(err)
+		}
+		expected := `query,disagreements,sites,missing_from
+Query2,1,A3N,
+Query1,1,T4A,
+Query4,,,a
+Query3,,,b
+`
+		if ignoreMissing {
+			expected = strings.Replace(expected, "Query2,1,A3N,", "Query2,0,,", 1)
+		}
+		if out.String() != expected {
+			t.Errorf("problem in TestCompareAlignments()")
+			fmt.Println(out.String())
+		}
+	}
+
+	_, err := CompareAlignments(bytes.NewReader(aData), strings.NewReader(">Query1\nACG\n"), false, false)
+	if !errors.Is(err, ErrLengthMismatch) {
+		t.Errorf("problem in TestCompareAlignments(): a length mismatch gave %v", err)
+	}
+}
+
+func TestContigs(t *testing.T) {
+	refData := []byte(`>HA
+ATGATG
+>NA
+CCCGGG
+`)
+	queryData := []byte(
+		`>A/Texas/50/2012|HA
+ATTATG
+>A/Texas/50/2012|NA
+CCCGGA
+>sample3
+CCCGGA
+>sample4_HA
+ATTATC
+`)
+
+	contigs, err := ReadContigs(bytes.NewReader(refData), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contigs.Map = map[string]string{"sample3": "NA"}
+
+	out := new(bytes.Buffer)
+	ow, err := NewOutputWriter("csv", out, WriterOptions{Contigs: true})
+	if err != nil {
+		t.Error(err)
+	}
+	err = RunContigs(bytes.NewReader(queryData), contigs, Options{}, ow)
+	if err != nil {
+		t.Error(err)
+	}
+	if out.String() != `query,contig,SNPs
+A/Texas/50/2012|HA,HA,HA:G3T
+A/Texas/50/2012|NA,NA,NA:G6A
+sample3,NA,NA:G6A
+sample4_HA,HA,HA:G3T|HA:G6C
+` {
+		t.Errorf("problem in TestContigs()")
+		fmt.Println(out.String())
+	}
+
+	// SNPs at the same position in different contigs are counted apart
+	cr, err := NewCSVReader(bytes.NewReader(out.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	ow, err = NewOutputWriter("aggregate", out, cr.WriterOptions())
+	if err != nil {
+		t.Error(err)
+	}
+	err = Convert(cr, ow)
+	if err != nil {
+		t.Error(err)
+	}
+	if out.String() != `change,proportion
+HA:G3T,0.500000000
+HA:G6C,0.250000000
+NA:G6A,0.500000000
+` {
+		t.Errorf("problem in TestContigs(): aggregate")
+		fmt.Println(out.String())
+	}
+
+	contigs.Map = nil
+	err = RunContigs(bytes.NewReader(queryData), contigs, Options{}, nullWriter{})
+	if !errors.Is(err, ErrNoContig) {
+		t.Errorf("problem in TestContigs(): an unmatched query gave %v", err)
+	}
+}
+
+func TestFilters(t *testing.T) {
+	refData := []byte(`>ref
+ATGATGAT
+`)
+	queryData := []byte(
+		`>Query1
+ATGATGAC
+>Query2
+TTGNNNNN
+>Query3
+CAGATGTT
+`)
+
+	filter, err := CompileFilter("completeness > 0.5 && snp_count > 0")
+	if err != nil {
+		t.Error(err)
+	}
+	snpFilter, err := CompileSNPFilter("position > 1")
+	if err != nil {
+		t.Error(err)
+	}
+
+	out := new(bytes.Buffer)
+	ow, err := NewOutputWriter("csv", out, WriterOptions{})
+	if err != nil {
+		t.Error(err)
+	}
+	err = Run(bytes.NewReader(queryData), bytes.NewReader(refData), Options{Filter: filter, SNPFilter: snpFilter}, ow)
+	if err != nil {
+		t.Error(err)
+	}
+	if out.String() != `query,SNPs
+Query1,T8C
+Query3,T2A|A7T
+` {
+		t.Errorf("problem in TestFilters()")
+		fmt.Println(out.String())
+	}
+
+	filter, err = CompileFilter("query > 1")
+	if err != nil {
+		t.Error(err)
+	}
+	err = Run(bytes.NewReader(queryData), bytes.NewReader(refData), Options{Filter: filter}, nullWriter{})
+	if !errors.Is(err, ErrExpressionType) {
+		t.Errorf("problem in TestFilters(): %v", err)
+	}
+
+	if _, err := CompileFilter("snps < 1"); !errors.Is(err, ErrBadExpression) {
+		t.Errorf("problem in TestFilters(): %v", err)
+	}
+}
+
+func TestReport(t *testing.T) {
+	refData := []byte(`>ref
+ATGATG
+`)
+	queryData := []byte(
+		`>Query1
+ATGATC
+>Query<2>
+ATTNNC
+`)
+
+	out := new(bytes.Buffer)
+	ow, err := NewOutputWriter("report", out, WriterOptions{MissingSites: true})
+	if err != nil {
+		t.Error(err)
+	}
+	err = Run(bytes.NewReader(queryData), bytes.NewReader(refData), Options{CountMissing: true}, ow)
+	if err != nil {
+		t.Error(err)
+	}
+	for _, want := range []string{
+		"<tr><th>Queries</th><td>2</td></tr>",
+		"<tr><th>Distinct SNPs</th><td>2</td></tr>",
+		"<tr><td>G6C</td><td>2</td><td>1.0000</td>",
+		"<tr><td>Query&lt;2&gt;</td><td>2</td></tr>",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("problem in TestReport(): no %s", want)
+			fmt.Println(out.String())
+		}
+	}
+	if strings.Contains(out.String(), "<script") || strings.Contains(out.String(), "http") {
+		t.Errorf("problem in TestReport(): report isn't self-contained")
+	}
+}
+
+func TestRankProfile(t *testing.T) {
+	refData := []byte(`>ref
+ATGATGAT
+`)
+	queryData := []byte(
+		`>Query1
+ATGATGAT
+>Query2
+ACGNTGAC
+>Query3
+ACGATGRC
+>Query4
+ACGATGCC
+`)
+
+	profile, err := ReadProfile(bytes.NewReader([]byte("# a hypothetical variant\nT2C, A7G|T8C\n")))
+	if err != nil {
+		t.Error(err)
+	}
+	refSeq, err := ReadReference(bytes.NewReader(refData), false)
+	if err != nil {
+		t.Error(err)
+	}
+	matches, err := RankProfile(bytes.NewReader(queryData), refSeq, profile, Options{})
+	if err != nil {
+		t.Error(err)
+	}
+	out := new(bytes.Buffer)
+	err = WriteProfileMatches(out, matches)
+	if err != nil {
+		t.Error(err)
+	}
+	if out.String() != `query,matched,mismatched,missing,proportion_matched,mismatched_sites,missing_sites
+Query3,2,0,1,0.6667,,A7G
+Query2,2,1,0,0.6667,A7G,
+Query4,2,1,0,0.6667,A7G,
+Query1,0,3,0,0.0000,T2C|A7G|T8C,
+` {
+		t.Errorf("problem in TestRankProfile()")
+		fmt.Println(out.String())
+	}
+
+	for _, p := range []string{"T2C\nA3G\n", "T20C\n", "x\n", "\n"} {
+		profile, err := ReadProfile(strings.NewReader(p))
+		if err == nil {
+			_, err = RankProfile(bytes.NewReader(queryData), refSeq, profile, Options{})
+		}
+		if !errors.Is(err, ErrBadProfile) {
+			t.Errorf("problem in TestRankProfile(): %q: %v", p, err)
+		}
+	}
+}
+
+func TestGVCF(t *testing.T) {
+	refData := []byte(`>ref
+ATGATG
+`)
+	queryData := []byte(
+		`>Query1
+ATGATC
+>Query2
+ATTNNW
+>Query3
+AT-ATC
+>Query4
+ATGA
+`)
+
+	out := new(bytes.Buffer)
+	ow, err := NewOutputWriter("gvcf", out, WriterOptions{ReferenceName: "MN908947.3"})
+	if err != nil {
+		t.Error(err)
+	}
+	err = Run(bytes.NewReader(queryData), bytes.NewReader(refData), Options{MissingRanges: true, LengthMismatch: LengthMismatchPad}, ow)
+	if err != nil {
+		t.Error(err)
+	}
+	lines := strings.Split(out.String(), "\n")
+	if lines[2] != "##contig=<ID=MN908947.3,length=6>" || strings.Join(lines[12:], "\n") != `MN908947.3	1	.	A	<*>	.	.	END=2;MinAN=4;MinCOV=1.0000
+MN908947.3	3	.	G	T	.	.	AC=1;AN=3;AF=0.3333;COV=0.7500
+MN908947.3	4	.	A	<*>	.	.	END=4;MinAN=3;MinCOV=0.7500
+MN908947.3	5	.	T	<*>	.	.	END=5;MinAN=2;MinCOV=0.5000
+MN908947.3	6	.	G	C	.	.	AC=2;AN=2;AF=1.0000;COV=0.5000
+` {
+		t.Errorf("problem in TestGVCF()")
+		fmt.Println(out.String())
+	}
+
+	if !reflect.DeepEqual(findMissingRanges(8, []byte{136, 240, 240, 24, 244}, Options{}), [][2]int{{2, 3}, {5, 8}}) {
+		t.Errorf("problem in TestGVCF(): %v", findMissingRanges(8, []byte{136, 240, 240, 24, 244}, Options{}))
+	}
+}
+
+func TestPopulationVCF(t *testing.T) {
+	refData := []byte(`>ref
+ATGATG
+`)
+	queryData := []byte(
+		`>Query1
+ATGATC
+>Query2
+ATTNNW
+>Query3
+AT-ATC
+>Query4
+ATGA
+`)
+
+	for minCount, expected := range map[int]string{
+		0: `reference	3	.	G	T	.	.	AC=1;AN=3;AF=0.3333;COV=0.7500
+reference	6	.	G	C	.	.	AC=2;AN=2;AF=1.0000;COV=0.5000
+`,
+		2: `reference	6	.	G	C	.	.	AC=2;AN=2;AF=1.0000;COV=0.5000
+`,
+	} {
+		out := new(bytes.Buffer)
+		ow, err := NewOutputWriter("population-vcf", out, WriterOptions{MinCount: minCount})
+		if err != nil {
+			t.Error(err)
+		}
+		err = Run(bytes.NewReader(queryData), bytes.NewReader(refData), Options{MissingRanges: true, LengthMismatch: LengthMismatchPad}, ow)
+		if err != nil {
+			t.Error(err)
+		}
+		lines := strings.Split(out.String(), "\n")
+		if lines[7] != "#CHROM\tPOS\tID\tREF\tALT\tQUAL\tFILTER\tINFO" || strings.Join(lines[8:], "\n") != expected {
+			t.Errorf("problem in TestPopulationVCF(): min count %d", minCount)
+			fmt.Println(out.String())
+		}
+	}
+}
+
+func TestVCF(t *testing.T) {
+	refData := []byte(`>ref
+ATGATR
+`)
+	queryData := []byte(
+		`>Query1
+ATGATC
+>Query2
+ATTNNW
+>Query3
+AT-ATA
+>Query4
+ATGA
+`)
+
+	out := new(bytes.Buffer)
+	ow, err := NewOutputWriter("vcf", out, WriterOptions{ReferenceName: "MN908947.3"})
+	if err != nil {
+		t.Error(err)
+	}
+	err = Run(bytes.NewReader(queryData), bytes.NewReader(refData), Options{MissingRanges: true, LengthMismatch: LengthMismatchPad}, ow)
+	if err != nil {
+		t.Error(err)
+	}
+	if out.String() != `##fileformat=VCFv4.2
+##source=snps
+##contig=<ID=MN908947.3,length=6>
+##INFO=<ID=AC,Number=A,Type=Integer,Description="Number of queries with each alternative allele">
+##INFO=<ID=AN,Number=1,Type=Integer,Description="Number of queries called at the site">
+##FORMAT=<ID=GT,Number=1,Type=String,Description="Genotype">
+#CHROM	POS	ID	REF	ALT	QUAL	FILTER	INFO	FORMAT	Query1	Query2	Query3	Query4
+MN908947.3	3	.	G	T	.	.	AC=1;AN=3	GT	0	1	.	0
+MN908947.3	6	.	N	C	.	.	AC=1;AN=3	GT	1	0	0	.
+` {
+		t.Errorf("problem in TestVCF()")
+		fmt.Println(out.String())
+	}
+
+	// samples can't have the same name
+	ow, _ = NewOutputWriter("vcf", new(bytes.Buffer), WriterOptions{})
+	err = Run(bytes.NewReader([]byte(">Query1\nATGATC\n>Query1\nATGATC\n")), bytes.NewReader(refData), Options{}, ow)
+	if err == nil {
+		t.Errorf("problem in TestVCF(): two samples with the same name were accepted")
+	}
+}
+func TestReorient(t *testing.T) {
+	refData := []byte(`>ref
+ACGGTCAATGCA
+`)
+	queryData := []byte(
+		`>Query1
+ACGGTCAATGCT
+>Query2
+TNCATTGACCGA
+`)
+
+	var warnings []string
+	var mu sync.Mutex
+	warn := func(message string) {
+		mu.Lock()
+		warnings = append(warnings, message)
+		mu.Unlock()
+	}
+	out := new(bytes.Buffer)
+	ow, err := NewOutputWriter("csv", out, WriterOptions{})
+	if err != nil {
+		t.Error(err)
+	}
+	err = Run(bytes.NewReader(queryData), bytes.NewReader(refData), Options{Reorient: true, Warn: warn}, ow)
+	if err != nil {
+		t.Error(err)
+	}
+	if out.String() != `query,SNPs
+Query1,A12T
+Query2,A1T
+` {
+		t.Errorf("problem in TestReorient()")
+		fmt.Println(out.String())
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "Query2") {
+		t.Errorf("problem in TestReorient(): expected a warning about Query2, got %v", warnings)
+	}
+}
+
+func TestCircular(t *testing.T) {
+	refData := []byte(`>ref
+ACGTTGCAAGGCTTACCGATAGCTAGGACTTGACCATGCAGTCAAGTTCGACGGATCAAG
+`)
+	// Query1 starts at the reference's 11th base, and has SNPs either side of the origin
+	// and one near its start
+	queryData := []byte(
+		`>Query1
+GCATACCGATAGCTAGGACTTGACCATGCAGTCAAGTTCGACGGATCGAGATGTTGCAAG
+>Query2
+NNNNNNNNNNNNNNNNNNNNNNNNNNNNNNNNNNNNNNNNNNNNNNNNNNNNNNNNNNNN
+`)
+
+	var warnings []string
+	var mu sync.Mutex
+	warn := func(message string) {
+		mu.Lock()
+		warnings = append(warnings, message)
+		mu.Unlock()
+	}
+	for _, offset := range []int{0, 10} {
+		warnings = nil
+		out := new(bytes.Buffer)
+		ow, err := NewOutputWriter("csv", out, WriterOptions{})
+		if err != nil {
+			t.Error(err)
+		}
+		err = Run(bytes.NewReader(queryData), bytes.NewReader(refData), Options{Circular: true, RotationOffset: offset, Warn: warn}, ow)
+		if err != nil {
+			t.Error(err)
+		}
+		if out.String() != `query,SNPs
+Query1,C2T|T13A|A58G
+Query2,
+` {
+			t.Errorf("problem in TestCircular(): offset %d", offset)
+			fmt.Println(out.String())
+		}
+		if offset == 0 && len(warnings) != 1 {
+			t.Errorf("problem in TestCircular(): expected a warning about Query2, got %v", warnings)
+		}
+	}
+}
+
+func TestDiscriminate(t *testing.T) {
+	refData := []byte(`>ref
+ACGTACGT
+`)
+	queryData := []byte(
+		`>Query1
+TCGTACGT
+>Query2
+ACCTACGT
+>Query3
+ACGTACGT
+>Query4
+TCCTACGT
+>Query5
+ACGTACGA
+>Query6
+ACGTACGA
+`)
+	groups := map[string]string{"Query1": "X", "Query2": "X", "Query3": "Y", "Query4": "Y", "Query5": "Z"}
+
+	out := new(bytes.Buffer)
+	ow, err := NewOutputWriter("discriminate", out, WriterOptions{Discriminate: []string{"X", "Y"}})
+	if err != nil {
+		t.Error(err)
+	}
+	err = Run(bytes.NewReader(queryData), bytes.NewReader(refData), Options{Groups: groups}, ow)
+	if err != nil {
+		t.Error(err)
+	}
+	if out.String() != `change,X_count,Y_count,pairs_separated,cumulative_proportion_separated
+A1T,1,1,2,0.500000000
+G3C,1,1,2,1.000000000
+` {
+		t.Errorf("problem in TestDiscriminate()")
+		fmt.Println(out.String())
+	}
+
+	ow, err = NewOutputWriter("discriminate", new(bytes.Buffer), WriterOptions{Discriminate: []string{"X", "W"}})
+	if err != nil {
+		t.Error(err)
+	}
+	err = Run(bytes.NewReader(queryData), bytes.NewReader(refData), Options{Groups: groups}, ow)
+	if err == nil {
+		t.Errorf("problem in TestDiscriminate(): expected an error for an empty group")
+	}
+}
+
+func TestTrack(t *testing.T) {
+	refData := []byte(`>ref
+ACGTACGT
+`)
+	queryData := []byte(
+		`>Query1
+TCGTACGA
+>Query2
+ACCTACGA
+`)
+
+	bedGraph := "track type=bedGraph\nref\t0\t1\t0.5\nref\t6\t8\t-2\n"
+	wiggle := "track type=wiggle_0\nvariableStep chrom=ref\n1 0.5\nfixedStep chrom=ref start=7 step=1\n-2\n-2\n"
+	for _, data := range []string{bedGraph, wiggle} {
+		track, err := ReadTrack(strings.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := new(bytes.Buffer)
+		ow, err := NewOutputWriter("csv", out, WriterOptions{Scores: true})
+		if err != nil {
+			t.Error(err)
+		}
+		err = Run(bytes.NewReader(queryData), bytes.NewReader(refData), Options{Track: track}, ow)
+		if err != nil {
+			t.Error(err)
+		}
+		if out.String() != `query,SNPs,scored_SNPs
+Query1,A1T|T8A,A1T (0.5)|T8A (-2)
+Query2,G3C|T8A,G3C (NA)|T8A (-2)
+` {
+			t.Errorf("problem in TestTrack()")
+			fmt.Println(out.String())
+		}
+	}
+
+	for _, bad := range []string{"ref\t1\t1\t0.5\n", "ref\t0\t1\tx\n", "fixedStep chrom=ref\n1\n", "1 0.5\n"} {
+		_, err := ReadTrack(strings.NewReader(bad))
+		if !errors.Is(err, ErrBadTrack) {
+			t.Errorf("problem in TestTrack(): %q gave %v", bad, err)
+		}
+	}
+}
+
+func TestSignature(t *testing.T) {
+	refData := []byte(`>ref
+ACGTACGT
+`)
+	queryData := []byte(
+		`>Query1
+TCGTACGA
+>Query2
+ACSTACGT
+>Query3
+ACGTACGT
+`)
+
+	out := new(bytes.Buffer)
+	positions := new(bytes.Buffer)
+	ow, err := NewOutputWriter("signature", out, WriterOptions{SignaturePositions: positions})
+	if err != nil {
+		t.Error(err)
+	}
+	err = Run(bytes.NewReader(queryData), bytes.NewReader(refData), Options{}, ow)
+	if err != nil {
+		t.Error(err)
+	}
+	if out.String() != `>Query1
+TA
+>Query2
+AT
+>Query3
+AT
+` {
+		t.Errorf("problem in TestSignature()")
+		fmt.Println(out.String())
+	}
+	if positions.String() != "position,ref\n1,A\n8,T\n" {
+		t.Errorf("problem in TestSignature(): positions")
+		fmt.Println(positions.String())
+	}
+}
+
+func TestCompareAll(t *testing.T) {
+	ref := []byte("ACGTACGT")
+	queries := []Sequence{
+		{ID: "Query1", Seq: []byte("TCGTACGA")},
+		{ID: "Query2", Seq: []byte("acgtacgt")},
+		{ID: "Query3", Seq: []byte("TCGTNCGT")},
+	}
+
+	records, err := CompareAll(ref, queries, Options{Exclude: regexp.MustCompile("Query2")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0].Query != "Query1" || records[1].Query != "Query3" {
+		t.Fatalf("problem in TestCompareAll(): %v", records)
+	}
+	if !reflect.DeepEqual(records[0].SNPs, []SNP{{Position: 1, Ref: "A", Alt: "T"}, {Position: 8, Ref: "T", Alt: "A"}}) || records[0].Distance != 2 {
+		t.Errorf("problem in TestCompareAll(): %v", records[0])
+	}
+
+	agg := AggregateRecords(records)
+	if agg.Queries != 2 || len(agg.Changes) != 2 || agg.Changes[0].SNP.String() != "A1T" || agg.Changes[0].Count != 2 {
+		t.Errorf("problem in TestCompareAll(): %v", agg)
+	}
+
+	SNPs, err := Compare(ref, []byte("ACGTACGG"), Options{})
+	if err != nil {
+		t.Error(err)
+	}
+	if len(SNPs) != 1 || SNPs[0].String() != "T8G" {
+		t.Errorf("problem in TestCompareAll(): %v", SNPs)
+	}
+
+	_, err = Compare(ref, []byte("ACGTAC\nGT"), Options{})
+	var re *RecordError
+	if !errors.Is(err, ErrInvalidChar) || !errors.As(err, &re) || re.Position != 7 {
+		t.Errorf("problem in TestCompareAll(): %v", err)
+	}
+}
+
+func TestAnnotate(t *testing.T) {
+	refData := []byte(`>ref
+ATGGATTAACCCAT
+`)
+	queryData := []byte(
+		`>Query1
+ATGGATTAGCCCAT
+>Query2
+ATGGGTTAACCCNT
+>Query3
+CCCGACTAACCTAT
+`)
+	gffData := []byte(`ref	.	CDS	1	9	.	+	0	ID=cds-1;gene=g1
+ref	.	CDS	10	12	.	-	0	ID=cds-2;gene=g2
+`)
+	regions, err := annotation.ReadGFF(bytes.NewReader(gffData))
+	if err != nil {
+		t.Fatal(err)
+	}
+	refSeq, err := ReadReference(bytes.NewReader(refData), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// annotating the output of a run without the annotation gives the same as a run with it
+	direct := new(bytes.Buffer)
+	ow, err := NewOutputWriter("csv", direct, WriterOptions{Annotated: true, CodonPositions: true, Effects: true})
+	if err != nil {
+		t.Error(err)
+	}
+	err = Run(bytes.NewReader(queryData), bytes.NewReader(refData), Options{Regions: regions}, ow)
+	if err != nil {
+		t.Error(err)
+	}
+
+	plain := new(bytes.Buffer)
+	ow, err = NewOutputWriter("csv", plain, WriterOptions{})
+	if err != nil {
+		t.Error(err)
+	}
+	err = Run(bytes.NewReader(queryData), bytes.NewReader(refData), Options{}, ow)
+	if err != nil {
+		t.Error(err)
+	}
+	cr, err := NewCSVReader(plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cr.Annotator = NewAnnotator(refSeq, regions)
+	annotated := new(bytes.Buffer)
+	ow, err = NewOutputWriter("csv", annotated, cr.WriterOptions())
+	if err != nil {
+		t.Error(err)
+	}
+	err = Convert(cr, ow)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if annotated.String() != direct.String() {
+		t.Errorf("problem in TestAnnotate()")
+		fmt.Println(direct.String())
+		fmt.Println(annotated.String())
+	}
+
+	for annotation, expected := range map[string]string{
+		"":                      "non-coding",
+		"g1:D2D":                "synonymous",
+		"g1:D2G":                "missense",
+		"g1:*3K":                "stop_lost",
+		"g1:K3*;g2:P1X":         "nonsense;unknown",
+		"ORF1ab:nsp3:A1026D":    "missense",
+		"ORF1ab:nsp3:A1026A;g2": "synonymous;unknown",
+	} {
+		if e := effect(annotation); e != expected {
+			t.Errorf("problem in TestAnnotate(): %s gave %s", annotation, e)
+		}
+	}
+}
+
+func TestPerf(t *testing.T) {
+	refData := []byte(`>ref
+ATGATG
+`)
+	queryData := []byte(`>Query1
+ATGATC
+>Query2
+ATGATG
+>Query3
+ATTATG
+`)
+
+	perf := new(Perf)
+	ow, err := NewOutputWriter("csv", new(bytes.Buffer), WriterOptions{})
+	if err != nil {
+		t.Error(err)
+	}
+	err = Run(bytes.NewReader(queryData), bytes.NewReader(refData), Options{Perf: perf, Exclude: regexp.MustCompile("Query2")}, ow)
+	if err != nil {
+		t.Error(err)
+	}
+
+	// skipped records are compared, but not written
+	c := perf.counters
+	if c[perfCompared] != 3 || c[perfWritten] != 2 || c[perfReadEnd] <= 0 || c[perfWriteEnd] < c[perfCompareEnd] {
+		t.Errorf("problem in TestPerf(): %v", c)
+	}
+
+	out := new(bytes.Buffer)
+	err = perf.Report(out)
+	if err != nil {
+		t.Error(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 4 || !strings.HasPrefix(lines[0], "read: 3 records in ") || !strings.HasPrefix(lines[2], "write: 2 records in ") || !strings.HasPrefix(lines[3], "bottleneck: ") {
+		t.Errorf("problem in TestPerf()")
+		fmt.Println(out.String())
+	}
+}
+
+func TestHomopolymers(t *testing.T) {
+	refData := []byte(`>ref
+ACGAAAAATCGATATATATGCC
+`)
+	queryData := []byte(`>Query1
+ACGAAGAATCGATATATATGCC
+>Query2
+ACGAAAAAACGATATATATGCC
+>Query3
+ATGAAAAATCGATACATATGCC
+`)
+
+	opts := Options{Context: ContextOptions{Homopolymer: 5, LowComplexity: 6}}
+	out := new(bytes.Buffer)
+	ow, err := NewOutputWriter("csv", out, WriterOptions{Contexts: true})
+	if err != nil {
+		t.Error(err)
+	}
+	err = Run(bytes.NewReader(queryData), bytes.NewReader(refData), opts, ow)
+	if err != nil {
+		t.Error(err)
+	}
+	// T9A makes a run of six As out of five
+	if out.String() != `query,SNPs,flagged_SNPs
+Query1,A6G,A6G (homopolymer:5)
+Query2,T9A,T9A (homopolymer:6)
+Query3,C2T|T15C,C2T|T15C (low_complexity:8)
+` {
+		t.Errorf("problem in TestHomopolymers()")
+		fmt.Println(out.String())
+	}
+
+	cr, err := NewCSVReader(bytes.NewReader(out.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	ow, err = NewOutputWriter("aggregate", out, cr.WriterOptions())
+	if err != nil {
+		t.Error(err)
+	}
+	err = Convert(cr, ow)
+	if err != nil {
+		t.Error(err)
+	}
+	if out.String() != `change,proportion,context
+C2T,0.333333333,
+A6G,0.333333333,homopolymer:5
+T9A,0.333333333,homopolymer:6
+T15C,0.333333333,low_complexity:8
+` {
+		t.Errorf("problem in TestHomopolymers(): aggregate")
+		fmt.Println(out.String())
+	}
+
+	opts.SNPFilter, err = CompileSNPFilter(`context == ""`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	ow, err = NewOutputWriter("csv", out, WriterOptions{})
+	if err != nil {
+		t.Error(err)
+	}
+	err = Run(bytes.NewReader(queryData), bytes.NewReader(refData), opts, ow)
+	if err != nil {
+		t.Error(err)
+	}
+	if out.String() != `query,SNPs
+Query1,
+Query2,
+Query3,C2T
+` {
+		t.Errorf("problem in TestHomopolymers(): SNP filter")
+		fmt.Println(out.String())
+	}
+}
+
+func TestCore(t *testing.T) {
+	refData := []byte(`>ref
+ATGATGATG
+`)
+	queryData := []byte(`>Query1
+TTCATCNTG
+>Query2
+TTNNTGATC
+>Query3
+ATRATCCTG
+>Query4
+ATGATGNTG
+`)
+
+	// site 4 is N in one query, so it is core at 0.75, but site 3 is N or an ambiguity
+	// code in two, as is site 7, so G3C and A7C are dropped
+	out := new(bytes.Buffer)
+	agg := new(bytes.Buffer)
+	perQuery, err := NewOutputWriter("csv", out, WriterOptions{})
+	if err != nil {
+		t.Error(err)
+	}
+	aggregate, err := NewOutputWriter("aggregate", agg, WriterOptions{})
+	if err != nil {
+		t.Error(err)
+	}
+	err = Run(bytes.NewReader(queryData), bytes.NewReader(refData), Options{Core: 0.75}, MultiWriter(perQuery, aggregate))
+	if err != nil {
+		t.Error(err)
+	}
+	if out.String() != `query,SNPs
+Query1,A1T|G6C
+Query2,A1T|G9C
+Query3,G6C
+Query4,
+` {
+		t.Errorf("problem in TestCore()")
+		fmt.Println(out.String())
+	}
+	if agg.String() != `change,proportion
+A1T,0.500000000
+G6C,0.500000000
+G9C,0.250000000
+` {
+		t.Errorf("problem in TestCore(): aggregate")
+		fmt.Println(agg.String())
+	}
+
+	// CompareAll finds the same core sites
+	queries := []Sequence{{ID: "Query1", Seq: []byte("TTCATCNTG")}, {ID: "Query2", Seq: []byte("TTNNTGATC")}, {ID: "Query3", Seq: []byte("ATRATCCTG")}, {ID: "Query4", Seq: []byte("ATGATGNTG")}}
+	records, err := CompareAll([]byte("ATGATGATG"), queries, Options{Core: 0.75})
+	if err != nil {
+		t.Error(err)
+	}
+	var changes []string
+	for _, record := range records {
+		changes = append(changes, record.Query+":"+fmt.Sprint(len(record.SNPs)))
+	}
+	if strings.Join(changes, ",") != "Query1:2,Query2:2,Query3:1,Query4:0" {
+		t.Errorf("problem in TestCore(): CompareAll gave %v", changes)
+	}
+
+	for _, opts := range []Options{{Core: 1.5}, {Core: 0.9, CountOnly: true}} {
+		err = Run(bytes.NewReader(queryData), bytes.NewReader(refData), opts, nullWriter{})
+		if err == nil {
+			t.Errorf("problem in TestCore(): %v was accepted", opts.Core)
+		}
+		_, err = CompareAll([]byte("ATGATGATG"), queries, opts)
+		if err == nil {
+			t.Errorf("problem in TestCore(): %v was accepted by CompareAll", opts.Core)
+		}
+	}
+}
+
+func TestOutputSchema(t *testing.T) {
+	for _, format := range OutputFormats() {
+		// counting is registered by TestRegisterOutputWriter
+		if _, ok := OutputSchema(format); !ok && format != "counting" {
+			t.Errorf("problem in TestOutputSchema(): no schema for %s", format)
+		}
+	}
+
+	// every column that can be written is, so the headers of the formats whose columns
+	// don't depend on the data should be the schemas' columns
+	wopts := WriterOptions{Annotated: true, CodonPositions: true, Effects: true, Weights: true, Scores: true, Contexts: true, Contigs: true, Description: true, Source: true, Dates: true, Ambiguities: true, Resolutions: true, Clusters: true, Parents: true, Dropouts: true, Missing: true, Lineages: true, WithSamples: true, Catalogue: Catalogue{}, Trinucleotide: true}
+	for _, schema := range OutputSchemas() {
+		if schema.Version != SchemaVersion || (schema.Kind != KindCSV && schema.Kind != KindTSV) {
+			continue
+		}
+		separator := ","
+		if schema.Kind == KindTSV {
+			separator = "\t"
+		}
+		names := make([]string, len(schema.Columns))
+		for i, column := range schema.Columns {
+			names[i] = column.Name
+		}
+		if strings.Contains(strings.Join(names, ","), "{") {
+			continue
+		}
+		out := new(bytes.Buffer)
+		ow, err := NewOutputWriter(schema.Format, out, wopts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rw, ok := ow.(ReferenceWriter); ok {
+			rw.SetReference([]byte{136, 72, 40, 24})
+		}
+		if err = ow.WriteHeader(); err != nil {
+			t.Error(err)
+		}
+		if err = ow.Close(); err != nil {
+			t.Error(err)
+		}
+		if out.String() != strings.Join(names, separator)+"\n" {
+			t.Errorf("problem in TestOutputSchema(): %s", schema.Format)
+			fmt.Println(out.String())
+		}
+	}
+}
+
+func TestLong(t *testing.T) {
+	refData := []byte(`>ref
+ATGGATTAACCCAT
+`)
+	queryData := []byte(
+		`>Query1
+ATGGATTAGCCCAT
+>Query2
+ATGGATTAACCCAT
+>Query3
+CCCGACTAACCTAT
+`)
+	gffData := []byte(`ref	.	CDS	1	9	.	+	0	ID=cds-1;gene=g1
+`)
+	regions, err := annotation.ReadGFF(bytes.NewReader(gffData))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := new(bytes.Buffer)
+	ow, err := NewOutputWriter("long", out, WriterOptions{Annotated: true})
+	if err != nil {
+		t.Error(err)
+	}
+	err = Run(bytes.NewReader(queryData), bytes.NewReader(refData), Options{Regions: regions}, ow)
+	if err != nil {
+		t.Error(err)
+	}
+	if out.String() != `query	position	ref	alt	annotation
+Query1	9	A	G	g1:*3*
+Query3	1	A	C	g1:M1P
+Query3	2	T	C	g1:M1P
+Query3	3	G	C	g1:M1P
+Query3	6	T	C	g1:D2D
+Query3	12	C	T	
+` {
+		t.Errorf("problem in TestLong()")
+		fmt.Println(out.String())
+	}
+}
+
+func TestJSON(t *testing.T) {
+	refData := []byte(`>ref
+ATGGATTAACCCAT
+`)
+	queryData := []byte(
+		`>Query1 2021-03-01
+ATGGATTAGCCCAT
+>Query2
+ATGGATTAACCCAN
+`)
+	gffData := []byte(`ref	.	CDS	1	9	.	+	0	ID=cds-1;gene=g1
+`)
+	regions, err := annotation.ReadGFF(bytes.NewReader(gffData))
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := Options{Regions: regions, IncludeMissing: true, Dates: DateOptions{Regex: regexp.MustCompile(`\d{4}-\d\d-\d\d`)}}
+	wopts := WriterOptions{Annotated: true, Missing: true, Dates: true}
+
+	out := new(bytes.Buffer)
+	ow, err := NewOutputWriter("json", out, wopts)
+	if err != nil {
+		t.Error(err)
+	}
+	err = Run(bytes.NewReader(queryData), bytes.NewReader(refData), opts, ow)
+	if err != nil {
+		t.Error(err)
+	}
+	if out.String() != `[
+  {"query":"Query1","date":"2021-03-01","snps":[{"position":9,"ref":"A","alt":"G","annotation":"g1:*3*"}]},
+  {"query":"Query2","snps":[],"missing":[{"position":14,"ref":"T","alt":"N"}]}
+]
+` || !json.Valid(out.Bytes()) {
+		t.Errorf("problem in TestJSON()")
+		fmt.Println(out.String())
+	}
+
+	out.Reset()
+	ow, err = NewOutputWriter("ndjson", out, wopts)
+	if err != nil {
+		t.Error(err)
+	}
+	err = Run(bytes.NewReader(queryData), bytes.NewReader(refData), opts, ow)
+	if err != nil {
+		t.Error(err)
+	}
+	if out.String() != `{"query":"Query1","date":"2021-03-01","snps":[{"position":9,"ref":"A","alt":"G","annotation":"g1:*3*"}]}
+{"query":"Query2","snps":[],"missing":[{"position":14,"ref":"T","alt":"N"}]}
+` {
+		t.Errorf("problem in TestJSON()")
+		fmt.Println(out.String())
+	}
+
+	// with no queries, json output is still an array
+	out.Reset()
+	ow, _ = NewOutputWriter("json", out, wopts)
+	err = Run(bytes.NewReader(nil), bytes.NewReader(refData), opts, ow)
+	if err != nil || !json.Valid(out.Bytes()) {
+		t.Errorf("problem in TestJSON(): %q %v", out.String(), err)
+	}
+}
+
+func TestParquet(t *testing.T) {
+	refData := []byte(`>ref
+ATGGATTAACCCAT
+`)
+	queryData := []byte(
+		`>Query1
+ATGGATTAGCCCAT
+>Query2
+ATGGATTAACCCAT
+>Query3
+CCCGACTAACCTAT
+`)
+	gffData := []byte(`ref	.	CDS	1	9	.	+	0	ID=cds-1;gene=g1
+`)
+	regions, err := annotation.ReadGFF(bytes.NewReader(gffData))
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := Options{Regions: regions}
+	wopts := WriterOptions{Annotated: true}
+
+	// the rows should be those of long output, here in row groups of two rows
+	out := new(bytes.Buffer)
+	long := new(bytes.Buffer)
+	pw := newParquetWriter(out, wopts)
+	pw.(*parquetWriter).rowGroupRows = 2
+	err = Run(bytes.NewReader(queryData), bytes.NewReader(refData), opts, MultiWriter(pw, newLongWriter(long, wopts)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := out.Bytes()
+	if !bytes.HasPrefix(b, []byte("PAR1")) || !bytes.HasSuffix(b, []byte("PAR1")) {
+		t.Fatalf("problem in TestParquet(): not a parquet file")
+	}
+	length := int(binary.LittleEndian.Uint32(b[len(b)-8:]))
+	meta, _ := readThrift(b[len(b)-8-length:len(b)-8], thriftStruct)
+	fields := meta.(map[int16]interface{})
+
+	var names []string
+	for _, element := range fields[2].([]interface{})[1:] {
+		names = append(names, element.(map[int16]interface{})[4].(string))
+	}
+	rows := [][]string{names}
+	dec, _ := zstd.NewReader(nil)
+	rowGroups := fields[4].([]interface{})
+	for _, rg := range rowGroups {
+		var columns [][]string
+		for _, chunk := range rg.(map[int16]interface{})[1].([]interface{}) {
+			md := chunk.(map[int16]interface{})[3].(map[int16]interface{})
+			var values []string
+			for rest := b[md[9].(int64):]; int64(len(values)) < md[5].(int64); {
+				header, after := readThrift(rest, thriftStruct)
+				size := header.(map[int16]interface{})[3].(int64)
+				data, err := dec.DecodeAll(after[:size], nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for len(data) > 0 {
+					if md[1].(int64) == parquetInt64 {
+						values = append(values, strconv.FormatUint(binary.LittleEndian.Uint64(data), 10))
+						data = data[8:]
+					} else {
+						l := binary.LittleEndian.Uint32(data)
+						values = append(values, string(data[4:4+l]))
+						data = data[4+l:]
+					}
+				}
+				rest = after[size:]
+			}
+			columns = append(columns, values)
+		}
+		for i := range columns[0] {
+			row := make([]string, len(columns))
+			for j := range columns {
+				row[j] = columns[j][i]
+			}
+			rows = append(rows, row)
+		}
+	}
+
+	var lines []string
+	for _, row := range rows {
+		lines = append(lines, strings.Join(row, "\t"))
+	}
+	if len(rowGroups) != 3 || fields[3].(int64) != 6 || strings.Join(lines, "\n")+"\n" != long.String() {
+		t.Errorf("problem in TestParquet()")
+		fmt.Println(strings.Join(lines, "\n"))
+	}
+
+	// with no SNPs there are no row groups, but there is still a schema
+	out.Reset()
+	err = Run(bytes.NewReader([]byte(">Query1\nATGGATTAACCCAT\n")), bytes.NewReader(refData), opts, newParquetWriter(out, wopts))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b = out.Bytes()
+	length = int(binary.LittleEndian.Uint32(b[len(b)-8:]))
+	meta, _ = readThrift(b[len(b)-8-length:len(b)-8], thriftStruct)
+	fields = meta.(map[int16]interface{})
+	if fields[3].(int64) != 0 || len(fields[4].([]interface{})) != 0 || len(fields[2].([]interface{})) != 6 {
+		t.Errorf("problem in TestParquet(): %v", fields)
+	}
+}
+
+// readThrift reads a value of a kind in Thrift's compact protocol, and returns the bytes
+// after it. Structs are read as maps of field IDs to values
+func readThrift(b []byte, kind byte) (interface{}, []byte) {
+	switch kind {
+	case thriftI32, thriftI64:
+		v, n := binary.Varint(b)
+		return v, b[n:]
+	case thriftBinary:
+		l, n := binary.Uvarint(b)
+		return string(b[n : n+int(l)]), b[n+int(l):]
+	case thriftList:
+		size, elem := int(b[0]>>4), b[0]&15
+		b = b[1:]
+		if size == 15 {
+			s, n := binary.Uvarint(b)
+			size, b = int(s), b[n:]
+		}
+		list := make([]interface{}, size)
+		for i := range list {
+			list[i], b = readThrift(b, elem)
+		}
+		return list, b
+	case thriftStruct:
+		fields := make(map[int16]interface{})
+		var id int16
+		for b[0] != 0 {
+			kind := b[0] & 15
+			if delta := b[0] >> 4; delta != 0 {
+				id += int16(delta)
+				b = b[1:]
+			} else {
+				v, n := binary.Varint(b[1:])
+				id, b = int16(v), b[1+n:]
+			}
+			fields[id], b = readThrift(b, kind)
+		}
+		return fields, b[1:]
+	}
+	panic(fmt.Sprintf("unknown Thrift type %d", kind))
+}
+
+func TestGenes(t *testing.T) {
+	refData := []byte(`>ref
+ATGGATTAACCCAT
+`)
+	queryData := []byte(
+		`>Query1
+ATGGATTAGCCCAT
+>Query2
+ATGGGTTAACCCNT
+>Query3
+CCCGACTAACCTAT
+`)
+	gffData := []byte(`ref	.	CDS	1	9	.	+	0	ID=cds-1;gene=g1
+ref	.	CDS	10	12	.	-	0	ID=cds-2;gene=g2
+`)
+	regions, err := annotation.ReadGFF(bytes.NewReader(gffData))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := new(bytes.Buffer)
+	ow, err := NewOutputWriter("genes", out, WriterOptions{Annotated: true, Genes: GeneNames(regions)})
+	if err != nil {
+		t.Error(err)
+	}
+	err = Run(bytes.NewReader(queryData), bytes.NewReader(refData), Options{Regions: regions}, ow)
+	if err != nil {
+		t.Error(err)
+	}
+
+	// Query1's stop codon is synonymous, and Query3's three SNPs in the first codon of g1
+	// are one amino acid change
+	if out.String() != `query,gene,nucleotide_changes,amino_acid_changes
+Query1,g1,1,0
+Query1,g2,0,0
+Query2,g1,1,1
+Query2,g2,0,0
+Query3,g1,4,1
+Query3,g2,1,1
+` {
+		t.Errorf("problem in TestGenes()")
+		fmt.Println(out.String())
+	}
+}
+
+func TestExport(t *testing.T) {
+	refData := []byte(`>ref
+ATGGATTAACCCAT
+`)
+	queryData := []byte(
+		`>Query1
+ATGGATTAGCCCAT
+>Query2
+ATGGGTTAACCCNT
+`)
+	gffData := []byte(`ref	.	CDS	1	9	.	+	0	ID=cds-1;gene=g1
+`)
+	metadataData := []byte("strain\tcountry\tdate\nQuery2\tUK\t2021-01-01\n")
+	regions, err := annotation.ReadGFF(bytes.NewReader(gffData))
+	if err != nil {
+		t.Fatal(err)
+	}
+	metadata, err := ReadMetadata(bytes.NewReader(metadataData), "", []string{"country"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	auspice := new(bytes.Buffer)
+	microreact := new(bytes.Buffer)
+	wopts := WriterOptions{Annotated: true, Metadata: metadata}
+	ow := MultiWriter(newAuspiceWriter(auspice, wopts), newMicroreactWriter(microreact, wopts))
+	err = Run(bytes.NewReader(queryData), bytes.NewReader(refData), Options{Regions: regions}, ow)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if auspice.String() != `{
+  "generated_by": {"program": "snps"},
+  "nodes": {
+    "Query1": {"aa_muts":{},"muts":["A9G"]},
+    "Query2": {"aa_muts":{"g1":["D2G"]},"country":"UK","muts":["A5G"]}
+  }
+}
+` {
+		t.Errorf("problem in TestExport(): auspice")
+		fmt.Println(auspice.String())
+	}
+	if microreact.String() != `[
+  {"amino_acid_mutations":"","id":"Query1","mutations":"A9G"},
+  {"amino_acid_mutations":"g1:D2G","country":"UK","id":"Query2","mutations":"A5G"}
+]
+` {
+		t.Errorf("problem in TestExport(): microreact")
+		fmt.Println(microreact.String())
+	}
+
+	_, err = ReadMetadata(bytes.NewReader(metadataData), "", []string{"region"})
+	if err == nil {
+		t.Errorf("problem in TestExport(): a missing column was accepted")
+	}
+}
+
+func TestSpectrum(t *testing.T) {
+	refData := []byte(`>ref
+ATCGATCAGT
+`)
+	queryData := []byte(
+		`>Query1
+ATTGATCAGT
+>Query2
+ATTGATTAGT
+>Query3
+ATCGATCAAN
+`)
+
+	out := new(bytes.Buffer)
+	ow, err := NewOutputWriter("spectrum", out, WriterOptions{})
+	if err != nil {
+		t.Error(err)
+	}
+	err = Run(bytes.NewReader(queryData), bytes.NewReader(refData), Options{}, ow)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if out.String() != `substitution,changes,count,proportion
+A>C,0,0,0.000000000
+A>G,0,0,0.000000000
+A>T,0,0,0.000000000
+C>A,0,0,0.000000000
+C>G,0,0,0.000000000
+C>T,2,3,0.750000000
+G>A,1,1,0.250000000
+G>C,0,0,0.000000000
+G>T,0,0,0.000000000
+T>A,0,0,0.000000000
+T>C,0,0,0.000000000
+T>G,0,0,0.000000000
+` {
+		t.Errorf("problem in TestSpectrum()")
+		fmt.Println(out.String())
+	}
+
+	// G9A, between A and T, is C>T between A and T on the other strand
+	out.Reset()
+	ow, err = NewOutputWriter("spectrum", out, WriterOptions{Trinucleotide: true})
+	if err != nil {
+		t.Error(err)
+	}
+	err = Run(bytes.NewReader(queryData), bytes.NewReader(refData), Options{}, ow)
+	if err != nil {
+		t.Error(err)
+	}
+	lines := make([]string, 0)
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		if !strings.HasSuffix(line, ",0,0,0.000000000") {
+			lines = append(lines, line)
+		}
+	}
+	if len(strings.Split(out.String(), "\n")) != 98 || strings.Join(lines, "\n") != `substitution,context,changes,count,proportion
+C>T,A[C>T]T,1,1,0.250000000
+C>T,T[C>T]A,1,1,0.250000000
+C>T,T[C>T]G,1,2,0.500000000` {
+		t.Errorf("problem in TestSpectrum(): trinucleotide")
+		fmt.Println(out.String())
+	}
+}
+
+func TestLiftover(t *testing.T) {
+	refA, err := ReadReference(strings.NewReader(">a\nATGCGTACGTTAGCCATGACGGATCCTAGGCTTAACGGTCATGCAAGTCGATCGGCTAAGCTTGCA\n"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// b has a substitution at 11, a deletion of 31-33 and an insertion after 50
+	refB, err := ReadReference(strings.NewReader(">b\nATGCGTACGTCAGCCATGACGGATCCTAGGAACGGTCATGCAAGTCGTTTATCGGCTAAGCTTGCA\n"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lo := NewLiftover(refA, refB)
+
+	out := new(bytes.Buffer)
+	err = WriteRefDifferences(out, lo.Differences())
+	if err != nil {
+		t.Error(err)
+	}
+	if out.String() != `type,position_a,allele_a,position_b,allele_b
+substitution,11,T,11,C
+deletion,31,CTT,30,
+insertion,50,,48,TTT
+` {
+		t.Errorf("problem in TestLiftover(): differences")
+		fmt.Println(out.String())
+	}
+
+	// Query1 has b's base at 11, Query2 has a's base there and a SNP in the deletion, and
+	// Query3 is missing data there
+	cr, err := NewCSVReader(strings.NewReader(`query,SNPs,annotated_SNPs,missing
+Query1,T11C|C40G,T11C (g:L4P)|C40G (),
+Query2,C32A,C32A (),
+Query3,C40T,C40T (),T11N
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cr.Liftover = lo
+	out.Reset()
+	ow, err := NewOutputWriter("csv", out, cr.WriterOptions())
+	if err != nil {
+		t.Error(err)
+	}
+	err = Convert(cr, ow)
+	if err != nil {
+		t.Error(err)
+	}
+	if out.String() != `query,SNPs,missing
+Query1,C37G,
+Query2,C11T,
+Query3,C37T,C11N
+` || lo.Unlifted() != 1 {
+		t.Errorf("problem in TestLiftover()")
+		fmt.Println(out.String())
+	}
+}
@@ -0,0 +1,139 @@
+package snps
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strconv"
+
+	"github.com/benjamincjackson/snps/pkg/encoding"
+)
+
+// spectrumWriter writes the mutation spectrum of the run: the number of each of the 12
+// substitution types (A>C, A>G, ...), counted once for each change and once for each
+// query it is in, and the proportion of the queries' substitutions that are of each
+// type. Only changes from A, C, G or T to another of them count. If trinucleotide is
+// true, the substitutions are split by the reference's bases either side of them into
+// the usual 96 categories of mutational signatures, e.g. T[C>T]A, with the reference's
+// base a pyrimidine (substitutions from A or G are reverse complemented). Changes at
+// either end of the reference, or next to a site that isn't A, C, G or T, have no
+// trinucleotide context and aren't counted then
+type spectrumWriter struct {
+	w             *bufio.Writer
+	trinucleotide bool
+	refSeq        []byte
+}
+
+func newSpectrumWriter(w io.Writer, opts WriterOptions) OutputWriter {
+	return &spectrumWriter{w: bufio.NewWriter(w), trinucleotide: opts.Trinucleotide}
+}
+
+func (sw *spectrumWriter) SetReference(refSeq []byte) {
+	sw.refSeq = refSeq
+}
+
+func (sw *spectrumWriter) WriteHeader() error {
+	header := "substitution,changes,count,proportion\n"
+	if sw.trinucleotide {
+		if sw.refSeq == nil {
+			return errors.New("a trinucleotide spectrum needs a single reference sequence")
+		}
+		header = "substitution,context,changes,count,proportion\n"
+	}
+	_, err := sw.w.WriteString(header)
+	return err
+}
+
+// the spectrum is made from the aggregate
+func (sw *spectrumWriter) WriteRecord(Record) error {
+	return nil
+}
+
+func (sw *spectrumWriter) NeedsAggregate() bool {
+	return true
+}
+
+func (sw *spectrumWriter) WriteAggregate(agg Aggregate) error {
+	bases := []string{"A", "C", "G", "T"}
+	substitutions := make([]string, 0, 12)
+	if sw.trinucleotide {
+		// the 96 categories are in the usual order, by substitution then the bases 5' and 3'
+		// of it
+		for _, ref := range []string{"C", "T"} {
+			for _, alt := range bases {
+				if alt == ref {
+					continue
+				}
+				substitutions = append(substitutions, ref+">"+alt)
+			}
+		}
+	} else {
+		for _, ref := range bases {
+			for _, alt := range bases {
+				if alt != ref {
+					substitutions = append(substitutions, ref+">"+alt)
+				}
+			}
+		}
+	}
+
+	DA := encoding.MakeDecodingArray()
+	complement := map[string]string{"A": "T", "C": "G", "G": "C", "T": "A"}
+	changes := make(map[string]int)
+	counts := make(map[string]int)
+	total := 0
+	for _, change := range agg.Changes {
+		snp := change.SNP
+		if !isACGT(snp.Ref) || !isACGT(snp.Alt) {
+			continue
+		}
+		key := snp.Ref + ">" + snp.Alt
+		if sw.trinucleotide {
+			pos := snp.Position - 1
+			if pos < 1 || pos+1 >= len(sw.refSeq) || sw.refSeq[pos-1]&8 != 8 || sw.refSeq[pos+1]&8 != 8 {
+				continue
+			}
+			before, after := DA[sw.refSeq[pos-1]], DA[sw.refSeq[pos+1]]
+			ref, alt := snp.Ref, snp.Alt
+			if ref == "A" || ref == "G" {
+				before, after = complement[after], complement[before]
+				ref, alt = complement[ref], complement[alt]
+			}
+			key = before + "[" + ref + ">" + alt + "]" + after
+		}
+		changes[key]++
+		counts[key] += change.Count
+		total += change.Count
+	}
+
+	for _, substitution := range substitutions {
+		keys := []string{substitution}
+		if sw.trinucleotide {
+			keys = keys[:0]
+			for _, before := range bases {
+				for _, after := range bases {
+					keys = append(keys, before+"["+substitution+"]"+after)
+				}
+			}
+		}
+		for _, key := range keys {
+			proportion := 0.0
+			if total > 0 {
+				proportion = float64(counts[key]) / float64(total)
+			}
+			line := substitution + ","
+			if sw.trinucleotide {
+				line += key + ","
+			}
+			line += strconv.Itoa(changes[key]) + "," + strconv.Itoa(counts[key]) + "," + strconv.FormatFloat(proportion, 'f', 9, 64) + "\n"
+			if _, err := sw.w.WriteString(line); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (sw *spectrumWriter) Close() error {
+	return sw.w.Flush()
+}
@@ -0,0 +1,143 @@
+package snps
+
+import (
+	"bufio"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// countsWriter writes the number of SNPs in each query, and the number of sites where
+// it resolves an ambiguity and where it is missing data (which are 0 unless they were
+// looked for)
+type countsWriter struct {
+	w *bufio.Writer
+}
+
+func newCountsWriter(w io.Writer, opts WriterOptions) OutputWriter {
+	return &countsWriter{w: bufio.NewWriter(w)}
+}
+
+func (cw *countsWriter) WriteHeader() error {
+	_, err := cw.w.WriteString("query,SNPs,ambiguities,missing\n")
+	return err
+}
+
+func (cw *countsWriter) WriteRecord(record Record) error {
+	_, err := cw.w.WriteString(csvField(record.Query) + "," + strconv.Itoa(len(record.SNPs)) + "," + strconv.Itoa(len(record.Ambiguities)) + "," + strconv.Itoa(len(record.Missing)) + "\n")
+	return err
+}
+
+func (cw *countsWriter) WriteAggregate(Aggregate) error {
+	return nil
+}
+
+func (cw *countsWriter) Close() error {
+	return cw.w.Flush()
+}
+
+// distanceOnlyWriter writes just the number of SNPs in each query, which is all that
+// there is of them if they were only counted
+type distanceOnlyWriter struct {
+	w *bufio.Writer
+}
+
+func newDistanceOnlyWriter(w io.Writer, opts WriterOptions) OutputWriter {
+	return &distanceOnlyWriter{w: bufio.NewWriter(w)}
+}
+
+func (dw *distanceOnlyWriter) WriteHeader() error {
+	_, err := dw.w.WriteString("query,distance\n")
+	return err
+}
+
+func (dw *distanceOnlyWriter) WriteRecord(record Record) error {
+	_, err := dw.w.WriteString(csvField(record.Query) + "," + strconv.Itoa(record.Distance) + "\n")
+	return err
+}
+
+func (dw *distanceOnlyWriter) WriteAggregate(Aggregate) error {
+	return nil
+}
+
+func (dw *distanceOnlyWriter) Close() error {
+	return dw.w.Flush()
+}
+
+// summaryWriter writes summary statistics of a run, one per line: the number of queries,
+// the number of distinct SNPs and how many of them are only found in one query, and the
+// mean, median, minimum and maximum number of SNPs per query
+type summaryWriter struct {
+	w      *bufio.Writer
+	counts []int
+}
+
+func newSummaryWriter(w io.Writer, opts WriterOptions) OutputWriter {
+	return &summaryWriter{w: bufio.NewWriter(w), counts: make([]int, 0)}
+}
+
+func (sw *summaryWriter) WriteHeader() error {
+	_, err := sw.w.WriteString("statistic,value\n")
+	return err
+}
+
+func (sw *summaryWriter) WriteRecord(record Record) error {
+	sw.counts = append(sw.counts, len(record.SNPs))
+	return nil
+}
+
+func (sw *summaryWriter) NeedsAggregate() bool {
+	return true
+}
+
+func (sw *summaryWriter) WriteAggregate(agg Aggregate) error {
+	singletons := 0
+	distinct := 0
+	for _, change := range agg.Changes {
+		// aggregates count missing data too, if it was looked for
+		if change.SNP.Alt == "N" || change.SNP.Alt == "?" {
+			continue
+		}
+		distinct++
+		if change.Count == 1 {
+			singletons++
+		}
+	}
+
+	var mean, median float64
+	min, max := 0, 0
+	if n := len(sw.counts); n > 0 {
+		sort.Ints(sw.counts)
+		total := 0
+		for _, c := range sw.counts {
+			total += c
+		}
+		mean = float64(total) / float64(n)
+		median = float64(sw.counts[n/2])
+		if n%2 == 0 {
+			median = float64(sw.counts[n/2-1]+sw.counts[n/2]) / 2
+		}
+		min, max = sw.counts[0], sw.counts[n-1]
+	}
+
+	stats := [][2]string{
+		{"queries", strconv.Itoa(len(sw.counts))},
+		{"distinct_SNPs", strconv.Itoa(distinct)},
+		{"singleton_SNPs", strconv.Itoa(singletons)},
+		{"mean_SNPs_per_query", strconv.FormatFloat(mean, 'f', 4, 64)},
+		{"median_SNPs_per_query", strconv.FormatFloat(median, 'f', 1, 64)},
+		{"min_SNPs_per_query", strconv.Itoa(min)},
+		{"max_SNPs_per_query", strconv.Itoa(max)},
+	}
+	for _, stat := range stats {
+		_, err := sw.w.WriteString(stat[0] + "," + stat[1] + "\n")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (sw *summaryWriter) Close() error {
+	return sw.w.Flush()
+}
@@ -0,0 +1,68 @@
+package snps
+
+import "sync"
+
+// Tracer starts spans around the stages of a run, so that an application embedding this
+// package can see where the time goes in its own tracing system: an adapter for e.g.
+// OpenTelemetry needs only to start a child of the current request's span in Start, and
+// record the error and end it in End. The stages are snps.read_reference, snps.run, and
+// within snps.run, which run concurrently, snps.read (reading and encoding the queries),
+// snps.compare (finding SNPs) and snps.write (writing the output)
+type Tracer interface {
+	Start(name string) Span
+}
+
+// Span is one stage of a run. End is called once, with the error that ended the stage
+// early, or nil
+type Span interface {
+	End(err error)
+}
+
+// stages keeps track of the spans that are open, so that they can all be ended if a
+// run stops early
+type stages struct {
+	mu     sync.Mutex
+	tracer Tracer
+	open   map[string]Span
+}
+
+func newStages(tracer Tracer) *stages {
+	return &stages{tracer: tracer, open: make(map[string]Span)}
+}
+
+func (s *stages) start(name string) {
+	if s.tracer == nil {
+		return
+	}
+	span := s.tracer.Start(name)
+	s.mu.Lock()
+	s.open[name] = span
+	s.mu.Unlock()
+}
+
+func (s *stages) end(name string, err error) {
+	if s.tracer == nil {
+		return
+	}
+	s.mu.Lock()
+	span, ok := s.open[name]
+	delete(s.open, name)
+	s.mu.Unlock()
+	if ok {
+		span.End(err)
+	}
+}
+
+// endAll ends every span that is still open
+func (s *stages) endAll(err error) {
+	if s.tracer == nil {
+		return
+	}
+	s.mu.Lock()
+	open := s.open
+	s.open = make(map[string]Span)
+	s.mu.Unlock()
+	for _, span := range open {
+		span.End(err)
+	}
+}
@@ -0,0 +1,170 @@
+package snps
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Track is a numeric track of the reference, e.g. per-site conservation scores, read
+// from a bedGraph or wiggle file. Its intervals are 1-based and inclusive, by chromosome
+type Track map[string][]trackInterval
+
+type trackInterval struct {
+	start int
+	end   int
+	value float64
+}
+
+// ReadTrack reads a bedGraph file, of lines of a chromosome, a 0-based start, an end and
+// a value, or a wiggle file, of fixedStep or variableStep sections. track and browser
+// lines and lines starting with # are skipped. Intervals shouldn't overlap
+func ReadTrack(r io.Reader) (Track, error) {
+	t := make(Track)
+	// the current wiggle section, if there is one
+	var wig struct {
+		fixed bool
+		chrom string
+		next  int
+		step  int
+		span  int
+	}
+	inWig := false
+
+	s := bufio.NewScanner(r)
+	for line := 1; s.Scan(); line++ {
+		fields := strings.Fields(s.Text())
+		if len(fields) == 0 || fields[0] == "track" || fields[0] == "browser" || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		bad := func(problem string) (Track, error) {
+			return nil, fmt.Errorf("%w: line %d: %s", ErrBadTrack, line, problem)
+		}
+
+		if fields[0] == "fixedStep" || fields[0] == "variableStep" {
+			inWig = true
+			wig.fixed = fields[0] == "fixedStep"
+			wig.chrom, wig.next, wig.step, wig.span = "", 0, 1, 1
+			for _, field := range fields[1:] {
+				kv := strings.SplitN(field, "=", 2)
+				if len(kv) != 2 {
+					return bad("bad " + fields[0] + " setting " + field)
+				}
+				if kv[0] == "chrom" {
+					wig.chrom = kv[1]
+					continue
+				}
+				n, err := strconv.Atoi(kv[1])
+				if err != nil || n < 1 {
+					return bad("bad " + fields[0] + " setting " + field)
+				}
+				switch kv[0] {
+				case "start":
+					wig.next = n
+				case "step":
+					wig.step = n
+				case "span":
+					wig.span = n
+				}
+			}
+			if wig.chrom == "" {
+				return bad(fields[0] + " needs chrom")
+			}
+			if wig.fixed && wig.next == 0 {
+				return bad("fixedStep needs start")
+			}
+			continue
+		}
+
+		var chrom string
+		var start, end int
+		var value string
+		switch {
+		case inWig && wig.fixed && len(fields) == 1:
+			chrom, start, end, value = wig.chrom, wig.next, wig.next+wig.span-1, fields[0]
+			wig.next += wig.step
+		case inWig && !wig.fixed && len(fields) == 2:
+			pos, err := strconv.Atoi(fields[0])
+			if err != nil || pos < 1 {
+				return bad("bad position " + fields[0])
+			}
+			chrom, start, end, value = wig.chrom, pos, pos+wig.span-1, fields[1]
+		case len(fields) >= 4:
+			// a bedGraph line, which also ends a wiggle section
+			inWig = false
+			var err error
+			start, err = strconv.Atoi(fields[1])
+			if err != nil || start < 0 {
+				return bad("bad start " + fields[1])
+			}
+			end, err = strconv.Atoi(fields[2])
+			if err != nil || end <= start {
+				return bad("bad end " + fields[2])
+			}
+			chrom, start, value = fields[0], start+1, fields[3]
+		default:
+			return bad("should be a bedGraph line or a wiggle value")
+		}
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil || math.IsNaN(v) {
+			return bad("bad value " + value)
+		}
+		t[chrom] = append(t[chrom], trackInterval{start: start, end: end, value: v})
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	for _, intervals := range t {
+		sort.SliceStable(intervals, func(i, j int) bool {
+			return intervals[i].start < intervals[j].start
+		})
+	}
+	return t, nil
+}
+
+// at returns the track's value at pos of chrom, or of any chromosome if chrom is "", and
+// false if it has none there
+func (t Track) at(chrom string, pos int) (float64, bool) {
+	find := func(intervals []trackInterval) (float64, bool) {
+		// the last interval that starts at or before pos is the only one that can hold it
+		i := sort.Search(len(intervals), func(i int) bool {
+			return intervals[i].start > pos
+		})
+		if i > 0 && intervals[i-1].end >= pos {
+			return intervals[i-1].value, true
+		}
+		return 0, false
+	}
+	if chrom != "" {
+		return find(t[chrom])
+	}
+	for _, intervals := range t {
+		if v, ok := find(intervals); ok {
+			return v, true
+		}
+	}
+	return 0, false
+}
+
+// score sets the score of each of SNPs to the track's value at its site, or NaN if it
+// has none there
+func (t Track) score(SNPs []SNP) {
+	for i := range SNPs {
+		SNPs[i].Score = math.NaN()
+		if v, ok := t.at(SNPs[i].Contig, SNPs[i].Position); ok {
+			SNPs[i].Score = v
+		}
+	}
+}
+
+// formatScore formats a SNP's score for output, as NA if it has none
+func formatScore(score float64) string {
+	if math.IsNaN(score) {
+		return "NA"
+	}
+	return strconv.FormatFloat(score, 'f', -1, 64)
+}
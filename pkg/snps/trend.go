@@ -0,0 +1,111 @@
+package snps
+
+import (
+	"bufio"
+	"io"
+	"sort"
+	"strconv"
+
+	"github.com/benjamincjackson/snps/pkg/stats"
+)
+
+// trendWriter fits a logistic growth curve over time to the frequency of each SNP,
+// using the queries' collection dates, and writes the growth rate (the change in log
+// odds per week) with a 95% confidence interval. SNPs whose interval is above zero are
+// flagged as rising. Only SNPs whose overall proportion is at least the threshold are
+// fitted, and queries without a date are left out. If a fit fails, which happens when
+// a SNP is only found before or after some date, its growth rate is left empty
+type trendWriter struct {
+	w         *bufio.Writer
+	threshold float64
+	agg       *aggregator
+	days      map[int]*aggregator // the SNPs in the queries collected on each day
+}
+
+func newTrendWriter(w io.Writer, opts WriterOptions) OutputWriter {
+	return &trendWriter{w: bufio.NewWriter(w), threshold: opts.Threshold, agg: newAggregator(), days: make(map[int]*aggregator)}
+}
+
+func (tw *trendWriter) WriteHeader() error {
+	_, err := tw.w.WriteString("change,count,proportion,growth_rate,ci_lower,ci_upper,rising\n")
+	return err
+}
+
+func (tw *trendWriter) WriteRecord(record Record) error {
+	if record.Date.IsZero() {
+		return nil
+	}
+	day := int(record.Date.Unix() / 86400)
+	agg, ok := tw.days[day]
+	if !ok {
+		agg = newAggregator()
+		tw.days[day] = agg
+	}
+	agg.add(record)
+	tw.agg.add(record)
+	return nil
+}
+
+func (tw *trendWriter) WriteAggregate(Aggregate) error {
+	days := make([]int, 0, len(tw.days))
+	for day := range tw.days {
+		days = append(days, day)
+	}
+	sort.Ints(days)
+
+	// weeks, centred on the mean collection date so that the fit is well conditioned
+	var mean float64
+	for _, day := range days {
+		mean += float64(day * tw.days[day].queries)
+	}
+	mean /= float64(tw.agg.queries)
+
+	x := make([]float64, len(days))
+	n := make([]float64, len(days))
+	for i, day := range days {
+		x[i] = (float64(day) - mean) / 7
+		n[i] = float64(tw.days[day].queries)
+	}
+
+	agg := tw.agg.aggregate()
+	k := make([]float64, len(days))
+
+	for _, change := range agg.Changes {
+		prop := float64(change.Count) / float64(agg.Queries)
+		if prop < tw.threshold {
+			continue
+		}
+
+		key := change.SNP.String()
+		for i, day := range days {
+			k[i] = 0
+			if c, ok := tw.days[day].counts[key]; ok {
+				k[i] = float64(c.Count)
+			}
+		}
+
+		line := key + "," + strconv.Itoa(change.Count) + "," + strconv.FormatFloat(prop, 'f', 9, 64)
+
+		slope, se, err := stats.LogisticRegression(x, n, k)
+		if err != nil {
+			line += ",,,,"
+		} else {
+			lower, upper := slope-1.96*se, slope+1.96*se
+			line += "," + strconv.FormatFloat(slope, 'f', 6, 64) +
+				"," + strconv.FormatFloat(lower, 'f', 6, 64) +
+				"," + strconv.FormatFloat(upper, 'f', 6, 64) +
+				"," + strconv.FormatBool(lower > 0)
+		}
+
+		_, err = tw.w.WriteString(line + "\n")
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (tw *trendWriter) Close() error {
+	return tw.w.Flush()
+}
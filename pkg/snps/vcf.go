@@ -0,0 +1,156 @@
+package snps
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/benjamincjackson/snps/pkg/encoding"
+)
+
+// vcfWriter writes a multi-sample VCF with a haploid genotype (GT) for each query: one
+// line for each site where any query has a SNP to A, C, G or T, as bcftools, UShER and
+// the like read them. A query's genotype is the number of its allele, 0 for the
+// reference's, or . if it isn't called there, as in gvcf output: where it is N, ?, a gap
+// (without hard gaps), masked, or an ambiguity code or hard gap that differs from the
+// reference. Sites that aren't called are only known if the run looked for them, with
+// Options.MissingRanges. The sample columns aren't known until every query has been
+// read, so the whole VCF is written at the end. The writer needs the reference, so
+// can't be used with contigs
+type vcfWriter struct {
+	w       *bufio.Writer
+	name    string
+	refSeq  []byte
+	samples []vcfSample
+	seen    map[string]bool
+	alts    map[int]map[string]int
+}
+
+// vcfSample is what vcfWriter keeps of a query: its SNPs, to A, C, G or T or not, and
+// the runs of sites it isn't called at, both in order
+type vcfSample struct {
+	name    string
+	snps    []SNP
+	missing [][2]int
+}
+
+func newVCFWriter(w io.Writer, opts WriterOptions) OutputWriter {
+	name := opts.ReferenceName
+	if name == "" {
+		name = "reference"
+	}
+	return &vcfWriter{w: bufio.NewWriter(w), name: name, seen: make(map[string]bool), alts: make(map[int]map[string]int)}
+}
+
+func (vw *vcfWriter) SetReference(refSeq []byte) {
+	vw.refSeq = refSeq
+}
+
+func (vw *vcfWriter) WriteHeader() error {
+	if vw.refSeq == nil {
+		return errors.New("vcf output needs a single reference sequence")
+	}
+	header := []string{
+		"##fileformat=VCFv4.2",
+		"##source=snps",
+		"##contig=<ID=" + vw.name + ",length=" + strconv.Itoa(len(vw.refSeq)) + ">",
+		`##INFO=<ID=AC,Number=A,Type=Integer,Description="Number of queries with each alternative allele">`,
+		`##INFO=<ID=AN,Number=1,Type=Integer,Description="Number of queries called at the site">`,
+		`##FORMAT=<ID=GT,Number=1,Type=String,Description="Genotype">`,
+	}
+	_, err := vw.w.WriteString(strings.Join(header, "\n") + "\n")
+	return err
+}
+
+func (vw *vcfWriter) WriteRecord(record Record) error {
+	if vw.seen[record.Query] {
+		return fmt.Errorf("vcf output needs every query to have a different ID, but %s is in it more than once", record.Query)
+	}
+	vw.seen[record.Query] = true
+	sample := vcfSample{name: record.Query, snps: make([]SNP, 0, len(record.SNPs)), missing: record.MissingRanges}
+	for _, snp := range record.SNPs {
+		if snp.Position > len(vw.refSeq) {
+			continue
+		}
+		sample.snps = append(sample.snps, SNP{Position: snp.Position, Alt: snp.Alt})
+		if !isACGT(snp.Alt) {
+			continue
+		}
+		if vw.alts[snp.Position] == nil {
+			vw.alts[snp.Position] = make(map[string]int)
+		}
+		vw.alts[snp.Position][snp.Alt]++
+	}
+	vw.samples = append(vw.samples, sample)
+	return nil
+}
+
+func (vw *vcfWriter) WriteAggregate(Aggregate) error {
+	columns := []string{"#CHROM", "POS", "ID", "REF", "ALT", "QUAL", "FILTER", "INFO", "FORMAT"}
+	for _, sample := range vw.samples {
+		columns = append(columns, sample.name)
+	}
+	if _, err := vw.w.WriteString(strings.Join(columns, "\t") + "\n"); err != nil {
+		return err
+	}
+
+	positions := make([]int, 0, len(vw.alts))
+	for pos := range vw.alts {
+		positions = append(positions, pos)
+	}
+	sort.Ints(positions)
+
+	DA := encoding.MakeDecodingArray()
+	// each sample's SNPs and missing ranges are gone through once, in step with the sites
+	nextSNP := make([]int, len(vw.samples))
+	nextMissing := make([]int, len(vw.samples))
+	genotypes := make([]string, len(vw.samples))
+	for _, pos := range positions {
+		alleles := make([]string, 0, len(vw.alts[pos]))
+		for alt := range vw.alts[pos] {
+			alleles = append(alleles, alt)
+		}
+		sort.Strings(alleles)
+
+		called := 0
+		for i, sample := range vw.samples {
+			for nextSNP[i] < len(sample.snps) && sample.snps[nextSNP[i]].Position < pos {
+				nextSNP[i]++
+			}
+			for nextMissing[i] < len(sample.missing) && sample.missing[nextMissing[i]][1] < pos {
+				nextMissing[i]++
+			}
+			genotypes[i] = "0"
+			if j := nextMissing[i]; j < len(sample.missing) && sample.missing[j][0] <= pos {
+				genotypes[i] = "."
+			}
+			if j := nextSNP[i]; j < len(sample.snps) && sample.snps[j].Position == pos {
+				genotypes[i] = "."
+				if k := sort.SearchStrings(alleles, sample.snps[j].Alt); k < len(alleles) && alleles[k] == sample.snps[j].Alt {
+					genotypes[i] = strconv.Itoa(k + 1)
+				}
+			}
+			if genotypes[i] != "." {
+				called++
+			}
+		}
+
+		ac := make([]string, len(alleles))
+		for i, alt := range alleles {
+			ac[i] = strconv.Itoa(vw.alts[pos][alt])
+		}
+		line := vw.name + "\t" + strconv.Itoa(pos) + "\t.\t" + refAllele(vw.refSeq, pos, DA) + "\t" + strings.Join(alleles, ",") + "\t.\t.\tAC=" + strings.Join(ac, ",") + ";AN=" + strconv.Itoa(called) + "\tGT\t" + strings.Join(genotypes, "\t")
+		if _, err := vw.w.WriteString(line + "\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (vw *vcfWriter) Close() error {
+	return vw.w.Flush()
+}
@@ -0,0 +1,70 @@
+package snps
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Weights are the weights of sites of the reference, by 1-based position, e.g. the
+// probability that a call there is right, so that SNPs at error-prone sites can be
+// down-weighted rather than masked. Sites that aren't listed have a weight of 1
+type Weights map[int]float64
+
+// ReadWeights reads weights as lines of a position and its weight, separated by a tab,
+// a comma or spaces. A first line that isn't a position, e.g. position,weight, is taken
+// to be a header, and lines starting with # are comments. Weights can't be negative
+func ReadWeights(r io.Reader) (Weights, error) {
+	w := make(Weights)
+	s := bufio.NewScanner(r)
+	for line := 1; s.Scan(); line++ {
+		text := strings.TrimSpace(s.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.FieldsFunc(text, func(r rune) bool {
+			return r == ',' || r == '\t' || r == ' '
+		})
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("%w: line %d should have a position and a weight", ErrBadWeights, line)
+		}
+		pos, err := strconv.Atoi(fields[0])
+		if err != nil && line == 1 {
+			continue
+		}
+		if err != nil || pos < 1 {
+			return nil, fmt.Errorf("%w: line %d: bad position %s", ErrBadWeights, line, fields[0])
+		}
+		weight, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil || weight < 0 || math.IsInf(weight, 0) || math.IsNaN(weight) {
+			return nil, fmt.Errorf("%w: line %d: bad weight %s", ErrBadWeights, line, fields[1])
+		}
+		w[pos] = weight
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// weigh sets the weight of each of SNPs to that of its site
+func (w Weights) weigh(SNPs []SNP) {
+	for i := range SNPs {
+		SNPs[i].Weight = 1
+		if weight, ok := w[SNPs[i].Position]; ok {
+			SNPs[i].Weight = weight
+		}
+	}
+}
+
+// weightedDistance returns the sum of the weights of SNPs
+func weightedDistance(SNPs []SNP) float64 {
+	total := 0.0
+	for _, snp := range SNPs {
+		total += snp.Weight
+	}
+	return total
+}
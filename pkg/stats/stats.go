@@ -0,0 +1,182 @@
+// Package stats has the statistical tests used to screen SNPs for associations with
+// metadata and for trends over time
+package stats
+
+import (
+	"errors"
+	"math"
+	"sort"
+)
+
+// logChoose returns the log of n choose k
+func logChoose(n int, k int) float64 {
+	a, _ := math.Lgamma(float64(n + 1))
+	b, _ := math.Lgamma(float64(k + 1))
+	c, _ := math.Lgamma(float64(n - k + 1))
+	return a - b - c
+}
+
+// FisherExact returns the two-sided p-value of Fisher's exact test on the 2x2 table
+//
+//	a b
+//	c d
+//
+// which is the sum of the probabilities of all the tables with the same margins that
+// are no more likely than this one
+func FisherExact(a int, b int, c int, d int) float64 {
+	row1 := a + b
+	col1 := a + c
+	n := a + b + c + d
+
+	logDenom := logChoose(n, col1)
+	prob := func(x int) float64 {
+		return math.Exp(logChoose(row1, x) + logChoose(n-row1, col1-x) - logDenom)
+	}
+
+	observed := prob(a)
+
+	lo := col1 - (n - row1)
+	if lo < 0 {
+		lo = 0
+	}
+	hi := row1
+	if col1 < hi {
+		hi = col1
+	}
+
+	p := 0.0
+	for x := lo; x <= hi; x++ {
+		// allow for rounding error in tables as likely as the observed one
+		if px := prob(x); px <= observed*(1+1e-7) {
+			p += px
+		}
+	}
+
+	return math.Min(p, 1)
+}
+
+// OddsRatio returns the odds ratio (a*d)/(b*c) of a 2x2 table laid out as for
+// FisherExact. If any cell is zero, 0.5 is added to every cell first (the
+// Haldane-Anscombe correction), so that the result is always finite
+func OddsRatio(a int, b int, c int, d int) float64 {
+	fa, fb, fc, fd := float64(a), float64(b), float64(c), float64(d)
+	if a == 0 || b == 0 || c == 0 || d == 0 {
+		fa, fb, fc, fd = fa+0.5, fb+0.5, fc+0.5, fd+0.5
+	}
+	return (fa * fd) / (fb * fc)
+}
+
+// BenjaminiHochberg returns p-values adjusted to control the false discovery rate
+// across all of ps, in the same order as ps
+func BenjaminiHochberg(ps []float64) []float64 {
+	m := len(ps)
+
+	order := make([]int, m)
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool { return ps[order[i]] < ps[order[j]] })
+
+	adjusted := make([]float64, m)
+	min := 1.0
+	for rank := m; rank > 0; rank-- {
+		i := order[rank-1]
+		q := ps[i] * float64(m) / float64(rank)
+		if q < min {
+			min = q
+		}
+		adjusted[i] = min
+	}
+
+	return adjusted
+}
+
+// ErrNotConverged is returned by LogisticRegression when the fit doesn't converge,
+// which usually means that the outcome is perfectly separated by x
+var ErrNotConverged = errors.New("logistic regression didn't converge")
+
+// LogisticRegression fits log(p/(1-p)) = intercept + slope*x to binomial data, where
+// k[i] of n[i] trials at x[i] were successes, by Newton-Raphson. It returns the slope
+// and its standard error
+func LogisticRegression(x []float64, n []float64, k []float64) (float64, float64, error) {
+	var b0, b1 float64
+
+	for iter := 0; iter < 100; iter++ {
+		var g0, g1, h00, h01, h11 float64
+		for i := range x {
+			p := 1 / (1 + math.Exp(-(b0 + b1*x[i])))
+			w := n[i] * p * (1 - p)
+			g0 += k[i] - n[i]*p
+			g1 += x[i] * (k[i] - n[i]*p)
+			h00 += w
+			h01 += w * x[i]
+			h11 += w * x[i] * x[i]
+		}
+
+		det := h00*h11 - h01*h01
+		if det <= 0 || math.IsNaN(det) {
+			return 0, 0, ErrNotConverged
+		}
+
+		d0 := (h11*g0 - h01*g1) / det
+		d1 := (h00*g1 - h01*g0) / det
+		b0 += d0
+		b1 += d1
+
+		if math.Abs(d0) < 1e-10 && math.Abs(d1) < 1e-10 {
+			return b1, math.Sqrt(h00 / det), nil
+		}
+		if math.Abs(b1) > 1e6 {
+			break
+		}
+	}
+
+	return 0, 0, ErrNotConverged
+}
+
+// ErrDegenerate is returned by LinearRegression when x doesn't vary, so that there is
+// no line to fit
+var ErrDegenerate = errors.New("x doesn't vary")
+
+// LinearRegression fits y = intercept + slope*x by least squares, and returns the slope,
+// the intercept and the coefficient of determination (r squared)
+func LinearRegression(x []float64, y []float64) (float64, float64, float64, error) {
+	n := float64(len(x))
+	var mx, my float64
+	for i := range x {
+		mx += x[i]
+		my += y[i]
+	}
+	mx /= n
+	my /= n
+
+	var sxx, sxy, syy float64
+	for i := range x {
+		sxx += (x[i] - mx) * (x[i] - mx)
+		sxy += (x[i] - mx) * (y[i] - my)
+		syy += (y[i] - my) * (y[i] - my)
+	}
+	if len(x) < 2 || sxx == 0 {
+		return 0, 0, 0, ErrDegenerate
+	}
+
+	slope := sxy / sxx
+	r2 := 1.0
+	if syy > 0 {
+		r2 = sxy * sxy / (sxx * syy)
+	}
+	return slope, my - slope*mx, r2, nil
+}
+
+// Quantile returns the q quantile of sorted, interpolating between its elements
+func Quantile(sorted []float64, q float64) float64 {
+	if len(sorted) == 0 {
+		return math.NaN()
+	}
+	h := q * float64(len(sorted)-1)
+	i := int(h)
+	if i+1 >= len(sorted) {
+		return sorted[len(sorted)-1]
+	}
+	return sorted[i] + (h-float64(i))*(sorted[i+1]-sorted[i])
+}
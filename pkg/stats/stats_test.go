@@ -0,0 +1,98 @@
+package stats
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFisherExact(t *testing.T) {
+	p := FisherExact(1, 9, 11, 3)
+	if math.Abs(p-0.002759) > 1e-6 {
+		t.Errorf("problem in TestFisherExact(): %f", p)
+	}
+
+	p = FisherExact(3, 3, 3, 3)
+	if math.Abs(p-1) > 1e-9 {
+		t.Errorf("problem in TestFisherExact(): %f", p)
+	}
+
+	p = FisherExact(0, 0, 0, 0)
+	if math.Abs(p-1) > 1e-9 {
+		t.Errorf("problem in TestFisherExact(): %f", p)
+	}
+}
+
+func TestOddsRatio(t *testing.T) {
+	if or := OddsRatio(1, 9, 11, 3); math.Abs(or-3.0/99.0) > 1e-9 {
+		t.Errorf("problem in TestOddsRatio(): %f", or)
+	}
+	if or := OddsRatio(0, 10, 5, 5); math.Abs(or-(0.5*5.5)/(10.5*5.5)) > 1e-9 {
+		t.Errorf("problem in TestOddsRatio(): %f", or)
+	}
+}
+
+func TestBenjaminiHochberg(t *testing.T) {
+	adjusted := BenjaminiHochberg([]float64{0.04, 0.01, 0.03, 0.5})
+	expected := []float64{0.04 * 4 / 3, 0.04, 0.04 * 4 / 3, 0.5}
+	for i := range expected {
+		if math.Abs(adjusted[i]-expected[i]) > 1e-9 {
+			t.Errorf("problem in TestBenjaminiHochberg(): %v", adjusted)
+			break
+		}
+	}
+}
+
+func TestLogisticRegression(t *testing.T) {
+	// simulate expected counts from a known curve, which the fit should recover
+	x := []float64{-3, -2, -1, 0, 1, 2, 3}
+	n := make([]float64, len(x))
+	k := make([]float64, len(x))
+	for i := range x {
+		n[i] = 1000
+		k[i] = 1000 / (1 + math.Exp(-(0.5 + 0.8*x[i])))
+	}
+
+	slope, se, err := LogisticRegression(x, n, k)
+	if err != nil {
+		t.Error(err)
+	}
+	if math.Abs(slope-0.8) > 1e-6 || se <= 0 || se > 0.1 {
+		t.Errorf("problem in TestLogisticRegression(): %f %f", slope, se)
+	}
+
+	// perfectly separated
+	_, _, err = LogisticRegression([]float64{0, 1, 2, 3}, []float64{1, 1, 1, 1}, []float64{0, 0, 1, 1})
+	if err != ErrNotConverged {
+		t.Errorf("problem in TestLogisticRegression(): expected ErrNotConverged")
+	}
+}
+
+func TestLinearRegression(t *testing.T) {
+	slope, intercept, r2, err := LinearRegression([]float64{0, 1, 2, 3}, []float64{1, 3, 5, 7})
+	if err != nil {
+		t.Error(err)
+	}
+	if math.Abs(slope-2) > 1e-9 || math.Abs(intercept-1) > 1e-9 || math.Abs(r2-1) > 1e-9 {
+		t.Errorf("problem in TestLinearRegression(): %f %f %f", slope, intercept, r2)
+	}
+
+	_, _, r2, err = LinearRegression([]float64{0, 1, 2, 3}, []float64{1, 2, 1, 2})
+	if err != nil {
+		t.Error(err)
+	}
+	if math.Abs(r2-0.2) > 1e-9 {
+		t.Errorf("problem in TestLinearRegression(): r squared %f", r2)
+	}
+
+	_, _, _, err = LinearRegression([]float64{1, 1}, []float64{1, 2})
+	if err != ErrDegenerate {
+		t.Errorf("problem in TestLinearRegression(): expected ErrDegenerate")
+	}
+}
+
+func TestQuantile(t *testing.T) {
+	sorted := []float64{1, 2, 3, 4, 5}
+	if Quantile(sorted, 0.25) != 2 || Quantile(sorted, 0.5) != 3 || Quantile(sorted, 1) != 5 || Quantile([]float64{1, 2}, 0.5) != 1.5 {
+		t.Errorf("problem in TestQuantile()")
+	}
+}
@@ -0,0 +1,83 @@
+//go:build js && wasm
+// +build js,wasm
+
+// Command wasm exposes the SNP calling in pkg/snps to JavaScript, so that it can be run
+// in a browser on sequences that never leave the client. Build it with:
+//
+//	GOOS=js GOARCH=wasm go build -o snps.wasm ./wasm
+//
+// and load it with the wasm_exec.js that ships with Go. It registers one global function:
+//
+//	snps(reference, alignment, {gff: "", hardGaps: false, aggregate: false, threshold: 0})
+//
+// whose arguments are the contents of the files (the options object is optional). It
+// returns the output as a string, or an Error
+package main
+
+import (
+	"bytes"
+	"strings"
+	"syscall/js"
+
+	"github.com/benjamincjackson/snps/pkg/annotation"
+	"github.com/benjamincjackson/snps/pkg/snps"
+)
+
+func run(this js.Value, args []js.Value) interface{} {
+	if len(args) < 2 {
+		return js.Global().Get("Error").New("snps() needs a reference and an alignment")
+	}
+
+	var gff string
+	var hardGaps, aggregate bool
+	var threshold float64
+
+	if len(args) > 2 && args[2].Type() == js.TypeObject {
+		opts := args[2]
+		if v := opts.Get("gff"); v.Type() == js.TypeString {
+			gff = v.String()
+		}
+		if v := opts.Get("hardGaps"); v.Type() == js.TypeBoolean {
+			hardGaps = v.Bool()
+		}
+		if v := opts.Get("aggregate"); v.Type() == js.TypeBoolean {
+			aggregate = v.Bool()
+		}
+		if v := opts.Get("threshold"); v.Type() == js.TypeNumber {
+			threshold = v.Float()
+		}
+	}
+
+	var regions []annotation.CDS
+	var err error
+	if gff != "" {
+		regions, err = annotation.ReadGFF(strings.NewReader(gff))
+		if err != nil {
+			return js.Global().Get("Error").New(err.Error())
+		}
+	}
+
+	format := "csv"
+	if aggregate {
+		format = "aggregate"
+	}
+
+	out := new(bytes.Buffer)
+
+	ow, err := snps.NewOutputWriter(format, out, snps.WriterOptions{Annotated: regions != nil, Threshold: threshold})
+	if err != nil {
+		return js.Global().Get("Error").New(err.Error())
+	}
+
+	err = snps.Run(strings.NewReader(args[1].String()), strings.NewReader(args[0].String()), snps.Options{Regions: regions, HardGaps: hardGaps}, ow)
+	if err != nil {
+		return js.Global().Get("Error").New(err.Error())
+	}
+
+	return out.String()
+}
+
+func main() {
+	js.Global().Set("snps", js.FuncOf(run))
+	select {}
+}